@@ -0,0 +1,572 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package binlogtest builds synthetic binary logs for tests, such as
+//
+//	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+//	t := b.Table("test", "t", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+//	b.Begin().Insert(t, []interface{}{1, "a"}).Update(t, []interface{}{1, "a"}, []interface{}{1, "b"}).Commit()
+//	data, err := b.Bytes()
+//
+// Events are written as the mysql server version does, with FORMAT_DESCRIPTION_EVENT,
+// PREVIOUS_GTIDS_EVENT, GTID_EVENT, TABLE_MAP_EVENT with optional metadata and ROWS_EVENT v1 or v2.
+package binlogtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// post-header lengths of event types written by mysql 5.5, 5.6, 5.7 and 8.0
+var (
+	eventTypeHeader55 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 84, 0, 4, 26, 8, 0,
+		0, 0, 8, 8, 8, 2, 0,
+	}
+	eventTypeHeader56 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 92, 0, 4, 26, 8, 0,
+		0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 25, 25, 0,
+	}
+	eventTypeHeader57 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0,
+		0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0,
+	}
+	eventTypeHeader80 = []byte{
+		56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 98, 0, 4, 26, 8, 0,
+		0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0, 10, 40, 0,
+	}
+)
+
+// default collations of utf8mb4
+const (
+	collationUTF8MB4GeneralCI = 45
+	collationUTF8MB40900AICI  = 255
+)
+
+// Table is a table of rows events, the TABLE_MAP_EVENT is written before every statement
+type Table struct {
+	ID      uint64
+	Schema  string
+	Name    string
+	Columns []Column
+}
+
+// Builder builds a binary log in memory, errors are kept and returned by Bytes().
+// Exported fields should be set before the first event, except Timestamp.
+type Builder struct {
+	Version     string
+	ChecksumAlg byte
+	ServerID    int64
+	Timestamp   int64
+
+	// server uuid of GTID_EVENT, ANONYMOUS_GTID_EVENT is written if empty (mysql >= 5.7)
+	UUID string
+
+	// gtid set of PREVIOUS_GTIDS_EVENT
+	PreviousGTIDs string
+
+	// write column names, enum & set values and primary key as binlog_row_metadata=FULL (mysql >= 8.0.1)
+	FullMetadata bool
+
+	// binlog_row_image=MINIMAL, before images have primary key columns only if table has,
+	// after images of update have changed columns only
+	MinimalRowImage bool
+
+	// 4 for table ids of mysql before 5.1.4, 6 by default
+	TableIDSize int
+
+	version int
+	buf     bytes.Buffer
+	writer  *binlog.BinFileWriter
+
+	// measure writes events of transaction for transaction_length of GTID_EVENT
+	measure *binlog.BinFileWriter
+
+	// events of current transaction, GTID_EVENT first if written
+	pending []*binlog.BinEvent
+	inTrx   bool
+
+	nextTableID uint64
+	gno         int64
+	sequence    int64
+	xid         uint64
+	err         error
+}
+
+// New return a Builder of mysql server version, such as "5.7.44-log" or "8.0.32",
+// checksumAlg is binlog.BinlogChecksumAlgCRC32 or binlog.BinlogChecksumAlgOff
+func New(version string, checksumAlg byte) *Builder {
+	return &Builder{
+		Version:     version,
+		ChecksumAlg: checksumAlg,
+		ServerID:    1,
+		Timestamp:   1537600000,
+		TableIDSize: 6,
+		nextTableID: 108,
+	}
+}
+
+// serverVersion return the version number as 80032 of version string
+func serverVersion(version string) int {
+	split := strings.SplitN(version, ".", 3)
+	n := 0
+	for i := 0; i < 3; i++ {
+		v := 0
+		if i < len(split) {
+			end := 0
+			for end < len(split[i]) && split[i][end] >= '0' && split[i][end] <= '9' {
+				end++
+			}
+			v, _ = strconv.Atoi(split[i][:end])
+		}
+		n = n*100 + v
+	}
+	return n
+}
+
+// Table return a table of columns with a new table id
+func (b *Builder) Table(schema, name string, columns ...Column) *Table {
+	t := &Table{ID: b.nextTableID, Schema: schema, Name: name, Columns: columns}
+	b.nextTableID++
+	return t
+}
+
+// start write FORMAT_DESCRIPTION_EVENT and PREVIOUS_GTIDS_EVENT before the first event
+func (b *Builder) start() error {
+	if b.writer != nil {
+		return nil
+	}
+
+	b.version = serverVersion(b.Version)
+	description := &binlog.BinFmtDescEvent{
+		BinlogVersion:     4,
+		MySQLVersion:      b.Version,
+		CreateTime:        b.Timestamp,
+		EventHeaderLength: 19,
+		EventTypeHeader:   eventTypeHeader57,
+		ChecksumAlg:       b.ChecksumAlg,
+	}
+	switch {
+	case b.version >= 80000:
+		description.EventTypeHeader = eventTypeHeader80
+	case b.version < 50600:
+		description.EventTypeHeader = eventTypeHeader55
+	case b.version < 50700:
+		description.EventTypeHeader = eventTypeHeader56
+	}
+	if b.TableIDSize == 4 {
+		types := append([]byte{}, description.EventTypeHeader...)
+		for _, typ := range []uint8{binlog.TableMapEvent, binlog.WriteRowsEventV1, binlog.UpdateRowsEventV1,
+			binlog.DeleteRowsEventV1, binlog.WriteRowsEventV2, binlog.UpdateRowsEventV2, binlog.DeleteRowsEventV2} {
+			if int(typ) <= len(types) {
+				types[typ-1] -= 2
+			}
+		}
+		description.EventTypeHeader = types
+	}
+
+	var err error
+	if b.writer, err = binlog.NewBinWriter(&b.buf); err != nil {
+		return err
+	}
+	if b.measure, err = binlog.NewBinWriter(ioutil.Discard); err != nil {
+		return err
+	}
+
+	events := []*binlog.BinEvent{b.event(binlog.FormatDescriptionEvent, description)}
+	if b.version >= 50600 {
+		set, err := binlog.ParseGTIDSet(b.PreviousGTIDs)
+		if err != nil {
+			return err
+		}
+		events = append(events, b.event(binlog.PreviousGTIDEvent, &binlog.BinPreGTIDsEvent{GTIDs: set}))
+	}
+	for _, event := range events {
+		if err := b.writer.WriteEvent(event); err != nil {
+			return err
+		}
+		if err := b.measure.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// event return an event of type with the header of builder
+func (b *Builder) event(typ uint8, body binlog.BinEventBody) *binlog.BinEvent {
+	header := &binlog.BinEventHeader{Timestamp: b.Timestamp, EventType: typ, ServerID: b.ServerID}
+	return &binlog.BinEvent{Header: header, Body: body}
+}
+
+// add add an event into current transaction
+func (b *Builder) add(typ uint8, body binlog.BinEventBody) {
+	if b.err == nil {
+		b.err = b.start()
+	}
+	if b.err == nil {
+		b.pending = append(b.pending, b.event(typ, body))
+	}
+}
+
+// gtid add the GTID_EVENT or ANONYMOUS_GTID_EVENT of a new transaction
+func (b *Builder) gtid() {
+	if b.err == nil {
+		b.err = b.start()
+	}
+	if b.err != nil || b.version < 50600 || (b.UUID == "" && b.version < 50700) {
+		return
+	}
+
+	// the logical clock is written since mysql 5.7
+	event := &binlog.BinGTIDEvent{CommitFlag: 1}
+	if b.version >= 50700 {
+		b.sequence++
+		event.LastCommitted, event.SequenceNumber = b.sequence-1, b.sequence
+	}
+	if b.version >= 80002 {
+		event.ImmediateCommitTimestamp = b.Timestamp * 1000000
+		event.TransactionLength = 1
+	}
+	if b.version >= 80014 {
+		event.ImmediateServerVersion = uint32(b.version)
+	}
+
+	typ := uint8(binlog.AnonymousGTIDEvent)
+	if b.UUID != "" {
+		sid, err := parseUUID(b.UUID)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.gno++
+		event.SID, event.GNO, typ = sid, b.gno, binlog.GTIDEvent
+	}
+	b.add(typ, event)
+}
+
+// parseUUID return the 16 bytes of server uuid
+func parseUUID(uuid string) ([]byte, error) {
+	sid, err := hex.DecodeString(strings.Replace(uuid, "-", "", -1))
+	if err != nil || len(uuid) != 36 || len(sid) != 16 {
+		return nil, fmt.Errorf("invalid server uuid %q", uuid)
+	}
+	return sid, nil
+}
+
+// Begin start a transaction by GTID_EVENT and QUERY_EVENT 'BEGIN'
+func (b *Builder) Begin() *Builder {
+	if b.inTrx {
+		b.setErr(fmt.Errorf("transaction is already started"))
+		return b
+	}
+	b.inTrx = true
+	b.gtid()
+	b.add(binlog.QueryEvent, &binlog.BinQueryEvent{Query: "BEGIN"})
+	return b
+}
+
+// Commit end the transaction by XID_EVENT
+func (b *Builder) Commit() *Builder {
+	if !b.inTrx {
+		b.setErr(fmt.Errorf("transaction is not started"))
+		return b
+	}
+	b.xid++
+	b.add(binlog.XIDEvent, &binlog.BinXIDEvent{XID: b.xid})
+	b.inTrx = false
+	return b.flush()
+}
+
+// Query add a QUERY_EVENT, a statement out of transaction is a transaction itself as DDL
+func (b *Builder) Query(schema, query string) *Builder {
+	if !b.inTrx {
+		b.gtid()
+	}
+	b.add(binlog.QueryEvent, &binlog.BinQueryEvent{Schema: schema, Query: query})
+	if !b.inTrx {
+		b.flush()
+	}
+	return b
+}
+
+// Event add an event of type, for events which Builder does not have a method
+func (b *Builder) Event(typ uint8, body binlog.BinEventBody) *Builder {
+	b.add(typ, body)
+	if !b.inTrx {
+		b.flush()
+	}
+	return b
+}
+
+// Rotate add a ROTATE_EVENT to the next binary log, which ends the binary log
+func (b *Builder) Rotate(next string) *Builder {
+	return b.Event(binlog.RotateEvent, &binlog.BinRotateEvent{Position: 4, FileName: next})
+}
+
+// Insert add a WRITE_ROWS_EVENT of rows, rows out of transaction are committed as autocommit
+func (b *Builder) Insert(t *Table, rows ...[]interface{}) *Builder {
+	changes := make([]*binlog.BinRowChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, &binlog.BinRowChange{After: row})
+	}
+	return b.rows(t, binlog.WriteRowsEventV1, changes)
+}
+
+// Update add an UPDATE_ROWS_EVENT, rows are pairs of before and after images
+func (b *Builder) Update(t *Table, rows ...[]interface{}) *Builder {
+	if len(rows)%2 != 0 {
+		b.setErr(fmt.Errorf("rows of update should be pairs of before and after images"))
+		return b
+	}
+
+	changes := make([]*binlog.BinRowChange, 0, len(rows)/2)
+	for i := 0; i < len(rows); i += 2 {
+		changes = append(changes, &binlog.BinRowChange{Before: rows[i], After: rows[i+1]})
+	}
+	return b.rows(t, binlog.UpdateRowsEventV1, changes)
+}
+
+// Delete add a DELETE_ROWS_EVENT of rows
+func (b *Builder) Delete(t *Table, rows ...[]interface{}) *Builder {
+	changes := make([]*binlog.BinRowChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, &binlog.BinRowChange{Before: row})
+	}
+	return b.rows(t, binlog.DeleteRowsEventV1, changes)
+}
+
+// rows add the TABLE_MAP_EVENT and ROWS_EVENT of a statement,
+// typ is the v1 event type which is changed to v2 for mysql >= 5.6
+func (b *Builder) rows(t *Table, typ uint8, changes []*binlog.BinRowChange) *Builder {
+	autocommit := !b.inTrx
+	if autocommit {
+		b.Begin()
+	}
+
+	if b.err == nil {
+		b.err = b.start()
+	}
+	if b.err != nil {
+		return b
+	}
+
+	table := b.tableMap(t)
+	b.add(binlog.TableMapEvent, table)
+
+	version := 1
+	if b.version >= 50600 {
+		typ += binlog.WriteRowsEventV2 - binlog.WriteRowsEventV1
+		version = 2
+	}
+	event := &binlog.BinRowsEvent{
+		Type:        typ,
+		Version:     version,
+		TableID:     t.ID,
+		Flags:       binlog.RowsEventStmtEndF,
+		ColumnCount: uint64(len(t.Columns)),
+		Table:       table,
+		Rows:        changes,
+	}
+	if b.MinimalRowImage {
+		b.minimalRowImage(t, event)
+	}
+	b.add(typ, event)
+
+	if autocommit {
+		b.Commit()
+	}
+	return b
+}
+
+// minimalRowImage set columns bitmaps of update and delete rows event as binlog_row_image=MINIMAL
+func (b *Builder) minimalRowImage(t *Table, event *binlog.BinRowsEvent) {
+	if len(event.Rows) == 0 || event.Rows[0].Before == nil {
+		return
+	}
+
+	size := (len(t.Columns) + 7) / 8
+	before, after := make([]byte, size), make([]byte, size)
+	hasKey := false
+	for i, c := range t.Columns {
+		if c.PrimaryKey {
+			before[i/8] |= 1 << uint(i%8)
+			hasKey = true
+		}
+		for _, row := range event.Rows {
+			if row.After != nil && fmt.Sprint(row.Before[i]) != fmt.Sprint(row.After[i]) {
+				after[i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+
+	if hasKey {
+		event.ColumnsBitmap1 = before
+	}
+	if event.Rows[0].After != nil {
+		event.ColumnsBitmap2 = after
+	}
+}
+
+// tableMap return the TABLE_MAP_EVENT of table, optional metadata is written for mysql >= 8.0.1
+func (b *Builder) tableMap(t *Table) *binlog.BinTableMapEvent {
+	count := len(t.Columns)
+	event := &binlog.BinTableMapEvent{
+		TableID:       t.ID,
+		Flags:         1,
+		Schema:        t.Schema,
+		Table:         t.Name,
+		ColumnCount:   uint64(count),
+		ColumnTypeDef: make([]byte, count),
+		ColumnMetaDef: make([]uint16, count),
+		NullBitmap:    make([]byte, (count+7)/8),
+	}
+
+	collation := uint64(collationUTF8MB4GeneralCI)
+	if b.version >= 80000 {
+		collation = collationUTF8MB40900AICI
+	}
+
+	var signedness []byte
+	numeric := 0
+	for i, c := range t.Columns {
+		event.ColumnTypeDef[i] = c.Type
+		event.ColumnMetaDef[i] = c.Meta
+		if !c.NotNull {
+			event.NullBitmap[i/8] |= 1 << uint(i%8)
+		}
+
+		if c.isNumeric() {
+			if numeric%8 == 0 {
+				signedness = append(signedness, 0)
+			}
+			if c.Unsigned {
+				signedness[numeric/8] |= 0x80 >> uint(numeric%8)
+			}
+			numeric++
+		}
+	}
+
+	if b.version < 80001 {
+		return event
+	}
+
+	// binlog_row_metadata=MINIMAL
+	event.Signedness = signedness
+	event.ColumnCharset = make([]uint64, count)
+	for i, c := range t.Columns {
+		if c.isCharacter() {
+			event.ColumnCharset[i] = collation
+			if c.Collation != 0 {
+				event.ColumnCharset[i] = c.Collation
+			}
+		}
+	}
+	if !b.FullMetadata {
+		return event
+	}
+
+	event.ColumnNames = make([]string, count)
+	event.EnumValues = make([][]string, count)
+	event.SetValues = make([][]string, count)
+	for i, c := range t.Columns {
+		event.ColumnNames[i] = c.Name
+		if c.Type == binlog.MySQLTypeString {
+			switch byte(c.Meta >> 8) {
+			case binlog.MySQLTypeEnum:
+				event.EnumValues[i] = c.Values
+			case binlog.MySQLTypeSet:
+				event.SetValues[i] = c.Values
+			}
+		}
+		if c.PrimaryKey {
+			event.PrimaryKey = append(event.PrimaryKey, i)
+		}
+	}
+	return event
+}
+
+// flush write events of transaction, transaction_length of GTID_EVENT is computed by mysql >= 8.0.2
+func (b *Builder) flush() *Builder {
+	events := b.pending
+	b.pending = nil
+	if b.err != nil || len(events) == 0 {
+		return b
+	}
+
+	if gtid, ok := events[0].Body.(*binlog.BinGTIDEvent); ok && gtid.TransactionLength != 0 {
+		pos := b.measure.Pos()
+		for _, event := range events[1:] {
+			if b.err = b.measure.WriteEvent(event); b.err != nil {
+				return b
+			}
+		}
+		length := uint64(b.measure.Pos() - pos)
+
+		// the size of length encoded transaction_length may change with itself
+		for i := 0; i < 3; i++ {
+			pos = b.measure.Pos()
+			if b.err = b.measure.WriteEvent(events[0]); b.err != nil {
+				return b
+			}
+			gtid.TransactionLength = length + uint64(b.measure.Pos()-pos)
+		}
+	}
+
+	for _, event := range events {
+		if b.err = b.writer.WriteEvent(event); b.err != nil {
+			return b
+		}
+	}
+	return b
+}
+
+// setErr keep the first error
+func (b *Builder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Bytes return the binary log built, events of the transaction not committed are written too
+// for truncated binary logs
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err == nil {
+		b.err = b.start()
+	}
+	b.flush()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := b.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b.buf.Bytes()...), nil
+}
+
+// WriteFile write the binary log built into file of path
+func (b *Builder) WriteFile(path string) error {
+	data, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
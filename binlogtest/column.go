@@ -0,0 +1,225 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlogtest
+
+import (
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// utf8mb4 characters are 4 bytes at most, lengths of CHAR and VARCHAR columns are in bytes in binlog
+const utf8mb4MaxLen = 4
+
+// binaryCollation is the collation id of binary strings
+const binaryCollation = 63
+
+// Column is a column of Table, Type and Meta are written into TABLE_MAP_EVENT as mysql does
+type Column struct {
+	Name       string
+	Type       byte
+	Meta       uint16
+	Unsigned   bool
+	NotNull    bool
+	PrimaryKey bool
+
+	// collation id of character column, 0 for the default collation of server version
+	Collation uint64
+
+	// values of ENUM or SET column
+	Values []string
+}
+
+// AsUnsigned return the column with UNSIGNED attribute
+func (c Column) AsUnsigned() Column {
+	c.Unsigned = true
+	return c
+}
+
+// AsNotNull return the column with NOT NULL attribute
+func (c Column) AsNotNull() Column {
+	c.NotNull = true
+	return c
+}
+
+// AsPrimaryKey return the column as a part of PRIMARY KEY, which is NOT NULL
+func (c Column) AsPrimaryKey() Column {
+	c.PrimaryKey, c.NotNull = true, true
+	return c
+}
+
+// WithCollation return the character column with collation id
+func (c Column) WithCollation(id uint64) Column {
+	c.Collation = id
+	return c
+}
+
+// TinyInt return a TINYINT column, values are int64 or uint64 if unsigned
+func TinyInt(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeTiny}
+}
+
+// SmallInt return a SMALLINT column
+func SmallInt(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeShort}
+}
+
+// MediumInt return a MEDIUMINT column
+func MediumInt(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeInt24}
+}
+
+// Int return an INT column
+func Int(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeLong}
+}
+
+// BigInt return a BIGINT column
+func BigInt(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeLonglong}
+}
+
+// Float return a FLOAT column
+func Float(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeFloat, Meta: 4}
+}
+
+// Double return a DOUBLE column
+func Double(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeDouble, Meta: 8}
+}
+
+// Decimal return a DECIMAL(precision, scale) column, values are strings such as "-12.340"
+func Decimal(name string, precision, scale int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeNewDecimal, Meta: uint16(precision<<8 | scale)}
+}
+
+// Year return a YEAR column
+func Year(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeYear}
+}
+
+// Date return a DATE column, values are strings such as "2018-09-22"
+func Date(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeDate}
+}
+
+// Time return a TIME(fsp) column, values are strings such as "-838:59:59.000000"
+func Time(name string, fsp int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeTime2, Meta: uint16(fsp)}
+}
+
+// Datetime return a DATETIME(fsp) column, values are strings such as "2018-09-22 10:00:00.123"
+func Datetime(name string, fsp int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeDatetime2, Meta: uint16(fsp)}
+}
+
+// Timestamp return a TIMESTAMP(fsp) column, values are strings in UTC
+func Timestamp(name string, fsp int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeTimestamp2, Meta: uint16(fsp)}
+}
+
+// Char return a CHAR(length) column of utf8mb4
+func Char(name string, length int) Column {
+	return stringColumn(name, length*utf8mb4MaxLen, 0)
+}
+
+// Binary return a BINARY(length) column
+func Binary(name string, length int) Column {
+	return stringColumn(name, length, binaryCollation)
+}
+
+// stringColumn return a CHAR column of bytes length, the high bits of length are in the real type of meta
+func stringColumn(name string, length int, collation uint64) Column {
+	meta := uint16(binlog.MySQLTypeString^byte((length&0x300)>>4))<<8 | uint16(length&0xff)
+	return Column{Name: name, Type: binlog.MySQLTypeString, Meta: meta, Collation: collation}
+}
+
+// Varchar return a VARCHAR(length) column of utf8mb4
+func Varchar(name string, length int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeVarchar, Meta: uint16(length * utf8mb4MaxLen)}
+}
+
+// VarBinary return a VARBINARY(length) column
+func VarBinary(name string, length int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeVarchar, Meta: uint16(length), Collation: binaryCollation}
+}
+
+// Text return a TEXT column, packlen is the bytes of length, 1 for TINYTEXT to 4 for LONGTEXT
+func Text(name string, packlen int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeBlob, Meta: uint16(packlen)}
+}
+
+// Blob return a BLOB column, packlen is the bytes of length, 1 for TINYBLOB to 4 for LONGBLOB
+func Blob(name string, packlen int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeBlob, Meta: uint16(packlen), Collation: binaryCollation}
+}
+
+// JSON return a JSON column, values are JSON texts
+func JSON(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeJSON, Meta: 4}
+}
+
+// Geometry return a GEOMETRY column, values are WKB with 4 bytes SRID
+func Geometry(name string) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeGeometry, Meta: 4}
+}
+
+// Bit return a BIT(bits) column, values are integers
+func Bit(name string, bits int) Column {
+	return Column{Name: name, Type: binlog.MySQLTypeBit, Meta: uint16(bits/8<<8 | bits%8)}
+}
+
+// Enum return an ENUM column, values are 1-based indexes of values
+func Enum(name string, values ...string) Column {
+	packlen := 1
+	if len(values) > 255 {
+		packlen = 2
+	}
+	meta := uint16(binlog.MySQLTypeEnum)<<8 | uint16(packlen)
+	return Column{Name: name, Type: binlog.MySQLTypeString, Meta: meta, Values: values}
+}
+
+// Set return a SET column, values are bitmaps of values
+func Set(name string, values ...string) Column {
+	packlen := (len(values) + 7) / 8
+	if packlen > 4 {
+		packlen = 8
+	}
+	meta := uint16(binlog.MySQLTypeSet)<<8 | uint16(packlen)
+	return Column{Name: name, Type: binlog.MySQLTypeString, Meta: meta, Values: values}
+}
+
+// isCharacter return true if the column has charset
+func (c Column) isCharacter() bool {
+	switch c.Type {
+	case binlog.MySQLTypeVarchar, binlog.MySQLTypeVarString, binlog.MySQLTypeBlob:
+		return true
+	case binlog.MySQLTypeString:
+		t := byte(c.Meta >> 8)
+		return t != binlog.MySQLTypeEnum && t != binlog.MySQLTypeSet
+	}
+	return false
+}
+
+// isNumeric return true if the column has signedness
+func (c Column) isNumeric() bool {
+	switch c.Type {
+	case binlog.MySQLTypeTiny, binlog.MySQLTypeShort, binlog.MySQLTypeInt24, binlog.MySQLTypeLong,
+		binlog.MySQLTypeLonglong, binlog.MySQLTypeNewDecimal, binlog.MySQLTypeFloat, binlog.MySQLTypeDouble:
+		return true
+	}
+	return false
+}
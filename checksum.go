@@ -43,13 +43,16 @@ func mysqlVersion(versionStr string) int {
 	var version int
 	split := strings.Split(versionStr, ".")
 	f, _ := strconv.Atoi(split[0])
+	if len(split) < 2 {
+		return f << 10 << 10
+	}
 	s, _ := strconv.Atoi(split[1])
 	version = f<<10<<10 + s<<10
 	if len(split) < 3 {
 		return version
 	}
 
-	index := 0
+	index := len(split[2])
 	for i, c := range split[2] {
 		if !unicode.IsNumber(c) {
 			index = i
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import "testing"
+
+// mysqlVersion is unexported, so it's tested in package binlog as the fuzz targets
+func TestMySQLVersion(t *testing.T) {
+	for _, c := range []struct {
+		version  string
+		expected int
+		checksum bool
+	}{
+		{"5.5.62-log", 5<<20 + 5<<10 + 62, false},
+		{"5.6.1", 5<<20 + 6<<10 + 1, false},
+		{"5.6.2", 5<<20 + 6<<10 + 2, true},
+		{"5.6.10", 5<<20 + 6<<10 + 10, true},
+		{"5.6.51-log", 5<<20 + 6<<10 + 51, true},
+		{"8.0.32", 8<<20 + 32, true},
+		{"8.0.36-28", 8<<20 + 36, true},
+		{"10.11.6-MariaDB-log", 10<<20 + 11<<10 + 6, true},
+		{"8.4", 8<<20 + 4<<10, true},
+		{"8", 8 << 20, true},
+	} {
+		if v := mysqlVersion(c.version); v != c.expected {
+			t.Errorf("mysqlVersion(%q) = %d, expected %d", c.version, v, c.expected)
+		}
+		if ok := hasChecksum(c.version); ok != c.checksum {
+			t.Errorf("hasChecksum(%q) = %v, expected %v", c.version, ok, c.checksum)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runDump print events as mysqlbinlog text, JSON Lines or SQL
+func runDump(args []string) error {
+	var opts options
+	fs := newFlagSet("dump", "<binlog>...")
+	opts.register(fs)
+	format := fs.String("format", "text", "output format: text, json or sql")
+	verbose := fs.Int("verbose", 2, "text: verbosity of row pseudo-SQL, 1 as mysqlbinlog -v and 2 as -vv")
+	decodeRows := fs.Bool("decode-rows", false, "text: omit BINLOG statements as --base64-output=decode-rows")
+	rows := fs.Bool("rows", false, "json: one line per row change instead of per event")
+	batchSize := fs.Int("batch-size", 1, "sql: rows per INSERT statement")
+	fs.Parse(args)
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	switch *format {
+	case "text":
+		f := binlog.NewTextFormatter(w)
+		f.Verbose, f.DecodeRows = *verbose, *decodeRows
+		err = walkEvents(paths, &opts, func(path string, event *binlog.BinEvent) error {
+			return f.Format(event)
+		})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+
+	case "json":
+		enc := binlog.NewJSONEncoder(w)
+		return walkEvents(paths, &opts, func(path string, event *binlog.BinEvent) error {
+			enc.File = filepath.Base(path)
+			if *rows {
+				return enc.EncodeRows(event)
+			}
+			return enc.EncodeEvent(event)
+		})
+
+	case "sql":
+		g := binlog.NewSQLGenerator()
+		g.BatchSize = *batchSize
+		return dumpSQL(w, g, paths, &opts)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
+
+// walkEvents walk the events of binary logs which pass the filter flags, binary logs are decoded one by one.
+// It stops at the event reaching --stop-position or --stop-datetime as mysqlbinlog.
+func walkEvents(paths []string, opts *options, f func(path string, event *binlog.BinEvent) error) error {
+	for i, path := range paths {
+		decoder, err := opts.newFileDecoder(paths, i)
+		if err != nil {
+			return err
+		}
+
+		err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+			return true, f(path, event)
+		})
+		decoder.BinFile.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// dumpSQL write the SQL of transactions, transactions whose row changes are all filtered out are skipped
+func dumpSQL(w *bufio.Writer, g *binlog.SQLGenerator, paths []string, opts *options) error {
+	for i, path := range paths {
+		decoder, err := opts.newFileDecoder(paths, i)
+		if err != nil {
+			return err
+		}
+
+		err = decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+			if len(tx.Rows) == 0 && len(tx.Statements) == 0 && tx.XAPrepare == nil {
+				return true, nil
+			}
+			return true, g.WriteTransaction(w, tx)
+		})
+		decoder.BinFile.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
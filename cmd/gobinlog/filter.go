@@ -0,0 +1,58 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runFilter write the events which pass the filter flags into a new binary log.
+// Context events of transactions are kept by the filter, so transactions stay complete,
+// and the binary log is written by Rewriter, which moves STMT_END_F to the last rows event kept.
+func runFilter(args []string) error {
+	var opts options
+	fs := newFlagSet("filter", "-o <output> <binlog>")
+	opts.register(fs)
+	output := fs.String("o", "", "path of the binary log to write")
+	fs.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("no output binary log given by -o")
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("filter reads exactly one binary log")
+	}
+
+	decoder, err := opts.newDecoder(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	defer decoder.BinFile.Close()
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = binlog.NewRewriter().Rewrite(file, decoder); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
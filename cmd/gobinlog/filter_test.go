@@ -0,0 +1,117 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// decodeFile return the events of binary log
+func decodeFile(t *testing.T, path string) []*binlog.BinEvent {
+	decoder, err := binlog.NewBinFileDecoder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+
+	var events []*binlog.BinEvent
+	err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		events = append(events, event)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// multiTableUpdate write a binary log of 'UPDATE a JOIN b ...', whose TABLE_MAP_EVENTs are written
+// before the rows events and only the rows event of b has STMT_END_F
+func multiTableUpdate(t *testing.T, path string) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	a, c := b.Table("db", "a", binlogtest.Int("id")), b.Table("db", "b", binlogtest.Int("id"))
+	b.Begin().Update(a, []interface{}{1}, []interface{}{2}).Update(c, []interface{}{1}, []interface{}{2}).Commit()
+	if err := b.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// FDE, PREVIOUS_GTIDS, GTID, BEGIN, TABLE_MAP a, UPDATE a, TABLE_MAP b, UPDATE b, XID
+	events := decodeFile(t, path)
+	events[5], events[6] = events[6], events[5]
+	events[6].Body.(*binlog.BinRowsEvent).Flags &^= binlog.RowsEventStmtEndF
+
+	writer, err := binlog.NewBinFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if err := writer.WriteEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilterStatementEnd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobinlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "mysql-bin.000001"), filepath.Join(dir, "filtered.000001")
+	multiTableUpdate(t, input)
+
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "[TABLE_MAP_EVENT TABLE_MAP_EVENT a UPDATE_ROWS_EVENTv2 b UPDATE_ROWS_EVENTv2 STMT_END_F]"},
+		// the rows event of a ends the statement when the one of b is filtered out
+		{[]string{"--exclude", "db.b"}, "[TABLE_MAP_EVENT TABLE_MAP_EVENT a UPDATE_ROWS_EVENTv2 STMT_END_F]"},
+		{[]string{"--exclude", "db.a"}, "[TABLE_MAP_EVENT TABLE_MAP_EVENT b UPDATE_ROWS_EVENTv2 STMT_END_F]"},
+	} {
+		if err := runFilter(append(append([]string{"-o", output}, c.args...), input)); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, event := range decodeFile(t, output) {
+			switch body := event.Body.(type) {
+			case *binlog.BinTableMapEvent:
+				got = append(got, event.Header.Type())
+			case *binlog.BinRowsEvent:
+				got = append(got, body.Table.Table, event.Header.Type())
+				if body.Flags&binlog.RowsEventStmtEndF != 0 {
+					got = append(got, "STMT_END_F")
+				}
+			}
+		}
+		if fmt.Sprint(got) != c.expected {
+			t.Errorf("filter %v: %v, expected %s", c.args, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runFlashback write the undo of row changes as SQL, or as binary log with -o
+func runFlashback(args []string) error {
+	var opts options
+	fs := newFlagSet("flashback", "[-o <output>] <binlog>...")
+	opts.register(fs)
+	output := fs.String("o", "", "write a binary log instead of SQL")
+	batchSize := fs.Int("batch-size", 1, "rows per INSERT statement")
+	fs.Parse(args)
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	decoder, err := opts.newDecoder(paths...)
+	if err != nil {
+		return err
+	}
+	defer decoder.BinFile.Close()
+
+	fb := binlog.NewFlashback(decoder)
+	fb.Generator.BatchSize = *batchSize
+	if *output == "" {
+		return fb.WriteSQL(os.Stdout)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = fb.WriteBinlog(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runIndex list binary logs with size, server version, checksum, event count and time range
+func runIndex(args []string) error {
+	fs := newFlagSet("index", "<index|binlog>...")
+	var keyring string
+	registerKeyring(fs, &keyring)
+	fs.Parse(args)
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	keys, err := keyProvider(keyring)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSIZE\tSERVER VERSION\tCHECKSUM\tEVENTS\tFIRST EVENT\tLAST EVENT")
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		decoder, err := binlog.NewBinFileDecoder(path, &binlog.BinReaderOption{KeyProvider: keys})
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		var version, checksum string
+		var count, first, last int64
+		err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+			if description, ok := event.Body.(*binlog.BinFmtDescEvent); ok && version == "" {
+				version, checksum = description.MySQLVersion, "NONE"
+				if description.ChecksumAlg == binlog.BinlogChecksumAlgCRC32 {
+					checksum = "CRC32"
+				}
+			}
+
+			if count == 0 {
+				first = event.Header.Timestamp
+			}
+			count++
+			last = event.Header.Timestamp
+			return true, nil
+		})
+		decoder.BinFile.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%s\t%s\n", path, info.Size(), version, checksum, count,
+			time.Unix(first, 0).Format(datetimeLayout), time.Unix(last, 0).Format(datetimeLayout))
+	}
+	return w.Flush()
+}
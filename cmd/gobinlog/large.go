@@ -0,0 +1,78 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runLarge print the transactions exceeding any of the thresholds
+func runLarge(args []string) error {
+	var opts options
+	fs := newFlagSet("large", "[--bytes N] [--rows N] [--tables N] [--duration D] <binlog>...")
+	opts.register(fs)
+	var d binlog.LargeTransactionDetector
+	fs.Int64Var(&d.MaxBytes, "bytes", 0, "flag transactions larger than `N` bytes")
+	fs.Int64Var(&d.MaxRows, "rows", 0, "flag transactions changing more than `N` rows")
+	fs.IntVar(&d.MaxTables, "tables", 0, "flag transactions changing more than `N` tables")
+	fs.DurationVar(&d.MaxDuration, "duration", 0, "flag transactions running longer than `D`, such as 10s")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if d.MaxBytes <= 0 && d.MaxRows <= 0 && d.MaxTables <= 0 && d.MaxDuration <= 0 {
+		return fmt.Errorf("no threshold given by --bytes, --rows, --tables or --duration")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for i, path := range paths {
+		decoder, err := opts.newFileDecoder(paths, i)
+		if err != nil {
+			return err
+		}
+
+		d.File = filepath.Base(path)
+		err = decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+			lt := d.Check(tx)
+			if lt == nil {
+				return true, nil
+			}
+			if *format == "json" {
+				return true, lt.WriteJSON(w)
+			}
+			return true, lt.WriteText(w)
+		})
+		decoder.BinFile.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
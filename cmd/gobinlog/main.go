@@ -0,0 +1,82 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command gobinlog reads MySQL binary logs.
+//
+// Usage:
+//
+//	gobinlog <command> [flags] <binlog>...
+//
+// Commands are dump, stats, large, parallel, schema, filter, rewrite, flashback, index and verify, run 'gobinlog <command> -h' for the flags.
+// A binlog argument ending with '.index', such as mysql-bin.index, is replaced by the binary logs listed in it.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of gobinlog
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{"dump", "print events as mysqlbinlog text, JSON Lines or SQL", runDump},
+	{"stats", "print workload statistics of events, tables and transactions", runStats},
+	{"parallel", "simulate the parallel apply of replica workers by logical clock", runParallel},
+	{"large", "print transactions exceeding size, rows, tables or duration thresholds", runLarge},
+	{"schema", "track table definitions through the DDL of binary logs", runSchema},
+	{"filter", "write the events of matched tables into a new binary log", runFilter},
+	{"rewrite", "write a new binary log with databases and tables renamed or dropped", runRewrite},
+	{"flashback", "write the undo of row changes as SQL or binary log", runFlashback},
+	{"index", "list binary logs with size, version and time range", runIndex},
+	{"verify", "check checksums, positions, GTIDs and transactions of binary logs", runVerify},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "gobinlog:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if os.Args[1] != "-h" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "gobinlog: unknown command %q\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gobinlog <command> [flags] <binlog>...")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// datetimeLayout is the layout of --start-datetime and --stop-datetime, in local time as mysqlbinlog
+const datetimeLayout = "2006-01-02 15:04:05"
+
+// list is a flag of values, it can be repeated or separated by comma
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// options are the flags shared by commands reading events
+type options struct {
+	startPos      int64
+	stopPos       int64
+	startDatetime string
+	stopDatetime  string
+
+	include           list
+	exclude           list
+	eventTypes        list
+	excludeEventTypes list
+	serverIDs         list
+	excludeServerIDs  list
+	includeGTIDs      string
+	excludeGTIDs      string
+	actions           list
+
+	masks    list
+	maskSalt string
+
+	schemaFile    string
+	schemaHistory string
+
+	recover bool
+
+	keyring string
+}
+
+// newFlagSet return a FlagSet of command, with usage of arguments
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gobinlog %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// register the flags of options
+func (o *options) register(fs *flag.FlagSet) {
+	fs.Int64Var(&o.startPos, "start-position", 0, "start reading at the event at position")
+	fs.Int64Var(&o.stopPos, "stop-position", 0, "stop reading at the event which ends after position")
+	fs.StringVar(&o.startDatetime, "start-datetime", "", "start reading at the first event at or after datetime, as '"+datetimeLayout+"'")
+	fs.StringVar(&o.stopDatetime, "stop-datetime", "", "stop reading at the first event at or after datetime, as '"+datetimeLayout+"'")
+	fs.Var(&o.include, "include", "tables to include, patterns as 'db', 'db.table' with * and ?, or '/regexp/' of db.table")
+	fs.Var(&o.exclude, "exclude", "tables to exclude, patterns as --include")
+	fs.Var(&o.eventTypes, "event-types", "event types to include, such as WRITE_ROWS_EVENTv2, context events are always kept")
+	fs.Var(&o.excludeEventTypes, "exclude-event-types", "event types to exclude")
+	fs.Var(&o.serverIDs, "server-ids", "server ids of the transactions to include")
+	fs.Var(&o.excludeServerIDs, "exclude-server-ids", "server ids of the transactions to exclude")
+	fs.StringVar(&o.includeGTIDs, "include-gtids", "", "GTID set of the transactions to include")
+	fs.StringVar(&o.excludeGTIDs, "exclude-gtids", "", "GTID set of the transactions to exclude")
+	fs.Var(&o.actions, "actions", "row changes to include: insert, update or delete")
+	fs.Var(&o.masks, "mask", "mask columns as 'pattern=action', pattern is [[db.]table.]column, action is drop, hash, truncate:N or constant:VALUE")
+	fs.StringVar(&o.maskSalt, "mask-salt", "", "salt of the columns masked by hash")
+	fs.StringVar(&o.schemaFile, "schema-file", "", "definitions of tables in JSON or YAML, for binary logs without column names")
+	fs.StringVar(&o.schemaHistory, "schema-history", "", "schema history written by 'gobinlog schema', for binary logs without column names")
+	registerKeyring(fs, &o.keyring)
+	fs.BoolVar(&o.recover, "recover", false, "skip corrupted events and resume from the next valid event, skipped ranges are printed to stderr")
+}
+
+// readerOption return the BinReaderOption of positions and datetimes
+func (o *options) readerOption() (*binlog.BinReaderOption, error) {
+	option := &binlog.BinReaderOption{StartPos: o.startPos, EndPos: o.stopPos}
+
+	var err error
+	if option.KeyProvider, err = keyProvider(o.keyring); err != nil {
+		return nil, err
+	}
+	if o.startDatetime != "" {
+		if option.StartTime, err = time.ParseInLocation(datetimeLayout, o.startDatetime, time.Local); err != nil {
+			return nil, fmt.Errorf("bad --start-datetime: %v", err)
+		}
+	}
+	if o.stopDatetime != "" {
+		if option.EndTime, err = time.ParseInLocation(datetimeLayout, o.stopDatetime, time.Local); err != nil {
+			return nil, fmt.Errorf("bad --stop-datetime: %v", err)
+		}
+	}
+	return option, nil
+}
+
+// registerKeyring register the --keyring flag of encrypted binary logs
+func registerKeyring(fs *flag.FlagSet, keyring *string) {
+	fs.StringVar(keyring, "keyring", "", "keyring_file_data of the keyring_file plugin, for binary logs encrypted by binlog_encryption")
+}
+
+// keyProvider return the KeyProvider of --keyring, nil if it's not set
+func keyProvider(keyring string) (binlog.KeyProvider, error) {
+	if keyring == "" {
+		return nil, nil
+	}
+	keys, err := binlog.NewKeyringFile(keyring)
+	if err != nil {
+		return nil, fmt.Errorf("bad --keyring: %v", err)
+	}
+	return keys, nil
+}
+
+// filter return the EventFilter of flags, nil if no filter is set
+func (o *options) filter() (*binlog.EventFilter, error) {
+	f := &binlog.EventFilter{
+		IncludeTables: o.include,
+		ExcludeTables: o.exclude,
+		IncludeGTIDs:  o.includeGTIDs,
+		ExcludeGTIDs:  o.excludeGTIDs,
+		Actions:       o.actions,
+	}
+
+	var err error
+	if f.IncludeEventTypes, err = eventTypes(o.eventTypes); err != nil {
+		return nil, err
+	}
+	if f.ExcludeEventTypes, err = eventTypes(o.excludeEventTypes); err != nil {
+		return nil, err
+	}
+	if f.IncludeServerIDs, err = serverIDs(o.serverIDs); err != nil {
+		return nil, err
+	}
+	if f.ExcludeServerIDs, err = serverIDs(o.excludeServerIDs); err != nil {
+		return nil, err
+	}
+
+	for _, action := range f.Actions {
+		switch action {
+		case binlog.RowsActionInsert, binlog.RowsActionUpdate, binlog.RowsActionDelete:
+		default:
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+	}
+
+	if reflect.DeepEqual(f, &binlog.EventFilter{}) {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// eventTypes return the event types of names
+func eventTypes(names []string) ([]uint8, error) {
+	var types []uint8
+	for _, name := range names {
+		found := false
+		for typ, s := range binlog.EventType2Str {
+			if strings.EqualFold(s, name) {
+				types, found = append(types, typ), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+	}
+	return types, nil
+}
+
+// serverIDs return the server ids of strings
+func serverIDs(ids []string) ([]int64, error) {
+	var result []int64
+	for _, id := range ids {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server id %q", id)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// newDecoder return the decoder of binary logs with position, datetime and filter flags
+func (o *options) newDecoder(paths ...string) (*binlog.BinFileDecoder, error) {
+	option, err := o.readerOption()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := o.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := binlog.NewBinFileChainDecoder(paths, option)
+	if err != nil {
+		return nil, err
+	}
+	decoder.Filter = filter
+	if decoder.Masker, err = o.masker(); err != nil {
+		return nil, err
+	}
+	if decoder.Schema, err = o.schemaProvider(); err != nil {
+		return nil, err
+	}
+	decoder.OnSchemaMismatch = func(mismatch *binlog.SchemaMismatch) error {
+		fmt.Fprintln(os.Stderr, "warning:", mismatch)
+		return nil
+	}
+	decoder.Recover = o.recover
+	decoder.OnSkip = func(skipped *binlog.SkippedRange) error {
+		fmt.Fprintln(os.Stderr, "warning:", skipped)
+		return nil
+	}
+	return decoder, nil
+}
+
+// newFileDecoder return the decoder of the i-th binary log of paths, which are decoded one by one.
+// As mysqlbinlog, --start-position is applied to the first binary log and --stop-position to the last one.
+func (o *options) newFileDecoder(paths []string, i int) (*binlog.BinFileDecoder, error) {
+	decoder, err := o.newDecoder(paths[i])
+	if err != nil {
+		return nil, err
+	}
+	if i > 0 {
+		decoder.Option.StartPos = 0
+	}
+	if i < len(paths)-1 {
+		decoder.Option.EndPos = 0
+	}
+	return decoder, nil
+}
+
+// schemaProvider return the SchemaProvider of --schema-file or --schema-history, nil if neither is set
+func (o *options) schemaProvider() (binlog.SchemaProvider, error) {
+	switch {
+	case o.schemaFile != "" && o.schemaHistory != "":
+		return nil, fmt.Errorf("--schema-file and --schema-history can't be used together")
+	case o.schemaFile != "":
+		return binlog.NewSchemaFile(o.schemaFile)
+	case o.schemaHistory != "":
+		file, err := os.Open(o.schemaHistory)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return binlog.LoadSchemaHistory(file)
+	}
+	return nil, nil
+}
+
+// masker return the ColumnMasker of --mask flags, nil if no column is masked
+func (o *options) masker() (*binlog.ColumnMasker, error) {
+	if len(o.masks) == 0 {
+		return nil, nil
+	}
+
+	masker := &binlog.ColumnMasker{Salt: o.maskSalt}
+	for _, mask := range o.masks {
+		i := strings.IndexByte(mask, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid mask %q, it should be 'pattern=action'", mask)
+		}
+
+		rule := &binlog.MaskRule{Pattern: mask[:i], Action: mask[i+1:]}
+		if j := strings.IndexByte(rule.Action, ':'); j >= 0 {
+			rule.Action, rule.Value = rule.Action[:j], rule.Action[j+1:]
+		}
+		if rule.Action == binlog.MaskTruncate {
+			n, err := strconv.Atoi(rule.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid truncate length of mask %q", mask)
+			}
+			rule.Length, rule.Value = n, ""
+		}
+		masker.Rules = append(masker.Rules, rule)
+	}
+	return masker, nil
+}
+
+// binlogPaths return the binary logs of arguments, index files are replaced by the binary logs listed in them
+func binlogPaths(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no binary log given")
+	}
+
+	var paths []string
+	for _, arg := range args {
+		if !strings.HasSuffix(arg, ".index") {
+			paths = append(paths, arg)
+			continue
+		}
+
+		listed, err := binlog.ReadIndexFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, listed...)
+	}
+	return paths, nil
+}
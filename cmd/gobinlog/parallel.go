@@ -0,0 +1,99 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// transactionCosts are the cost models of --cost
+var transactionCosts = map[string]func(tx *binlog.Transaction) int64{
+	"bytes": func(tx *binlog.Transaction) int64 { return tx.Size() },
+	"rows": func(tx *binlog.Transaction) int64 {
+		n := int64(1)
+		for _, rows := range tx.Rows {
+			n += int64(len(rows.Rows))
+		}
+		return n
+	},
+	"transactions": func(tx *binlog.Transaction) int64 { return 1 },
+}
+
+// runParallel simulate the multi-threaded applier with the logical clock of GTID_EVENT
+func runParallel(args []string) error {
+	var opts options
+	fs := newFlagSet("parallel", "[--workers 1,2,4,8,16] <binlog>...")
+	opts.register(fs)
+	var workers list
+	fs.Var(&workers, "workers", "comma separated numbers of workers to simulate (default 1,2,4,8,16)")
+	cost := fs.String("cost", "bytes", "cost of a transaction: bytes, rows or transactions")
+	preserve := fs.Bool("preserve-commit-order", true, "simulate replica_preserve_commit_order")
+	top := fs.Int("top", 10, "number of the most costly serializing transactions to report")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if len(workers) == 0 {
+		workers = list{"1", "2", "4", "8", "16"}
+	}
+	sim := binlog.NewParallelSimulator()
+	for _, w := range workers {
+		n, err := strconv.Atoi(w)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of workers %q", w)
+		}
+		sim.Workers = append(sim.Workers, n)
+	}
+	if sim.Cost = transactionCosts[*cost]; sim.Cost == nil {
+		return fmt.Errorf("unknown cost %q", *cost)
+	}
+	sim.PreserveCommitOrder, sim.TopN = *preserve, *top
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		decoder, err := opts.newFileDecoder(paths, i)
+		if err != nil {
+			return err
+		}
+
+		sim.File = filepath.Base(path)
+		err = decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+			sim.Add(tx)
+			return true, nil
+		})
+		decoder.BinFile.Close()
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	switch *format {
+	case "text":
+		return sim.Report().WriteText(os.Stdout)
+	case "json":
+		return sim.Report().WriteJSON(os.Stdout)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runRewrite write a new binary log with databases and tables renamed, tables and ROWS_QUERY_EVENT dropped
+func runRewrite(args []string) error {
+	var opts options
+	var renameSchemas, renameTables, dropTables list
+	fs := newFlagSet("rewrite", "-o <output> <binlog>")
+	opts.register(fs)
+	output := fs.String("o", "", "path of the binary log to write")
+	fs.Var(&renameSchemas, "rename-schema", "rename database as 'from=to'")
+	fs.Var(&renameTables, "rename-table", "rename table as 'db.table=table' or 'db.table=db2.table2'")
+	fs.Var(&dropTables, "drop-table", "drop the events of tables, patterns as --include")
+	stripRowsQuery := fs.Bool("strip-rows-query", false, "drop ROWS_QUERY_EVENT")
+	fs.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("no output binary log given by -o")
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("rewrite reads exactly one binary log")
+	}
+
+	r := binlog.NewRewriter()
+	r.DropTables = dropTables
+	r.StripRowsQuery = *stripRowsQuery
+	for _, rule := range renameSchemas {
+		from, to, err := splitRename(rule)
+		if err != nil {
+			return err
+		}
+		r.RenameSchemas[from] = to
+	}
+	for _, rule := range renameTables {
+		from, to, err := splitRename(rule)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(from, ".") {
+			return fmt.Errorf("bad --rename-table %q, the table should be 'db.table'", rule)
+		}
+		r.RenameTables[from] = to
+	}
+
+	decoder, err := opts.newDecoder(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	defer decoder.BinFile.Close()
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = r.Rewrite(file, decoder); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// splitRename split the rule 'from=to'
+func splitRename(rule string) (string, string, error) {
+	i := strings.IndexByte(rule, '=')
+	if i <= 0 || i == len(rule)-1 {
+		return "", "", fmt.Errorf("bad rename rule %q, it should be 'from=to'", rule)
+	}
+	return rule[:i], rule[i+1:], nil
+}
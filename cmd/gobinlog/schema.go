@@ -0,0 +1,85 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runSchema build the schema history of tables from a snapshot and the DDL of binary logs
+func runSchema(args []string) error {
+	var opts options
+	fs := newFlagSet("schema", "[--snapshot <file>] [--history <file>] [-o <output>] <binlog>...")
+	opts.register(fs)
+	snapshot := fs.String("snapshot", "", "CREATE TABLE statements of tables, such as mysqldump --no-data")
+	database := fs.String("database", "", "database of unqualified tables in snapshot")
+	history := fs.String("history", "", "schema history to continue, written by a previous run")
+	output := fs.String("o", "", "path of the schema history to write, stdout if empty")
+	fs.Parse(args)
+
+	h := binlog.NewSchemaHistory()
+	if *history != "" {
+		file, err := os.Open(*history)
+		if err != nil {
+			return err
+		}
+		h, err = binlog.LoadSchemaHistory(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if *snapshot != "" {
+		file, err := os.Open(*snapshot)
+		if err != nil {
+			return err
+		}
+		err = h.LoadSnapshot(file, *database)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	err = walkEvents(paths, &opts, func(path string, event *binlog.BinEvent) error {
+		h.File = filepath.Base(path)
+		return h.Add(event)
+	})
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return h.Save(os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = h.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
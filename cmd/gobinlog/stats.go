@@ -0,0 +1,63 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runStats print the statistics of events, row changes, transactions and throughput
+func runStats(args []string) error {
+	var opts options
+	fs := newFlagSet("stats", "[--format text|json|csv] <binlog>...")
+	opts.register(fs)
+	format := fs.String("format", "text", "output format: text, json or csv")
+	section := fs.String("section", binlog.StatsTables, "section written as csv: event_types, tables, transactions, ddl or minutes")
+	top := fs.Int("top", 10, "number of the largest transactions to report")
+	fs.Parse(args)
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	analyzer := binlog.NewStatsAnalyzer()
+	analyzer.TopN = *top
+	err = walkEvents(paths, &opts, func(path string, event *binlog.BinEvent) error {
+		analyzer.File = filepath.Base(path)
+		analyzer.Add(event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stats := analyzer.Stats()
+	switch *format {
+	case "text":
+		return stats.WriteText(os.Stdout)
+	case "json":
+		return stats.WriteJSON(os.Stdout)
+	case "csv":
+		return stats.WriteCSV(os.Stdout, *section)
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// runVerify check the integrity of binary logs, such as checksums, positions, GTIDs and unterminated transactions
+func runVerify(args []string) error {
+	fs := newFlagSet("verify", "[--format text|json] <binlog>...")
+	format := fs.String("format", "text", "output format: text, or json as one report per line")
+	var keyring string
+	registerKeyring(fs, &keyring)
+	fs.Parse(args)
+
+	paths, err := binlogPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	keys, err := keyProvider(keyring)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	enc := json.NewEncoder(os.Stdout)
+	for _, path := range paths {
+		report, err := binlog.Verify(path, &binlog.BinReaderOption{KeyProvider: keys})
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !report.OK() {
+			failed++
+		}
+
+		if *format == "json" {
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if report.OK() {
+			fmt.Printf("%s: OK, %d events, %d transactions, %d warnings\n", path, report.Events, report.Transactions, len(report.Warnings))
+		} else {
+			fmt.Printf("%s: FAILED, %d events, %d transactions, %d issues, %d warnings\n", path, report.Events,
+				report.Transactions, len(report.Issues), len(report.Warnings))
+		}
+		for _, issue := range report.Issues {
+			fmt.Printf("  %s:%s\n", path, issue)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Printf("  %s:%s (warning)\n", path, warning)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d binary logs failed", failed, len(paths))
+	}
+	return nil
+}
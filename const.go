@@ -93,6 +93,28 @@ const (
 	GTIDEvent              = 0x21
 	AnonymousGTIDEvent     = 0x22
 	PreviousGTIDEvent      = 0x23
+
+	// mysql 5.7 & 8.0
+	TransactionContextEvent = 0x24
+	ViewChangeEvent         = 0x25
+	XAPrepareLogEvent       = 0x26
+	PartialUpdateRowsEvent  = 0x27
+	TransactionPayloadEvent = 0x28
+	HeartbeatLogEventV2     = 0x29
+
+	// mariadb 10.x & 11.x
+	MariaDBAnnotateRowsEvent           = 0xa0
+	MariaDBBinlogCheckpointEvent       = 0xa1
+	MariaDBGTIDEvent                   = 0xa2
+	MariaDBGTIDListEvent               = 0xa3
+	MariaDBStartEncryptionEvent        = 0xa4
+	MariaDBQueryCompressedEvent        = 0xa5
+	MariaDBWriteRowsCompressedEventV1  = 0xa6
+	MariaDBUpdateRowsCompressedEventV1 = 0xa7
+	MariaDBDeleteRowsCompressedEventV1 = 0xa8
+	MariaDBWriteRowsCompressedEvent    = 0xa9
+	MariaDBUpdateRowsCompressedEvent   = 0xaa
+	MariaDBDeleteRowsCompressedEvent   = 0xab
 )
 
 // EventType2Str mapping the name of binary log event type
@@ -133,8 +155,43 @@ var EventType2Str = map[uint8]string{
 	GTIDEvent:              "GTID_EVENT",
 	AnonymousGTIDEvent:     "ANONYMOUS_GTID_EVENT",
 	PreviousGTIDEvent:      "PREVIOUS_GTIDS_EVENT",
+
+	TransactionContextEvent: "TRANSACTION_CONTEXT_EVENT",
+	ViewChangeEvent:         "VIEW_CHANGE_EVENT",
+	XAPrepareLogEvent:       "XA_PREPARE_LOG_EVENT",
+	PartialUpdateRowsEvent:  "PARTIAL_UPDATE_ROWS_EVENT",
+	TransactionPayloadEvent: "TRANSACTION_PAYLOAD_EVENT",
+	HeartbeatLogEventV2:     "HEARTBEAT_LOG_EVENT_V2",
+
+	MariaDBAnnotateRowsEvent:           "ANNOTATE_ROWS_EVENT",
+	MariaDBBinlogCheckpointEvent:       "BINLOG_CHECKPOINT_EVENT",
+	MariaDBGTIDEvent:                   "MARIADB_GTID_EVENT",
+	MariaDBGTIDListEvent:               "MARIADB_GTID_LIST_EVENT",
+	MariaDBStartEncryptionEvent:        "START_ENCRYPTION_EVENT",
+	MariaDBQueryCompressedEvent:        "QUERY_COMPRESSED_EVENT",
+	MariaDBWriteRowsCompressedEventV1:  "WRITE_ROWS_COMPRESSED_EVENT_V1",
+	MariaDBUpdateRowsCompressedEventV1: "UPDATE_ROWS_COMPRESSED_EVENT_V1",
+	MariaDBDeleteRowsCompressedEventV1: "DELETE_ROWS_COMPRESSED_EVENT_V1",
+	MariaDBWriteRowsCompressedEvent:    "WRITE_ROWS_COMPRESSED_EVENT",
+	MariaDBUpdateRowsCompressedEvent:   "UPDATE_ROWS_COMPRESSED_EVENT",
+	MariaDBDeleteRowsCompressedEvent:   "DELETE_ROWS_COMPRESSED_EVENT",
 }
 
+// binary log event header flags
+// https://dev.mysql.com/doc/internals/en/binlog-event-flag.html
+const (
+	LogEventBinlogInUseF       uint16 = 0x0001
+	LogEventForcedRotateF      uint16 = 0x0002
+	LogEventThreadSpecificF    uint16 = 0x0004
+	LogEventSuppressUseF       uint16 = 0x0008
+	LogEventUpdateTableMapVerF uint16 = 0x0010
+	LogEventArtificialF        uint16 = 0x0020
+	LogEventRelayLogF          uint16 = 0x0040
+	LogEventIgnorableF         uint16 = 0x0080
+	LogEventNoFilterF          uint16 = 0x0100
+	LogEventMTSIsolateF        uint16 = 0x0200
+)
+
 // BINGLOG_CHECKSUM_ALG
 const (
 	BinlogChecksumAlgOff   byte = 0
@@ -158,6 +215,17 @@ const (
 	QInvokers              = 0x0b
 	QUpdatedDBNames        = 0x0c
 	QMicroseconds          = 0x0d
+
+	// mysql 8.0
+	QExplicitDefaultsForTimestamp = 0x10
+	QDDLLoggedWithXID             = 0x11
+	QDefaultCollationForUTF8MB4   = 0x12
+	QSQLRequirePrimaryKey         = 0x13
+	QDefaultTableEncryption       = 0x14
+
+	// mariadb
+	QHRNow = 0x80
+	QXID   = 0x81
 )
 
 // QStatusKey2Str is the name of status_vars
@@ -176,4 +244,31 @@ var QStatusKey2Str = map[uint8]string{
 	QInvokers:              "Q_INVOKERS",
 	QUpdatedDBNames:        "Q_UPDATED_DB_NAMES",
 	QMicroseconds:          "Q_MICROSECONDS",
+
+	QExplicitDefaultsForTimestamp: "Q_EXPLICIT_DEFAULTS_FOR_TIMESTAMP",
+	QDDLLoggedWithXID:             "Q_DDL_LOGGED_WITH_XID",
+	QDefaultCollationForUTF8MB4:   "Q_DEFAULT_COLLATION_FOR_UTF8MB4",
+	QSQLRequirePrimaryKey:         "Q_SQL_REQUIRE_PRIMARY_KEY",
+	QDefaultTableEncryption:       "Q_DEFAULT_TABLE_ENCRYPTION",
+
+	QHRNow: "Q_HRNOW",
+	QXID:   "Q_XID",
 }
+
+// INTVAR_EVENT types
+const (
+	IntvarLastInsertID = 0x01
+	IntvarInsertID     = 0x02
+)
+
+// USER_VAR_EVENT value types and flags
+// https://dev.mysql.com/doc/internals/en/user-var-event.html
+const (
+	UserVarStringResult  = 0x00
+	UserVarRealResult    = 0x01
+	UserVarIntResult     = 0x02
+	UserVarRowResult     = 0x03
+	UserVarDecimalResult = 0x04
+
+	UserVarUnsignedF = 0x01
+)
@@ -0,0 +1,1069 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// types of DDLStatement
+const (
+	DDLCreateTable    = "CREATE TABLE"
+	DDLAlterTable     = "ALTER TABLE"
+	DDLDropTable      = "DROP TABLE"
+	DDLRenameTable    = "RENAME TABLE"
+	DDLCreateDatabase = "CREATE DATABASE"
+	DDLDropDatabase   = "DROP DATABASE"
+)
+
+// actions of AlterSpec
+const (
+	AlterAddColumn      = "ADD COLUMN"
+	AlterDropColumn     = "DROP COLUMN"
+	AlterModifyColumn   = "MODIFY COLUMN" // MODIFY and CHANGE
+	AlterRenameColumn   = "RENAME COLUMN"
+	AlterRenameTable    = "RENAME TABLE"
+	AlterAddPrimaryKey  = "ADD PRIMARY KEY"
+	AlterDropPrimaryKey = "DROP PRIMARY KEY"
+	AlterAddUniqueKey   = "ADD UNIQUE KEY"
+	AlterDropIndex      = "DROP INDEX"
+	AlterRenameIndex    = "RENAME INDEX"
+	AlterSetVisibility  = "SET VISIBILITY"           // ALTER COLUMN ... SET VISIBLE / INVISIBLE
+	AlterConvertCharset = "CONVERT TO CHARACTER SET" // the table and its character columns
+	AlterTableCharset   = "DEFAULT CHARACTER SET"    // the default of table
+)
+
+// TableName is a table, Schema is empty if the name is not qualified
+type TableName struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+// TableDef is the definition of a table
+type TableDef struct {
+	Schema     string       `json:"schema"`
+	Name       string       `json:"name"`
+	Columns    []*ColumnDef `json:"columns"`
+	PrimaryKey []string     `json:"primary_key,omitempty"`
+	UniqueKeys []*KeyDef    `json:"unique_keys,omitempty"`
+
+	// default charset and collation of columns, empty if not given
+	Charset   string `json:"charset,omitempty"`
+	Collation string `json:"collation,omitempty"`
+}
+
+// KeyDef is an index
+type KeyDef struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// ColumnDef is the definition of a column
+type ColumnDef struct {
+	Name string `json:"name"`
+
+	// Type is the data type in lower case, such as int, varchar and enum
+	Type     string `json:"type"`
+	Unsigned bool   `json:"unsigned,omitempty"`
+	Nullable bool   `json:"nullable"`
+
+	// Values are the values of ENUM and SET
+	Values []string `json:"values,omitempty"`
+
+	// Charset and Collation are empty if they are not given, the default of table is used
+	Charset   string `json:"charset,omitempty"`
+	Collation string `json:"collation,omitempty"`
+
+	// Generated is VIRTUAL or STORED for generated columns, they are written in row images as other columns
+	Generated string `json:"generated,omitempty"`
+	Invisible bool   `json:"invisible,omitempty"`
+}
+
+// DDLStatement is a statement which changes tables
+type DDLStatement struct {
+	Type string
+
+	// Table is the table of CREATE TABLE and ALTER TABLE
+	Table TableName
+
+	// Definition is the table created, nil for CREATE TABLE ... LIKE
+	Definition  *TableDef
+	Like        *TableName
+	IfNotExists bool
+
+	// Alters are the specifications of ALTER TABLE which change columns, primary key or table name
+	Alters []*AlterSpec
+
+	// Tables are the tables of DROP TABLE
+	Tables   []TableName
+	IfExists bool
+
+	// Renames are the pairs of old and new names of RENAME TABLE
+	Renames [][2]TableName
+
+	// Database of CREATE DATABASE and DROP DATABASE
+	Database string
+}
+
+// AlterSpec is a specification of ALTER TABLE
+type AlterSpec struct {
+	Action string
+
+	// Name is the column dropped, modified, renamed or changed visibility, or the index dropped or renamed
+	Name string
+
+	// Column is the column added or modified, NewName is the new name of RENAME COLUMN and RENAME INDEX
+	Column  *ColumnDef
+	NewName string
+
+	// position of the column added or modified
+	First bool
+	After string
+
+	// Table is the new name of RENAME TABLE
+	Table TableName
+
+	// PrimaryKey are the columns of ADD PRIMARY KEY, Key is the index of ADD UNIQUE KEY
+	PrimaryKey []string
+	Key        *KeyDef
+
+	// Charset and Collation of CONVERT TO CHARACTER SET and DEFAULT CHARACTER SET
+	Charset   string
+	Collation string
+
+	// Invisible is the visibility of SET VISIBLE / INVISIBLE
+	Invisible bool
+}
+
+// ParseDDL parse a statement, return nil if it doesn't change tables or databases
+func ParseDDL(query string) (*DDLStatement, error) {
+	tokens, err := tokenizeDDL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &ddlParser{tokens: tokens}
+	return p.statement()
+}
+
+// kinds of ddlToken
+const (
+	ddlEOF    = iota
+	ddlWord   // keyword or unquoted identifier
+	ddlIdent  // quoted identifier
+	ddlString // quoted string
+	ddlSymbol
+)
+
+// ddlToken is a token of SQL statement
+type ddlToken struct {
+	kind int
+	text string
+
+	// offsets of the token in statement, [start, end)
+	start, end int
+}
+
+// isDDLWordByte return true if c is a byte of unquoted identifier or number
+func isDDLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// tokenizeDDL split statements into tokens, comments are skipped while the content of
+// version comments (/*!50100 ... */) is kept as mysql does
+func tokenizeDDL(query string) ([]ddlToken, error) {
+	var tokens []ddlToken
+	versioned := 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+
+		case c == '#' || c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || query[i+2] <= ' '):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case strings.HasPrefix(query[i:], "/*!"):
+			i += 3
+			for i < len(query) && query[i] >= '0' && query[i] <= '9' {
+				i++
+			}
+			versioned++
+
+		case strings.HasPrefix(query[i:], "*/") && versioned > 0:
+			i += 2
+			versioned--
+
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at %d", i)
+			}
+			i += end + 4
+
+		case c == '`' || c == '\'' || c == '"':
+			text, n, err := unquoteDDL(query[i:])
+			if err != nil {
+				return nil, err
+			}
+			kind := ddlString
+			if c == '`' {
+				kind = ddlIdent
+			}
+			tokens = append(tokens, ddlToken{kind, text, i, i + n})
+			i += n
+
+		case isDDLWordByte(c):
+			j := i
+			for j < len(query) && isDDLWordByte(query[j]) {
+				j++
+			}
+			tokens = append(tokens, ddlToken{ddlWord, query[i:j], i, j})
+			i = j
+
+		default:
+			tokens = append(tokens, ddlToken{ddlSymbol, query[i : i+1], i, i + 1})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// unquoteDDL return the content of the quoted string or identifier at the beginning of s, and its length
+func unquoteDDL(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			b.WriteByte(quote)
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote != '`' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'Z':
+				b.WriteByte(26)
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string %.20q", s)
+}
+
+// ddlParser is a recursive descent parser of DDL statements, clauses which don't change
+// columns are skipped with balanced parentheses
+type ddlParser struct {
+	tokens []ddlToken
+	pos    int
+}
+
+// peek return the next token
+func (p *ddlParser) peek() ddlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ddlToken{}
+}
+
+// next return the next token and move forward
+func (p *ddlParser) next() ddlToken {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// eof return true at the end of statement
+func (p *ddlParser) eof() bool {
+	t := p.peek()
+	return t.kind == ddlEOF || t.kind == ddlSymbol && t.text == ";"
+}
+
+// isKeyword return true if the next tokens are the keywords
+func (p *ddlParser) isKeyword(keywords ...string) bool {
+	for i, keyword := range keywords {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		t := p.tokens[p.pos+i]
+		if t.kind != ddlWord || !strings.EqualFold(t.text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptKeyword move forward if the next tokens are the keywords
+func (p *ddlParser) acceptKeyword(keywords ...string) bool {
+	if !p.isKeyword(keywords...) {
+		return false
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+// isSymbol return true if the next token is the symbol
+func (p *ddlParser) isSymbol(symbol string) bool {
+	t := p.peek()
+	return t.kind == ddlSymbol && t.text == symbol
+}
+
+// acceptSymbol move forward if the next token is the symbol
+func (p *ddlParser) acceptSymbol(symbol string) bool {
+	if !p.isSymbol(symbol) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// expectSymbol move forward if the next token is the symbol, else return an error
+func (p *ddlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+// unexpected return an error of the next token
+func (p *ddlParser) unexpected() error {
+	if p.eof() {
+		return fmt.Errorf("unexpected end of statement")
+	}
+	return fmt.Errorf("unexpected %q", p.peek().text)
+}
+
+// ident return the next identifier
+func (p *ddlParser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != ddlWord && t.kind != ddlIdent {
+		return "", p.unexpected()
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// tableName return the next table name, 'table' or 'schema.table'
+func (p *ddlParser) tableName() (TableName, error) {
+	var name TableName
+	table, err := p.ident()
+	if err != nil {
+		return name, err
+	}
+	if p.acceptSymbol(".") {
+		name.Schema = table
+		if table, err = p.ident(); err != nil {
+			return name, err
+		}
+	}
+	name.Table = table
+	return name, nil
+}
+
+// skip a token, or a parenthesized group
+func (p *ddlParser) skip() {
+	depth := 0
+	for !p.eof() {
+		t := p.next()
+		if t.kind == ddlSymbol && t.text == "(" {
+			depth++
+		} else if t.kind == ddlSymbol && t.text == ")" {
+			depth--
+		}
+		if depth <= 0 {
+			return
+		}
+	}
+}
+
+// skipUntil skip tokens until ',' or ')' out of parentheses, or the end of statement
+func (p *ddlParser) skipUntil() {
+	for !p.eof() && !p.isSymbol(",") && !p.isSymbol(")") {
+		p.skip()
+	}
+}
+
+// statement parse a statement
+func (p *ddlParser) statement() (*DDLStatement, error) {
+	switch {
+	case p.acceptKeyword("CREATE"):
+		if p.acceptKeyword("DATABASE") || p.acceptKeyword("SCHEMA") {
+			return p.database(DDLCreateDatabase, "IF", "NOT", "EXISTS")
+		}
+		if p.acceptKeyword("TABLE") {
+			return p.createTable()
+		}
+
+	case p.acceptKeyword("ALTER"):
+		for p.acceptKeyword("ONLINE") || p.acceptKeyword("OFFLINE") || p.acceptKeyword("IGNORE") {
+		}
+		if p.acceptKeyword("TABLE") {
+			return p.alterTable()
+		}
+
+	case p.acceptKeyword("DROP"):
+		if p.acceptKeyword("DATABASE") || p.acceptKeyword("SCHEMA") {
+			return p.database(DDLDropDatabase, "IF", "EXISTS")
+		}
+		if p.acceptKeyword("TABLE") || p.acceptKeyword("TABLES") {
+			return p.dropTable()
+		}
+
+	case p.acceptKeyword("RENAME"):
+		if p.acceptKeyword("TABLE") || p.acceptKeyword("TABLES") {
+			return p.renameTable()
+		}
+	}
+	// temporary tables are not tracked
+	return nil, nil
+}
+
+// database parse CREATE DATABASE and DROP DATABASE
+func (p *ddlParser) database(typ string, ifClause ...string) (*DDLStatement, error) {
+	st := &DDLStatement{Type: typ}
+	exists := p.acceptKeyword(ifClause...)
+	st.IfExists, st.IfNotExists = exists && typ == DDLDropDatabase, exists && typ == DDLCreateDatabase
+
+	var err error
+	st.Database, err = p.ident()
+	return st, err
+}
+
+// createTable parse CREATE TABLE after the keywords
+func (p *ddlParser) createTable() (*DDLStatement, error) {
+	st := &DDLStatement{Type: DDLCreateTable, IfNotExists: p.acceptKeyword("IF", "NOT", "EXISTS")}
+
+	var err error
+	if st.Table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("LIKE") {
+		like, err := p.tableName()
+		st.Like = &like
+		return st, err
+	}
+	if !p.acceptSymbol("(") {
+		return nil, fmt.Errorf("column definitions of %s are not found", st.Table.Table)
+	}
+	if p.acceptKeyword("LIKE") {
+		like, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		st.Like = &like
+		return st, p.expectSymbol(")")
+	}
+
+	def := &TableDef{Schema: st.Table.Schema, Name: st.Table.Table}
+	for {
+		if err = p.createDefinition(def); err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol(")") {
+			break
+		}
+		if err = p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.tableOptions(def); err != nil {
+		return nil, err
+	}
+	st.Definition = def
+	return st, nil
+}
+
+// tableOptions parse the default charset and collation of table options,
+// other options, partitions and SELECT are skipped
+func (p *ddlParser) tableOptions(def *TableDef) error {
+	for !p.eof() {
+		for _, keyword := range []string{"PARTITION", "AS", "SELECT", "IGNORE", "REPLACE", "TABLE", "WITH"} {
+			if p.isKeyword(keyword) {
+				for !p.eof() {
+					p.skip()
+				}
+				return nil
+			}
+		}
+
+		charset, collation, ok, err := p.charsetOption()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			p.skip()
+			continue
+		}
+		if charset != "" {
+			def.Charset = charset
+		}
+		if collation != "" {
+			def.Collation = collation
+		}
+	}
+	return nil
+}
+
+// charsetOption parse '[DEFAULT] CHARACTER SET [=] name' or '[DEFAULT] COLLATE [=] name', return false if it's not
+func (p *ddlParser) charsetOption() (charset, collation string, ok bool, err error) {
+	start := p.pos
+	p.acceptKeyword("DEFAULT")
+
+	var name *string
+	switch {
+	case p.acceptKeyword("CHARACTER", "SET"), p.acceptKeyword("CHAR", "SET"), p.acceptKeyword("CHARSET"):
+		name = &charset
+	case p.acceptKeyword("COLLATE"):
+		name = &collation
+	default:
+		p.pos = start
+		return "", "", false, nil
+	}
+
+	p.acceptSymbol("=")
+	t := p.peek()
+	if t.kind != ddlWord && t.kind != ddlIdent && t.kind != ddlString {
+		return "", "", false, p.unexpected()
+	}
+	p.pos++
+	*name = strings.ToLower(t.text)
+	return charset, collation, true, nil
+}
+
+// isConstraint return true if the next tokens are an index or constraint rather than a column
+func (p *ddlParser) isConstraint() bool {
+	for _, keyword := range []string{"CONSTRAINT", "PRIMARY", "KEY", "INDEX", "UNIQUE", "FULLTEXT", "SPATIAL", "FOREIGN", "CHECK"} {
+		if p.isKeyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// constraint parse an index or constraint, return the columns of primary key or the unique key
+func (p *ddlParser) constraint() (primaryKey []string, unique *KeyDef, err error) {
+	symbol := ""
+	if p.acceptKeyword("CONSTRAINT") && !p.isConstraint() {
+		if symbol, err = p.ident(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("PRIMARY", "KEY"):
+		p.indexType()
+		primaryKey, err = p.keyParts()
+
+	case p.acceptKeyword("UNIQUE"):
+		_ = p.acceptKeyword("KEY") || p.acceptKeyword("INDEX")
+		unique = &KeyDef{Name: symbol}
+		if !p.isSymbol("(") && !p.isKeyword("USING") {
+			if unique.Name, err = p.ident(); err != nil {
+				return nil, nil, err
+			}
+		}
+		p.indexType()
+		unique.Columns, err = p.keyParts()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.skipUntil()
+	return primaryKey, unique, nil
+}
+
+// indexType skip 'USING BTREE' before key parts
+func (p *ddlParser) indexType() {
+	for p.acceptKeyword("USING") {
+		p.skip()
+	}
+}
+
+// keyParts parse the columns of an index, prefix lengths and functional key parts are skipped
+func (p *ddlParser) keyParts() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for {
+		if p.isSymbol("(") {
+			p.skip()
+		} else {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, name)
+			if p.isSymbol("(") {
+				p.skip()
+			}
+		}
+		_ = p.acceptKeyword("ASC") || p.acceptKeyword("DESC")
+
+		if p.acceptSymbol(")") {
+			return columns, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// createDefinition parse a column or constraint of CREATE TABLE
+func (p *ddlParser) createDefinition(def *TableDef) error {
+	if p.isConstraint() {
+		primaryKey, unique, err := p.constraint()
+		if primaryKey != nil {
+			def.PrimaryKey = primaryKey
+		}
+		if unique != nil {
+			def.addUniqueKey(unique)
+		}
+		return err
+	}
+
+	column, primary, unique, err := p.columnDef()
+	if err != nil {
+		return err
+	}
+	def.Columns = append(def.Columns, column)
+	if primary {
+		def.PrimaryKey = []string{column.Name}
+	}
+	if unique {
+		def.addUniqueKey(&KeyDef{Columns: []string{column.Name}})
+	}
+	return nil
+}
+
+// columnTypes are the aliases of data types
+var columnTypes = map[string]string{
+	"bool":      "tinyint",
+	"boolean":   "tinyint",
+	"int1":      "tinyint",
+	"int2":      "smallint",
+	"int3":      "mediumint",
+	"middleint": "mediumint",
+	"int4":      "int",
+	"integer":   "int",
+	"int8":      "bigint",
+	"serial":    "bigint",
+	"dec":       "decimal",
+	"numeric":   "decimal",
+	"fixed":     "decimal",
+	"real":      "double",
+	"float4":    "float",
+	"float8":    "double",
+	"character": "char",
+	"nchar":     "char",
+	"nvarchar":  "varchar",
+}
+
+// columnType parse the data type of column, which may be more than one word, return true for national types
+func (p *ddlParser) columnType() (string, bool, error) {
+	t := p.peek()
+	if t.kind != ddlWord {
+		return "", false, p.unexpected()
+	}
+	p.pos++
+
+	typ := strings.ToLower(t.text)
+	national := typ == "national" || typ == "nchar" || typ == "nvarchar"
+	if typ == "national" {
+		if t = p.peek(); t.kind != ddlWord {
+			return "", false, p.unexpected()
+		}
+		p.pos++
+		typ = strings.ToLower(t.text)
+	}
+
+	switch typ {
+	case "double":
+		p.acceptKeyword("PRECISION")
+	case "char", "character", "nchar":
+		if p.acceptKeyword("VARYING") {
+			typ = "varchar"
+		}
+	case "long":
+		typ = "mediumtext"
+		if p.acceptKeyword("VARBINARY") {
+			typ = "mediumblob"
+		} else if !p.acceptKeyword("VARCHAR") {
+			p.acceptKeyword("CHAR", "VARYING")
+		}
+	}
+	if alias, ok := columnTypes[typ]; ok {
+		typ = alias
+	}
+	return typ, national, nil
+}
+
+// columnDef parse a column definition, return whether it's the primary key or a unique key
+func (p *ddlParser) columnDef() (column *ColumnDef, primary, unique bool, err error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, false, false, err
+	}
+	serial := p.isKeyword("SERIAL")
+	typ, national, err := p.columnType()
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	// SERIAL is BIGINT UNSIGNED NOT NULL AUTO_INCREMENT UNIQUE
+	column = &ColumnDef{Name: name, Type: typ, Unsigned: serial, Nullable: !serial}
+	unique = serial
+	if p.acceptSymbol("(") {
+		if column.Type == "enum" || column.Type == "set" {
+			if column.Values, err = p.values(); err != nil {
+				return nil, false, false, err
+			}
+		} else {
+			p.pos--
+			p.skip()
+		}
+	}
+
+	for !p.eof() && !p.isSymbol(",") && !p.isSymbol(")") && !p.isKeyword("FIRST") && !p.isKeyword("AFTER") {
+		charset, collation, ok, err := p.charsetOption()
+		if err != nil {
+			return nil, false, false, err
+		}
+		if ok {
+			if charset != "" {
+				column.Charset = charset
+			}
+			if collation != "" {
+				column.Collation = collation
+			}
+			continue
+		}
+
+		switch {
+		case p.acceptKeyword("UNSIGNED"), p.acceptKeyword("ZEROFILL"):
+			column.Unsigned = true
+		case p.acceptKeyword("NOT", "NULL"):
+			column.Nullable = false
+		case p.acceptKeyword("UNIQUE"):
+			p.acceptKeyword("KEY")
+			unique = true
+		case p.acceptKeyword("PRIMARY", "KEY"), p.acceptKeyword("KEY"):
+			primary, column.Nullable = true, false
+		case p.acceptKeyword("SERIAL", "DEFAULT", "VALUE"):
+			column.Nullable, unique = false, true
+		case p.acceptKeyword("GENERATED", "ALWAYS", "AS"), p.acceptKeyword("AS"):
+			p.skip()
+			column.Generated = "VIRTUAL"
+			if p.acceptKeyword("STORED") || p.acceptKeyword("PERSISTENT") {
+				column.Generated = "STORED"
+			}
+		case p.acceptKeyword("INVISIBLE"):
+			column.Invisible = true
+		case p.acceptKeyword("VISIBLE"):
+			column.Invisible = false
+		default:
+			p.skip()
+		}
+	}
+
+	if national && column.Charset == "" {
+		column.Charset = "utf8"
+	}
+	return column, primary, unique, nil
+}
+
+// values parse the quoted values of ENUM and SET after '('
+func (p *ddlParser) values() ([]string, error) {
+	var values []string
+	for {
+		t := p.peek()
+		if t.kind != ddlString {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		values = append(values, t.text)
+
+		if p.acceptSymbol(")") {
+			return values, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// alterTable parse ALTER TABLE after the keywords
+func (p *ddlParser) alterTable() (*DDLStatement, error) {
+	st := &DDLStatement{Type: DDLAlterTable}
+
+	var err error
+	if st.Table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+
+	for !p.eof() {
+		specs, err := p.alterSpec()
+		if err != nil {
+			return nil, err
+		}
+		st.Alters = append(st.Alters, specs...)
+		if !p.acceptSymbol(",") && !p.eof() {
+			// partition options follow the specifications without comma
+			p.skip()
+		}
+	}
+	return st, nil
+}
+
+// alterSpec parse a specification of ALTER TABLE, return nil if it doesn't change columns or keys
+func (p *ddlParser) alterSpec() ([]*AlterSpec, error) {
+	var specs []*AlterSpec
+	var err error
+	switch {
+	case p.acceptKeyword("ADD"):
+		if p.isConstraint() {
+			var primaryKey []string
+			var unique *KeyDef
+			if primaryKey, unique, err = p.constraint(); primaryKey != nil {
+				specs = append(specs, &AlterSpec{Action: AlterAddPrimaryKey, PrimaryKey: primaryKey})
+			} else if unique != nil {
+				specs = append(specs, &AlterSpec{Action: AlterAddUniqueKey, Key: unique})
+			}
+			break
+		}
+		if p.isKeyword("PARTITION") {
+			break
+		}
+
+		p.acceptKeyword("COLUMN")
+		if !p.acceptSymbol("(") {
+			specs, err = p.alterColumn(AlterAddColumn, "")
+			break
+		}
+		for err == nil && !p.acceptSymbol(")") {
+			var more []*AlterSpec
+			if more, err = p.alterColumn(AlterAddColumn, ""); err == nil && !p.isSymbol(")") {
+				err = p.expectSymbol(",")
+			}
+			specs = append(specs, more...)
+		}
+
+	case p.acceptKeyword("DROP"):
+		switch {
+		case p.acceptKeyword("PRIMARY", "KEY"):
+			specs = append(specs, &AlterSpec{Action: AlterDropPrimaryKey})
+		case p.acceptKeyword("INDEX"), p.acceptKeyword("KEY"), p.acceptKeyword("CONSTRAINT"):
+			var name string
+			if name, err = p.ident(); err == nil {
+				specs = append(specs, &AlterSpec{Action: AlterDropIndex, Name: name})
+			}
+		case p.isConstraint(), p.isKeyword("PARTITION"), p.isKeyword("DEFAULT"):
+		default:
+			p.acceptKeyword("COLUMN")
+			var name string
+			if name, err = p.ident(); err == nil {
+				specs = append(specs, &AlterSpec{Action: AlterDropColumn, Name: name})
+			}
+		}
+
+	case p.acceptKeyword("MODIFY"):
+		p.acceptKeyword("COLUMN")
+		specs, err = p.alterColumn(AlterModifyColumn, "")
+
+	case p.acceptKeyword("CHANGE"):
+		p.acceptKeyword("COLUMN")
+		var name string
+		if name, err = p.ident(); err == nil {
+			specs, err = p.alterColumn(AlterModifyColumn, name)
+		}
+
+	case p.acceptKeyword("RENAME"):
+		switch {
+		case p.acceptKeyword("COLUMN"):
+			specs, err = p.rename(AlterRenameColumn)
+		case p.acceptKeyword("INDEX"), p.acceptKeyword("KEY"):
+			specs, err = p.rename(AlterRenameIndex)
+		default:
+			_ = p.acceptKeyword("TO") || p.acceptKeyword("AS")
+			spec := &AlterSpec{Action: AlterRenameTable}
+			if spec.Table, err = p.tableName(); err == nil {
+				specs = append(specs, spec)
+			}
+		}
+
+	case p.acceptKeyword("ALTER"):
+		if p.isKeyword("INDEX") || p.isKeyword("CHECK") || p.isKeyword("CONSTRAINT") {
+			break
+		}
+		p.acceptKeyword("COLUMN")
+		spec := &AlterSpec{Action: AlterSetVisibility}
+		if spec.Name, err = p.ident(); err != nil {
+			break
+		}
+		if p.acceptKeyword("SET", "INVISIBLE") {
+			spec.Invisible = true
+			specs = append(specs, spec)
+		} else if p.acceptKeyword("SET", "VISIBLE") {
+			specs = append(specs, spec)
+		}
+
+	case p.acceptKeyword("CONVERT", "TO"):
+		specs, err = p.alterCharset(AlterConvertCharset)
+
+	default:
+		// table options are not separated by comma
+		specs, err = p.alterCharset(AlterTableCharset)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipUntil()
+	return specs, nil
+}
+
+// rename parse 'old TO new' of RENAME COLUMN and RENAME INDEX
+func (p *ddlParser) rename(action string) ([]*AlterSpec, error) {
+	spec := &AlterSpec{Action: action}
+	var err error
+	if spec.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("TO") {
+		return nil, p.unexpected()
+	}
+	if spec.NewName, err = p.ident(); err != nil {
+		return nil, err
+	}
+	return []*AlterSpec{spec}, nil
+}
+
+// alterCharset parse the charset and collation options of CONVERT TO or table options until the next
+// specification, other options are skipped, return nil if there is no charset or collation
+func (p *ddlParser) alterCharset(action string) ([]*AlterSpec, error) {
+	spec := &AlterSpec{Action: action}
+	for !p.eof() && !p.isSymbol(",") {
+		charset, collation, ok, err := p.charsetOption()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			p.skip()
+			continue
+		}
+		if charset != "" {
+			spec.Charset = charset
+		}
+		if collation != "" {
+			spec.Collation = collation
+		}
+	}
+
+	if spec.Charset == "" && spec.Collation == "" {
+		return nil, nil
+	}
+	return []*AlterSpec{spec}, nil
+}
+
+// alterColumn parse the column definition and position of ADD, MODIFY and CHANGE
+func (p *ddlParser) alterColumn(action, name string) ([]*AlterSpec, error) {
+	column, primary, unique, err := p.columnDef()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = column.Name
+	}
+
+	spec := &AlterSpec{Action: action, Name: name, Column: column}
+	if p.acceptKeyword("FIRST") {
+		spec.First = true
+	} else if p.acceptKeyword("AFTER") {
+		if spec.After, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+
+	specs := []*AlterSpec{spec}
+	if primary {
+		specs = append(specs, &AlterSpec{Action: AlterAddPrimaryKey, PrimaryKey: []string{column.Name}})
+	}
+	if unique {
+		specs = append(specs, &AlterSpec{Action: AlterAddUniqueKey, Key: &KeyDef{Columns: []string{column.Name}}})
+	}
+	return specs, nil
+}
+
+// dropTable parse DROP TABLE after the keywords
+func (p *ddlParser) dropTable() (*DDLStatement, error) {
+	st := &DDLStatement{Type: DDLDropTable, IfExists: p.acceptKeyword("IF", "EXISTS")}
+	for {
+		name, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		st.Tables = append(st.Tables, name)
+		if !p.acceptSymbol(",") {
+			return st, nil
+		}
+	}
+}
+
+// renameTable parse RENAME TABLE after the keywords
+func (p *ddlParser) renameTable() (*DDLStatement, error) {
+	st := &DDLStatement{Type: DDLRenameTable}
+	for {
+		from, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("TO") {
+			return nil, p.unexpected()
+		}
+		to, err := p.tableName()
+		if err != nil {
+			return nil, err
+		}
+		st.Renames = append(st.Renames, [2]TableName{from, to})
+		if !p.acceptSymbol(",") {
+			return st, nil
+		}
+	}
+}
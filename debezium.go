@@ -0,0 +1,530 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Debezium change event operations
+const (
+	DebeziumOpCreate = "c"
+	DebeziumOpUpdate = "u"
+	DebeziumOpDelete = "d"
+	DebeziumOpRead   = "r"
+)
+
+// DebeziumVersion is the version of DebeziumEncoder written in source of change events
+const DebeziumVersion = "1.0.0"
+
+// DebeziumConnector is the connector name written in source of change events
+const DebeziumConnector = "go-mysql-binlog"
+
+// DebeziumEncoder writes row changes as Debezium MySQL connector change events,
+// a JSON object with schema and payload per line, as Kafka Connect JsonConverter does.
+// https://debezium.io/documentation/reference/stable/connectors/mysql.html#mysql-events
+// Column types are mapped with decimal.handling.mode=string, time.precision.mode=adaptive_time_microseconds
+// and bigint.unsigned.handling.mode=precise, BIGINT UNSIGNED is a Decimal of scale 0 encoded as base64 bytes.
+// ENUM is the index of int32 if its values are not known from TABLE_MAP_EVENT.
+// Columns absent from partial row images, such as binlog_row_image=MINIMAL, are optional.
+// All events should be passed in order, so that change events know the GTID of transaction.
+type DebeziumEncoder struct {
+	// ServerName is the logical name of MySQL server, used as the prefix of schema names
+	ServerName string
+
+	// File is the binary log file name written in source
+	File string
+
+	// Now return the time when events are processed, time.Now if nil
+	Now func() time.Time
+
+	enc  *json.Encoder
+	gtid string
+}
+
+// NewDebeziumEncoder return a DebeziumEncoder writing into w
+func NewDebeziumEncoder(w io.Writer, serverName string) *DebeziumEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &DebeziumEncoder{ServerName: serverName, enc: enc}
+}
+
+// debeziumField is the Kafka Connect schema of a field
+type debeziumField struct {
+	Type       string            `json:"type"`
+	Fields     []*debeziumField  `json:"fields,omitempty"`
+	Optional   bool              `json:"optional"`
+	Name       string            `json:"name,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Default    interface{}       `json:"default,omitempty"`
+	Field      string            `json:"field,omitempty"`
+}
+
+// debeziumSource is the source of change event
+type debeziumSource struct {
+	Version   string  `json:"version"`
+	Connector string  `json:"connector"`
+	Name      string  `json:"name"`
+	TsMs      int64   `json:"ts_ms"`
+	Snapshot  string  `json:"snapshot"`
+	DB        string  `json:"db"`
+	Sequence  *string `json:"sequence"`
+	Table     string  `json:"table"`
+	ServerID  int64   `json:"server_id"`
+	GTID      *string `json:"gtid"`
+	File      string  `json:"file"`
+	Pos       int64   `json:"pos"`
+	Row       int     `json:"row"`
+	Thread    *int64  `json:"thread"`
+	Query     *string `json:"query"`
+}
+
+// debeziumPayload is the envelope of change event
+type debeziumPayload struct {
+	Before      debeziumRow     `json:"before"`
+	After       debeziumRow     `json:"after"`
+	Source      *debeziumSource `json:"source"`
+	Op          string          `json:"op"`
+	TsMs        int64           `json:"ts_ms"`
+	Transaction interface{}     `json:"transaction"`
+}
+
+// debeziumMessage is the change event with schema
+type debeziumMessage struct {
+	Schema  *debeziumField   `json:"schema"`
+	Payload *debeziumPayload `json:"payload"`
+}
+
+// debeziumRow is a row image which keeps the order of columns
+type debeziumRow []debeziumColumn
+
+type debeziumColumn struct {
+	Name  string
+	Value interface{}
+}
+
+// MarshalJSON implement json.Marshaler
+func (row debeziumRow) MarshalJSON() ([]byte, error) {
+	if row == nil {
+		return []byte("null"), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range row {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(column.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Encode write change events of ROWS_EVENT, other events write nothing
+func (e *DebeziumEncoder) Encode(event *BinEvent) error {
+	if gtid, ok := event.Body.(*BinGTIDEvent); ok {
+		e.gtid = gtid.GTID()
+	}
+
+	rows, ok := event.Body.(*BinRowsEvent)
+	if !ok || rows.Table == nil {
+		return nil
+	}
+
+	op := DebeziumOpCreate
+	switch rows.Action() {
+	case RowsActionUpdate:
+		op = DebeziumOpUpdate
+	case RowsActionDelete:
+		op = DebeziumOpDelete
+	}
+
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+
+	schema := e.schema(rows)
+	for i, row := range rows.Rows {
+		source := &debeziumSource{
+			Version:   DebeziumVersion,
+			Connector: DebeziumConnector,
+			Name:      e.ServerName,
+			TsMs:      event.Header.Timestamp * 1000,
+			Snapshot:  "false",
+			DB:        rows.Table.Schema,
+			Table:     rows.Table.Table,
+			ServerID:  event.Header.ServerID,
+			File:      e.File,
+			Pos:       event.Header.LogPos - event.Header.EventSize,
+			Row:       i,
+		}
+		if e.gtid != "" {
+			gtid := e.gtid
+			source.GTID = &gtid
+		}
+
+		before, err := debeziumImage(rows, row.Before, false)
+		if err != nil {
+			return err
+		}
+		after, err := debeziumImage(rows, row.After, true)
+		if err != nil {
+			return err
+		}
+
+		message := &debeziumMessage{
+			Schema: schema,
+			Payload: &debeziumPayload{
+				Before: before,
+				After:  after,
+				Source: source,
+				Op:     op,
+				TsMs:   now().UnixNano() / int64(time.Millisecond),
+			},
+		}
+		if err := e.enc.Encode(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schema return the envelope schema of the table of rows event
+func (e *DebeziumEncoder) schema(rows *BinRowsEvent) *debeziumField {
+	table := rows.Table
+	prefix := fmt.Sprintf("%s.%s.%s", e.ServerName, table.Schema, table.Table)
+
+	columns := make([]*debeziumField, table.ColumnCount)
+	for i := range columns {
+		columns[i] = debeziumColumnSchema(table, i)
+		// column absent from partial row image
+		if !rows.IsPresent(i, false) || !rows.IsPresent(i, true) {
+			columns[i].Optional = true
+		}
+	}
+
+	value := func(field string) *debeziumField {
+		return &debeziumField{Type: "struct", Fields: columns, Optional: true, Name: prefix + ".Value", Field: field}
+	}
+
+	return &debeziumField{
+		Type: "struct",
+		Fields: []*debeziumField{
+			value("before"),
+			value("after"),
+			debeziumSourceSchema(),
+			{Type: "string", Field: "op"},
+			{Type: "int64", Optional: true, Field: "ts_ms"},
+			{
+				Type: "struct",
+				Fields: []*debeziumField{
+					{Type: "string", Field: "id"},
+					{Type: "int64", Field: "total_order"},
+					{Type: "int64", Field: "data_collection_order"},
+				},
+				Optional: true,
+				Name:     "event.block",
+				Version:  1,
+				Field:    "transaction",
+			},
+		},
+		Name:    prefix + ".Envelope",
+		Version: 1,
+	}
+}
+
+// debeziumSourceSchema return the schema of source
+func debeziumSourceSchema() *debeziumField {
+	return &debeziumField{
+		Type: "struct",
+		Fields: []*debeziumField{
+			{Type: "string", Field: "version"},
+			{Type: "string", Field: "connector"},
+			{Type: "string", Field: "name"},
+			{Type: "int64", Field: "ts_ms"},
+			{
+				Type:       "string",
+				Optional:   true,
+				Name:       "io.debezium.data.Enum",
+				Version:    1,
+				Parameters: map[string]string{"allowed": "true,last,false,incremental"},
+				Default:    "false",
+				Field:      "snapshot",
+			},
+			{Type: "string", Field: "db"},
+			{Type: "string", Optional: true, Field: "sequence"},
+			{Type: "string", Optional: true, Field: "table"},
+			{Type: "int64", Field: "server_id"},
+			{Type: "string", Optional: true, Field: "gtid"},
+			{Type: "string", Field: "file"},
+			{Type: "int64", Field: "pos"},
+			{Type: "int32", Field: "row"},
+			{Type: "int64", Optional: true, Field: "thread"},
+			{Type: "string", Optional: true, Field: "query"},
+		},
+		Name:  "io.debezium.connector.mysql.Source",
+		Field: "source",
+	}
+}
+
+// debeziumColumnSchema return the schema of column i derived from column type
+func debeziumColumnSchema(table *BinTableMapEvent, i int) *debeziumField {
+	field := &debeziumField{Field: table.ColumnName(i), Optional: table.IsNullable(i)}
+	unsigned := table.IsUnsigned(i)
+	meta := table.ColumnMetaDef[i]
+
+	switch table.RealType(i) {
+	case MySQLTypeTiny:
+		field.Type = "int16"
+	case MySQLTypeShort:
+		field.Type = "int16"
+		if unsigned {
+			field.Type = "int32"
+		}
+	case MySQLTypeInt24:
+		field.Type = "int32"
+	case MySQLTypeLong:
+		field.Type = "int32"
+		if unsigned {
+			field.Type = "int64"
+		}
+	case MySQLTypeLonglong:
+		field.Type = "int64"
+		if unsigned {
+			field.Type, field.Name, field.Version = "bytes", "org.apache.kafka.connect.data.Decimal", 1
+			field.Parameters = map[string]string{"scale": "0"}
+		}
+	case MySQLTypeFloat:
+		field.Type = "float"
+	case MySQLTypeDouble:
+		field.Type = "double"
+	case MySQLTypeNewDecimal, MySQLTypeDecimal:
+		field.Type = "string"
+	case MySQLTypeYear:
+		field.Type, field.Name, field.Version = "int32", "io.debezium.time.Year", 1
+	case MySQLTypeDate, MySQLTypeNewDate:
+		field.Type, field.Name, field.Version = "int32", "io.debezium.time.Date", 1
+	case MySQLTypeTime, MySQLTypeTime2:
+		field.Type, field.Name, field.Version = "int64", "io.debezium.time.MicroTime", 1
+	case MySQLTypeDatetime, MySQLTypeDatetime2:
+		field.Type, field.Name, field.Version = "int64", "io.debezium.time.Timestamp", 1
+		if table.ColumnTypeDef[i] == MySQLTypeDatetime2 && meta > 3 {
+			field.Name = "io.debezium.time.MicroTimestamp"
+		}
+	case MySQLTypeTimestamp, MySQLTypeTimestamp2:
+		field.Type, field.Name, field.Version = "string", "io.debezium.time.ZonedTimestamp", 1
+	case MySQLTypeBit:
+		field.Type = "boolean"
+		if nbits := int(meta>>8)*8 + int(meta&0xff); nbits > 1 {
+			field.Type, field.Name, field.Version = "bytes", "io.debezium.data.Bits", 1
+			field.Parameters = map[string]string{"length": strconv.Itoa(nbits)}
+		}
+	case MySQLTypeEnum:
+		field.Type = "int32"
+		if i < len(table.EnumValues) && table.EnumValues[i] != nil {
+			field.Type, field.Name, field.Version = "string", "io.debezium.data.Enum", 1
+			field.Parameters = map[string]string{"allowed": strings.Join(table.EnumValues[i], ",")}
+		}
+	case MySQLTypeSet:
+		field.Type, field.Name, field.Version = "string", "io.debezium.data.EnumSet", 1
+		if i < len(table.SetValues) && table.SetValues[i] != nil {
+			field.Parameters = map[string]string{"allowed": strings.Join(table.SetValues[i], ",")}
+		}
+	case MySQLTypeJSON:
+		field.Type, field.Name, field.Version = "string", "io.debezium.data.Json", 1
+	case MySQLTypeGeometry:
+		field.Type, field.Name = "struct", "io.debezium.data.geometry.Geometry"
+		field.Fields = []*debeziumField{
+			{Type: "bytes", Field: "wkb"},
+			{Type: "int32", Optional: true, Field: "srid"},
+		}
+	case MySQLTypeBlob:
+		field.Type = "bytes"
+		if collation := debeziumCollation(table, i); collation != 0 && collation != binaryCollationID {
+			field.Type = "string"
+		}
+	default:
+		field.Type = "string"
+		if debeziumCollation(table, i) == binaryCollationID {
+			field.Type = "bytes"
+		}
+	}
+
+	return field
+}
+
+func debeziumCollation(table *BinTableMapEvent, i int) uint64 {
+	if i < len(table.ColumnCharset) {
+		return table.ColumnCharset[i]
+	}
+	return 0
+}
+
+// debeziumImage return the row image with Debezium values, nil if image is nil
+func debeziumImage(rows *BinRowsEvent, image []interface{}, isAfter bool) (debeziumRow, error) {
+	if image == nil {
+		return nil, nil
+	}
+
+	row := make(debeziumRow, 0, len(image))
+	for i, v := range image {
+		if !rows.IsPresent(i, isAfter) {
+			continue
+		}
+
+		value, err := debeziumValue(rows.Table, i, v)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, debeziumColumn{Name: rows.Table.ColumnName(i), Value: value})
+	}
+	return row, nil
+}
+
+// debeziumValue convert column value into the value of Debezium
+func debeziumValue(table *BinTableMapEvent, i int, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch table.RealType(i) {
+	case MySQLTypeLonglong:
+		if n, ok := v.(uint64); ok {
+			return debeziumDecimalBytes(n), nil
+		}
+
+	case MySQLTypeDate, MySQLTypeNewDate:
+		t, err := time.Parse("2006-01-02", v.(string))
+		if err != nil {
+			// zero date
+			return nil, nil
+		}
+		return t.Unix() / 86400, nil
+
+	case MySQLTypeTime, MySQLTypeTime2:
+		return debeziumMicroTime(v.(string))
+
+	case MySQLTypeDatetime, MySQLTypeDatetime2:
+		t, err := time.Parse("2006-01-02 15:04:05.999999", v.(string))
+		if err != nil {
+			return nil, nil
+		}
+		if table.ColumnTypeDef[i] == MySQLTypeDatetime2 && table.ColumnMetaDef[i] > 3 {
+			return t.UnixNano() / int64(time.Microsecond), nil
+		}
+		return t.UnixNano() / int64(time.Millisecond), nil
+
+	case MySQLTypeTimestamp, MySQLTypeTimestamp2:
+		t, err := time.Parse("2006-01-02 15:04:05.999999", v.(string))
+		if err != nil {
+			return nil, nil
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+
+	case MySQLTypeBit:
+		bits := v.(uint64)
+		meta := table.ColumnMetaDef[i]
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		if nbits <= 1 {
+			return bits != 0, nil
+		}
+
+		// little endian bytes as java.util.BitSet
+		b := make([]byte, (nbits+7)/8)
+		for j := range b {
+			b[j] = byte(bits >> (8 * uint(j)))
+		}
+		return b, nil
+
+	case MySQLTypeEnum:
+		index := v.(int64)
+		if i >= len(table.EnumValues) || table.EnumValues[i] == nil {
+			return int32(index), nil
+		}
+		s, ok := table.EnumValue(i, index)
+		if !ok {
+			return nil, fmt.Errorf("invalid ENUM index %d of column %s", index, table.ColumnName(i))
+		}
+		return s, nil
+
+	case MySQLTypeSet:
+		if s, ok := table.SetValue(i, v.(uint64)); ok {
+			return s, nil
+		}
+		return strconv.FormatUint(v.(uint64), 10), nil
+
+	case MySQLTypeGeometry:
+		// MySQL geometry is 4 bytes SRID and WKB
+		data := v.([]byte)
+		if len(data) < 4 {
+			return nil, fmt.Errorf("invalid geometry value of column %s", table.ColumnName(i))
+		}
+		return map[string]interface{}{"wkb": data[4:], "srid": FixedLengthInt(data[:4])}, nil
+	}
+
+	return v, nil
+}
+
+// debeziumDecimalBytes return the unscaled value of Decimal as java.math.BigInteger.toByteArray(),
+// which is big endian two's complement
+func debeziumDecimalBytes(n uint64) []byte {
+	b := new(big.Int).SetUint64(n).Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+// debeziumMicroTime convert TIME string [-]HH:MM:SS[.ffffff] into microseconds
+func debeziumMicroTime(s string) (int64, error) {
+	sign := int64(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+
+	var hour, minute, second, usec int64
+	parts := strings.SplitN(s, ".", 2)
+	if _, err := fmt.Sscanf(parts[0], "%d:%d:%d", &hour, &minute, &second); err != nil {
+		return 0, err
+	}
+	if len(parts) == 2 {
+		frac := (parts[1] + "000000")[:6]
+		usec, _ = strconv.ParseInt(frac, 10, 64)
+	}
+
+	return sign * (((hour*60+minute)*60+second)*1000000 + usec), nil
+}
@@ -19,7 +19,6 @@ package binlog
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -37,18 +36,45 @@ type BinReaderOption struct {
 	EndPos    int64
 	StartTime time.Time
 	EndTime   time.Time
+
+	// KeyProvider provides the keys of binary logs encrypted by binlog_encryption, nil if they are not encrypted
+	KeyProvider KeyProvider
+}
+
+// keyProvider return the KeyProvider of option, nil if option is nil
+func (o *BinReaderOption) keyProvider() KeyProvider {
+	if o == nil {
+		return nil
+	}
+	return o.KeyProvider
 }
 
-// Start return bool of if start decoding
+// Start return bool of if start decoding, both StartPos and StartTime are checked if they are set
 func (o *BinReaderOption) Start(header *BinEventHeader) bool {
 	if o == nil {
 		return true
-	} else if o.StartPos != 0 && o.StartPos <= header.LogPos-header.EventSize {
-		return true
-	} else if o.StartTime.Unix() <= time.Unix(header.Timestamp, 0).Unix() {
-		return true
+	} else if o.StartPos != 0 && o.StartPos > header.LogPos-header.EventSize {
+		return false
+	} else if !o.StartTime.IsZero() && o.StartTime.Unix() > time.Unix(header.Timestamp, 0).Unix() {
+		return false
 	}
-	return false
+	return true
+}
+
+// chain return the option of a binary log in chain as mysqlbinlog, StartPos is applied to the first
+// binary log and EndPos to the last one, StartTime and EndTime are applied to all of them
+func (o *BinReaderOption) chain(isFirst, isLast bool) *BinReaderOption {
+	if o == nil {
+		return nil
+	}
+	option := *o
+	if !isFirst {
+		option.StartPos = 0
+	}
+	if !isLast {
+		option.EndPos = 0
+	}
+	return &option
 }
 
 // Stop return bool of if stop decoding
@@ -80,12 +106,48 @@ type BinFileDecoder struct {
 	// binary log reading options
 	Option *BinReaderOption
 
+	// Filter chooses the events to walk, all events if nil
+	Filter *EventFilter
+
+	// Masker drops or masks columns of row changes, nil if no column is masked
+	Masker *ColumnMasker
+
+	// Schema fills the column metadata of TABLE_MAP_EVENT which are not written by server, nil if not needed
+	Schema SchemaProvider
+
+	// OnSchemaMismatch is called when the definition of Schema doesn't match TABLE_MAP_EVENT, the columns are
+	// not filled and the error returned stops decoding. Mismatches are returned as errors if it's nil.
+	OnSchemaMismatch func(mismatch *SchemaMismatch) error
+
+	// Recover enables the recovery mode: when an event is corrupted, the decoder scans forward for the next
+	// plausible event and resumes from it instead of failing. Encrypted binary logs are not recovered.
+	Recover bool
+
+	// OnSkip is called with the bytes skipped in recovery mode, the error returned stops decoding
+	OnSkip func(skipped *SkippedRange) error
+
+	// Strict returns ErrUnsupportedEvent for the events without decoder, such as STOP_EVENT and
+	// INCIDENT_EVENT, instead of walking them as BinEventUnParsed
+	Strict bool
+
+	// encrypted is true if the binary log is encrypted
+	encrypted bool
+
+	// skipTransaction is true if current transaction is excluded by Filter
+	skipTransaction bool
+
 	// file object
 	BinFile *os.File
 
 	// buffer
 	buf *bufio.Reader
 
+	// offset of the next event in binary log file
+	offset int64
+
+	// relay log state, nil if not in relay log mode
+	relay *relayLogInfo
+
 	*BinaryLogInfo
 }
 
@@ -103,6 +165,32 @@ func NewBinFileDecoder(path string, options ...*BinReaderOption) (*BinFileDecode
 	return decoder, decoder.init()
 }
 
+// NewBinFileChainDecoder return a BinFileDecoder which walks the binary logs of paths in order.
+// As mysqlbinlog, StartPos of options is the position in the first binary log and EndPos is the position
+// in the last one, StartTime and EndTime are applied to every binary log.
+func NewBinFileChainDecoder(paths []string, options ...*BinReaderOption) (*BinFileDecoder, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no binary log to decode")
+	}
+
+	decoder, err := NewBinFileDecoder(paths[0], options...)
+	if err != nil {
+		return decoder, err
+	}
+
+	decoder.link(paths[1:])
+	return decoder, nil
+}
+
+// NewBinFileIndexDecoder return a BinFileDecoder which walks all binary logs listed in index file, such as mysql-bin.index
+func NewBinFileIndexDecoder(indexPath string, options ...*BinReaderOption) (*BinFileDecoder, error) {
+	paths, err := ReadIndexFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewBinFileChainDecoder(paths, options...)
+}
+
 // Init BinFileDecoder, binary log file validate
 func (decoder *BinFileDecoder) init() error {
 	// open binary log
@@ -121,16 +209,80 @@ func (decoder *BinFileDecoder) init() error {
 		return err
 	}
 
+	// encrypted binary log, the decrypted content starts with binary log header too
+	if bytes.Equal(header, encryptedFileHeader) {
+		if err := decoder.openEncrypted(header); err != nil {
+			return err
+		}
+
+		if _, err := io.ReadFull(decoder.buf, header); err != nil {
+			return err
+		}
+	}
+
 	if !bytes.Equal(header, binFileHeader) {
-		return fmt.Errorf("invalid binary log header {%x}", header)
+		return &ErrInvalidHeader{EventPosition: EventPosition{File: decoder.Path}, Reason: fmt.Sprintf("invalid binary log magic {%x}", header)}
 	}
 
 	decoder.BinaryLogInfo = &BinaryLogInfo{tableInfo: make(map[uint64]*BinTableMapEvent)}
+	decoder.offset = int64(len(binFileHeader))
 	return nil
 }
 
-// DecodeEvent will decode a single event from binary log
+// link the binary logs after current decoder, they will be opened when walking to them
+func (decoder *BinFileDecoder) link(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	option := decoder.Option
+	decoder.Option = option.chain(true, false)
+	prev := decoder
+	for i, path := range paths {
+		next := &BinFileDecoder{
+			Path:   path,
+			prev:   prev,
+			Option: option.chain(false, i == len(paths)-1),
+			relay:  decoder.relay,
+		}
+		prev.next = next
+		prev = next
+	}
+}
+
+// openNext init the next binary log decoder, table map events and settings, such as Filter set after
+// the decoder is created, are kept for the next binary log
+func (decoder *BinFileDecoder) openNext() (*BinFileDecoder, error) {
+	next := decoder.next
+	next.Filter, next.Masker = decoder.Filter, decoder.Masker
+	next.Schema, next.OnSchemaMismatch = decoder.Schema, decoder.OnSchemaMismatch
+	next.Recover, next.OnSkip, next.Strict = decoder.Recover, decoder.OnSkip, decoder.Strict
+	// a transaction of relay logs may continue in the next file
+	next.skipTransaction = decoder.skipTransaction
+	if err := next.init(); err != nil {
+		return nil, err
+	}
+
+	for id, table := range decoder.tableInfo {
+		next.tableInfo[id] = table
+	}
+	return next, nil
+}
+
+// DecodeEvent will decode a single event from binary log.
+// In recovery mode, a nil event is returned after the corrupted bytes are skipped.
 func (decoder *BinFileDecoder) DecodeEvent() (*BinEvent, error) {
+	event, err := decoder.decodeEvent()
+	if err != nil && decoder.Recover {
+		if start, ok := recoverable(err); ok {
+			return nil, decoder.resync(start, err)
+		}
+	}
+	return event, err
+}
+
+// decodeEvent decode the next event
+func (decoder *BinFileDecoder) decodeEvent() (*BinEvent, error) {
 	event := &BinEvent{}
 	rd := decoder.buf
 
@@ -139,20 +291,38 @@ func (decoder *BinFileDecoder) DecodeEvent() (*BinEvent, error) {
 		eventHeaderLength = decoder.description.EventHeaderLength
 	}
 
-	// read binlog event header
+	// position of the event in errors
+	pos := EventPosition{File: decoder.Path, Offset: decoder.offset}
+
+	// read binlog event header, io.EOF is returned at the end of binary log
 	headerData, err := ReadNBytes(rd, eventHeaderLength)
 	if err != nil {
+		if err == io.EOF && len(headerData) > 0 {
+			err = &ErrTruncatedEvent{EventPosition: pos, Expected: eventHeaderLength, Actual: int64(len(headerData))}
+		}
 		return nil, err
 	}
 
 	// decode binlog event header
 	event.Header, err = decodeEventHeader(headerData, eventHeaderLength)
 	if err != nil {
-		return nil, err
+		return nil, &ErrInvalidHeader{EventPosition: pos, Reason: err.Error()}
 	}
 
 	if _, ok := EventType2Str[event.Header.EventType]; !ok {
-		return nil, fmt.Errorf("got unknown event type {%x}", event.Header.EventType)
+		return nil, &ErrInvalidHeader{EventPosition: pos, Reason: fmt.Sprintf("unknown event type %#x", event.Header.EventType)}
+	}
+	pos.EventType = event.Header.EventType
+
+	if event.Header.EventSize < eventHeaderLength {
+		return nil, &ErrInvalidHeader{EventPosition: pos, Reason: fmt.Sprintf("event size %d less than header length %d",
+			event.Header.EventSize, eventHeaderLength)}
+	}
+
+	// events are described by the FORMAT_DESCRIPTION_EVENT at the beginning of binary log
+	if decoder.description == nil && event.Header.EventType != FormatDescriptionEvent &&
+		(decoder.relay == nil || decoder.relay.description == nil) {
+		return nil, &ErrInvalidHeader{EventPosition: pos, Reason: "FORMAT_DESCRIPTION_EVENT should be decoded first"}
 	}
 
 	readDataLength := event.Header.EventSize - eventHeaderLength
@@ -160,17 +330,42 @@ func (decoder *BinFileDecoder) DecodeEvent() (*BinEvent, error) {
 	var data []byte
 	data, err = ReadNBytes(rd, readDataLength)
 	if err != nil {
+		if err == io.EOF {
+			err = &ErrTruncatedEvent{EventPosition: pos, Expected: event.Header.EventSize, Actual: eventHeaderLength + int64(len(data))}
+		}
 		return nil, err
 	}
 
-	// skip data if not start
-	if event.Header.EventType != FormatDescriptionEvent && !decoder.Option.Start(event.Header) {
-		return nil, err
+	offset := decoder.offset
+	decoder.offset += event.Header.EventSize
+
+	// relay log events are described by the FORMAT_DESCRIPTION_EVENT of replica or source
+	if decoder.relay != nil && decoder.relay.description != nil {
+		decoder.description = decoder.relay.format(event.Header)
+	}
+
+	// skip data if not start, TABLE_MAP_EVENT is kept for the rows events after start,
+	// ROTATE_EVENT of relay log is decoded for the source coordinates
+	isStart := decoder.Option.Start(event.Header)
+	typ := event.Header.EventType
+	if !isStart && typ != FormatDescriptionEvent && typ != TableMapEvent && (typ != RotateEvent || decoder.relay == nil) {
+		if decoder.relay != nil {
+			decoder.relay.update(decoder, event, offset)
+		}
+		return nil, nil
 	}
 
 	data, err = event.Validation(decoder.BinaryLogInfo, headerData, data)
 	if err != nil {
-		return event, err
+		return event, withPosition(err, pos)
+	}
+	event.data = data
+
+	// rows events filtered out are skipped before decoding rows
+	if decoder.Filter != nil && isRowsEvent(event.Header.EventType) {
+		if keep, err := decoder.filterRows(event.Header, data); !keep || err != nil {
+			return nil, err
+		}
 	}
 
 	// decode binlog event body
@@ -193,55 +388,131 @@ func (decoder *BinFileDecoder) DecodeEvent() (*BinEvent, error) {
 		// INTVAR_EVENT
 		eventBody, err = decodeIntvarEvent(data)
 
+	case RandEvent:
+		// RAND_EVENT
+		eventBody, err = decodeRandEvent(data)
+
+	case UserVarEvent:
+		// USER_VAR_EVENT
+		eventBody, err = decodeUserVarEvent(data)
+
 	case RotateEvent:
 		// ROTATE_EVENT
 		eventBody, err = decodeRotateEvent(data, decoder.description.BinlogVersion)
 
 	case TableMapEvent:
 		// TABLE_MAP_EVENT
-		eventBody, err = decodeTableMapEvent(data, decoder.description)
-		decoder.tableInfo[eventBody.(*BinTableMapEvent).TableID] = eventBody.(*BinTableMapEvent)
+		var table *BinTableMapEvent
+		if table, err = decodeTableMapEvent(data, decoder.description); err != nil {
+			break
+		}
+		// schema mismatch is not an error of decoding
+		if decoder.Schema != nil {
+			if err := decoder.fillSchema(table, event.Header.LogPos-event.Header.EventSize); err != nil {
+				return nil, err
+			}
+		}
+		decoder.tableInfo[table.TableID] = table
+		eventBody = table
 
 	case WriteRowsEventV0, UpdateRowsEventV0, DeleteRowsEventV0,
 		WriteRowsEventV1, UpdateRowsEventV1, DeleteRowsEventV1,
 		WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2:
 		// ROWS_EVENT
-		eventBody, err = decodeRowsEvent(data, decoder.description, event.Header.EventType)
+		eventBody, err = decodeRowsEvent(data, decoder.description, event.Header.EventType, decoder.tableInfo)
 
-	case PreviousGTIDEvent, AnonymousGTIDEvent:
-		// decode ignore event.
-		// TODO: decode AnonymousGTIDEvent
-		eventBody, err = decodeUnSupportEvent(data)
+	case GTIDEvent, AnonymousGTIDEvent:
+		// GTID_EVENT && ANONYMOUS_GTID_EVENT
+		eventBody, err = decodeGTIDEvent(data)
+
+	case XAPrepareLogEvent:
+		// XA_PREPARE_LOG_EVENT
+		eventBody, err = decodeXAPrepareEvent(data)
+
+	case RowsQueryEvent:
+		// ROWS_QUERY_EVENT
+		eventBody, err = decodeRowsQueryEvent(data)
+
+	case PreviousGTIDEvent:
+		// PREVIOUS_GTIDS_EVENT
+		eventBody, err = decodePreGTIDsEvent(data)
 
 	case UnknownEvent:
-		return nil, fmt.Errorf("got unknown event")
+		return nil, &ErrInvalidHeader{EventPosition: pos, Reason: "unknown event type 0"}
 
 	default:
-		// TODO more decoders for more events
-		err = errors.New("not support event: " + event.Header.Type())
+		// events without decoder are kept as they are
+		if decoder.Strict {
+			return nil, &ErrUnsupportedEvent{EventPosition: pos}
+		}
+		eventBody, err = decodeUnSupportEvent(data)
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, withPosition(err, pos)
 	}
 
 	// set event body
 	event.Body = eventBody
 
+	// set relay log position, events filtered out or masked are counted in the source coordinates
+	if decoder.relay != nil {
+		event.Relay = decoder.relay.update(decoder, event, offset)
+	}
+
+	// TABLE_MAP_EVENT and ROTATE_EVENT before start
+	if !isStart && event.Header.EventType != FormatDescriptionEvent {
+		return nil, nil
+	}
+
+	if decoder.Filter != nil {
+		if keep, err := decoder.filterEvent(event.Header, eventBody); !keep || err != nil {
+			return nil, err
+		}
+	}
+
+	// mask columns of table maps and row changes, statement-based DML is dropped
+	if decoder.Masker != nil {
+		if keep, err := decoder.Masker.mask(event); !keep || err != nil {
+			return nil, err
+		}
+	}
+
 	return event, nil
 }
 
 // WalkEvent will walk all events for binary log which in io.Reader
 // This function will return isFinish bool and err error.
+// If there are binary logs linked after, such as relay logs in relay-log.index, they will be walked in order.
 func (decoder *BinFileDecoder) WalkEvent(f func(event *BinEvent) (isContinue bool, err error)) error {
+	current := decoder
+	for {
+		isFinish, err := current.walkEvent(f)
+		if isFinish || err != nil || current.next == nil {
+			return err
+		}
+
+		// the first binary log file is kept open for the caller
+		if current != decoder {
+			current.BinFile.Close()
+		}
+
+		if current, err = current.openNext(); err != nil {
+			return err
+		}
+	}
+}
+
+// walkEvent walk events of current binary log file, isFinish is false if it reaches the end of file
+func (decoder *BinFileDecoder) walkEvent(f func(event *BinEvent) (isContinue bool, err error)) (isFinish bool, err error) {
 	for {
 		// if rd is nil, BinFileDecoder.DecodeEvent() will set rd to BinFileDecoder.BinFile
 		event, err := decoder.DecodeEvent()
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				return false, nil
 			}
-			return err
+			return true, err
 		}
 
 		// will receive a nil event if decoding not start yet
@@ -251,12 +522,12 @@ func (decoder *BinFileDecoder) WalkEvent(f func(event *BinEvent) (isContinue boo
 
 		// if stop decoding
 		if decoder.Option.Stop(event.Header) {
-			return nil
+			return true, nil
 		}
 
 		isContinue, err := f(event)
 		if !isContinue || err != nil {
-			return err
+			return true, err
 		}
 	}
 }
@@ -0,0 +1,257 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// encryptedFileHeader : An encrypted binlog file starts with [ fd 'bin' ]
+// https://dev.mysql.com/doc/refman/8.0/en/replication-binlog-encryption-encryption-keys.html
+var encryptedFileHeader = []byte{253, 98, 105, 110}
+
+// encryption header of binlog_encryption, which is followed by the AES-CTR encrypted binary log
+const (
+	encryptionHeaderSize     = 512
+	encryptionHeaderVersion1 = 1
+
+	// fields of encryption header v1
+	encryptionFieldKeyID             = 1
+	encryptionFieldEncryptedPassword = 2
+	encryptionFieldIV                = 3
+
+	encryptionPasswordLength = 32
+	encryptionIVLength       = 16
+)
+
+// KeyProvider provides the replication master keys which encrypt the password of binary log files
+type KeyProvider interface {
+	// Key return the key of key id such as 'MySQLReplicationKey_{server_uuid}_{seq_no}'
+	Key(keyID string) ([]byte, error)
+}
+
+// binEncryptionHeader is the header of an encrypted binary log file
+type binEncryptionHeader struct {
+	Version           int
+	KeyID             string
+	EncryptedPassword []byte
+	IV                []byte
+}
+
+func decodeEncryptionHeader(data []byte) (*binEncryptionHeader, error) {
+	if len(data) != encryptionHeaderSize || !bytes.Equal(data[:4], encryptedFileHeader) {
+		return nil, fmt.Errorf("invalid encrypted binary log header")
+	}
+
+	header := &binEncryptionHeader{Version: int(data[4])}
+	if header.Version != encryptionHeaderVersion1 {
+		return nil, fmt.Errorf("not support binary log encryption version %d", header.Version)
+	}
+
+	for pos := 5; pos < len(data) && data[pos] != 0; {
+		field := data[pos]
+		pos++
+
+		var n int
+		switch field {
+		case encryptionFieldKeyID:
+			n = int(data[pos])
+			pos++
+		case encryptionFieldEncryptedPassword:
+			n = encryptionPasswordLength
+		case encryptionFieldIV:
+			n = encryptionIVLength
+		default:
+			return nil, fmt.Errorf("unknown binary log encryption header field %d", field)
+		}
+
+		if pos+n > len(data) {
+			return nil, fmt.Errorf("invalid encrypted binary log header")
+		}
+		value := data[pos : pos+n]
+		pos += n
+
+		switch field {
+		case encryptionFieldKeyID:
+			header.KeyID = string(value)
+		case encryptionFieldEncryptedPassword:
+			header.EncryptedPassword = value
+		case encryptionFieldIV:
+			header.IV = value
+		}
+	}
+
+	if header.KeyID == "" || header.EncryptedPassword == nil || header.IV == nil {
+		return nil, fmt.Errorf("incomplete encrypted binary log header")
+	}
+
+	return header, nil
+}
+
+// decrypter return the stream to decrypt binary log content after header.
+// The file password is encrypted by the replication master key with AES-256-CBC,
+// and the AES-256-CTR key and iv of file content are derived from SHA-512 of the file password.
+func (header *binEncryptionHeader) decrypter(keys KeyProvider) (cipher.Stream, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("binary log is encrypted, key provider needed")
+	}
+
+	masterKey, err := keys.Key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	password := make([]byte, encryptionPasswordLength)
+	cipher.NewCBCDecrypter(block, header.IV).CryptBlocks(password, header.EncryptedPassword)
+
+	keyIV := sha512.Sum512(password)
+	block, err = aes.NewCipher(keyIV[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewCTR(block, keyIV[32:32+aes.BlockSize]), nil
+}
+
+// openEncrypted read the encryption header of binary log,
+// then the decoder will read the decrypted binary log.
+func (decoder *BinFileDecoder) openEncrypted(magic []byte) error {
+	data := make([]byte, encryptionHeaderSize)
+	copy(data, magic)
+	if _, err := io.ReadFull(decoder.BinFile, data[len(magic):]); err != nil {
+		return err
+	}
+
+	header, err := decodeEncryptionHeader(data)
+	if err != nil {
+		return err
+	}
+
+	stream, err := header.decrypter(decoder.Option.keyProvider())
+	if err != nil {
+		return err
+	}
+
+	decoder.buf = bufio.NewReader(&cipher.StreamReader{S: stream, R: decoder.BinFile})
+	decoder.encrypted = true
+	return nil
+}
+
+// keyringFileVersion is the header of keyring_file plugin data file
+const keyringFileVersion = "Keyring file version:2.0"
+
+// keyringFileEOF is the mark after all keys, followed by SHA-256 digest of the keys
+const keyringFileEOF = "EOF"
+
+// keyringObfuscate is used by keyring_file plugin to obfuscate stored keys
+const keyringObfuscate = "*305=Ljt0*!@$Hnm(*-9-w;:"
+
+// KeyringFile is a KeyProvider which reads keys from the data file of MySQL keyring_file plugin
+// https://dev.mysql.com/doc/refman/8.0/en/keyring-file-plugin.html
+type KeyringFile struct {
+	Path string
+	keys map[string][]byte
+}
+
+// NewKeyringFile load all keys from keyring_file_data
+func NewKeyringFile(path string) (*KeyringFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := decodeKeyringFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyringFile{Path: path, keys: keys}, nil
+}
+
+// Key implement KeyProvider
+func (k *KeyringFile) Key(keyID string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in keyring %s", keyID, k.Path)
+	}
+	return key, nil
+}
+
+// decodeKeyringFile decode keyring file, every key is stored as
+// [pod_size][key_id_len][key_type_len][user_id_len][key_len][key_id][key_type][user_id][key] with 8 bytes aligned
+func decodeKeyringFile(data []byte) (map[string][]byte, error) {
+	digestLength := len(keyringFileEOF) + sha256.Size
+	if len(data) < len(keyringFileVersion)+digestLength || string(data[:len(keyringFileVersion)]) != keyringFileVersion {
+		return nil, fmt.Errorf("invalid keyring file")
+	}
+
+	body := data[:len(data)-digestLength]
+	if string(data[len(body):len(body)+len(keyringFileEOF)]) != keyringFileEOF {
+		return nil, fmt.Errorf("invalid keyring file, EOF mark not found")
+	}
+
+	// digest is computed from the keys only
+	if digest := sha256.Sum256(body[len(keyringFileVersion):]); !bytes.Equal(digest[:], data[len(data)-sha256.Size:]) {
+		return nil, fmt.Errorf("keyring file digest validation failed")
+	}
+
+	keys := make(map[string][]byte)
+	for pos := len(keyringFileVersion); pos < len(body); {
+		if pos+40 > len(body) {
+			return nil, fmt.Errorf("invalid keyring file, key at %d", pos)
+		}
+
+		podSize := int(binary.LittleEndian.Uint64(body[pos:]))
+		lengths := make([]int, 4)
+		for i := range lengths {
+			lengths[i] = int(binary.LittleEndian.Uint64(body[pos+8+i*8:]))
+		}
+
+		if podSize < 40 || pos+podSize > len(body) || 40+lengths[0]+lengths[1]+lengths[2]+lengths[3] > podSize {
+			return nil, fmt.Errorf("invalid keyring file, key at %d", pos)
+		}
+
+		field := pos + 40
+		keyID := string(body[field : field+lengths[0]])
+		field += lengths[0] + lengths[1] + lengths[2]
+
+		key := make([]byte, lengths[3])
+		copy(key, body[field:field+lengths[3]])
+		for i := range key {
+			key[i] ^= keyringObfuscate[i%len(keyringObfuscate)]
+		}
+
+		keys[keyID] = key
+		pos += podSize
+	}
+
+	return keys, nil
+}
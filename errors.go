@@ -0,0 +1,147 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EventPosition is the position of the event failed to decode, carried by the errors of decoder.
+// File and Offset are not set if the error is not returned by BinFileDecoder, such as BinEvent.Validation.
+type EventPosition struct {
+	// path of binary log
+	File string
+
+	// start offset of the event in binary log
+	Offset int64
+
+	// event type, UnknownEvent if the event header is not decoded
+	EventType uint8
+}
+
+// String return the position as "mysql-bin.000123:884211"
+func (p EventPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Offset)
+}
+
+// describe return the position and event type in error messages
+func (p EventPosition) describe() string {
+	s := ""
+	if p.File != "" || p.Offset != 0 {
+		s = " at " + p.String()
+	}
+	if p.EventType != UnknownEvent {
+		s += " (" + EventType2Str[p.EventType] + ")"
+	}
+	return s
+}
+
+// position return the position of typed errors
+func (p *EventPosition) position() *EventPosition {
+	return p
+}
+
+// positioned is the typed errors with EventPosition
+type positioned interface {
+	error
+	position() *EventPosition
+}
+
+// ErrChecksumMismatch is returned if the checksum of event is not the checksum computed
+type ErrChecksumMismatch struct {
+	EventPosition
+
+	// checksum algorithm of the event
+	ChecksumAlg byte
+
+	// Expected is the checksum at the end of event, Actual is the checksum computed from event data
+	Expected, Actual uint32
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("binlog checksum validation failed%s: expected %08x, actual %08x", e.describe(), e.Expected, e.Actual)
+}
+
+// ErrUnsupportedEvent is returned in strict mode if the event type is known but no decoder for it
+type ErrUnsupportedEvent struct {
+	EventPosition
+}
+
+func (e *ErrUnsupportedEvent) Error() string {
+	return fmt.Sprintf("not support event%s", e.describe())
+}
+
+// ErrTruncatedEvent is returned if the event is shorter than expected, such as the last event of a truncated binary log.
+// Expected and Actual are the bytes of the truncated part, which is the event or a field of event.
+type ErrTruncatedEvent struct {
+	EventPosition
+	Expected, Actual int64
+}
+
+func (e *ErrTruncatedEvent) Error() string {
+	return fmt.Sprintf("truncated event%s: need %d bytes, got %d", e.describe(), e.Expected, e.Actual)
+}
+
+// Unwrap return io.ErrUnexpectedEOF
+func (e *ErrTruncatedEvent) Unwrap() error {
+	return io.ErrUnexpectedEOF
+}
+
+// ErrInvalidHeader is returned if the binary log header or the event header is invalid
+type ErrInvalidHeader struct {
+	EventPosition
+
+	// what is invalid, such as "unknown event type 0xa5"
+	Reason string
+}
+
+func (e *ErrInvalidHeader) Error() string {
+	return fmt.Sprintf("invalid header%s: %s", e.describe(), e.Reason)
+}
+
+// ErrMalformedEvent is returned if the event body failed to decode, Err is the error of decoding
+type ErrMalformedEvent struct {
+	EventPosition
+	Err error
+}
+
+func (e *ErrMalformedEvent) Error() string {
+	return fmt.Sprintf("malformed event%s: %v", e.describe(), e.Err)
+}
+
+// Unwrap return the error of decoding
+func (e *ErrMalformedEvent) Unwrap() error {
+	return e.Err
+}
+
+// withPosition set the position of typed errors without position, other errors are wrapped by ErrMalformedEvent
+func withPosition(err error, pos EventPosition) error {
+	if err == nil {
+		return nil
+	}
+
+	var e positioned
+	if errors.As(err, &e) {
+		if p := e.position(); p.File == "" && p.Offset == 0 {
+			*p = pos
+		}
+		return err
+	}
+	return &ErrMalformedEvent{EventPosition: pos, Err: err}
+}
@@ -20,6 +20,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +38,12 @@ type BinEvent struct {
 	Body         BinEventBody
 	ChecksumType byte
 	ChecksumVal  []byte
+
+	// position in relay log, only set in relay log mode
+	Relay *RelayLogPosition
+
+	// event body without header and checksum
+	data []byte
 }
 
 // Validation event validity check
@@ -48,17 +57,44 @@ func (event *BinEvent) Validation(bin *BinaryLogInfo, header, body []byte) ([]by
 	}
 
 	if l := int64(len(body) + len(header)); l != event.Header.EventSize {
-		return body, fmt.Errorf("event size got %d need %d", l, event.Header.EventSize)
+		return body, &ErrTruncatedEvent{
+			EventPosition: EventPosition{EventType: event.Header.EventType},
+			Expected:      event.Header.EventSize,
+			Actual:        l,
+		}
+	}
+
+	// FORMAT_DESCRIPTION_EVENT describes its own checksum algorithm,
+	// the others follow the algorithm of the FORMAT_DESCRIPTION_EVENT before.
+	checksumType, hasChecksumVal := BinlogChecksumAlgOff, false
+	if event.Header.EventType == FormatDescriptionEvent {
+		checksumType, hasChecksumVal = fmtDescChecksumAlg(body)
+	} else if bin.description != nil {
+		checksumType = bin.description.ChecksumAlg
+		hasChecksumVal = checksumType == BinlogChecksumAlgCRC32
 	}
 
-	if bin.description != nil && bin.description.hasCheckSum {
-		index := len(body) - binlogChecksumLength - 1
-		event.ChecksumType = body[index]
-		event.ChecksumVal = body[index+1:]
-		body = body[:index+1]
+	if hasChecksumVal {
+		if len(body) < binlogChecksumLength {
+			return body, &ErrTruncatedEvent{
+				EventPosition: EventPosition{EventType: event.Header.EventType},
+				Expected:      int64(len(header) + binlogChecksumLength),
+				Actual:        event.Header.EventSize,
+			}
+		}
 
-		if !ChecksumValidate(event.ChecksumType, event.ChecksumVal, append(header, body...)) || len(event.ChecksumVal) != 4 {
-			return body, fmt.Errorf("binlog checksum validation failed")
+		index := len(body) - binlogChecksumLength
+		event.ChecksumType = checksumType
+		event.ChecksumVal = body[index:]
+		body = body[:index]
+
+		if data := append(header, body...); !ChecksumValidate(event.ChecksumType, event.ChecksumVal, data) {
+			return body, &ErrChecksumMismatch{
+				EventPosition: EventPosition{EventType: event.Header.EventType},
+				ChecksumAlg:   event.ChecksumType,
+				Expected:      binary.LittleEndian.Uint32(event.ChecksumVal),
+				Actual:        crc32.ChecksumIEEE(data),
+			}
 		}
 	}
 
@@ -113,8 +149,27 @@ func (header *BinEventHeader) String() string {
 	)
 }
 
+// encode the header as it's written in binary log, binlog version 4
+func (header *BinEventHeader) encode() []byte {
+	data := make([]byte, defaultEventHeaderSize)
+	binary.LittleEndian.PutUint32(data, uint32(header.Timestamp))
+	data[4] = header.EventType
+	binary.LittleEndian.PutUint32(data[5:], uint32(header.ServerID))
+	binary.LittleEndian.PutUint32(data[9:], uint32(header.EventSize))
+	binary.LittleEndian.PutUint32(data[13:], uint32(header.LogPos))
+	binary.LittleEndian.PutUint16(data[17:], header.Flag)
+	return data
+}
+
+// raw return the event as it's written in binary log, with header, body and checksum
+func (event *BinEvent) raw() []byte {
+	data := event.Header.encode()
+	data = append(data, event.data...)
+	return append(data, event.ChecksumVal...)
+}
+
 func decodeEventHeader(data []byte, size int64) (*BinEventHeader, error) {
-	if l := len(data); int64(l) < size {
+	if l := len(data); int64(l) < size || size < 13 {
 		return nil, fmt.Errorf("invalid event header size %d, should be %d", l, size)
 	}
 
@@ -138,7 +193,7 @@ func decodeEventHeader(data []byte, size int64) (*BinEventHeader, error) {
 	pos += 4
 
 	// version > 2
-	if size > 13 {
+	if size >= defaultEventHeaderSize {
 		// log_pos
 		eventHeader.LogPos = int64(binary.LittleEndian.Uint32(data[pos:]))
 		pos += 4
@@ -158,12 +213,26 @@ type BinFmtDescEvent struct {
 	CreateTime        int64
 	EventHeaderLength int64
 	EventTypeHeader   []byte
+	ChecksumAlg       byte
 
 	// cache the result of hasCheckSum()
 	hasCheckSum bool
 }
 
+// fmtDescChecksumAlg return the checksum algorithm of FORMAT_DESCRIPTION_EVENT body,
+// and if the body ends with checksum algorithm and checksum value (mysql >= 5.6.2).
+func fmtDescChecksumAlg(data []byte) (byte, bool) {
+	if len(data) < 2+50+1+binlogChecksumLength || !hasChecksum(string(bytes.Trim(data[2:52], "\x00"))) {
+		return BinlogChecksumAlgOff, false
+	}
+	return data[len(data)-binlogChecksumLength-1], true
+}
+
 func decodeFmtDescEvent(data []byte) (*BinFmtDescEvent, error) {
+	if len(data) < 2+50+4+1 {
+		return nil, fmt.Errorf("invalid FORMAT_DESCRIPTION_EVENT length %d", len(data))
+	}
+
 	var pos int
 	desc := &BinFmtDescEvent{}
 
@@ -172,7 +241,7 @@ func decodeFmtDescEvent(data []byte) (*BinFmtDescEvent, error) {
 	pos += 2
 
 	// mysql-server version
-	desc.MySQLVersion = string(bytes.Trim(data[pos:pos+50], string(0x00)))
+	desc.MySQLVersion = string(bytes.Trim(data[pos:pos+50], "\x00"))
 	desc.hasCheckSum = hasChecksum(desc.MySQLVersion)
 	pos += 50
 
@@ -183,9 +252,16 @@ func decodeFmtDescEvent(data []byte) (*BinFmtDescEvent, error) {
 	// event header length
 	desc.EventHeaderLength = int64(data[pos])
 	pos++
+	if desc.EventHeaderLength < 13 {
+		return nil, fmt.Errorf("invalid event header length %d", desc.EventHeaderLength)
+	}
 
-	// event type header lengths
+	// event type header lengths, followed by checksum algorithm since mysql 5.6.2
 	desc.EventTypeHeader = data[pos:]
+	if desc.hasCheckSum && len(desc.EventTypeHeader) > 0 {
+		desc.ChecksumAlg = data[len(data)-1]
+		desc.EventTypeHeader = data[pos : len(data)-1]
+	}
 
 	return desc, nil
 }
@@ -204,6 +280,15 @@ type BinQueryEvent struct {
 }
 
 func decodeQueryEvent(data []byte, binlogVersion int) (*BinQueryEvent, error) {
+	// slave_proxy_id, execution time, schema length, error-code and status-vars length
+	postHeaderLength := 4 + 4 + 1 + 2
+	if binlogVersion >= 4 {
+		postHeaderLength += 2
+	}
+	if len(data) < postHeaderLength {
+		return nil, fmt.Errorf("invalid QUERY_EVENT length %d", len(data))
+	}
+
 	var pos int
 	event := &BinQueryEvent{}
 
@@ -227,6 +312,9 @@ func decodeQueryEvent(data []byte, binlogVersion int) (*BinQueryEvent, error) {
 		// status-vars length
 		event.statusVarsLength = int(binary.LittleEndian.Uint16(data[pos:]))
 		pos += 2
+		if len(data) < pos+event.statusVarsLength {
+			return nil, fmt.Errorf("invalid QUERY_EVENT status-vars length %d", event.statusVarsLength)
+		}
 
 		// status-vars
 		event.StatusVars = data[pos : pos+event.statusVarsLength]
@@ -234,6 +322,9 @@ func decodeQueryEvent(data []byte, binlogVersion int) (*BinQueryEvent, error) {
 	}
 
 	// schema
+	if len(data) < pos+schemaLength+1 {
+		return nil, fmt.Errorf("invalid QUERY_EVENT schema length %d", schemaLength)
+	}
 	event.Schema = string(data[pos : pos+schemaLength])
 	pos += schemaLength
 
@@ -245,96 +336,191 @@ func decodeQueryEvent(data []byte, binlogVersion int) (*BinQueryEvent, error) {
 	return event, nil
 }
 
-// Statue will format status_vars of QUERY_EVENT
-// TODO decode QUERY_EVENT status_var
-func (event *BinQueryEvent) Statue() error {
-	fmt.Println(event.statusVarsLength)
-	for i := 0; i < event.statusVarsLength; {
-		// got status_vars key
-		k := event.StatusVars[i]
-		i++
-
-		// decode values
-		switch k {
-		case QFlags2Code:
-			v := event.StatusVars[i : i+4]
-			i += 4
-
-			// TODO
-			fmt.Println("QFlags2Code", v)
-		case QSQLModeCode:
-			v := event.StatusVars[i : i+8]
-			i += 8
-
-			// TODO
-			fmt.Println("QSQLModeCode", v)
+// QueryStatusVars is the status_vars of QUERY_EVENT, the session context of the statement.
+// Fields of status vars not written are zero.
+type QueryStatusVars struct {
+	Flags2  uint32
+	SQLMode uint64
+	Catalog string
+
+	// auto_increment_increment and auto_increment_offset
+	AutoIncrementIncrement uint16
+	AutoIncrementOffset    uint16
+
+	// character_set_client, collation_connection and collation_server
+	ClientCharset       uint16
+	CollationConnection uint16
+	CollationServer     uint16
+
+	TimeZone          string
+	LCTimeNames       uint16
+	CharsetDatabase   uint16
+	TableMapForUpdate uint64
+	MasterDataWritten uint32
+
+	// definer of stored routines, views and triggers
+	InvokerUser string
+	InvokerHost string
+
+	// databases updated by the statement, nil if there are too many to write
+	UpdatedDBNames []string
+
+	// fractional seconds of the statement start time
+	Microseconds uint32
+
+	// mysql 8.0
+	ExplicitDefaultsForTimestamp uint8
+	DDLLoggedWithXID             uint64
+	DefaultCollationForUTF8MB4   uint16
+	SQLRequirePrimaryKey         uint8
+	DefaultTableEncryption       uint8
+}
+
+// queryStatusVarLength is the lengths of QUERY_EVENT status vars of fixed length
+var queryStatusVarLength = map[byte]int{
+	QFlags2Code:                   4,
+	QSQLModeCode:                  8,
+	QAutoIncrement:                4,
+	QCharsetCode:                  6,
+	QLCTimeNamesCode:              2,
+	QCharsetDatabaseCode:          2,
+	QTableMapForUpdateCode:        8,
+	QMasterDataWrittenCode:        4,
+	QMicroseconds:                 3,
+	QExplicitDefaultsForTimestamp: 1,
+	QDDLLoggedWithXID:             8,
+	QDefaultCollationForUTF8MB4:   2,
+	QSQLRequirePrimaryKey:         1,
+	QDefaultTableEncryption:       1,
+	QHRNow:                        3,
+	QXID:                          8,
+}
+
+// Statue decode status_vars of QUERY_EVENT, ErrMalformedEvent is returned if they are truncated or unknown
+func (event *BinQueryEvent) Statue() (*QueryStatusVars, error) {
+	vars := &QueryStatusVars{}
+	data := event.StatusVars
+	malformed := func(key byte, format string, args ...interface{}) error {
+		name, ok := QStatusKey2Str[key]
+		if !ok {
+			name = fmt.Sprintf("%#x", key)
+		}
+		return &ErrMalformedEvent{
+			EventPosition: EventPosition{EventType: QueryEvent},
+			Err:           fmt.Errorf("status var %s: %s", name, fmt.Sprintf(format, args...)),
+		}
+	}
+
+	for pos := 0; pos < len(data); {
+		key := data[pos]
+		pos++
+
+		// status vars of fixed length
+		if n, ok := queryStatusVarLength[key]; ok {
+			if len(data) < pos+n {
+				return nil, malformed(key, "need %d bytes, got %d", n, len(data)-pos)
+			}
+			v := data[pos : pos+n]
+			pos += n
+
+			switch key {
+			case QFlags2Code:
+				vars.Flags2 = binary.LittleEndian.Uint32(v)
+			case QSQLModeCode:
+				vars.SQLMode = binary.LittleEndian.Uint64(v)
+			case QAutoIncrement:
+				vars.AutoIncrementIncrement = binary.LittleEndian.Uint16(v)
+				vars.AutoIncrementOffset = binary.LittleEndian.Uint16(v[2:])
+			case QCharsetCode:
+				vars.ClientCharset = binary.LittleEndian.Uint16(v)
+				vars.CollationConnection = binary.LittleEndian.Uint16(v[2:])
+				vars.CollationServer = binary.LittleEndian.Uint16(v[4:])
+			case QLCTimeNamesCode:
+				vars.LCTimeNames = binary.LittleEndian.Uint16(v)
+			case QCharsetDatabaseCode:
+				vars.CharsetDatabase = binary.LittleEndian.Uint16(v)
+			case QTableMapForUpdateCode:
+				vars.TableMapForUpdate = binary.LittleEndian.Uint64(v)
+			case QMasterDataWrittenCode:
+				vars.MasterDataWritten = binary.LittleEndian.Uint32(v)
+			case QMicroseconds:
+				vars.Microseconds = uint32(FixedLengthInt(v))
+			case QExplicitDefaultsForTimestamp:
+				vars.ExplicitDefaultsForTimestamp = v[0]
+			case QDDLLoggedWithXID:
+				vars.DDLLoggedWithXID = binary.LittleEndian.Uint64(v)
+			case QDefaultCollationForUTF8MB4:
+				vars.DefaultCollationForUTF8MB4 = binary.LittleEndian.Uint16(v)
+			case QSQLRequirePrimaryKey:
+				vars.SQLRequirePrimaryKey = v[0]
+			case QDefaultTableEncryption:
+				vars.DefaultTableEncryption = v[0]
+			}
+			continue
+		}
+
+		// status vars of length-prefixed strings
+		str := func() (string, error) {
+			if pos >= len(data) || len(data) < pos+1+int(data[pos]) {
+				return "", malformed(key, "truncated string at %d", pos)
+			}
+			s := string(data[pos+1 : pos+1+int(data[pos])])
+			pos += 1 + int(data[pos])
+			return s, nil
+		}
+
+		var err error
+		switch key {
 		case QCatalog:
-			n := int(event.StatusVars[i])
-			v := string(event.StatusVars[i+1 : i+1+n])
-			i += 1 + n + 1
-
-			// TODO
-			fmt.Println("QCatalog", v)
-		case QAutoIncrement:
-			increment := binary.LittleEndian.Uint32(event.StatusVars[i:])
-			offset := binary.LittleEndian.Uint32(event.StatusVars[i+2:])
-
-			// TODO
-			fmt.Printf("QAutoIncrement %d, %d\n", increment, offset)
-		case QCharsetCode:
-			clientCharSet := event.StatusVars[i : i+2]
-			i += 2
-			collationConnection := event.StatusVars[i : i+2]
-			i += 2
-			collationServer := event.StatusVars[i : i+2]
-			i += 2
-
-			// TODO
-			fmt.Println("QCharsetCode", clientCharSet, collationConnection, collationServer)
+			// [length][catalog]0x00 of mysql 5.0
+			if vars.Catalog, err = str(); err == nil {
+				if pos >= len(data) {
+					return nil, malformed(key, "missing terminating 0x00")
+				}
+				pos++
+			}
+
 		case QTimeZoneCode:
-			n := int(event.StatusVars[i])
-			v := string(event.StatusVars[i+1 : i+1+n])
-			i += 1 + n
+			vars.TimeZone, err = str()
 
-			// TODO
-			fmt.Println("QTimeZoneCode", v)
 		case QCatalogNZCode:
-			n := int(event.StatusVars[i])
-			v := string(event.StatusVars[i+1 : i+1+n])
-			i += 1 + n
-
-			// TODO
-			fmt.Printf("QCatalogNZCode %s\n", v)
-		case QLCTimeNamesCode:
-			// TODO
-			fmt.Println("QLCTimeNamesCode")
-		case QCharsetDatabaseCode:
-			// TODO
-			fmt.Println("QCharsetDatabaseCode")
-		case QTableMapForUpdateCode:
-			// TODO
-			fmt.Println("QTableMapForUpdateCode")
-		case QMasterDataWrittenCode:
-			// TODO
-			fmt.Println("QMasterDataWrittenCode")
+			vars.Catalog, err = str()
+
 		case QInvokers:
-			// TODO
-			fmt.Println("QInvokers")
+			if vars.InvokerUser, err = str(); err == nil {
+				vars.InvokerHost, err = str()
+			}
+
 		case QUpdatedDBNames:
-			// TODO
-			fmt.Println("QUpdatedDBNames")
-		case QMicroseconds:
-			microseconds := binary.LittleEndian.Uint32(event.StatusVars[i:])
-			i += 3
-
-			// TODO
-			fmt.Printf("QMicroseconds %d\n", microseconds)
+			// [count]([name]0x00)*, count 254 means too many databases and no names
+			if pos >= len(data) {
+				return nil, malformed(key, "missing count")
+			}
+			count := int(data[pos])
+			pos++
+			if count == 254 {
+				break
+			}
+			vars.UpdatedDBNames = make([]string, 0, count)
+			for i := 0; i < count; i++ {
+				end := bytes.IndexByte(data[pos:], 0x00)
+				if end < 0 {
+					return nil, malformed(key, "database name %d is not terminated", i)
+				}
+				vars.UpdatedDBNames = append(vars.UpdatedDBNames, string(data[pos:pos+end]))
+				pos += end + 1
+			}
+
 		default:
-			return fmt.Errorf("unknown status var %x", k)
+			// the length of unknown status var is unknown, the rest can't be decoded
+			return nil, malformed(key, "unknown status var at %d", pos-1)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return vars, nil
 }
 
 // BinXIDEvent is the definition of XID_EVENT
@@ -346,28 +532,139 @@ type BinXIDEvent struct {
 }
 
 func decodeXIDEvent(data []byte) (*BinXIDEvent, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("invalid XID_EVENT length %d", len(data))
+	}
 	return &BinXIDEvent{
 		XID: binary.LittleEndian.Uint64(data),
 	}, nil
 }
 
 // BinIntvarEvent is the definition of INTVAR_EVENT
-// https://dev.mysql.com/doc/internals/en/xid-event.html
-// Transaction ID for 2PC, written whenever a COMMIT is expected.
+// https://dev.mysql.com/doc/internals/en/intvar-event.html
+// The value of LAST_INSERT_ID() or the next auto increment value for the next statement.
 type BinIntvarEvent struct {
 	BaseEventBody
-	Type  uint8
+	Type  uint8 // IntvarLastInsertID or IntvarInsertID
 	Value uint64
 }
 
 func decodeIntvarEvent(data []byte) (*BinIntvarEvent, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("invalid INTVAR_EVENT length %d", len(data))
+	}
 	return &BinIntvarEvent{
 		Type:  data[0],
 		Value: binary.LittleEndian.Uint64(data[1:]),
 	}, nil
 }
 
-// TODO: BinIntvarEvent.Type format
+// BinRandEvent is the definition of RAND_EVENT
+// https://dev.mysql.com/doc/internals/en/rand-event.html
+// The seeds of RAND() for the next statement.
+type BinRandEvent struct {
+	BaseEventBody
+	Seed1 uint64
+	Seed2 uint64
+}
+
+func decodeRandEvent(data []byte) (*BinRandEvent, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("invalid RAND_EVENT length %d", len(data))
+	}
+	return &BinRandEvent{
+		Seed1: binary.LittleEndian.Uint64(data),
+		Seed2: binary.LittleEndian.Uint64(data[8:]),
+	}, nil
+}
+
+// BinUserVarEvent is the definition of USER_VAR_EVENT
+// https://dev.mysql.com/doc/internals/en/user-var-event.html
+// The value of a user variable used by the next statement.
+type BinUserVarEvent struct {
+	BaseEventBody
+	Name    string
+	IsNull  bool
+	Type    uint8  // UserVarStringResult, UserVarRealResult, UserVarIntResult or UserVarDecimalResult
+	Charset uint32 // collation id of string value
+	Value   []byte
+	Flags   uint8
+}
+
+func decodeUserVarEvent(data []byte) (*BinUserVarEvent, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid USER_VAR_EVENT length %d", len(data))
+	}
+	nameLength := uint64(binary.LittleEndian.Uint32(data))
+	if uint64(len(data)) < 4+nameLength+1 {
+		return nil, fmt.Errorf("invalid USER_VAR_EVENT length %d, name length %d", len(data), nameLength)
+	}
+	pos := 4 + int(nameLength)
+	event := &BinUserVarEvent{Name: string(data[4:pos]), IsNull: data[pos] != 0}
+	pos++
+	if event.IsNull {
+		return event, nil
+	}
+
+	if len(data) < pos+9 {
+		return nil, fmt.Errorf("invalid USER_VAR_EVENT length %d", len(data))
+	}
+	event.Type = data[pos]
+	event.Charset = binary.LittleEndian.Uint32(data[pos+1:])
+	valueLength := uint64(binary.LittleEndian.Uint32(data[pos+5:]))
+	pos += 9
+	if uint64(len(data)-pos) < valueLength {
+		return nil, fmt.Errorf("invalid USER_VAR_EVENT length %d, value length %d", len(data), valueLength)
+	}
+	event.Value = data[pos : pos+int(valueLength)]
+	pos += int(valueLength)
+
+	// flags are written since mysql 5.6
+	if pos < len(data) {
+		event.Flags = data[pos]
+	}
+	return event, nil
+}
+
+// SQLValue return the value of user variable as SQL literal
+func (event *BinUserVarEvent) SQLValue() (string, error) {
+	if event.IsNull {
+		return "NULL", nil
+	}
+
+	switch event.Type {
+	case UserVarStringResult:
+		return quoteCharsetString(string(event.Value), collationCharset(uint64(event.Charset))), nil
+
+	case UserVarRealResult:
+		if len(event.Value) < 8 {
+			return "", fmt.Errorf("invalid REAL user variable length %d", len(event.Value))
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(event.Value))
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+
+	case UserVarIntResult:
+		if len(event.Value) < 8 {
+			return "", fmt.Errorf("invalid INT user variable length %d", len(event.Value))
+		}
+		value := binary.LittleEndian.Uint64(event.Value)
+		if event.Flags&UserVarUnsignedF != 0 {
+			return strconv.FormatUint(value, 10), nil
+		}
+		return strconv.FormatInt(int64(value), 10), nil
+
+	case UserVarDecimalResult:
+		if len(event.Value) < 2 {
+			return "", fmt.Errorf("invalid DECIMAL user variable length %d", len(event.Value))
+		}
+		value, _, err := decodeDecimal(event.Value[2:], int(event.Value[0]), int(event.Value[1]))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(value), nil
+	}
+	return "", fmt.Errorf("unknown user variable type %d", event.Type)
+}
 
 // BinRotateEvent is the definition of ROTATE_EVENT
 // https://dev.mysql.com/doc/internals/en/rotate-event.html
@@ -382,6 +679,9 @@ func decodeRotateEvent(data []byte, binlogVersion int) (*BinRotateEvent, error)
 	event := &BinRotateEvent{}
 	var pos int
 	if binlogVersion > 1 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("invalid ROTATE_EVENT length %d", len(data))
+		}
 		event.Position = binary.LittleEndian.Uint64(data)
 		pos += 8
 	}
@@ -391,5 +691,226 @@ func decodeRotateEvent(data []byte, binlogVersion int) (*BinRotateEvent, error)
 }
 
 // BinPreGTIDsEvent is the definition of PREVIOUS_GTIDS_EVENT
-// TODO: PREVIOUS_GTIDS_EVENT
-type BinPreGTIDsEvent struct{ BaseEventBody }
+type BinPreGTIDsEvent struct {
+	BaseEventBody
+	GTIDs GTIDSet
+}
+
+// decodePreGTIDsEvent decode PREVIOUS_GTIDS_EVENT, intervals are [start, end) in binary log
+func decodePreGTIDsEvent(data []byte) (*BinPreGTIDsEvent, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("invalid PREVIOUS_GTIDS_EVENT length %d", len(data))
+	}
+
+	event := &BinPreGTIDsEvent{GTIDs: GTIDSet{}}
+	count := binary.LittleEndian.Uint64(data)
+	pos := 8
+	for i := uint64(0); i < count; i++ {
+		if len(data) < pos+gtidSIDLength+8 {
+			return nil, fmt.Errorf("invalid PREVIOUS_GTIDS_EVENT length %d", len(data))
+		}
+		uuid := (&BinGTIDEvent{SID: data[pos : pos+gtidSIDLength]}).UUID()
+		pos += gtidSIDLength
+		n := binary.LittleEndian.Uint64(data[pos:])
+		pos += 8
+
+		if uint64(len(data)-pos)/16 < n {
+			return nil, fmt.Errorf("invalid PREVIOUS_GTIDS_EVENT length %d", len(data))
+		}
+		for j := uint64(0); j < n; j++ {
+			start := int64(binary.LittleEndian.Uint64(data[pos:]))
+			end := int64(binary.LittleEndian.Uint64(data[pos+8:]))
+			pos += 16
+			if start < 1 || end <= start {
+				return nil, fmt.Errorf("invalid PREVIOUS_GTIDS_EVENT interval %d-%d", start, end)
+			}
+			event.GTIDs[uuid] = append(event.GTIDs[uuid], GTIDInterval{Start: start, End: end - 1})
+		}
+	}
+	return event, nil
+}
+
+// BinGTIDEvent is the definition of GTID_EVENT and ANONYMOUS_GTID_EVENT
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Gtid__event.html
+// Fields after GNO are only written by newer servers, they keep zero value if absent.
+type BinGTIDEvent struct {
+	BaseEventBody
+	CommitFlag uint8
+	SID        []byte
+	GNO        int64
+
+	// mysql 5.7, logical clock
+	LastCommitted  int64
+	SequenceNumber int64
+
+	// mysql 8.0, microseconds since epoch
+	ImmediateCommitTimestamp int64
+	OriginalCommitTimestamp  int64
+	TransactionLength        uint64
+	ImmediateServerVersion   uint32
+	OriginalServerVersion    uint32
+}
+
+// gtidSIDLength is the length of server uuid in GTID_EVENT
+const gtidSIDLength = 16
+
+// logicalTimestampTypeCode marks the beginning of last_committed and sequence_number
+const logicalTimestampTypeCode = 2
+
+func decodeGTIDEvent(data []byte) (*BinGTIDEvent, error) {
+	if len(data) < 1+gtidSIDLength+8 {
+		return nil, fmt.Errorf("invalid GTID_EVENT length %d", len(data))
+	}
+
+	var pos int
+	event := &BinGTIDEvent{}
+
+	// commit flag
+	event.CommitFlag = data[pos]
+	pos++
+
+	// SID, server uuid
+	event.SID = data[pos : pos+gtidSIDLength]
+	pos += gtidSIDLength
+
+	// GNO, transaction number
+	event.GNO = int64(binary.LittleEndian.Uint64(data[pos:]))
+	pos += 8
+
+	// logical clock, mysql >= 5.7.6
+	if len(data) < pos+17 || data[pos] != logicalTimestampTypeCode {
+		return event, nil
+	}
+	pos++
+	event.LastCommitted = int64(binary.LittleEndian.Uint64(data[pos:]))
+	pos += 8
+	event.SequenceNumber = int64(binary.LittleEndian.Uint64(data[pos:]))
+	pos += 8
+
+	// commit timestamps, mysql >= 8.0.1
+	// the highest bit of immediate_commit_timestamp tells if original_commit_timestamp is written
+	if len(data) < pos+7 {
+		return event, nil
+	}
+	event.ImmediateCommitTimestamp = int64(FixedLengthInt(data[pos : pos+7]))
+	pos += 7
+	event.OriginalCommitTimestamp = event.ImmediateCommitTimestamp
+	if event.ImmediateCommitTimestamp&(1<<55) != 0 {
+		event.ImmediateCommitTimestamp &^= 1 << 55
+		if len(data) < pos+7 {
+			return nil, fmt.Errorf("invalid GTID_EVENT length %d", len(data))
+		}
+		event.OriginalCommitTimestamp = int64(FixedLengthInt(data[pos : pos+7]))
+		pos += 7
+	}
+
+	// transaction length, mysql >= 8.0.2
+	if len(data) <= pos {
+		return event, nil
+	}
+	var n int
+	event.TransactionLength, _, n = LengthEncodedInt(data[pos:])
+	if pos += n; pos > len(data) {
+		return nil, fmt.Errorf("invalid GTID_EVENT length %d", len(data))
+	}
+
+	// server versions, mysql >= 8.0.14
+	// the highest bit of immediate_server_version tells if original_server_version is written
+	if len(data) < pos+4 {
+		return event, nil
+	}
+	event.ImmediateServerVersion = binary.LittleEndian.Uint32(data[pos:])
+	pos += 4
+	event.OriginalServerVersion = event.ImmediateServerVersion
+	if event.ImmediateServerVersion&(1<<31) != 0 {
+		event.ImmediateServerVersion &^= 1 << 31
+		if len(data) < pos+4 {
+			return nil, fmt.Errorf("invalid GTID_EVENT length %d", len(data))
+		}
+		event.OriginalServerVersion = binary.LittleEndian.Uint32(data[pos:])
+	}
+
+	return event, nil
+}
+
+// IsAnonymous return true if the event is an ANONYMOUS_GTID_EVENT
+func (event *BinGTIDEvent) IsAnonymous() bool {
+	for _, b := range event.SID {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// UUID will format SID as server uuid string
+func (event *BinGTIDEvent) UUID() string {
+	if len(event.SID) != gtidSIDLength {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		event.SID[0:4], event.SID[4:6], event.SID[6:8], event.SID[8:10], event.SID[10:16])
+}
+
+// GTID return the global transaction identifier as 'uuid:gno', empty if it's anonymous
+func (event *BinGTIDEvent) GTID() string {
+	if event.IsAnonymous() {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", event.UUID(), event.GNO)
+}
+
+// BinXAPrepareEvent is the definition of XA_PREPARE_LOG_EVENT
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classXA__prepare__log__event.html
+// It's written at XA PREPARE or XA COMMIT ... ONE PHASE, which ends the XA transaction in binary log.
+type BinXAPrepareEvent struct {
+	BaseEventBody
+	OnePhase bool
+	FormatID uint32
+	GTRID    []byte
+	BQUAL    []byte
+}
+
+func decodeXAPrepareEvent(data []byte) (*BinXAPrepareEvent, error) {
+	if len(data) < 13 {
+		return nil, fmt.Errorf("invalid XA_PREPARE_LOG_EVENT length %d", len(data))
+	}
+
+	event := &BinXAPrepareEvent{}
+	event.OnePhase = data[0] != 0
+	event.FormatID = binary.LittleEndian.Uint32(data[1:])
+	gtridLength := int(binary.LittleEndian.Uint32(data[5:]))
+	bqualLength := int(binary.LittleEndian.Uint32(data[9:]))
+
+	pos := 13
+	if len(data) < pos+gtridLength+bqualLength {
+		return nil, fmt.Errorf("invalid XA_PREPARE_LOG_EVENT length %d", len(data))
+	}
+	event.GTRID = data[pos : pos+gtridLength]
+	pos += gtridLength
+	event.BQUAL = data[pos : pos+bqualLength]
+
+	return event, nil
+}
+
+// XID will format XA transaction id as MySQL does, X'gtrid',X'bqual',formatID
+func (event *BinXAPrepareEvent) XID() string {
+	return fmt.Sprintf("X'%x',X'%x',%d", event.GTRID, event.BQUAL, event.FormatID)
+}
+
+// BinRowsQueryEvent is the definition of ROWS_QUERY_EVENT
+// https://dev.mysql.com/doc/internals/en/rows-query-event.html
+// The original statement written when binlog_rows_query_log_events is enabled.
+type BinRowsQueryEvent struct {
+	BaseEventBody
+	Query string
+}
+
+func decodeRowsQueryEvent(data []byte) (*BinRowsQueryEvent, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("invalid ROWS_QUERY_EVENT length %d", len(data))
+	}
+
+	// the first byte is the length of query, ignored as it's truncated to 255
+	return &BinRowsQueryEvent{Query: string(data[1:])}, nil
+}
@@ -0,0 +1,447 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultMySQLVersion is the server version of FORMAT_DESCRIPTION_EVENT encoded without version
+const defaultMySQLVersion = "5.7.44-log"
+
+// defaultEventTypeHeader is the post-header lengths of event types 1 to 38 written by mysql 5.7
+var defaultEventTypeHeader = []byte{
+	56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0,
+	0, 0, 8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0,
+}
+
+// NewFmtDescEvent return a FORMAT_DESCRIPTION_EVENT of mysql 5.7 for writing a binary log,
+// checksumAlg is BinlogChecksumAlgCRC32 or BinlogChecksumAlgOff
+func NewFmtDescEvent(checksumAlg byte) *BinFmtDescEvent {
+	return &BinFmtDescEvent{
+		BinlogVersion:     4,
+		MySQLVersion:      defaultMySQLVersion,
+		EventHeaderLength: defaultEventHeaderSize,
+		EventTypeHeader:   defaultEventTypeHeader,
+		ChecksumAlg:       checksumAlg,
+		hasCheckSum:       true,
+	}
+}
+
+// encodeEventBody encode the body of event type, description is the FORMAT_DESCRIPTION_EVENT before,
+// tables are the TABLE_MAP_EVENT written for rows events which are not decoded
+func encodeEventBody(typ uint8, body BinEventBody, description *BinFmtDescEvent, tables map[uint64]*BinTableMapEvent) ([]byte, error) {
+	if description == nil && typ != FormatDescriptionEvent {
+		return nil, fmt.Errorf("FORMAT_DESCRIPTION_EVENT should be written before %s", EventType2Str[typ])
+	}
+
+	switch body := body.(type) {
+	case *BinFmtDescEvent:
+		return encodeFmtDescEvent(body), nil
+	case *BinQueryEvent:
+		return encodeQueryEvent(body), nil
+	case *BinXIDEvent:
+		return appendFixedLengthInt(nil, body.XID, 8), nil
+	case *BinIntvarEvent:
+		return appendFixedLengthInt([]byte{body.Type}, body.Value, 8), nil
+	case *BinRandEvent:
+		return appendFixedLengthInt(appendFixedLengthInt(nil, body.Seed1, 8), body.Seed2, 8), nil
+	case *BinUserVarEvent:
+		return encodeUserVarEvent(body), nil
+	case *BinRotateEvent:
+		return append(appendFixedLengthInt(nil, body.Position, 8), body.FileName...), nil
+	case *BinGTIDEvent:
+		data := encodeGTIDEvent(body)
+		// GTID_EVENT of mysql 5.6 has no logical clock, its post-header is 25 bytes
+		if len(description.EventTypeHeader) >= int(typ) && description.EventTypeHeader[typ-1] < 42 {
+			data = data[:1+gtidSIDLength+8]
+		}
+		return data, nil
+	case *BinPreGTIDsEvent:
+		return encodePreGTIDsEvent(body)
+	case *BinXAPrepareEvent:
+		return encodeXAPrepareEvent(body), nil
+	case *BinRowsQueryEvent:
+		return encodeRowsQueryEvent(body), nil
+	case *BinTableMapEvent:
+		return encodeTableMapEvent(body, description), nil
+	case *BinRowsEvent:
+		table := body.Table
+		if table == nil {
+			table = tables[body.TableID]
+		}
+		return encodeRowsEvent(body, typ, description, table)
+	case *BinEventUnParsed:
+		return body.Data, nil
+	}
+	return nil, fmt.Errorf("encoding %s is not supported", EventType2Str[typ])
+}
+
+// encodeFmtDescEvent encode FORMAT_DESCRIPTION_EVENT, the checksum algorithm is written since mysql 5.6.2
+func encodeFmtDescEvent(desc *BinFmtDescEvent) []byte {
+	version := desc.MySQLVersion
+	if version == "" {
+		version = defaultMySQLVersion
+	}
+	headerLength := desc.EventHeaderLength
+	if headerLength == 0 {
+		headerLength = defaultEventHeaderSize
+	}
+	types := desc.EventTypeHeader
+	if len(types) == 0 {
+		types = defaultEventTypeHeader
+	}
+	binlogVersion := desc.BinlogVersion
+	if binlogVersion == 0 {
+		binlogVersion = 4
+	}
+
+	data := make([]byte, 2+50, 2+50+4+1+len(types)+1)
+	binary.LittleEndian.PutUint16(data, uint16(binlogVersion))
+	copy(data[2:52], version)
+	data = appendFixedLengthInt(data, uint64(desc.CreateTime), 4)
+	data = append(data, byte(headerLength))
+	data = append(data, types...)
+	if hasChecksum(version) {
+		data = append(data, desc.ChecksumAlg)
+	}
+	return data
+}
+
+// encodeQueryEvent encode QUERY_EVENT of binlog version 4
+func encodeQueryEvent(event *BinQueryEvent) []byte {
+	data := make([]byte, 0, 13+len(event.StatusVars)+len(event.Schema)+1+len(event.Query))
+	data = appendFixedLengthInt(data, uint64(event.SlaveProxyID), 4)
+	data = appendFixedLengthInt(data, uint64(event.ExecutionTime), 4)
+	data = append(data, byte(len(event.Schema)))
+	data = appendFixedLengthInt(data, uint64(event.ErrorCode), 2)
+	data = appendFixedLengthInt(data, uint64(len(event.StatusVars)), 2)
+	data = append(data, event.StatusVars...)
+	data = append(data, event.Schema...)
+	data = append(data, 0x00)
+	return append(data, event.Query...)
+}
+
+// encodeGTIDEvent encode GTID_EVENT or ANONYMOUS_GTID_EVENT with logical clock,
+// the fields of mysql 8.0 are written if they are set
+func encodeGTIDEvent(event *BinGTIDEvent) []byte {
+	sid := make([]byte, gtidSIDLength)
+	copy(sid, event.SID)
+
+	data := append([]byte{event.CommitFlag}, sid...)
+	data = appendFixedLengthInt(data, uint64(event.GNO), 8)
+	data = append(data, logicalTimestampTypeCode)
+	data = appendFixedLengthInt(data, uint64(event.LastCommitted), 8)
+	data = appendFixedLengthInt(data, uint64(event.SequenceNumber), 8)
+
+	if event.ImmediateCommitTimestamp == 0 && event.TransactionLength == 0 && event.ImmediateServerVersion == 0 {
+		return data
+	}
+
+	// the highest bit tells that the original one is different
+	if event.OriginalCommitTimestamp != 0 && event.OriginalCommitTimestamp != event.ImmediateCommitTimestamp {
+		data = appendFixedLengthInt(data, uint64(event.ImmediateCommitTimestamp)|1<<55, 7)
+		data = appendFixedLengthInt(data, uint64(event.OriginalCommitTimestamp), 7)
+	} else {
+		data = appendFixedLengthInt(data, uint64(event.ImmediateCommitTimestamp), 7)
+	}
+	data = appendLengthEncodedInt(data, event.TransactionLength)
+
+	if event.ImmediateServerVersion == 0 {
+		return data
+	}
+	if event.OriginalServerVersion != 0 && event.OriginalServerVersion != event.ImmediateServerVersion {
+		data = appendFixedLengthInt(data, uint64(event.ImmediateServerVersion|1<<31), 4)
+		return appendFixedLengthInt(data, uint64(event.OriginalServerVersion), 4)
+	}
+	return appendFixedLengthInt(data, uint64(event.ImmediateServerVersion), 4)
+}
+
+// encodePreGTIDsEvent encode PREVIOUS_GTIDS_EVENT,
+// [n_sids]([sid][n_intervals]([start][end))*)* with 8 bytes integers and end exclusive
+func encodePreGTIDsEvent(event *BinPreGTIDsEvent) ([]byte, error) {
+	// intervals are sorted and merged as gtid_executed
+	set, err := ParseGTIDSet(event.GTIDs.String())
+	if err != nil {
+		return nil, err
+	}
+
+	uuids := make([]string, 0, len(set))
+	for uuid := range set {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	data := appendFixedLengthInt(nil, uint64(len(uuids)), 8)
+	for _, uuid := range uuids {
+		sid, err := hex.DecodeString(strings.Replace(uuid, "-", "", -1))
+		if err != nil || len(sid) != gtidSIDLength {
+			return nil, fmt.Errorf("invalid server uuid %q", uuid)
+		}
+		data = append(data, sid...)
+		data = appendFixedLengthInt(data, uint64(len(set[uuid])), 8)
+		for _, interval := range set[uuid] {
+			data = appendFixedLengthInt(data, uint64(interval.Start), 8)
+			data = appendFixedLengthInt(data, uint64(interval.End+1), 8)
+		}
+	}
+	return data, nil
+}
+
+// encodeXAPrepareEvent encode XA_PREPARE_LOG_EVENT
+func encodeXAPrepareEvent(event *BinXAPrepareEvent) []byte {
+	var onePhase byte
+	if event.OnePhase {
+		onePhase = 1
+	}
+	data := []byte{onePhase}
+	data = appendFixedLengthInt(data, uint64(event.FormatID), 4)
+	data = appendFixedLengthInt(data, uint64(len(event.GTRID)), 4)
+	data = appendFixedLengthInt(data, uint64(len(event.BQUAL)), 4)
+	data = append(data, event.GTRID...)
+	return append(data, event.BQUAL...)
+}
+
+// encodeRowsQueryEvent encode ROWS_QUERY_EVENT, the length byte is truncated to 255 as server does
+func encodeRowsQueryEvent(event *BinRowsQueryEvent) []byte {
+	length := len(event.Query)
+	if length > 255 {
+		length = 255
+	}
+	return append([]byte{byte(length)}, event.Query...)
+}
+
+// encodeUserVarEvent encode USER_VAR_EVENT, the flags are written as mysql 5.6 and later
+func encodeUserVarEvent(event *BinUserVarEvent) []byte {
+	data := appendFixedLengthInt(nil, uint64(len(event.Name)), 4)
+	data = append(data, event.Name...)
+	if event.IsNull {
+		return append(data, 1)
+	}
+	data = append(data, 0, event.Type)
+	data = appendFixedLengthInt(data, uint64(event.Charset), 4)
+	data = appendFixedLengthInt(data, uint64(len(event.Value)), 4)
+	data = append(data, event.Value...)
+	return append(data, event.Flags)
+}
+
+// tableIDLength return the length of table id in event of type, 4 bytes for old servers
+func tableIDLength(description *BinFmtDescEvent, typ uint8) int {
+	if int(typ) <= len(description.EventTypeHeader) && description.EventTypeHeader[typ-1] == 6 {
+		return 4
+	}
+	return 6
+}
+
+// encodeTableMapEvent encode TABLE_MAP_EVENT, optional metadata is written for the fields set
+func encodeTableMapEvent(event *BinTableMapEvent, description *BinFmtDescEvent) []byte {
+	data := appendFixedLengthInt(nil, event.TableID, tableIDLength(description, TableMapEvent))
+	data = appendFixedLengthInt(data, uint64(event.Flags), 2)
+	data = append(data, byte(len(event.Schema)))
+	data = append(data, event.Schema...)
+	data = append(data, 0x00, byte(len(event.Table)))
+	data = append(data, event.Table...)
+	data = append(data, 0x00)
+	data = appendLengthEncodedInt(data, event.ColumnCount)
+	data = append(data, event.ColumnTypeDef...)
+
+	var meta []byte
+	for i, t := range event.ColumnTypeDef {
+		m := event.ColumnMetaDef[i]
+		switch t {
+		case MySQLTypeString, MySQLTypeNewDecimal:
+			meta = append(meta, byte(m>>8), byte(m))
+		case MySQLTypeVarString, MySQLTypeVarchar, MySQLTypeBit:
+			meta = appendFixedLengthInt(meta, uint64(m), 2)
+		case MySQLTypeBlob, MySQLTypeDouble, MySQLTypeFloat, MySQLTypeGeometry, MySQLTypeJSON,
+			MySQLTypeTime2, MySQLTypeDatetime2, MySQLTypeTimestamp2:
+			meta = append(meta, byte(m))
+		}
+	}
+	data = appendLengthEncodedString(data, string(meta))
+
+	nullBitmap := event.NullBitmap
+	if size := bitmapByteSize(int(event.ColumnCount)); len(nullBitmap) != size {
+		nullBitmap = make([]byte, size)
+	}
+	data = append(data, nullBitmap...)
+
+	return event.appendOptionalMeta(data)
+}
+
+// appendOptionalMeta append the optional metadata fields [type][length][value] of TABLE_MAP_EVENT
+func (e *BinTableMapEvent) appendOptionalMeta(data []byte) []byte {
+	field := func(typ byte, value []byte) {
+		data = append(data, typ)
+		data = appendLengthEncodedInt(data, uint64(len(value)))
+		data = append(data, value...)
+	}
+
+	if len(e.Signedness) > 0 {
+		field(tableMapSignedness, e.Signedness)
+	}
+
+	if len(e.ColumnCharset) == int(e.ColumnCount) {
+		var value []byte
+		for i, collation := range e.ColumnCharset {
+			if e.IsCharacterColumn(i) {
+				value = appendLengthEncodedInt(value, collation)
+			}
+		}
+		if len(value) > 0 {
+			field(tableMapColumnCharset, value)
+		}
+	}
+
+	if len(e.ColumnNames) > 0 {
+		var value []byte
+		for _, name := range e.ColumnNames {
+			value = appendLengthEncodedString(value, name)
+		}
+		field(tableMapColumnName, value)
+	}
+
+	typeValues := func(typ byte, values [][]string) []byte {
+		var value []byte
+		for i := range e.ColumnTypeDef {
+			if e.RealType(i) != typ || i >= len(values) {
+				continue
+			}
+			value = appendLengthEncodedInt(value, uint64(len(values[i])))
+			for _, v := range values[i] {
+				value = appendLengthEncodedString(value, v)
+			}
+		}
+		return value
+	}
+	if value := typeValues(MySQLTypeSet, e.SetValues); len(value) > 0 {
+		field(tableMapSetStrValue, value)
+	}
+	if value := typeValues(MySQLTypeEnum, e.EnumValues); len(value) > 0 {
+		field(tableMapEnumStrValue, value)
+	}
+
+	if len(e.PrimaryKey) > 0 {
+		var value []byte
+		for _, i := range e.PrimaryKey {
+			value = appendLengthEncodedInt(value, uint64(i))
+		}
+		field(tableMapSimplePrimaryKey, value)
+	}
+	return data
+}
+
+// encodeRowsEvent encode ROWS_EVENT of type from row values, table is the TABLE_MAP_EVENT of rows
+func encodeRowsEvent(event *BinRowsEvent, typ uint8, description *BinFmtDescEvent, table *BinTableMapEvent) ([]byte, error) {
+	if table == nil {
+		return nil, fmt.Errorf("TABLE_MAP_EVENT of table id %d is unknown for %s", event.TableID, EventType2Str[typ])
+	}
+
+	rows := &BinRowsEvent{Type: typ, Table: table, ColumnCount: table.ColumnCount}
+	if event.ColumnCount != 0 && event.ColumnCount != table.ColumnCount {
+		return nil, fmt.Errorf("column count %d of table %s.%s mismatch with rows event %d",
+			table.ColumnCount, table.Schema, table.Table, event.ColumnCount)
+	}
+
+	data := appendFixedLengthInt(nil, event.TableID, tableIDLength(description, typ))
+	data = appendFixedLengthInt(data, uint64(event.Flags), 2)
+	switch typ {
+	case WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2:
+		data = appendFixedLengthInt(data, uint64(2+len(event.ExtraData)), 2)
+		data = append(data, event.ExtraData...)
+	}
+	data = appendLengthEncodedInt(data, table.ColumnCount)
+
+	// all columns are present by default
+	size := bitmapByteSize(int(table.ColumnCount))
+	allColumns := make([]byte, size)
+	for i := 0; i < int(table.ColumnCount); i++ {
+		allColumns[i/8] |= 1 << uint(i%8)
+	}
+	rows.ColumnsBitmap1 = allColumns
+	if len(event.ColumnsBitmap1) == size {
+		rows.ColumnsBitmap1 = event.ColumnsBitmap1
+	}
+	data = append(data, rows.ColumnsBitmap1...)
+
+	isUpdate := typ == UpdateRowsEventV1 || typ == UpdateRowsEventV2
+	if isUpdate {
+		rows.ColumnsBitmap2 = allColumns
+		if len(event.ColumnsBitmap2) == size {
+			rows.ColumnsBitmap2 = event.ColumnsBitmap2
+		}
+		data = append(data, rows.ColumnsBitmap2...)
+	}
+
+	var err error
+	for _, row := range event.Rows {
+		switch rows.Action() {
+		case RowsActionInsert:
+			data, err = rows.appendImage(data, row.After, false)
+		case RowsActionDelete:
+			data, err = rows.appendImage(data, row.Before, false)
+		default:
+			if data, err = rows.appendImage(data, row.Before, false); err == nil {
+				data, err = rows.appendImage(data, row.After, true)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// appendImage append a row image, [null-bitmap][values of present and not null columns]
+func (e *BinRowsEvent) appendImage(data []byte, row []interface{}, isAfter bool) ([]byte, error) {
+	columnCount := int(e.ColumnCount)
+	if len(row) != columnCount {
+		return nil, fmt.Errorf("row of %s.%s has %d values, but table has %d columns",
+			e.Table.Schema, e.Table.Table, len(row), columnCount)
+	}
+
+	var present []int
+	for i := 0; i < columnCount; i++ {
+		if e.IsPresent(i, isAfter) {
+			present = append(present, i)
+		}
+	}
+
+	nullBitmap := make([]byte, bitmapByteSize(len(present)))
+	for bit, i := range present {
+		if row[i] == nil {
+			nullBitmap[bit/8] |= 1 << uint(bit%8)
+		}
+	}
+	data = append(data, nullBitmap...)
+
+	var err error
+	for _, i := range present {
+		if row[i] == nil {
+			continue
+		}
+		data, err = appendValue(data, row[i], e.Table.ColumnTypeDef[i], e.Table.ColumnMetaDef[i])
+		if err != nil {
+			return nil, fmt.Errorf("encode column %d of %s.%s failed: %v", i, e.Table.Schema, e.Table.Table, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// EventFilter chooses the events walked by decoder, an event is kept only if all the conditions set are satisfied.
+// Rows events are filtered before their rows are decoded.
+// Context events, FORMAT_DESCRIPTION_EVENT, ROTATE_EVENT, PREVIOUS_GTIDS_EVENT, TABLE_MAP_EVENT, GTID_EVENT,
+// XID_EVENT, XA_PREPARE_LOG_EVENT and transaction control statements such as BEGIN and COMMIT, are kept
+// for the integrity of transactions, unless the whole transaction is excluded by server id or GTID.
+type EventFilter struct {
+	// IncludeTables and ExcludeTables filter rows events by table, patterns are 'schema' or 'schema.table'
+	// with * and ? as path.Match, or regular expressions of 'schema.table' in slashes, such as '/^db[0-9]+\.t$/'.
+	// QUERY_EVENT is filtered by its default schema with the patterns which are not regular expressions.
+	IncludeTables []string
+	ExcludeTables []string
+
+	// IncludeEventTypes and ExcludeEventTypes filter the events other than context events
+	IncludeEventTypes []uint8
+	ExcludeEventTypes []uint8
+
+	// IncludeServerIDs and ExcludeServerIDs filter transactions by server id
+	IncludeServerIDs []int64
+	ExcludeServerIDs []int64
+
+	// IncludeGTIDs and ExcludeGTIDs filter transactions by GTID set, such as '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5'.
+	// Anonymous transactions are not in any GTID set.
+	IncludeGTIDs string
+	ExcludeGTIDs string
+
+	// Actions filter rows events by RowsActionInsert, RowsActionUpdate or RowsActionDelete
+	Actions []string
+
+	compiled     bool
+	include      []*tablePattern
+	exclude      []*tablePattern
+	includeGTIDs GTIDSet
+	excludeGTIDs GTIDSet
+}
+
+// tablePattern is a glob pattern of schema and table, or a regular expression of 'schema.table'
+type tablePattern struct {
+	schema string
+	table  string
+	re     *regexp.Regexp
+}
+
+// newTablePattern return the tablePattern of 'schema', 'schema.table' or '/regexp/'
+func newTablePattern(pattern string) (*tablePattern, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %v", pattern, err)
+		}
+		return &tablePattern{re: re}, nil
+	}
+
+	p := &tablePattern{schema: pattern, table: "*"}
+	if i := strings.IndexByte(pattern, '.'); i >= 0 {
+		p.schema, p.table = pattern[:i], pattern[i+1:]
+	}
+	if _, err := path.Match(p.schema, ""); err != nil {
+		return nil, fmt.Errorf("invalid table pattern %q", pattern)
+	}
+	if _, err := path.Match(p.table, ""); err != nil {
+		return nil, fmt.Errorf("invalid table pattern %q", pattern)
+	}
+	return p, nil
+}
+
+// match return true if the pattern matches the table
+func (p *tablePattern) match(schema, table string) bool {
+	if p.re != nil {
+		return p.re.MatchString(schema + "." + table)
+	}
+	ok, _ := path.Match(p.schema, schema)
+	if ok {
+		ok, _ = path.Match(p.table, table)
+	}
+	return ok
+}
+
+// compile the table patterns and GTID sets once
+func (f *EventFilter) compile() error {
+	if f.compiled {
+		return nil
+	}
+
+	for _, pattern := range f.IncludeTables {
+		p, err := newTablePattern(pattern)
+		if err != nil {
+			return err
+		}
+		f.include = append(f.include, p)
+	}
+	for _, pattern := range f.ExcludeTables {
+		p, err := newTablePattern(pattern)
+		if err != nil {
+			return err
+		}
+		f.exclude = append(f.exclude, p)
+	}
+
+	var err error
+	if f.IncludeGTIDs != "" {
+		if f.includeGTIDs, err = ParseGTIDSet(f.IncludeGTIDs); err != nil {
+			return err
+		}
+	}
+	if f.ExcludeGTIDs != "" {
+		if f.excludeGTIDs, err = ParseGTIDSet(f.ExcludeGTIDs); err != nil {
+			return err
+		}
+	}
+
+	f.compiled = true
+	return nil
+}
+
+// matchTable return true if the table is included and not excluded
+func (f *EventFilter) matchTable(schema, table string) bool {
+	if len(f.include) > 0 {
+		included := false
+		for _, p := range f.include {
+			if p.match(schema, table) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, p := range f.exclude {
+		if p.match(schema, table) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSchema return false if the default schema of QUERY_EVENT is not included, or all its tables are excluded
+func (f *EventFilter) matchSchema(schema string) bool {
+	if schema == "" {
+		return true
+	}
+
+	included := len(f.include) == 0
+	for _, p := range f.include {
+		if ok, _ := path.Match(p.schema, schema); ok || p.re != nil {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+
+	for _, p := range f.exclude {
+		if ok, _ := path.Match(p.schema, schema); ok && p.re == nil && p.table == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// matchEventType return true if the event type is included and not excluded
+func (f *EventFilter) matchEventType(eventType uint8) bool {
+	if len(f.IncludeEventTypes) > 0 && !containsEventType(f.IncludeEventTypes, eventType) {
+		return false
+	}
+	return !containsEventType(f.ExcludeEventTypes, eventType)
+}
+
+func containsEventType(types []uint8, eventType uint8) bool {
+	for _, t := range types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// matchServerID return true if the server id is included and not excluded
+func (f *EventFilter) matchServerID(serverID int64) bool {
+	if len(f.IncludeServerIDs) > 0 && !containsServerID(f.IncludeServerIDs, serverID) {
+		return false
+	}
+	return !containsServerID(f.ExcludeServerIDs, serverID)
+}
+
+func containsServerID(ids []int64, serverID int64) bool {
+	for _, id := range ids {
+		if id == serverID {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGTID return true if the GTID of transaction is included and not excluded
+func (f *EventFilter) matchGTID(event *BinGTIDEvent) bool {
+	isAnonymous := event.IsAnonymous()
+	if f.includeGTIDs != nil && (isAnonymous || !f.includeGTIDs.Contains(event.UUID(), event.GNO)) {
+		return false
+	}
+	return f.excludeGTIDs == nil || isAnonymous || !f.excludeGTIDs.Contains(event.UUID(), event.GNO)
+}
+
+// matchAction return true if the action of rows event is included
+func (f *EventFilter) matchAction(action string) bool {
+	if len(f.Actions) == 0 {
+		return true
+	}
+	for _, a := range f.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// isRowsEvent return true if the event type is ROWS_EVENT
+func isRowsEvent(eventType uint8) bool {
+	switch eventType {
+	case WriteRowsEventV0, UpdateRowsEventV0, DeleteRowsEventV0,
+		WriteRowsEventV1, UpdateRowsEventV1, DeleteRowsEventV1,
+		WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2:
+		return true
+	}
+	return false
+}
+
+// filterRows return false if the rows event is filtered out, it is checked before decoding rows
+func (decoder *BinFileDecoder) filterRows(header *BinEventHeader, data []byte) (bool, error) {
+	f := decoder.Filter
+	if err := f.compile(); err != nil {
+		return false, err
+	}
+
+	if decoder.skipTransaction || !f.matchServerID(header.ServerID) || !f.matchEventType(header.EventType) {
+		return false, nil
+	}
+
+	rows := (&BinRowsEvent{}).Init(decoder.description, header.EventType)
+	if !f.matchAction(rows.Action()) {
+		return false, nil
+	}
+
+	if len(data) < rows.tableIDLen {
+		return true, nil
+	}
+	table, ok := decoder.tableInfo[FixedLengthInt(data[:rows.tableIDLen])]
+	return !ok || f.matchTable(table.Schema, table.Table), nil
+}
+
+// filterEvent return false if the decoded event is filtered out
+func (decoder *BinFileDecoder) filterEvent(header *BinEventHeader, body BinEventBody) (bool, error) {
+	f := decoder.Filter
+	if err := f.compile(); err != nil {
+		return false, err
+	}
+
+	// the end of binary log is kept as ROTATE_EVENT
+	if header.EventType == StopEvent {
+		return true, nil
+	}
+
+	switch body := body.(type) {
+	case *BinFmtDescEvent, *BinRotateEvent, *BinPreGTIDsEvent:
+		return true, nil
+
+	case *BinGTIDEvent:
+		decoder.skipTransaction = !f.matchServerID(header.ServerID) || !f.matchGTID(body)
+		return !decoder.skipTransaction, nil
+
+	case *BinRowsEvent:
+		// checked by filterRows()
+		return true, nil
+	}
+
+	if decoder.skipTransaction || !f.matchServerID(header.ServerID) {
+		return false, nil
+	}
+
+	switch body := body.(type) {
+	case *BinTableMapEvent, *BinXIDEvent, *BinXAPrepareEvent:
+		return true, nil
+
+	case *BinQueryEvent:
+		if queryKind(body.Query) != queryStatement {
+			return true, nil
+		}
+		return f.matchEventType(header.EventType) && f.matchSchema(body.Schema), nil
+	}
+	return f.matchEventType(header.EventType), nil
+}
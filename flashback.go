@@ -0,0 +1,293 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Flashback generates the undo of row changes in binary log, such as reverting an accidental DELETE.
+// The range of binary log is chosen by the BinReaderOption of decoder.
+// Row changes are inverted, WRITE_ROWS_EVENT to DELETE_ROWS_EVENT, DELETE_ROWS_EVENT to WRITE_ROWS_EVENT,
+// before and after images of UPDATE_ROWS_EVENT are swapped, and transactions, rows events and rows
+// are in reverse order. It needs binlog_format=ROW and binlog_row_image=FULL.
+type Flashback struct {
+	decoder *BinFileDecoder
+
+	// Schemas and Tables filter the tables to flashback, all tables if empty
+	Schemas []string
+	Tables  []string
+
+	// Generator generates the SQL of WriteSQL()
+	Generator *SQLGenerator
+}
+
+// flashbackTransaction is a transaction with the rows events to flashback
+type flashbackTransaction struct {
+	tx *Transaction
+
+	// TABLE_MAP_EVENT and ROWS_EVENT of filtered tables
+	tables []*BinEvent
+	rows   []*BinEvent
+}
+
+// NewFlashback return a Flashback of the binary log events walked by decoder
+func NewFlashback(decoder *BinFileDecoder) *Flashback {
+	return &Flashback{decoder: decoder, Generator: NewSQLGenerator()}
+}
+
+// match return true if the table should be flashed back
+func (fb *Flashback) match(table *BinTableMapEvent) bool {
+	return matchName(fb.Schemas, table.Schema) && matchName(fb.Tables, table.Table)
+}
+
+func matchName(names []string, name string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// transactions return the FORMAT_DESCRIPTION_EVENT and the transactions to flashback in reverse order
+func (fb *Flashback) transactions() (*BinEvent, []*flashbackTransaction, error) {
+	var description *BinEvent
+	var txs []*flashbackTransaction
+
+	grouper := &transactionGrouper{}
+	err := fb.decoder.WalkEvent(func(event *BinEvent) (isContinue bool, err error) {
+		if _, ok := event.Body.(*BinFmtDescEvent); ok && description == nil {
+			description = event
+		}
+
+		tx := grouper.push(event)
+		if tx == nil || len(tx.Rows) == 0 {
+			return true, nil
+		}
+
+		ftx := &flashbackTransaction{tx: tx}
+		tables := make(map[uint64]*BinEvent)
+		for _, e := range tx.Events {
+			switch body := e.Body.(type) {
+			case *BinTableMapEvent:
+				tables[body.TableID] = e
+
+			case *BinRowsEvent:
+				if body.Table == nil {
+					return false, fmt.Errorf("table map of table id %d is unknown at %d",
+						body.TableID, e.Header.LogPos-e.Header.EventSize)
+				}
+				if !fb.match(body.Table) {
+					continue
+				}
+				if e.data == nil {
+					return false, fmt.Errorf("rows event of %s.%s at %d is masked, it can't be flashed back",
+						body.Table.Schema, body.Table.Table, e.Header.LogPos-e.Header.EventSize)
+				}
+				if !isFullImage(body.ColumnsBitmap1, body.ColumnCount) ||
+					(body.ColumnsBitmap2 != nil && !isFullImage(body.ColumnsBitmap2, body.ColumnCount)) {
+					return false, fmt.Errorf("rows event of %s.%s at %d is not full image, binlog_row_image=FULL is needed",
+						body.Table.Schema, body.Table.Table, e.Header.LogPos-e.Header.EventSize)
+				}
+
+				if table, ok := tables[body.TableID]; ok {
+					ftx.addTable(table)
+				}
+				ftx.rows = append(ftx.rows, e)
+			}
+		}
+
+		if len(ftx.rows) > 0 {
+			txs = append(txs, ftx)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// reverse transactions
+	for i, j := 0, len(txs)-1; i < j; i, j = i+1, j-1 {
+		txs[i], txs[j] = txs[j], txs[i]
+	}
+	return description, txs, nil
+}
+
+// addTable add TABLE_MAP_EVENT once
+func (ftx *flashbackTransaction) addTable(event *BinEvent) {
+	for _, e := range ftx.tables {
+		if e == event {
+			return
+		}
+	}
+	ftx.tables = append(ftx.tables, event)
+}
+
+// isFullImage return true if all columns are present in bitmap
+func isFullImage(bitmap []byte, columnCount uint64) bool {
+	for i := 0; i < int(columnCount); i++ {
+		if bitmap[i/8]&(1<<uint(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteSQL write the flashback SQL statements, every transaction is in BEGIN ... COMMIT.
+// Column names are needed, from binlog_row_metadata=FULL (mysql >= 8.0.1) or the schemas of Generator.
+func (fb *Flashback) WriteSQL(w io.Writer) error {
+	_, txs, err := fb.transactions()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, s := range sqlHeader {
+		fmt.Fprintln(bw, s)
+	}
+
+	for _, ftx := range txs {
+		var statements []*sqlStatement
+		for i := len(ftx.rows) - 1; i >= 0; i-- {
+			s, err := fb.Generator.rowsStatements(ftx.rows[i].Body.(*BinRowsEvent), true)
+			if err != nil {
+				return err
+			}
+			statements = append(statements, s...)
+		}
+
+		fmt.Fprintf(bw, "# flashback of transaction at %d, end_log_pos %d", ftx.tx.StartPos, ftx.tx.EndPos)
+		if ftx.tx.GTID != "" {
+			fmt.Fprintf(bw, ", GTID %s", ftx.tx.GTID)
+		}
+		fmt.Fprintln(bw, "\nBEGIN;")
+		for _, query := range renderSQL(statements, fb.Generator.BatchSize) {
+			fmt.Fprintln(bw, query)
+		}
+		fmt.Fprintln(bw, "COMMIT;")
+	}
+	return bw.Flush()
+}
+
+// WriteBinlog write the flashback binary log, which can be replayed by 'mysqlbinlog | mysql'.
+// GTID events are not written, the server will assign new GTIDs when replaying.
+func (fb *Flashback) WriteBinlog(w io.Writer) error {
+	description, txs, err := fb.transactions()
+	if err != nil {
+		return err
+	}
+
+	if description == nil {
+		return fmt.Errorf("no FORMAT_DESCRIPTION_EVENT found")
+	}
+
+	fw, err := NewBinWriter(w)
+	if err != nil {
+		return err
+	}
+	if err = fw.WriteEvent(description); err != nil {
+		return err
+	}
+
+	for _, ftx := range txs {
+		first := ftx.tx.Events[0].Header
+		err = fw.write(&BinEventHeader{Timestamp: ftx.tx.StartTime, EventType: QueryEvent, ServerID: first.ServerID},
+			encodeQueryEvent(&BinQueryEvent{Query: "BEGIN"}))
+		if err != nil {
+			return err
+		}
+
+		for _, table := range ftx.tables {
+			if err = fw.WriteEvent(table); err != nil {
+				return err
+			}
+		}
+
+		// the last rows event ends the statement
+		for i := len(ftx.rows) - 1; i >= 0; i-- {
+			header := *ftx.rows[i].Header
+			data, typ := invertRowsEvent(ftx.rows[i], i == 0)
+			header.EventType = typ
+			if err = fw.write(&header, data); err != nil {
+				return err
+			}
+		}
+
+		err = fw.write(&BinEventHeader{Timestamp: ftx.tx.CommitTime, EventType: QueryEvent, ServerID: first.ServerID},
+			encodeQueryEvent(&BinQueryEvent{Query: "COMMIT"}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return fw.Flush()
+}
+
+// flashback event types of ROWS_EVENT
+var flashbackRowsEventType = map[uint8]uint8{
+	WriteRowsEventV0:  DeleteRowsEventV0,
+	DeleteRowsEventV0: WriteRowsEventV0,
+	UpdateRowsEventV0: UpdateRowsEventV0,
+	WriteRowsEventV1:  DeleteRowsEventV1,
+	DeleteRowsEventV1: WriteRowsEventV1,
+	UpdateRowsEventV1: UpdateRowsEventV1,
+	WriteRowsEventV2:  DeleteRowsEventV2,
+	DeleteRowsEventV2: WriteRowsEventV2,
+	UpdateRowsEventV2: UpdateRowsEventV2,
+}
+
+// invertRowsEvent return the body and event type of the inverted ROWS_EVENT, isStmtEnd sets STMT_END_F
+func invertRowsEvent(event *BinEvent, isStmtEnd bool) ([]byte, uint8) {
+	rows := event.Body.(*BinRowsEvent)
+	data := make([]byte, rows.rowsOffset, len(event.data))
+	copy(data, event.data)
+
+	flags := binary.LittleEndian.Uint16(data[rows.tableIDLen:]) &^ RowsEventStmtEndF
+	if isStmtEnd {
+		flags |= RowsEventStmtEndF
+	}
+	binary.LittleEndian.PutUint16(data[rows.tableIDLen:], flags)
+
+	// swap columns-present-bitmap1 and columns-present-bitmap2 of UPDATE_ROWS_EVENT
+	if rows.ColumnsBitmap2 != nil {
+		n := len(rows.ColumnsBitmap1)
+		copy(data[len(data)-2*n:], rows.ColumnsBitmap2)
+		copy(data[len(data)-n:], rows.ColumnsBitmap1)
+	}
+
+	for i := len(rows.Rows) - 1; i >= 0; i-- {
+		row := rows.Rows[i]
+		switch rows.Action() {
+		case RowsActionInsert:
+			data = append(data, row.afterData...)
+		case RowsActionDelete:
+			data = append(data, row.beforeData...)
+		case RowsActionUpdate:
+			data = append(data, row.afterData...)
+			data = append(data, row.beforeData...)
+		}
+	}
+
+	return data, flashbackRowsEventType[rows.Type]
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Fuzz targets of event decoders, seeded from the golden corpus of test/testdata/golden.
+// Decoders are unexported, so they are fuzzed in package binlog instead of test/. Run one by
+//
+//	go test -run '^$' -fuzz FuzzDecodeEvent
+//
+// Decoders should return errors on malformed data instead of panic.
+
+// goldenCorpus is the binary logs seeding fuzz targets
+const goldenCorpus = "test/testdata/golden/*.bin"
+
+// rowsEventTypes are ROWS_EVENT types of all versions
+var rowsEventTypes = []uint8{
+	WriteRowsEventV0, UpdateRowsEventV0, DeleteRowsEventV0,
+	WriteRowsEventV1, UpdateRowsEventV1, DeleteRowsEventV1,
+	WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2,
+}
+
+// fuzzDescription is the FORMAT_DESCRIPTION_EVENT of event decoders, mysql 5.7 with 6 bytes table id
+var fuzzDescription = NewFmtDescEvent(BinlogChecksumAlgOff)
+
+// goldenEvents return the events of golden corpus, with event bodies in data
+func goldenEvents(f *testing.F) []*BinEvent {
+	paths, err := filepath.Glob(goldenCorpus)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	var events []*BinEvent
+	for _, path := range paths {
+		decoder, err := NewBinFileDecoder(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		err = decoder.WalkEvent(func(event *BinEvent) (isContinue bool, err error) {
+			events = append(events, event)
+			return true, nil
+		})
+		decoder.BinFile.Close()
+		if err != nil {
+			f.Fatal(path, err)
+		}
+	}
+	return events
+}
+
+// seedEvents add the event bodies of types in golden corpus
+func seedEvents(f *testing.F, types ...uint8) {
+	for _, event := range goldenEvents(f) {
+		for _, typ := range types {
+			if event.Header.EventType == typ {
+				f.Add(event.data)
+			}
+		}
+	}
+}
+
+func FuzzLengthEncodedInt(f *testing.F) {
+	for _, seed := range [][]byte{{0x01}, {0xfb}, {0xfc, 1, 2}, {0xfd, 1, 2, 3}, {0xfe, 1, 2, 3, 4, 5, 6, 7, 8}} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, _, n := LengthEncodedInt(data); n <= len(data) && len(data) > 0 {
+			LengthEnodedString(data)
+		}
+	})
+}
+
+func FuzzDecodeFmtDescEvent(f *testing.F) {
+	seedEvents(f, FormatDescriptionEvent)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeFmtDescEvent(data)
+	})
+}
+
+func FuzzDecodeQueryEvent(f *testing.F) {
+	seedEvents(f, QueryEvent)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeQueryEvent(data, 4)
+		decodeQueryEvent(data, 1)
+	})
+}
+
+func FuzzQueryStatusVars(f *testing.F) {
+	for _, event := range goldenEvents(f) {
+		if query, ok := event.Body.(*BinQueryEvent); ok {
+			f.Add(query.StatusVars)
+		}
+	}
+	f.Add([]byte("\x00\x00\x00\x00\x00\x05\x03UTC\x0c\x02a\x00b\x00\x0d\x01\x02\x03"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&BinQueryEvent{StatusVars: data}).Statue()
+	})
+}
+
+func FuzzDecodeXIDEvent(f *testing.F) {
+	seedEvents(f, XIDEvent)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeXIDEvent(data)
+		decodeIntvarEvent(data)
+		decodeRandEvent(data)
+	})
+}
+
+func FuzzDecodeUserVarEvent(f *testing.F) {
+	f.Add([]byte("\x01\x00\x00\x00a\x01"))
+	f.Add([]byte("\x01\x00\x00\x00a\x00\x00\x2d\x00\x00\x00\x01\x00\x00\x00b\x00"))
+	f.Add([]byte("\x01\x00\x00\x00a\x00\x02\x3f\x00\x00\x00\x08\x00\x00\x00\xff\xff\xff\xff\xff\xff\xff\xff\x01"))
+	f.Add([]byte("\x01\x00\x00\x00a\x00\x04\x3f\x00\x00\x00\x05\x00\x00\x00\x05\x02\x80\x01\x0c"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if event, err := decodeUserVarEvent(data); err == nil {
+			event.SQLValue()
+		}
+	})
+}
+
+func FuzzDecodeRotateEvent(f *testing.F) {
+	f.Add([]byte("\x04\x00\x00\x00\x00\x00\x00\x00mysql-bin.000002"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeRotateEvent(data, 4)
+		decodeRotateEvent(data, 1)
+	})
+}
+
+func FuzzDecodeGTIDEvent(f *testing.F) {
+	seedEvents(f, GTIDEvent, AnonymousGTIDEvent)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeGTIDEvent(data)
+	})
+}
+
+func FuzzDecodeXAPrepareEvent(f *testing.F) {
+	f.Add(encodeXAPrepareEvent(&BinXAPrepareEvent{FormatID: 1, GTRID: []byte("gtrid"), BQUAL: []byte("bqual")}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeXAPrepareEvent(data)
+		decodeRowsQueryEvent(data)
+	})
+}
+
+func FuzzDecodeTableMapEvent(f *testing.F) {
+	seedEvents(f, TableMapEvent)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeTableMapEvent(data, fuzzDescription)
+	})
+}
+
+func FuzzDecodeRowsEvent(f *testing.F) {
+	// every rows event follows its TABLE_MAP_EVENT in golden corpus
+	var table []byte
+	for _, event := range goldenEvents(f) {
+		switch event.Header.EventType {
+		case TableMapEvent:
+			table = event.data
+		case WriteRowsEventV2, UpdateRowsEventV2, DeleteRowsEventV2:
+			f.Add(table, event.data, event.Header.EventType)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, tableData, rowsData []byte, typ uint8) {
+		table, err := decodeTableMapEvent(tableData, fuzzDescription)
+		if err != nil {
+			return
+		}
+		typ = rowsEventTypes[int(typ)%len(rowsEventTypes)]
+		decodeRowsEvent(rowsData, fuzzDescription, typ, map[uint64]*BinTableMapEvent{table.TableID: table})
+	})
+}
+
+func FuzzDecodeValue(f *testing.F) {
+	f.Add([]byte{0x00, 0x04, 0x00, 0x00, 0x00, 0x00}, byte(MySQLTypeJSON), uint16(4), false, uint64(0))
+	f.Add([]byte{0x80, 0x00, 0x01, 0x00, 0x00}, byte(MySQLTypeNewDecimal), uint16(10<<8|3), false, uint64(0))
+	f.Add([]byte{0x99, 0xa1, 0x2b, 0x00, 0x00, 0x00}, byte(MySQLTypeDatetime2), uint16(2), false, uint64(0))
+	f.Add([]byte{0x80, 0x00, 0x00, 0x00}, byte(MySQLTypeTime2), uint16(3), false, uint64(0))
+	f.Add([]byte{0x02, 'a', 'b'}, byte(MySQLTypeString), uint16(MySQLTypeString)<<8|8, false, uint64(255))
+	f.Fuzz(func(t *testing.T, data []byte, typ byte, meta uint16, unsigned bool, collation uint64) {
+		decodeValue(data, typ, meta, unsigned, collation)
+	})
+}
+
+func FuzzDecodeJSONBinary(f *testing.F) {
+	for _, text := range []string{`{"a": [1, 2.5, null, true, "b"]}`, `[{"k": {}}]`, `"s"`, `-1`} {
+		data, err := encodeJSONBinary(text)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(data))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeJSONBinary(data)
+	})
+}
+
+func FuzzDecodeEvent(f *testing.F) {
+	paths, err := filepath.Glob(goldenCorpus)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	dir, err := ioutil.TempDir("", "fuzz")
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := ioutil.TempFile(dir, "mysql-bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.Write(data)
+		file.Close()
+
+		decoder, err := NewBinFileDecoder(file.Name())
+		if err != nil {
+			return
+		}
+		defer decoder.BinFile.Close()
+		decoder.WalkEvent(func(event *BinEvent) (isContinue bool, err error) {
+			return true, nil
+		})
+	})
+}
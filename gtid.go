@@ -0,0 +1,174 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GTIDSet is a set of GTIDs, such as '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:11,...'.
+// It maps the lower case server uuid to intervals of transaction numbers.
+type GTIDSet map[string][]GTIDInterval
+
+// GTIDInterval is the transaction numbers [Start, End]
+type GTIDInterval struct {
+	Start int64
+	End   int64
+}
+
+// ParseGTIDSet return the GTIDSet of string as gtid_executed
+func ParseGTIDSet(s string) (GTIDSet, error) {
+	set := make(GTIDSet)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		uuid := strings.ToLower(fields[0])
+		if len(uuid) != 36 || len(fields) < 2 {
+			return nil, fmt.Errorf("invalid GTID set %q", part)
+		}
+
+		for _, field := range fields[1:] {
+			interval, err := parseGTIDInterval(field)
+			if err != nil && isGTIDTag(field) {
+				return nil, fmt.Errorf("tagged GTID set %q is unsupported", part)
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid GTID set %q", part)
+			}
+			set[uuid] = append(set[uuid], interval)
+		}
+	}
+	return set, nil
+}
+
+// isGTIDTag return true if s is a tag of GTIDs of mysql 8.3 and later, such as 'uuid:tag:1-5',
+// which is a letter or underscore followed by at most 31 letters, digits or underscores
+func isGTIDTag(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseGTIDInterval parse 'n' or 'start-end'
+func parseGTIDInterval(s string) (GTIDInterval, error) {
+	var interval GTIDInterval
+	var err error
+
+	bounds := strings.SplitN(s, "-", 2)
+	if interval.Start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return interval, err
+	}
+
+	interval.End = interval.Start
+	if len(bounds) == 2 {
+		if interval.End, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+			return interval, err
+		}
+	}
+
+	if interval.Start < 1 || interval.End < interval.Start {
+		return interval, fmt.Errorf("invalid interval %q", s)
+	}
+	return interval, nil
+}
+
+// Contains return true if the GTID of server uuid and transaction number is in set
+func (set GTIDSet) Contains(uuid string, gno int64) bool {
+	for _, interval := range set[strings.ToLower(uuid)] {
+		if gno >= interval.Start && gno <= interval.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Add the GTID of server uuid and transaction number into set
+func (set GTIDSet) Add(uuid string, gno int64) {
+	uuid = strings.ToLower(uuid)
+	if set.Contains(uuid, gno) {
+		return
+	}
+
+	intervals := set[uuid]
+	for i := range intervals {
+		if intervals[i].End+1 == gno {
+			intervals[i].End = gno
+			return
+		}
+		if intervals[i].Start-1 == gno {
+			intervals[i].Start = gno
+			return
+		}
+	}
+	set[uuid] = append(intervals, GTIDInterval{Start: gno, End: gno})
+}
+
+// String return the GTID set as gtid_executed, server uuids and intervals are sorted and merged
+func (set GTIDSet) String() string {
+	uuids := make([]string, 0, len(set))
+	for uuid := range set {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	var parts []string
+	for _, uuid := range uuids {
+		intervals := append([]GTIDInterval{}, set[uuid]...)
+		if len(intervals) == 0 {
+			continue
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start < intervals[j].Start })
+
+		part := uuid
+		last := intervals[0]
+		for _, interval := range intervals[1:] {
+			if interval.Start <= last.End+1 {
+				if interval.End > last.End {
+					last.End = interval.End
+				}
+				continue
+			}
+			part += last.format()
+			last = interval
+		}
+		parts = append(parts, part+last.format())
+	}
+	return strings.Join(parts, ",")
+}
+
+// format return ':start-end', or ':start' for a single transaction
+func (interval GTIDInterval) format() string {
+	if interval.Start == interval.End {
+		return fmt.Sprintf(":%d", interval.Start)
+	}
+	return fmt.Sprintf(":%d-%d", interval.Start, interval.End)
+}
@@ -0,0 +1,528 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MySQL binary JSON value types
+// https://github.com/mysql/mysql-server/blob/8.0/sql/json_binary.h
+const (
+	jsonbTypeSmallObject = 0x00
+	jsonbTypeLargeObject = 0x01
+	jsonbTypeSmallArray  = 0x02
+	jsonbTypeLargeArray  = 0x03
+	jsonbTypeLiteral     = 0x04
+	jsonbTypeInt16       = 0x05
+	jsonbTypeUint16      = 0x06
+	jsonbTypeInt32       = 0x07
+	jsonbTypeUint32      = 0x08
+	jsonbTypeInt64       = 0x09
+	jsonbTypeUint64      = 0x0a
+	jsonbTypeDouble      = 0x0b
+	jsonbTypeString      = 0x0c
+	jsonbTypeOpaque      = 0x0f
+
+	jsonbLiteralNull  = 0x00
+	jsonbLiteralTrue  = 0x01
+	jsonbLiteralFalse = 0x02
+)
+
+// decodeJSONBinary decode MySQL binary JSON into JSON text formatted as MySQL does
+func decodeJSONBinary(data []byte) (string, error) {
+	// empty value is written for JSON null in some cases
+	if len(data) == 0 {
+		return "null", nil
+	}
+
+	// every value takes a byte at least, more values are decoded only if values are referred many times
+	var buf strings.Builder
+	budget := len(data)
+	if err := writeJSONValue(&buf, data[0], data[1:], 0, &budget); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeJSONValue write value of type t, data starts at the value.
+// depth is the depth of containers, budget is the count of values can be decoded yet.
+func writeJSONValue(buf *strings.Builder, t byte, data []byte, depth int, budget *int) error {
+	if *budget--; *budget < 0 {
+		return fmt.Errorf("invalid json, values are referred repeatedly")
+	}
+
+	switch t {
+	case jsonbTypeSmallObject:
+		return writeJSONContainer(buf, data, false, true, depth+1, budget)
+	case jsonbTypeLargeObject:
+		return writeJSONContainer(buf, data, true, true, depth+1, budget)
+	case jsonbTypeSmallArray:
+		return writeJSONContainer(buf, data, false, false, depth+1, budget)
+	case jsonbTypeLargeArray:
+		return writeJSONContainer(buf, data, true, false, depth+1, budget)
+
+	case jsonbTypeLiteral:
+		if err := needBytes(data, 1); err != nil {
+			return err
+		}
+		switch data[0] {
+		case jsonbLiteralNull:
+			buf.WriteString("null")
+		case jsonbLiteralTrue:
+			buf.WriteString("true")
+		case jsonbLiteralFalse:
+			buf.WriteString("false")
+		default:
+			return fmt.Errorf("invalid json literal %x", data[0])
+		}
+
+	case jsonbTypeInt16:
+		if err := needBytes(data, 2); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(data))), 10))
+	case jsonbTypeUint16:
+		if err := needBytes(data, 2); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint16(data)), 10))
+	case jsonbTypeInt32:
+		if err := needBytes(data, 4); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data))), 10))
+	case jsonbTypeUint32:
+		if err := needBytes(data, 4); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10))
+	case jsonbTypeInt64:
+		if err := needBytes(data, 8); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10))
+	case jsonbTypeUint64:
+		if err := needBytes(data, 8); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatUint(binary.LittleEndian.Uint64(data), 10))
+	case jsonbTypeDouble:
+		if err := needBytes(data, 8); err != nil {
+			return err
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		buf.WriteString(s)
+
+	case jsonbTypeString:
+		length, n, err := decodeJSONVarLen(data)
+		if err != nil {
+			return err
+		}
+		if err := needBytes(data, n+length); err != nil {
+			return err
+		}
+		writeJSONString(buf, string(data[n:n+length]))
+
+	case jsonbTypeOpaque:
+		if err := needBytes(data, 1); err != nil {
+			return err
+		}
+		typ := data[0]
+		length, n, err := decodeJSONVarLen(data[1:])
+		if err != nil {
+			return err
+		}
+		if err := needBytes(data, 1+n+length); err != nil {
+			return err
+		}
+		return writeJSONOpaque(buf, typ, data[1+n:1+n+length])
+
+	default:
+		return fmt.Errorf("invalid json type %x", t)
+	}
+
+	return nil
+}
+
+// jsonMaxDepth is the max depth of JSON document in mysql
+const jsonMaxDepth = 100
+
+// writeJSONContainer write object or array, data starts at element count
+func writeJSONContainer(buf *strings.Builder, data []byte, isLarge bool, isObject bool, depth int, budget *int) error {
+	if depth > jsonMaxDepth {
+		return fmt.Errorf("invalid json, depth exceeds %d", jsonMaxDepth)
+	}
+
+	offsetSize := 2
+	if isLarge {
+		offsetSize = 4
+	}
+
+	readOffset := func(pos int) (int, error) {
+		if err := needBytes(data, pos+offsetSize); err != nil {
+			return 0, err
+		}
+		return int(FixedLengthInt(data[pos : pos+offsetSize])), nil
+	}
+
+	count, err := readOffset(0)
+	if err != nil {
+		return err
+	}
+	size, err := readOffset(offsetSize)
+	if err != nil {
+		return err
+	}
+	if size > len(data) {
+		return io.ErrUnexpectedEOF
+	}
+	data = data[:size]
+
+	keyEntrySize := offsetSize + 2
+	valueEntrySize := 1 + offsetSize
+	valueEntries := 2 * offsetSize
+	if isObject {
+		valueEntries += count * keyEntrySize
+	}
+
+	if isObject {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte('[')
+	}
+
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+
+		if isObject {
+			entry := 2*offsetSize + i*keyEntrySize
+			keyOffset, err := readOffset(entry)
+			if err != nil {
+				return err
+			}
+			if err := needBytes(data, entry+keyEntrySize); err != nil {
+				return err
+			}
+			keyLength := int(binary.LittleEndian.Uint16(data[entry+offsetSize:]))
+			if err := needBytes(data, keyOffset+keyLength); err != nil {
+				return err
+			}
+			writeJSONString(buf, string(data[keyOffset:keyOffset+keyLength]))
+			buf.WriteString(": ")
+		}
+
+		entry := valueEntries + i*valueEntrySize
+		if err := needBytes(data, entry+valueEntrySize); err != nil {
+			return err
+		}
+		t := data[entry]
+
+		// small values are inlined in value entry
+		inlined := t == jsonbTypeLiteral || t == jsonbTypeInt16 || t == jsonbTypeUint16 ||
+			(isLarge && (t == jsonbTypeInt32 || t == jsonbTypeUint32))
+		if inlined {
+			if err := writeJSONValue(buf, t, data[entry+1:entry+valueEntrySize], depth, budget); err != nil {
+				return err
+			}
+			continue
+		}
+
+		valueOffset, err := readOffset(entry + 1)
+		if err != nil {
+			return err
+		}
+		if valueOffset >= len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		if err := writeJSONValue(buf, t, data[valueOffset:], depth, budget); err != nil {
+			return err
+		}
+	}
+
+	if isObject {
+		buf.WriteByte('}')
+	} else {
+		buf.WriteByte(']')
+	}
+	return nil
+}
+
+// writeJSONOpaque write opaque value of MySQL type typ, such as DECIMAL and DATETIME
+func writeJSONOpaque(buf *strings.Builder, typ byte, data []byte) error {
+	switch typ {
+	case MySQLTypeNewDecimal:
+		// precision, scale and binary decimal
+		if err := needBytes(data, 2); err != nil {
+			return err
+		}
+		v, _, err := decodeDecimal(data[2:], int(data[0]), int(data[1]))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(v.(string))
+		return nil
+
+	case MySQLTypeDate, MySQLTypeDatetime, MySQLTypeTimestamp, MySQLTypeTime:
+		if err := needBytes(data, 8); err != nil {
+			return err
+		}
+		writeJSONString(buf, formatPackedTime(int64(binary.LittleEndian.Uint64(data)), typ))
+		return nil
+	}
+
+	writeJSONString(buf, fmt.Sprintf("base64:type%d:%s", typ, base64.StdEncoding.EncodeToString(data)))
+	return nil
+}
+
+// formatPackedTime format temporal value in MySQL packed int64 format
+func formatPackedTime(v int64, typ byte) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+
+	usec := v % (1 << 24)
+	packed := v >> 24
+	hms := packed % (1 << 17)
+	fraction := ""
+	if usec != 0 {
+		fraction = fmt.Sprintf(".%06d", usec)
+	}
+
+	if typ == MySQLTypeTime {
+		return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, packed>>12, (hms>>6)%(1<<6), hms%(1<<6), fraction)
+	}
+
+	ymd := packed >> 17
+	ym := ymd >> 5
+	if typ == MySQLTypeDate {
+		return fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd%(1<<5))
+	}
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d%s",
+		ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6), fraction)
+}
+
+// decodeJSONVarLen decode variable length of string, 7 bits per byte, the highest bit means more bytes
+func decodeJSONVarLen(data []byte) (int, int, error) {
+	var length uint64
+	for i := 0; i < 5 && i < len(data); i++ {
+		length |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i]&0x80 == 0 {
+			return int(length), i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid json variable length")
+}
+
+// writeJSONString write quoted string without HTML escaping
+func writeJSONString(buf *strings.Builder, s string) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Write(bytes.TrimRight(b.Bytes(), "\n"))
+}
+
+// encodeJSONBinary encode JSON text into MySQL binary JSON, it's the inverse of decodeJSONBinary()
+// https://github.com/mysql/mysql-server/blob/8.0/sql/json_binary.cc serialize_json_value()
+func encodeJSONBinary(text string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid json %q: %v", text, err)
+	}
+	if dec.More() {
+		return "", fmt.Errorf("invalid json %q: extra data", text)
+	}
+
+	t, data, err := encodeJSONValue(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(append([]byte{t}, data...)), nil
+}
+
+// encodeJSONValue return the type and data of value decoded by encoding/json with UseNumber()
+func encodeJSONValue(v interface{}) (byte, []byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return jsonbTypeLiteral, []byte{jsonbLiteralNull}, nil
+	case bool:
+		if v {
+			return jsonbTypeLiteral, []byte{jsonbLiteralTrue}, nil
+		}
+		return jsonbTypeLiteral, []byte{jsonbLiteralFalse}, nil
+
+	case json.Number:
+		// integers are written in the smallest type
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			switch {
+			case n >= math.MinInt16 && n <= math.MaxInt16:
+				return jsonbTypeInt16, appendFixedLengthInt(nil, uint64(n), 2), nil
+			case n >= math.MinInt32 && n <= math.MaxInt32:
+				return jsonbTypeInt32, appendFixedLengthInt(nil, uint64(n), 4), nil
+			}
+			return jsonbTypeInt64, appendFixedLengthInt(nil, uint64(n), 8), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return jsonbTypeUint64, appendFixedLengthInt(nil, n, 8), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return 0, nil, err
+		}
+		return jsonbTypeDouble, appendFixedLengthInt(nil, math.Float64bits(f), 8), nil
+
+	case string:
+		data := appendJSONVarLen(nil, len(v))
+		return jsonbTypeString, append(data, v...), nil
+
+	case []interface{}:
+		return encodeJSONContainer(nil, v)
+
+	case map[string]interface{}:
+		// keys are sorted by length and then bytes
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = v[key]
+		}
+		return encodeJSONContainer(keys, values)
+	}
+	return 0, nil, fmt.Errorf("unsupported json value %v of %T", v, v)
+}
+
+// encodeJSONContainer encode object of keys or array if keys is nil, in small format if possible
+func encodeJSONContainer(keys []string, values []interface{}) (byte, []byte, error) {
+	isObject := keys != nil
+	for _, isLarge := range []bool{false, true} {
+		data, ok, err := appendJSONContainer(keys, values, isLarge)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		switch {
+		case isObject && isLarge:
+			return jsonbTypeLargeObject, data, nil
+		case isObject:
+			return jsonbTypeSmallObject, data, nil
+		case isLarge:
+			return jsonbTypeLargeArray, data, nil
+		}
+		return jsonbTypeSmallArray, data, nil
+	}
+	return 0, nil, fmt.Errorf("json document is too large")
+}
+
+// appendJSONContainer encode [count][size][key entries][value entries][keys][values],
+// return false if offsets overflow the small format
+func appendJSONContainer(keys []string, values []interface{}, isLarge bool) ([]byte, bool, error) {
+	offsetSize, maxOffset := 2, math.MaxUint16
+	if isLarge {
+		offsetSize, maxOffset = 4, math.MaxUint32
+	}
+
+	count := len(values)
+	keyEntrySize := offsetSize + 2
+	valueEntrySize := 1 + offsetSize
+	valueEntries := 2 * offsetSize
+	if keys != nil {
+		valueEntries += count * keyEntrySize
+	}
+
+	data := make([]byte, valueEntries+count*valueEntrySize)
+	putOffset := func(pos int, offset int) {
+		copy(data[pos:pos+offsetSize], appendFixedLengthInt(nil, uint64(offset), offsetSize))
+	}
+
+	for i, key := range keys {
+		if len(key) > math.MaxUint16 {
+			return nil, false, fmt.Errorf("json key is too long")
+		}
+		entry := 2*offsetSize + i*keyEntrySize
+		putOffset(entry, len(data))
+		binary.LittleEndian.PutUint16(data[entry+offsetSize:], uint16(len(key)))
+		data = append(data, key...)
+	}
+
+	for i, v := range values {
+		t, value, err := encodeJSONValue(v)
+		if err != nil {
+			return nil, false, err
+		}
+
+		entry := valueEntries + i*valueEntrySize
+		data[entry] = t
+
+		// small values are inlined in value entry
+		inlined := t == jsonbTypeLiteral || t == jsonbTypeInt16 || t == jsonbTypeUint16 ||
+			(isLarge && (t == jsonbTypeInt32 || t == jsonbTypeUint32))
+		if inlined {
+			copy(data[entry+1:entry+valueEntrySize], value)
+			continue
+		}
+		putOffset(entry+1, len(data))
+		data = append(data, value...)
+	}
+
+	if len(data) > maxOffset {
+		return nil, false, nil
+	}
+	putOffset(0, count)
+	putOffset(offsetSize, len(data))
+	return data, true, nil
+}
+
+// appendJSONVarLen append variable length of string, 7 bits per byte, the highest bit means more bytes
+func appendJSONVarLen(data []byte, length int) []byte {
+	for length >= 0x80 {
+		data = append(data, byte(length&0x7f|0x80))
+		length >>= 7
+	}
+	return append(data, byte(length))
+}
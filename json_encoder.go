@@ -0,0 +1,297 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// JSONEncoder writes binary log events or row changes as JSON Lines, one JSON object per line.
+// Values are encoded without losing precision:
+//
+//	BIGINT, DECIMAL, BIT: string
+//	binary string and BLOB: base64 string
+//	ENUM, SET: string if values are known from TABLE_MAP_EVENT, else the number as string for SET
+//	JSON: JSON value
+//	other numbers: number, others: string
+//
+// 64-bit integers of events, such as xid, gno and transaction_length, are strings too.
+//
+// All events should be passed in order, so that row changes know the GTID of transaction.
+type JSONEncoder struct {
+	// File is the binary log file name written in row changes
+	File string
+
+	enc  *json.Encoder
+	gtid string
+}
+
+// NewJSONEncoder return a JSONEncoder writing into w
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONEncoder{enc: enc}
+}
+
+// EncodeEvent write an event as a JSON line with header, body and checksum
+func (e *JSONEncoder) EncodeEvent(event *BinEvent) error {
+	e.track(event)
+
+	line := map[string]interface{}{
+		"header": map[string]interface{}{
+			"timestamp":  event.Header.Timestamp,
+			"event_type": event.Header.Type(),
+			"server_id":  event.Header.ServerID,
+			"event_size": event.Header.EventSize,
+			"log_pos":    event.Header.LogPos,
+			"flags":      event.Header.Flag,
+		},
+		"body": jsonEventBody(event.Body),
+	}
+
+	if event.ChecksumVal != nil {
+		line["checksum"] = map[string]interface{}{
+			"type":  event.ChecksumType,
+			"value": hex.EncodeToString(event.ChecksumVal),
+		}
+	}
+
+	if event.Relay != nil {
+		line["relay"] = map[string]interface{}{
+			"relay_file":  event.Relay.RelayFile,
+			"relay_pos":   event.Relay.RelayPos,
+			"source_file": event.Relay.SourceFile,
+			"source_pos":  event.Relay.SourcePos,
+		}
+	}
+
+	return e.enc.Encode(line)
+}
+
+// EncodeRows write every row change of ROWS_EVENT as a JSON line, other events write nothing
+func (e *JSONEncoder) EncodeRows(event *BinEvent) error {
+	e.track(event)
+
+	rows, ok := event.Body.(*BinRowsEvent)
+	if !ok || rows.Table == nil {
+		return nil
+	}
+
+	for i, row := range rows.Rows {
+		line := map[string]interface{}{
+			"schema":    rows.Table.Schema,
+			"table":     rows.Table.Table,
+			"op":        rows.Action(),
+			"before":    jsonRowImage(rows, row.Before, false),
+			"after":     jsonRowImage(rows, row.After, true),
+			"file":      e.File,
+			"pos":       event.Header.LogPos - event.Header.EventSize,
+			"log_pos":   event.Header.LogPos,
+			"row":       i,
+			"gtid":      e.gtid,
+			"timestamp": event.Header.Timestamp,
+			"server_id": event.Header.ServerID,
+		}
+		if err := e.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// track the GTID of current transaction
+func (e *JSONEncoder) track(event *BinEvent) {
+	if gtid, ok := event.Body.(*BinGTIDEvent); ok {
+		e.gtid = gtid.GTID()
+	}
+}
+
+// jsonRowImage return row image keyed by column name, nil if image is nil
+func jsonRowImage(rows *BinRowsEvent, image []interface{}, isAfter bool) map[string]interface{} {
+	if image == nil {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(image))
+	for i, v := range image {
+		if !rows.IsPresent(i, isAfter) {
+			continue
+		}
+		values[rows.Table.ColumnName(i)] = jsonColumnValue(rows.Table, i, v)
+	}
+	return values
+}
+
+// jsonColumnValue convert column value into the value encoded in JSON
+func jsonColumnValue(table *BinTableMapEvent, i int, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch table.RealType(i) {
+	case MySQLTypeLonglong, MySQLTypeBit:
+		switch n := v.(type) {
+		case int64:
+			return strconv.FormatInt(n, 10)
+		case uint64:
+			return strconv.FormatUint(n, 10)
+		}
+
+	case MySQLTypeEnum:
+		if index, ok := v.(int64); ok {
+			if s, ok := table.EnumValue(i, index); ok {
+				return s
+			}
+		}
+
+	case MySQLTypeSet:
+		if bits, ok := v.(uint64); ok {
+			if s, ok := table.SetValue(i, bits); ok {
+				return s
+			}
+			return strconv.FormatUint(bits, 10)
+		}
+
+	case MySQLTypeJSON:
+		if s, ok := v.(string); ok && json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	}
+
+	return v
+}
+
+// jsonEventBody return the JSON object of event body
+func jsonEventBody(body BinEventBody) interface{} {
+	switch b := body.(type) {
+	case nil:
+		return nil
+
+	case *BinFmtDescEvent:
+		return map[string]interface{}{
+			"binlog_version":      b.BinlogVersion,
+			"mysql_version":       b.MySQLVersion,
+			"create_time":         b.CreateTime,
+			"event_header_length": b.EventHeaderLength,
+			"event_type_header":   hex.EncodeToString(b.EventTypeHeader),
+			"checksum_alg":        b.ChecksumAlg,
+		}
+
+	case *BinQueryEvent:
+		return map[string]interface{}{
+			"slave_proxy_id": b.SlaveProxyID,
+			"execution_time": b.ExecutionTime,
+			"error_code":     b.ErrorCode,
+			"status_vars":    hex.EncodeToString(b.StatusVars),
+			"schema":         b.Schema,
+			"query":          b.Query,
+		}
+
+	case *BinXIDEvent:
+		return map[string]interface{}{"xid": strconv.FormatUint(b.XID, 10)}
+
+	case *BinIntvarEvent:
+		return map[string]interface{}{"type": b.Type, "value": strconv.FormatUint(b.Value, 10)}
+
+	case *BinRandEvent:
+		return map[string]interface{}{"seed1": strconv.FormatUint(b.Seed1, 10), "seed2": strconv.FormatUint(b.Seed2, 10)}
+
+	case *BinUserVarEvent:
+		return map[string]interface{}{
+			"name":    b.Name,
+			"is_null": b.IsNull,
+			"type":    b.Type,
+			"charset": b.Charset,
+			"value":   hex.EncodeToString(b.Value),
+			"flags":   b.Flags,
+		}
+
+	case *BinRotateEvent:
+		return map[string]interface{}{"position": strconv.FormatUint(b.Position, 10), "file_name": b.FileName}
+
+	case *BinGTIDEvent:
+		return map[string]interface{}{
+			"gtid":                       b.GTID(),
+			"sid":                        b.UUID(),
+			"gno":                        strconv.FormatInt(b.GNO, 10),
+			"commit_flag":                b.CommitFlag,
+			"last_committed":             strconv.FormatInt(b.LastCommitted, 10),
+			"sequence_number":            strconv.FormatInt(b.SequenceNumber, 10),
+			"immediate_commit_timestamp": strconv.FormatInt(b.ImmediateCommitTimestamp, 10),
+			"original_commit_timestamp":  strconv.FormatInt(b.OriginalCommitTimestamp, 10),
+			"transaction_length":         strconv.FormatUint(b.TransactionLength, 10),
+			"immediate_server_version":   b.ImmediateServerVersion,
+			"original_server_version":    b.OriginalServerVersion,
+		}
+
+	case *BinXAPrepareEvent:
+		return map[string]interface{}{"one_phase": b.OnePhase, "xid": b.XID()}
+
+	case *BinRowsQueryEvent:
+		return map[string]interface{}{"query": b.Query}
+
+	case *BinTableMapEvent:
+		columns := make([]map[string]interface{}, b.ColumnCount)
+		for i := range columns {
+			columns[i] = map[string]interface{}{
+				"name":     b.ColumnName(i),
+				"type":     b.RealType(i),
+				"meta":     b.ColumnMetaDef[i],
+				"nullable": b.IsNullable(i),
+				"unsigned": b.IsUnsigned(i),
+			}
+		}
+		return map[string]interface{}{
+			"table_id":    strconv.FormatUint(b.TableID, 10),
+			"flags":       b.Flags,
+			"schema":      b.Schema,
+			"table":       b.Table,
+			"columns":     columns,
+			"primary_key": b.PrimaryKey,
+		}
+
+	case *BinRowsEvent:
+		rows := make([]map[string]interface{}, 0, len(b.Rows))
+		if b.Table != nil {
+			for _, row := range b.Rows {
+				rows = append(rows, map[string]interface{}{
+					"before": jsonRowImage(b, row.Before, false),
+					"after":  jsonRowImage(b, row.After, true),
+				})
+			}
+		}
+		return map[string]interface{}{
+			"table_id":     strconv.FormatUint(b.TableID, 10),
+			"flags":        b.Flags,
+			"version":      b.Version,
+			"column_count": b.ColumnCount,
+			"action":       b.Action(),
+			"rows":         rows,
+		}
+
+	case *BinPreGTIDsEvent:
+		return map[string]interface{}{"gtids": b.GTIDs.String()}
+
+	case *BinEventUnParsed:
+		return map[string]interface{}{"data": b.Data}
+	}
+
+	return body
+}
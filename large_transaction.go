@@ -0,0 +1,115 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// LargeTransactionDetector flags the transactions which exceed any of the thresholds, a zero threshold is disabled.
+// Such transactions are applied as a whole by replicas, they are the usual cause of replication lag.
+type LargeTransactionDetector struct {
+	// File is the binary log file name of the transactions checked
+	File string
+
+	// MaxBytes is the size of transaction in binary log
+	MaxBytes int64
+
+	// MaxRows is the number of row changes
+	MaxRows int64
+
+	// MaxTables is the number of tables changed by rows events
+	MaxTables int
+
+	// MaxDuration is the time between the first event and the commit, binary log timestamps are in seconds
+	MaxDuration time.Duration
+}
+
+// LargeTransaction is a transaction exceeding thresholds
+type LargeTransaction struct {
+	TransactionStats
+
+	// Statements are the queries of QUERY_EVENT and ROWS_QUERY_EVENT in the transaction
+	Statements []string `json:"statements"`
+
+	// Reasons are the thresholds exceeded, such as 'rows 20000 > 10000'
+	Reasons []string `json:"reasons"`
+}
+
+// Check return the LargeTransaction of tx if it exceeds any threshold, else nil
+func (d *LargeTransactionDetector) Check(tx *Transaction) *LargeTransaction {
+	ts := newTransactionStats(d.File, tx)
+
+	var reasons []string
+	if d.MaxBytes > 0 && ts.Bytes > d.MaxBytes {
+		reasons = append(reasons, fmt.Sprintf("bytes %d > %d", ts.Bytes, d.MaxBytes))
+	}
+	if d.MaxRows > 0 && ts.Rows > d.MaxRows {
+		reasons = append(reasons, fmt.Sprintf("rows %d > %d", ts.Rows, d.MaxRows))
+	}
+	if d.MaxTables > 0 && len(ts.Tables) > d.MaxTables {
+		reasons = append(reasons, fmt.Sprintf("tables %d > %d", len(ts.Tables), d.MaxTables))
+	}
+	if duration := time.Duration(ts.Duration) * time.Second; d.MaxDuration > 0 && duration > d.MaxDuration {
+		reasons = append(reasons, fmt.Sprintf("duration %s > %s", duration, d.MaxDuration))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	lt := &LargeTransaction{TransactionStats: *ts, Statements: []string{}, Reasons: reasons}
+	for _, event := range tx.Events {
+		switch body := event.Body.(type) {
+		case *BinQueryEvent:
+			if queryKind(body.Query) == queryStatement {
+				lt.Statements = append(lt.Statements, body.Query)
+			}
+		case *BinRowsQueryEvent:
+			if body.Query != "" {
+				lt.Statements = append(lt.Statements, body.Query)
+			}
+		}
+	}
+	return lt
+}
+
+// WriteText write the transaction as a text block
+func (lt *LargeTransaction) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# %s %s [%d, %d) %s - %s\n#   %s\n#   bytes: %d, rows: %d, duration: %ds, tables: %s\n",
+		lt.File, lt.GTID, lt.StartPos, lt.EndPos, statsTime(lt.StartTime), statsTime(lt.CommitTime),
+		strings.Join(lt.Reasons, ", "), lt.Bytes, lt.Rows, lt.Duration, strings.Join(lt.Tables, ","))
+	if err != nil {
+		return err
+	}
+	for _, query := range lt.Statements {
+		if _, err = fmt.Fprintf(w, "%s;\n", strings.TrimRight(strings.TrimSpace(query), ";")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON write the transaction as a JSON line
+func (lt *LargeTransaction) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(lt)
+}
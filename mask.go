@@ -0,0 +1,383 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// mask actions of MaskRule
+const (
+	MaskDrop     = "drop"     // remove the column from row images
+	MaskHash     = "hash"     // replace with hex of SHA-256 of salt and value
+	MaskTruncate = "truncate" // keep the first Length characters of string, or bytes of binary
+	MaskConstant = "constant" // replace with Value
+)
+
+// masked columns of MaskHash and MaskConstant are VARCHAR in utf8mb4
+const maskCollation = 255
+
+// MaskRule masks the columns matched by Pattern
+type MaskRule struct {
+	// Pattern is 'column', 'table.column' or 'schema.table.column' with * and ? as path.Match
+	Pattern string
+
+	// Action is MaskDrop, MaskHash, MaskTruncate or MaskConstant
+	Action string
+
+	// Length is the length kept by MaskTruncate
+	Length int
+
+	// Value is the constant of MaskConstant
+	Value string
+}
+
+// ColumnMasker drops or masks columns of row changes before they are returned by decoder, the first rule
+// matching a column is applied to both before and after images.
+// Columns are matched by name, binlog_row_metadata=FULL (mysql >= 8.0.1) is needed to mask a table.
+// The TABLE_MAP_EVENT of masked table is replaced by the masked one, whose MaskHash and MaskConstant columns
+// are VARCHAR in utf8mb4. Masked events lose their raw data, they are encoded again by BinFileWriter but
+// can't be written as BINLOG statements, and the query of ROWS_QUERY_EVENT is cleared as it may contain masked values.
+// The values of statement-based DML can't be masked, so QUERY_EVENTs of DML such as INSERT, UPDATE and
+// DELETE are dropped if any rule is set, the BEGIN and COMMIT of their transactions are kept.
+type ColumnMasker struct {
+	Rules []*MaskRule
+
+	// Salt is hashed before values by MaskHash
+	Salt string
+
+	compiled bool
+	patterns [][3]string
+
+	// masked tables by table id, TABLE_MAP_EVENT is rewritten for every transaction
+	tables map[uint64]*maskedTable
+}
+
+// maskedTable is the table of rows events after masking
+type maskedTable struct {
+	source *BinTableMapEvent
+	table  *BinTableMapEvent // nil if no column is masked
+
+	// rule of every column, nil if the column is not masked
+	rules []*MaskRule
+}
+
+// compile the rule patterns into schema, table and column patterns
+func (m *ColumnMasker) compile() error {
+	if m.compiled {
+		return nil
+	}
+
+	for _, rule := range m.Rules {
+		switch rule.Action {
+		case MaskDrop, MaskHash, MaskConstant:
+		case MaskTruncate:
+			if rule.Length < 0 {
+				return fmt.Errorf("invalid truncate length %d of mask rule %q", rule.Length, rule.Pattern)
+			}
+		default:
+			return fmt.Errorf("unknown action %q of mask rule %q", rule.Action, rule.Pattern)
+		}
+
+		parts := strings.Split(rule.Pattern, ".")
+		if len(parts) > 3 || rule.Pattern == "" {
+			return fmt.Errorf("invalid mask rule pattern %q", rule.Pattern)
+		}
+
+		pattern := [3]string{"*", "*", "*"}
+		copy(pattern[3-len(parts):], parts)
+		for _, p := range pattern {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid mask rule pattern %q", rule.Pattern)
+			}
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+
+	m.tables = make(map[uint64]*maskedTable)
+	m.compiled = true
+	return nil
+}
+
+// table return the masked table of TABLE_MAP_EVENT, nil if no column is masked
+func (m *ColumnMasker) table(table *BinTableMapEvent) (*maskedTable, error) {
+	if mt, ok := m.tables[table.TableID]; ok && mt.source == table {
+		if mt.table == nil {
+			return nil, nil
+		}
+		return mt, nil
+	}
+
+	mt := &maskedTable{source: table, rules: make([]*MaskRule, table.ColumnCount)}
+	masked := false
+	for j, pattern := range m.patterns {
+		if ok, _ := path.Match(pattern[0], table.Schema); !ok {
+			continue
+		}
+		if ok, _ := path.Match(pattern[1], table.Table); !ok {
+			continue
+		}
+
+		// the table may have masked columns, fail rather than leaking them
+		if len(table.ColumnNames) == 0 {
+			return nil, fmt.Errorf("column names of %s.%s are unknown, binlog_row_metadata=FULL is needed to mask columns",
+				table.Schema, table.Table)
+		}
+
+		for i, name := range table.ColumnNames {
+			if ok, _ := path.Match(pattern[2], name); !ok || mt.rules[i] != nil {
+				continue
+			}
+			if m.Rules[j].Action == MaskTruncate && !isStringColumn(table, i) {
+				return nil, fmt.Errorf("column %s of %s.%s is not a string, it can't be truncated", name, table.Schema, table.Table)
+			}
+			mt.rules[i], masked = m.Rules[j], true
+		}
+	}
+
+	// unmasked tables are cached too, with nil table
+	m.tables[table.TableID] = mt
+	if !masked {
+		return nil, nil
+	}
+	mt.table = maskTableMap(table, mt.rules)
+	return mt, nil
+}
+
+// isStringColumn return true if the values of column are string or []byte
+func isStringColumn(table *BinTableMapEvent, i int) bool {
+	switch table.RealType(i) {
+	case MySQLTypeString, MySQLTypeVarString, MySQLTypeVarchar, MySQLTypeBlob, MySQLTypeTinyBlob,
+		MySQLTypeMediumBlob, MySQLTypeLongBlob:
+		return true
+	}
+	return false
+}
+
+// maskTableMap return a copy of table, columns of MaskHash and MaskConstant become VARCHAR in utf8mb4
+func maskTableMap(table *BinTableMapEvent, rules []*MaskRule) *BinTableMapEvent {
+	masked := *table
+	masked.ColumnTypeDef = append([]byte{}, table.ColumnTypeDef...)
+	masked.ColumnMetaDef = append([]uint16{}, table.ColumnMetaDef...)
+	if table.ColumnCharset != nil {
+		masked.ColumnCharset = append([]uint64{}, table.ColumnCharset...)
+	}
+	if table.EnumValues != nil {
+		masked.EnumValues = append([][]string{}, table.EnumValues...)
+	}
+	if table.SetValues != nil {
+		masked.SetValues = append([][]string{}, table.SetValues...)
+	}
+
+	unsigned := make([]bool, table.ColumnCount)
+	for i := range unsigned {
+		unsigned[i] = table.IsUnsigned(i)
+	}
+
+	for i, rule := range rules {
+		if rule == nil || (rule.Action != MaskHash && rule.Action != MaskConstant) {
+			continue
+		}
+
+		length := len(rule.Value)
+		if rule.Action == MaskHash {
+			length = sha256.Size * 2
+		}
+		masked.ColumnTypeDef[i], masked.ColumnMetaDef[i] = MySQLTypeVarchar, uint16(length*4)
+		if masked.ColumnCharset != nil {
+			masked.ColumnCharset[i] = maskCollation
+		}
+		if masked.EnumValues != nil {
+			masked.EnumValues[i] = nil
+		}
+		if masked.SetValues != nil {
+			masked.SetValues[i] = nil
+		}
+	}
+
+	// the signedness bitmap only has bits of numeric columns, which may be changed
+	if table.Signedness != nil {
+		var signedness []byte
+		n := 0
+		for i := range unsigned {
+			if !masked.IsNumericColumn(i) {
+				continue
+			}
+			if n%8 == 0 {
+				signedness = append(signedness, 0)
+			}
+			if unsigned[i] {
+				signedness[n/8] |= 0x80 >> uint(n%8)
+			}
+			n++
+		}
+		masked.Signedness = signedness
+	}
+	return &masked
+}
+
+// mask the table map, the row changes of rows event and the query of ROWS_QUERY_EVENT,
+// it return false if the event is dropped, such as the QUERY_EVENT of DML
+func (m *ColumnMasker) mask(event *BinEvent) (bool, error) {
+	if err := m.compile(); err != nil {
+		return false, err
+	}
+
+	switch body := event.Body.(type) {
+	case *BinQueryEvent:
+		return len(m.Rules) == 0 || !isDMLQuery(body.Query), nil
+
+	case *BinTableMapEvent:
+		// the masked table map is returned, so that the masked rows are written against it
+		mt, err := m.table(body)
+		if err != nil || mt == nil {
+			return err == nil, err
+		}
+		event.Body, event.data = mt.table, nil
+
+	case *BinRowsQueryEvent:
+		body.Query, event.data = "", nil
+
+	case *BinRowsEvent:
+		if body.Table == nil {
+			return true, nil
+		}
+
+		mt, err := m.table(body.Table)
+		if err != nil || mt == nil {
+			return err == nil, err
+		}
+
+		body.Table = mt.table
+		body.ColumnsBitmap1 = mt.bitmap(body.ColumnsBitmap1)
+		if body.ColumnsBitmap2 != nil {
+			body.ColumnsBitmap2 = mt.bitmap(body.ColumnsBitmap2)
+		}
+
+		for _, row := range body.Rows {
+			m.maskImage(mt, row.Before)
+			m.maskImage(mt, row.After)
+			row.beforeData, row.afterData = nil, nil
+		}
+		event.data = nil
+	}
+	return true, nil
+}
+
+// dmlKeywords are the first keywords of statements which may carry column values
+var dmlKeywords = map[string]bool{"INSERT": true, "REPLACE": true, "UPDATE": true, "DELETE": true, "LOAD": true, "WITH": true}
+
+// isDMLQuery return true if the statement is DML, leading comments and parentheses are skipped.
+// Statements with an unterminated comment are taken as DML, as they may contain values.
+func isDMLQuery(query string) bool {
+	q := query
+	for {
+		q = strings.TrimLeft(q, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(q, "/*"):
+			end := strings.Index(q, "*/")
+			if end < 0 {
+				return true
+			}
+			q = q[end+2:]
+			continue
+		case strings.HasPrefix(q, "#"), strings.HasPrefix(q, "-- "):
+			end := strings.IndexByte(q, '\n')
+			if end < 0 {
+				return true
+			}
+			q = q[end+1:]
+			continue
+		}
+		break
+	}
+
+	end := 0
+	for end < len(q) && (q[end] >= 'a' && q[end] <= 'z' || q[end] >= 'A' && q[end] <= 'Z') {
+		end++
+	}
+	return dmlKeywords[strings.ToUpper(q[:end])]
+}
+
+// bitmap return a copy of columns present bitmap, dropped columns are not present
+func (mt *maskedTable) bitmap(bitmap []byte) []byte {
+	masked := append([]byte{}, bitmap...)
+	for i, rule := range mt.rules {
+		if rule != nil && rule.Action == MaskDrop && i/8 < len(masked) {
+			masked[i/8] &^= 1 << uint(i%8)
+		}
+	}
+	return masked
+}
+
+// maskImage mask the values of row image, NULL values are kept
+func (m *ColumnMasker) maskImage(mt *maskedTable, image []interface{}) {
+	for i, v := range image {
+		if i >= len(mt.rules) || mt.rules[i] == nil {
+			continue
+		}
+
+		rule := mt.rules[i]
+		switch {
+		case rule.Action == MaskDrop:
+			image[i] = nil
+
+		case v == nil:
+
+		case rule.Action == MaskHash:
+			h := sha256.New()
+			h.Write([]byte(m.Salt))
+			switch value := v.(type) {
+			case string:
+				h.Write([]byte(value))
+			case []byte:
+				h.Write(value)
+			default:
+				fmt.Fprint(h, value)
+			}
+			image[i] = hex.EncodeToString(h.Sum(nil))
+
+		case rule.Action == MaskConstant:
+			image[i] = rule.Value
+
+		case rule.Action == MaskTruncate:
+			image[i] = truncateValue(v, rule.Length)
+		}
+	}
+}
+
+// truncateValue keep the first n characters of string, or n bytes of binary
+func truncateValue(v interface{}, n int) interface{} {
+	switch value := v.(type) {
+	case string:
+		if utf8.RuneCountInString(value) <= n {
+			return value
+		}
+		return string([]rune(value)[:n])
+	case []byte:
+		if len(value) <= n {
+			return value
+		}
+		return value[:n]
+	}
+	return v
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ParallelSimulator simulates the multi-threaded applier of replicas (replica_parallel_type=LOGICAL_CLOCK)
+// with the last_committed and sequence_number of GTID_EVENT, which are computed by the source with either
+// COMMIT_ORDER or WRITESET dependency tracking.
+//
+// A transaction is dispatched in order to a free worker after all transactions whose sequence_number is
+// not greater than its last_committed are committed. Sequence numbers restart in every binary log, the
+// applier waits for all workers at such a restart, as it does for transactions without logical clock.
+type ParallelSimulator struct {
+	// File is the binary log file name of the transactions added
+	File string
+
+	// Workers are the numbers of workers (replica_parallel_workers) simulated
+	Workers []int
+
+	// PreserveCommitOrder is replica_preserve_commit_order, a worker waits for the commit of the previous
+	// transactions before it's free again
+	PreserveCommitOrder bool
+
+	// Cost return the time to apply a transaction, the bytes of transaction by default
+	Cost func(tx *Transaction) int64
+
+	// TopN is the number of serializing transactions kept
+	TopN int
+
+	report  ParallelReport
+	clocks  []*parallelClock // one clock of every Workers, and the last one of unlimited workers
+	chains  parallelChains
+	lastSeq int64
+}
+
+// ParallelReport is the result of ParallelSimulator
+type ParallelReport struct {
+	Transactions int64 `json:"transactions"`
+
+	// SerialCost is the cost of applying all transactions by one thread
+	SerialCost int64 `json:"serial_cost"`
+
+	// CriticalPath is the cost with unlimited workers, MaxSpeedup is SerialCost / CriticalPath
+	CriticalPath int64   `json:"critical_path"`
+	MaxSpeedup   float64 `json:"max_speedup"`
+
+	// LongestChain is the most transactions in a chain of dependencies
+	LongestChain int64 `json:"longest_chain"`
+
+	// Distances is the histogram of sequence_number - last_committed, Distances[k] counts [2^k, 2^(k+1)),
+	// transactions with distance 1 depend on the previous one
+	Distances []int64 `json:"distances"`
+
+	// SerialTransactions is the number of transactions which can't be applied in parallel with the previous one,
+	// Serializing are the most costly of them
+	SerialTransactions int64                  `json:"serial_transactions"`
+	Serializing        []*ParallelTransaction `json:"serializing"`
+
+	Runs []*ParallelRun `json:"runs"`
+}
+
+// ParallelRun is the simulation of a number of workers
+type ParallelRun struct {
+	Workers int `json:"workers"`
+
+	// Makespan is the cost to apply all transactions, Speedup is SerialCost / Makespan
+	Makespan int64   `json:"makespan"`
+	Speedup  float64 `json:"speedup"`
+
+	// Utilization is the busy ratio of workers
+	Utilization float64 `json:"utilization"`
+}
+
+// ParallelTransaction is a transaction with logical clock
+type ParallelTransaction struct {
+	TransactionStats
+	LastCommitted  int64 `json:"last_committed"`
+	SequenceNumber int64 `json:"sequence_number"`
+	Cost           int64 `json:"cost"`
+}
+
+// NewParallelSimulator return a ParallelSimulator of workers, which keeps 10 serializing transactions
+func NewParallelSimulator(workers ...int) *ParallelSimulator {
+	return &ParallelSimulator{Workers: workers, TopN: defaultStatsTopN}
+}
+
+// parallelClock is the applier of a number of workers
+type parallelClock struct {
+	workers int
+	free    []int64 // time when the worker is free
+
+	// floor is the time when the transactions before sequence numbers restart are committed
+	floor      int64
+	lastStart  int64
+	lastCommit int64
+	maxCommit  int64
+	busy       int64
+
+	// sequence numbers and the prefix max of commit time of transactions since restart
+	seqs    []int64
+	commits []int64
+}
+
+// newParallelClock return a clock of workers, 0 for unlimited workers
+func newParallelClock(workers int) *parallelClock {
+	return &parallelClock{workers: workers, free: make([]int64, workers)}
+}
+
+// restart the sequence numbers, all transactions before must be committed
+func (c *parallelClock) restart() {
+	c.floor = c.maxCommit
+	c.seqs, c.commits = c.seqs[:0], c.commits[:0]
+}
+
+// apply a transaction
+func (c *parallelClock) apply(seq, lastCommitted, cost int64, preserveCommitOrder bool) {
+	start := c.floor
+	if i := sort.Search(len(c.seqs), func(i int) bool { return c.seqs[i] > lastCommitted }); i > 0 && c.commits[i-1] > start {
+		start = c.commits[i-1]
+	}
+	if c.lastStart > start {
+		start = c.lastStart
+	}
+
+	worker := -1
+	for i, free := range c.free {
+		if worker < 0 || free < c.free[worker] {
+			worker = i
+		}
+	}
+	if worker >= 0 && c.free[worker] > start {
+		start = c.free[worker]
+	}
+
+	commit := start + cost
+	if preserveCommitOrder && commit < c.lastCommit {
+		commit = c.lastCommit
+	}
+	if worker >= 0 {
+		c.free[worker] = commit
+	}
+	c.lastStart, c.lastCommit, c.busy = start, commit, c.busy+cost
+	if commit > c.maxCommit {
+		c.maxCommit = commit
+	}
+
+	c.seqs = append(c.seqs, seq)
+	c.commits = append(c.commits, c.maxCommit)
+}
+
+// parallelChains is the dependency chain length of transactions since sequence numbers restart
+type parallelChains struct {
+	floor int64
+	max   int64
+	seqs  []int64
+	chain []int64 // prefix max of chain length
+}
+
+// add a transaction
+func (p *parallelChains) add(seq, lastCommitted int64) {
+	n := p.floor
+	if i := sort.Search(len(p.seqs), func(i int) bool { return p.seqs[i] > lastCommitted }); i > 0 && p.chain[i-1] > n {
+		n = p.chain[i-1]
+	}
+	n++
+	if n > p.max {
+		p.max = n
+	}
+	p.seqs, p.chain = append(p.seqs, seq), append(p.chain, p.max)
+}
+
+// restart the sequence numbers
+func (p *parallelChains) restart() {
+	p.floor = p.max
+	p.seqs, p.chain = p.seqs[:0], p.chain[:0]
+}
+
+// Add a transaction, transactions should be added in order
+func (s *ParallelSimulator) Add(tx *Transaction) {
+	if s.clocks == nil {
+		for _, n := range s.Workers {
+			if n < 1 {
+				n = 1
+			}
+			s.clocks = append(s.clocks, newParallelClock(n))
+		}
+		s.clocks = append(s.clocks, newParallelClock(0))
+	}
+
+	cost := tx.Size()
+	if s.Cost != nil {
+		cost = s.Cost(tx)
+	}
+
+	var seq, lastCommitted int64
+	if tx.GTIDEvent != nil {
+		seq, lastCommitted = tx.GTIDEvent.SequenceNumber, tx.GTIDEvent.LastCommitted
+	}
+	if seq <= 0 || seq <= s.lastSeq || lastCommitted >= seq {
+		// a new binary log, or no logical clock
+		for _, c := range s.clocks {
+			c.restart()
+		}
+		s.chains.restart()
+		if seq <= 0 || lastCommitted >= seq {
+			seq, lastCommitted = 1, 0
+		}
+	}
+	s.lastSeq = seq
+
+	for _, c := range s.clocks {
+		c.apply(seq, lastCommitted, cost, s.PreserveCommitOrder)
+	}
+	s.chains.add(seq, lastCommitted)
+
+	s.report.Transactions++
+	s.report.SerialCost += cost
+
+	distance := seq - lastCommitted
+	k := 0
+	for ; distance > 1; distance >>= 1 {
+		k++
+	}
+	for len(s.report.Distances) <= k {
+		s.report.Distances = append(s.report.Distances, 0)
+	}
+	s.report.Distances[k]++
+
+	if seq-lastCommitted <= 1 {
+		s.report.SerialTransactions++
+		s.addSerializing(&ParallelTransaction{
+			TransactionStats: *newTransactionStats(s.File, tx),
+			LastCommitted:    lastCommitted,
+			SequenceNumber:   seq,
+			Cost:             cost,
+		})
+	}
+}
+
+// addSerializing keep the TopN most costly serializing transactions
+func (s *ParallelSimulator) addSerializing(pt *ParallelTransaction) {
+	if s.TopN <= 0 {
+		return
+	}
+	s.report.Serializing = append(s.report.Serializing, pt)
+	if len(s.report.Serializing) > 2*s.TopN {
+		s.sortSerializing()
+	}
+}
+
+// sortSerializing sort the serializing transactions by cost and truncate them to TopN
+func (s *ParallelSimulator) sortSerializing() {
+	list := s.report.Serializing
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Cost > list[j].Cost })
+	if len(list) > s.TopN {
+		s.report.Serializing = list[:s.TopN]
+	}
+}
+
+// Report return the result of transactions added
+func (s *ParallelSimulator) Report() *ParallelReport {
+	s.sortSerializing()
+	report := s.report
+	report.Serializing = append([]*ParallelTransaction{}, s.report.Serializing...)
+	report.Distances = append([]int64{}, s.report.Distances...)
+	report.LongestChain = s.chains.max
+	report.Runs = []*ParallelRun{}
+
+	if len(s.clocks) == 0 {
+		return &report
+	}
+
+	report.CriticalPath = s.clocks[len(s.clocks)-1].maxCommit
+	if report.CriticalPath > 0 {
+		report.MaxSpeedup = float64(report.SerialCost) / float64(report.CriticalPath)
+	}
+	for _, c := range s.clocks[:len(s.clocks)-1] {
+		run := &ParallelRun{Workers: c.workers, Makespan: c.maxCommit}
+		if run.Makespan > 0 {
+			run.Speedup = float64(report.SerialCost) / float64(run.Makespan)
+			run.Utilization = float64(c.busy) / float64(run.Makespan*int64(c.workers))
+		}
+		report.Runs = append(report.Runs, run)
+	}
+	return &report
+}
+
+// WriteText write the report as text tables
+func (r *ParallelReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Transactions: %d, Serial cost: %d, Critical path: %d, Max speedup: %.2f, Longest chain: %d\n",
+		r.Transactions, r.SerialCost, r.CriticalPath, r.MaxSpeedup, r.LongestChain)
+
+	fmt.Fprintln(tw, "\nWORKERS\tMAKESPAN\tSPEEDUP\tUTILIZATION")
+	for _, run := range r.Runs {
+		fmt.Fprintf(tw, "%d\t%d\t%.2f\t%.1f%%\n", run.Workers, run.Makespan, run.Speedup, run.Utilization*100)
+	}
+
+	fmt.Fprintln(tw, "\nDISTANCE\tTRANSACTIONS")
+	for k, n := range r.Distances {
+		lo, hi := int64(1)<<uint(k), int64(1)<<uint(k+1)-1
+		if lo == hi {
+			fmt.Fprintf(tw, "%d\t%d\n", lo, n)
+		} else {
+			fmt.Fprintf(tw, "%d-%d\t%d\n", lo, hi, n)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nSERIALIZING TRANSACTIONS: %d\nFILE\tGTID\tSTART POS\tEND POS\tLAST COMMITTED\tSEQUENCE NUMBER\tCOST\tROWS\tTABLES\n",
+		r.SerialTransactions)
+	for _, t := range r.Serializing {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", t.File, t.GTID, t.StartPos, t.EndPos,
+			t.LastCommitted, t.SequenceNumber, t.Cost, t.Rows, strings.Join(t.Tables, ","))
+	}
+	return tw.Flush()
+}
+
+// WriteJSON write the report as a JSON object
+func (r *ParallelReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxRecoverEventSize is the max size of a plausible event, events are not larger than max_allowed_packet of 1GB
+const maxRecoverEventSize = 1 << 30
+
+// recoverWindowSize is the bytes read at a time when scanning for the next event
+const recoverWindowSize = 64 << 10
+
+// SkippedRange is the corrupted bytes of binary log skipped in recovery mode, from Start to End exclusive
+type SkippedRange struct {
+	File       string
+	Start, End int64
+
+	// Err is the error of decoding the event at Start
+	Err error
+}
+
+func (r *SkippedRange) String() string {
+	return fmt.Sprintf("skipped %s:%d-%d (%d bytes): %v", r.File, r.Start, r.End, r.End-r.Start, r.Err)
+}
+
+// recoverable return the start offset of the event failed to decode, false if err is not an error of decoding,
+// an unsupported event is intact and is not skipped as corruption
+func recoverable(err error) (int64, bool) {
+	var e positioned
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	var unsupported *ErrUnsupportedEvent
+	if errors.As(err, &unsupported) {
+		return 0, false
+	}
+	return e.position().Offset, true
+}
+
+// resync skip the corrupted bytes from start, the decoder is moved to the next plausible event,
+// or the end of binary log if there is none
+func (decoder *BinFileDecoder) resync(start int64, cause error) error {
+	// offsets of encrypted binary log are in the decrypted stream
+	if decoder.encrypted {
+		return cause
+	}
+
+	info, err := decoder.BinFile.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	headerLength := int64(defaultEventHeaderSize)
+	if decoder.description != nil {
+		headerLength = decoder.description.EventHeaderLength
+	}
+
+	next := size
+	window := make([]byte, recoverWindowSize+headerLength)
+scan:
+	for base := start + 1; base+headerLength <= size; base += recoverWindowSize {
+		n, err := decoder.BinFile.ReadAt(window, base)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		for i := 0; i < recoverWindowSize && int64(i)+headerLength <= int64(n); i++ {
+			if decoder.plausible(window[i:int64(i)+headerLength], base+int64(i), size) {
+				next = base + int64(i)
+				break scan
+			}
+		}
+	}
+
+	if _, err := decoder.BinFile.Seek(next, io.SeekStart); err != nil {
+		return err
+	}
+	decoder.buf.Reset(decoder.BinFile)
+	decoder.offset = next
+
+	if decoder.OnSkip != nil {
+		return decoder.OnSkip(&SkippedRange{File: decoder.Path, Start: start, End: next, Err: cause})
+	}
+	return nil
+}
+
+// plausible return true if an event starts at offset: the event type is known, the size is sane,
+// log_pos is the end of event and the checksum is valid
+func (decoder *BinFileDecoder) plausible(headerData []byte, offset, size int64) bool {
+	headerLength := int64(len(headerData))
+	header, err := decodeEventHeader(headerData, headerLength)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := EventType2Str[header.EventType]; !ok || header.EventType == UnknownEvent {
+		return false
+	}
+
+	if header.EventSize < headerLength || header.EventSize > maxRecoverEventSize || offset+header.EventSize > size {
+		return false
+	}
+
+	// log_pos of relay log events are positions in the binary logs of source
+	if decoder.relay == nil && header.LogPos != offset+header.EventSize {
+		return false
+	}
+
+	data := make([]byte, header.EventSize)
+	if _, err := decoder.BinFile.ReadAt(data, offset); err != nil {
+		return false
+	}
+	event := &BinEvent{Header: header}
+	_, err = event.Validation(decoder.BinaryLogInfo, data[:headerLength:headerLength], data[headerLength:])
+	return err == nil
+}
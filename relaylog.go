@@ -0,0 +1,166 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RelayLogPosition describe where the event is in relay log and in the binary log of source
+type RelayLogPosition struct {
+	// relay log coordinates, RelayPos is the offset of the event in relay log
+	RelayFile string
+	RelayPos  int64
+
+	// source coordinates, the binary log position of source which is received up to this event
+	SourceFile string
+	SourcePos  int64
+}
+
+// relayLogInfo keeps the state of relay log decoding.
+// Relay log starts with the FORMAT_DESCRIPTION_EVENT of replica itself, followed by events from source,
+// including the FORMAT_DESCRIPTION_EVENT of source which describes the following events of source.
+type relayLogInfo struct {
+	// replica's own FORMAT_DESCRIPTION_EVENT and server id
+	serverID    int64
+	description *BinFmtDescEvent
+
+	// FORMAT_DESCRIPTION_EVENT of source
+	sourceDescription *BinFmtDescEvent
+
+	// source coordinates
+	sourceFile string
+	sourcePos  int64
+}
+
+// isReplicaEvent return true if the event is written by replica, not received from source
+func (relay *relayLogInfo) isReplicaEvent(header *BinEventHeader) bool {
+	if header.Flag&(LogEventArtificialF|LogEventRelayLogF) != 0 {
+		return true
+	}
+	return relay.description == nil || header.ServerID == relay.serverID
+}
+
+// format return the FORMAT_DESCRIPTION_EVENT which describes the event
+func (relay *relayLogInfo) format(header *BinEventHeader) *BinFmtDescEvent {
+	if relay.sourceDescription == nil || relay.isReplicaEvent(header) {
+		return relay.description
+	}
+	return relay.sourceDescription
+}
+
+// update the relay log state by decoded event, return the relay log position of the event
+func (relay *relayLogInfo) update(decoder *BinFileDecoder, event *BinEvent, offset int64) *RelayLogPosition {
+	isReplicaEvent := relay.isReplicaEvent(event.Header)
+
+	switch body := event.Body.(type) {
+	case *BinFmtDescEvent:
+		if relay.description == nil || event.Header.ServerID == relay.serverID {
+			relay.serverID = event.Header.ServerID
+			relay.description = body
+		} else {
+			relay.sourceDescription = body
+		}
+
+	case *BinRotateEvent:
+		// fake ROTATE_EVENT tells the source coordinates at the beginning of relay log,
+		// ROTATE_EVENT from source tells the next binary log of source.
+		if event.Header.Flag&LogEventArtificialF != 0 || !isReplicaEvent {
+			relay.sourceFile = body.FileName
+			relay.sourcePos = int64(body.Position)
+		}
+
+	default:
+		if !isReplicaEvent && event.Header.LogPos > 0 {
+			relay.sourcePos = event.Header.LogPos
+		}
+	}
+
+	return &RelayLogPosition{
+		RelayFile:  decoder.Path,
+		RelayPos:   offset,
+		SourceFile: relay.sourceFile,
+		SourcePos:  relay.sourcePos,
+	}
+}
+
+// NewRelayLogDecoder return a BinFileDecoder in relay log mode with relay log file path
+func NewRelayLogDecoder(path string, options ...*BinReaderOption) (*BinFileDecoder, error) {
+	decoder := &BinFileDecoder{
+		Path:  path,
+		relay: &relayLogInfo{},
+	}
+	// set options
+	if len(options) > 0 {
+		decoder.Option = options[0]
+	}
+
+	// decoder init
+	return decoder, decoder.init()
+}
+
+// NewRelayLogIndexDecoder return a BinFileDecoder in relay log mode with relay-log.index path,
+// WalkEvent() will walk all relay logs in the index file in order.
+func NewRelayLogIndexDecoder(indexPath string, options ...*BinReaderOption) (*BinFileDecoder, error) {
+	paths, err := ReadIndexFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no relay log found in %s", indexPath)
+	}
+
+	decoder, err := NewRelayLogDecoder(paths[0], options...)
+	if err != nil {
+		return decoder, err
+	}
+
+	decoder.link(paths[1:])
+	return decoder, nil
+}
+
+// ReadIndexFile return the paths of binary logs or relay logs in index file such as mysql-bin.index.
+// Relative paths are resolved from the directory of the index file.
+func ReadIndexFile(indexPath string) ([]string, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var paths []string
+	dir := filepath.Dir(indexPath)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, scanner.Err()
+}
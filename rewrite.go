@@ -0,0 +1,677 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"io"
+	"strings"
+)
+
+// Rewriter reads a binary log and writes a new one with the rules applied: databases and tables are
+// renamed in QUERY_EVENT and TABLE_MAP_EVENT, events of dropped tables and ROWS_QUERY_EVENT are removed.
+// Event positions and checksums are computed again by BinFileWriter, STMT_END_F is moved to the last rows
+// event kept in statement, and transaction_length of GTID_EVENT (mysql 8.0) is computed again.
+//
+// Names in statements are found by tokens: qualified names such as `db`.`t` anywhere, and unqualified
+// table names after TABLE, INTO, FROM, JOIN, UPDATE, REFERENCES, TO and LIKE of CREATE TABLE.
+// A statement is dropped if ParseDDL() finds a dropped table in it, a DDL is replaced by an empty
+// transaction (BEGIN and COMMIT) to keep its GTID. A statement-based DML is dropped if a dropped table
+// is in its table lists after INSERT, REPLACE, INTO, UPDATE, DELETE, FROM, USING and JOIN, the tables
+// read by INSERT ... SELECT and multi-table UPDATE or DELETE included, since it can't be replayed without them.
+type Rewriter struct {
+	// RenameSchemas maps database names, such as {"prod": "staging"}
+	RenameSchemas map[string]string
+
+	// RenameTables maps 'schema.table' to 'schema.table' or 'table', it takes precedence over RenameSchemas
+	RenameTables map[string]string
+
+	// DropTables are table patterns as EventFilter.ExcludeTables, matched with the names before renaming
+	DropTables []string
+
+	// StripRowsQuery removes ROWS_QUERY_EVENT
+	StripRowsQuery bool
+
+	drop     []*tablePattern
+	writer   *BinFileWriter
+	checksum bool
+
+	// table ids of dropped tables
+	dropped map[uint64]bool
+
+	// begun is true inside BEGIN ... COMMIT of the binary log read
+	begun bool
+
+	// hasGTID is true if the transaction read starts with GTID_EVENT
+	hasGTID bool
+
+	// rows event without STMT_END_F and the TABLE_MAP_EVENTs after it, which are held until the next
+	// rows event or statement is known
+	held []*BinEvent
+
+	// events of the GTID transaction written, held until it ends
+	pending []*BinEvent
+	txBegun bool
+}
+
+// NewRewriter return a Rewriter without rules, which copies the binary log
+func NewRewriter() *Rewriter {
+	return &Rewriter{
+		RenameSchemas: make(map[string]string),
+		RenameTables:  make(map[string]string),
+	}
+}
+
+// Rewrite read the events of decoder and write the rewritten binary log into w
+func (r *Rewriter) Rewrite(w io.Writer, decoder *BinFileDecoder) error {
+	r.drop = nil
+	for _, pattern := range r.DropTables {
+		p, err := newTablePattern(pattern)
+		if err != nil {
+			return err
+		}
+		r.drop = append(r.drop, p)
+	}
+
+	var err error
+	if r.writer, err = NewBinWriter(w); err != nil {
+		return err
+	}
+	r.dropped = make(map[uint64]bool)
+	r.begun, r.hasGTID, r.held, r.pending = false, false, nil, nil
+
+	err = decoder.WalkEvent(func(event *BinEvent) (bool, error) {
+		events, err := r.rewrite(event)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range events {
+			if err := r.emit(e); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the held rows event ends the statement, and the unfinished transaction is written as it is
+	if err = r.release(true); err != nil {
+		return err
+	}
+	if err = r.flush(); err != nil {
+		return err
+	}
+	return r.writer.Flush()
+}
+
+// renameSchema return the new name of database
+func (r *Rewriter) renameSchema(schema string) string {
+	if to, ok := r.RenameSchemas[schema]; ok {
+		return to
+	}
+	return schema
+}
+
+// renameTable return the new database and table name
+func (r *Rewriter) renameTable(schema, table string) (string, string) {
+	if to, ok := r.RenameTables[schema+"."+table]; ok {
+		if i := strings.IndexByte(to, '.'); i >= 0 {
+			return to[:i], to[i+1:]
+		}
+		return r.renameSchema(schema), to
+	}
+	return r.renameSchema(schema), table
+}
+
+// isRenamedTable return true if the table of schema has a rule in RenameTables
+func (r *Rewriter) isRenamedTable(schema, table string) bool {
+	_, ok := r.RenameTables[schema+"."+table]
+	return ok
+}
+
+// dropTable return true if the table is dropped
+func (r *Rewriter) dropTable(schema, table string) bool {
+	for _, p := range r.drop {
+		if p.match(schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite return the events to write for the event read, nil if it's removed
+func (r *Rewriter) rewrite(event *BinEvent) ([]*BinEvent, error) {
+	switch body := event.Body.(type) {
+	case *BinFmtDescEvent:
+		r.checksum = body.ChecksumAlg == BinlogChecksumAlgCRC32
+
+	case *BinGTIDEvent:
+		r.begun, r.hasGTID = false, true
+
+	case *BinXIDEvent, *BinXAPrepareEvent:
+		r.begun, r.hasGTID = false, false
+
+	case *BinRowsQueryEvent:
+		if r.StripRowsQuery {
+			return nil, nil
+		}
+
+	case *BinTableMapEvent:
+		if r.dropTable(body.Schema, body.Table) {
+			r.dropped[body.TableID] = true
+			return nil, nil
+		}
+		delete(r.dropped, body.TableID)
+
+		schema, table := r.renameTable(body.Schema, body.Table)
+		if schema == body.Schema && table == body.Table {
+			break
+		}
+		return []*BinEvent{renameTableMap(event, body, schema, table)}, nil
+
+	case *BinRowsEvent:
+		if r.dropped[body.TableID] {
+			return nil, nil
+		}
+
+	case *BinQueryEvent:
+		return r.rewriteQueryEvent(event, body), nil
+	}
+
+	return []*BinEvent{event}, nil
+}
+
+// rewriteQueryEvent rename the default database and names in statement,
+// the statement of dropped tables is removed, or replaced by an empty transaction if it's DDL with GTID
+func (r *Rewriter) rewriteQueryEvent(event *BinEvent, body *BinQueryEvent) []*BinEvent {
+	kind := queryKind(body.Query)
+	switch kind {
+	case queryBegin, queryXAStart:
+		r.begun = true
+	case queryCommit, queryRollback, queryXACommit, queryXARollback:
+		r.begun, r.hasGTID = false, false
+	}
+
+	query := body.Query
+	if kind == queryStatement {
+		if r.dropQuery(body) {
+			if r.begun || !r.hasGTID {
+				return nil
+			}
+			r.hasGTID = false
+			return []*BinEvent{
+				r.queryEvent(event, body, "BEGIN"),
+				r.queryEvent(event, body, "COMMIT"),
+			}
+		}
+		if !r.begun {
+			r.hasGTID = false
+		}
+		query = r.rewriteQuery(body.Query, body.Schema)
+	}
+
+	if query == body.Query && r.renameSchema(body.Schema) == body.Schema {
+		return []*BinEvent{event}
+	}
+	return []*BinEvent{r.queryEvent(event, body, query)}
+}
+
+// queryEvent return a QUERY_EVENT of query with the header and status of event, the default database is renamed
+func (r *Rewriter) queryEvent(event *BinEvent, body *BinQueryEvent, query string) *BinEvent {
+	header := *event.Header
+	q := *body
+	q.Schema = r.renameSchema(body.Schema)
+	q.StatusVars = renameUpdatedDBNames(body.StatusVars, r.renameSchema)
+	q.Query = query
+	return &BinEvent{Header: &header, Body: &q, data: encodeQueryEvent(&q)}
+}
+
+// dropQuery return true if the statement changes a dropped table
+func (r *Rewriter) dropQuery(body *BinQueryEvent) bool {
+	if len(r.drop) == 0 {
+		return false
+	}
+	stmt, err := ParseDDL(body.Query)
+	if err != nil {
+		return false
+	}
+	if stmt == nil {
+		for _, t := range statementTables(body.Query, body.Schema) {
+			if r.dropTable(t.Schema, t.Table) {
+				return true
+			}
+		}
+		return false
+	}
+
+	tables := append([]TableName{stmt.Table}, stmt.Tables...)
+	if stmt.Like != nil {
+		tables = append(tables, *stmt.Like)
+	}
+	for _, rename := range stmt.Renames {
+		tables = append(tables, rename[0], rename[1])
+	}
+	for _, alter := range stmt.Alters {
+		tables = append(tables, alter.Table)
+	}
+	for _, t := range tables {
+		if t.Table == "" {
+			continue
+		}
+		if t.Schema == "" {
+			t.Schema = body.Schema
+		}
+		if r.dropTable(t.Schema, t.Table) {
+			return true
+		}
+	}
+	return stmt.Database != "" && r.dropTable(stmt.Database, "")
+}
+
+// keywords before the table lists of DML, and keywords ending them
+var (
+	dmlTableKeywords  = []string{"INSERT", "REPLACE", "INTO", "UPDATE", "DELETE", "FROM", "USING", "JOIN", "STRAIGHT_JOIN"}
+	dmlClauseKeywords = []string{"SET", "WHERE", "ON", "VALUES", "VALUE", "SELECT", "ORDER", "GROUP", "HAVING",
+		"LIMIT", "PARTITION", "WINDOW", "DUPLICATE"}
+)
+
+// statementTables return the tables in the table lists of a statement-based DML,
+// unqualified names are in the default database schema
+func statementTables(query, schema string) []TableName {
+	tokens, err := tokenizeDDL(query)
+	if err != nil {
+		return nil
+	}
+
+	isName := func(i int) bool {
+		return i < len(tokens) && (tokens[i].kind == ddlWord || tokens[i].kind == ddlIdent)
+	}
+	isSymbol := func(i int, symbol string) bool {
+		return i < len(tokens) && tokens[i].kind == ddlSymbol && tokens[i].text == symbol
+	}
+
+	var tables []TableName
+	inList, expectTable := false, false
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		word := t.kind == ddlWord
+
+		switch {
+		case word && containsKeyword(dmlTableKeywords, t.text):
+			inList, expectTable = true, true
+
+		case word && containsKeyword(dmlClauseKeywords, t.text):
+			inList, expectTable = false, false
+
+		case word && expectTable && containsKeyword(nameModifiers, t.text):
+			// IGNORE, LOW_PRIORITY ...
+
+		case isName(i) && expectTable:
+			table := TableName{Schema: schema, Table: t.text}
+			if isSymbol(i+1, ".") && isName(i+2) {
+				table = TableName{Schema: t.text, Table: tokens[i+2].text}
+				i += 2
+			}
+			tables = append(tables, table)
+			expectTable = false
+
+		case isSymbol(i, ",") && inList:
+			expectTable = true
+
+		case t.kind == ddlSymbol:
+			// column list of INSERT, subquery and expressions
+			inList, expectTable = false, false
+
+		default:
+			// alias of table
+			expectTable = false
+		}
+	}
+	return tables
+}
+
+// contexts of names in statement
+const (
+	nameContextNone = iota
+	nameContextTable
+	nameContextSchema
+)
+
+// keywords before table names, and keywords between them and the names
+var (
+	tableNameKeywords  = []string{"TABLE", "INTO", "FROM", "JOIN", "UPDATE", "REFERENCES", "TO"}
+	schemaNameKeywords = []string{"DATABASE", "SCHEMA", "USE"}
+	nameModifiers      = []string{"IF", "NOT", "EXISTS", "TEMPORARY", "IGNORE", "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "QUICK"}
+)
+
+// containsKeyword return true if word is one of the keywords
+func containsKeyword(keywords []string, word string) bool {
+	for _, keyword := range keywords {
+		if strings.EqualFold(keyword, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteQuery rename the databases and tables in statement, schema is the default database
+func (r *Rewriter) rewriteQuery(query, schema string) string {
+	if len(r.RenameSchemas) == 0 && len(r.RenameTables) == 0 {
+		return query
+	}
+	tokens, err := tokenizeDDL(query)
+	if err != nil || len(tokens) == 0 {
+		return query
+	}
+
+	var buf strings.Builder
+	last := 0
+	replace := func(t ddlToken, name string) {
+		buf.WriteString(query[last:t.start])
+		buf.WriteString(name)
+		last = t.end
+	}
+
+	isName := func(i int) bool {
+		return i < len(tokens) && (tokens[i].kind == ddlWord || tokens[i].kind == ddlIdent)
+	}
+	isDot := func(i int) bool {
+		return i >= 0 && i < len(tokens) && tokens[i].kind == ddlSymbol && tokens[i].text == "."
+	}
+	isCreate := tokens[0].kind == ddlWord && strings.EqualFold(tokens[0].text, "CREATE")
+
+	context, afterTable := nameContextNone, false
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		word := t.kind == ddlWord
+
+		switch {
+		case isName(i) && isDot(i+1) && isName(i+2) && !isDot(i-1):
+			// schema.table, or table.column of a renamed table in default database
+			first, second := r.renameTable(t.text, tokens[i+2].text)
+			isColumn := first == t.text && !r.isRenamedTable(t.text, tokens[i+2].text) && r.isRenamedTable(schema, t.text)
+			if newSchema, newTable := r.renameTable(schema, t.text); isColumn && newSchema == r.renameSchema(schema) {
+				first, second = newTable, tokens[i+2].text
+			}
+			if first != t.text {
+				replace(t, quoteIdentifier(first))
+			}
+			if second != tokens[i+2].text {
+				replace(tokens[i+2], quoteIdentifier(second))
+			}
+			afterTable = context == nameContextTable
+			context = nameContextNone
+			i += 2
+			continue
+
+		case word && (containsKeyword(tableNameKeywords, t.text) || isCreate && strings.EqualFold(t.text, "LIKE")):
+			context = nameContextTable
+
+		case word && containsKeyword(schemaNameKeywords, t.text):
+			context = nameContextSchema
+
+		case word && context != nameContextNone && containsKeyword(nameModifiers, t.text):
+			// IF NOT EXISTS, TEMPORARY ...
+
+		case t.kind == ddlSymbol && t.text == "," && afterTable:
+			context = nameContextTable
+
+		case isName(i) && !isDot(i-1) && context == nameContextTable:
+			newSchema, newTable := r.renameTable(schema, t.text)
+			if newSchema != r.renameSchema(schema) {
+				replace(t, quoteIdentifier(newSchema)+"."+quoteIdentifier(newTable))
+			} else if newTable != t.text {
+				replace(t, quoteIdentifier(newTable))
+			}
+			context, afterTable = nameContextNone, true
+			continue
+
+		case isName(i) && !isDot(i-1) && context == nameContextSchema:
+			if newSchema := r.renameSchema(t.text); newSchema != t.text {
+				replace(t, quoteIdentifier(newSchema))
+			}
+			context = nameContextNone
+
+		default:
+			context = nameContextNone
+		}
+		afterTable = false
+	}
+
+	if last == 0 {
+		return query
+	}
+	buf.WriteString(query[last:])
+	return buf.String()
+}
+
+// renameTableMap return the TABLE_MAP_EVENT of new names, the event data is patched
+// so that the optional metadata is kept as it was
+func renameTableMap(event *BinEvent, body *BinTableMapEvent, schema, table string) *BinEvent {
+	header := *event.Header
+	t := *body
+	t.Schema, t.Table = schema, table
+	renamed := &BinEvent{Header: &header, Body: &t}
+	if event.data == nil {
+		return renamed
+	}
+
+	// [table id][flags][schema length][schema]0x00[table length][table]0x00...
+	pos := body.tableIDLen + 2
+	rest := pos + 1 + len(body.Schema) + 1 + 1 + len(body.Table) + 1
+	data := append([]byte{}, event.data[:pos]...)
+	data = append(data, byte(len(schema)))
+	data = append(data, schema...)
+	data = append(data, 0x00, byte(len(table)))
+	data = append(data, table...)
+	data = append(data, 0x00)
+	renamed.data = append(data, event.data[rest:]...)
+	return renamed
+}
+
+// renameUpdatedDBNames rename the databases of Q_UPDATED_DB_NAMES in status vars,
+// status vars are kept as they are if there is an unknown one
+func renameUpdatedDBNames(vars []byte, rename func(string) string) []byte {
+	for pos := 0; pos < len(vars); {
+		key := vars[pos]
+		pos++
+
+		if n, ok := queryStatusVarLength[key]; ok {
+			pos += n
+			continue
+		}
+
+		switch key {
+		case QCatalog:
+			if pos >= len(vars) {
+				return vars
+			}
+			pos += 1 + int(vars[pos]) + 1
+		case QTimeZoneCode, QCatalogNZCode:
+			if pos >= len(vars) {
+				return vars
+			}
+			pos += 1 + int(vars[pos])
+		case QInvokers:
+			for i := 0; i < 2 && pos < len(vars); i++ {
+				pos += 1 + int(vars[pos])
+			}
+		case QUpdatedDBNames:
+			// [count]([name]0x00)*, count 254 means too many databases and no names
+			if pos >= len(vars) || vars[pos] == 254 {
+				return vars
+			}
+			count := int(vars[pos])
+			start, names := pos, []string{}
+			pos++
+			for i := 0; i < count; i++ {
+				end := pos
+				for end < len(vars) && vars[end] != 0x00 {
+					end++
+				}
+				if end >= len(vars) {
+					return vars
+				}
+				names = append(names, rename(string(vars[pos:end])))
+				pos = end + 1
+			}
+
+			data := append([]byte{}, vars[:start]...)
+			data = append(data, byte(count))
+			for _, name := range names {
+				data = append(append(data, name...), 0x00)
+			}
+			return append(data, vars[pos:]...)
+		default:
+			return vars
+		}
+	}
+	return vars
+}
+
+// emit a rewritten event, rows event without STMT_END_F is held until the next event is known,
+// it ends the statement if the rows events after it are removed
+func (r *Rewriter) emit(event *BinEvent) error {
+	switch body := event.Body.(type) {
+	case *BinTableMapEvent:
+		// tables of a statement may be mapped between its rows events
+		if r.held != nil {
+			r.held = append(r.held, event)
+			return nil
+		}
+
+	case *BinRowsEvent:
+		if err := r.release(false); err != nil {
+			return err
+		}
+		if body.Flags&RowsEventStmtEndF == 0 {
+			r.held = []*BinEvent{event}
+			return nil
+		}
+		return r.push(event)
+	}
+
+	if err := r.release(true); err != nil {
+		return err
+	}
+	return r.push(event)
+}
+
+// release push the held events, the held rows event ends the statement if end is true
+func (r *Rewriter) release(end bool) error {
+	held := r.held
+	r.held = nil
+	if held != nil && end {
+		held[0].Body.(*BinRowsEvent).Flags |= RowsEventStmtEndF
+	}
+	for _, event := range held {
+		if err := r.push(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// push an event to writer, events of GTID transaction are held until it ends
+func (r *Rewriter) push(event *BinEvent) error {
+	if _, ok := event.Body.(*BinGTIDEvent); ok {
+		if err := r.flush(); err != nil {
+			return err
+		}
+		r.pending, r.txBegun = []*BinEvent{event}, false
+		return nil
+	}
+
+	if r.pending == nil {
+		return r.writer.WriteEvent(event)
+	}
+	r.pending = append(r.pending, event)
+
+	end := false
+	switch body := event.Body.(type) {
+	case *BinXIDEvent, *BinXAPrepareEvent:
+		end = true
+	case *BinQueryEvent:
+		switch queryKind(body.Query) {
+		case queryBegin, queryXAStart:
+			r.txBegun = true
+		case queryXAEnd:
+		case queryStatement:
+			end = !r.txBegun
+		default:
+			end = true
+		}
+	}
+	if end {
+		return r.flush()
+	}
+	return nil
+}
+
+// flush write the events of GTID transaction, with transaction_length of GTID_EVENT computed again
+func (r *Rewriter) flush() error {
+	events := r.pending
+	r.pending = nil
+	if len(events) == 0 {
+		return nil
+	}
+
+	events[0] = r.transactionLength(events)
+	for _, event := range events {
+		if err := r.writer.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transactionLength return the GTID_EVENT with transaction_length of events, which includes itself
+func (r *Rewriter) transactionLength(events []*BinEvent) *BinEvent {
+	gtid := events[0].Body.(*BinGTIDEvent)
+	if gtid.TransactionLength == 0 {
+		return events[0]
+	}
+
+	size := func(data []byte) uint64 {
+		n := uint64(defaultEventHeaderSize) + uint64(len(data))
+		if r.checksum {
+			n += binlogChecksumLength
+		}
+		return n
+	}
+
+	var length uint64
+	for _, event := range events[1:] {
+		if event.data == nil {
+			return events[0]
+		}
+		length += size(event.data)
+	}
+
+	// the size of length encoded transaction_length may change with itself
+	body := *gtid
+	for i := 0; i < 3; i++ {
+		body.TransactionLength = length + size(encodeGTIDEvent(&body))
+	}
+	if body.TransactionLength == gtid.TransactionLength {
+		return events[0]
+	}
+
+	header := *events[0].Header
+	return &BinEvent{Header: &header, Body: &body, data: encodeGTIDEvent(&body)}
+}
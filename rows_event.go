@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"strings"
 )
 
 func bitmapByteSize(columnCount int) int {
@@ -39,11 +40,37 @@ type BinTableMapEvent struct {
 	ColumnTypeDef []byte
 	ColumnMetaDef []uint16
 	NullBitmap    []byte
+
+	// optional metadata, mysql >= 8.0.1
+	// column names, enum & set values and primary key need binlog_row_metadata=FULL
+	Signedness    []byte
+	ColumnCharset []uint64
+	ColumnNames   []string
+	EnumValues    [][]string
+	SetValues     [][]string
+	PrimaryKey    []int
 }
 
+// TABLE_MAP_EVENT optional metadata types
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classbinary__log_1_1Table__map__event.html
+const (
+	tableMapSignedness               = 1
+	tableMapDefaultCharset           = 2
+	tableMapColumnCharset            = 3
+	tableMapColumnName               = 4
+	tableMapSetStrValue              = 5
+	tableMapEnumStrValue             = 6
+	tableMapGeometryType             = 7
+	tableMapSimplePrimaryKey         = 8
+	tableMapPrimaryKeyWithPrefix     = 9
+	tableMapEnumAndSetDefaultCharset = 10
+	tableMapEnumAndSetColumnCharset  = 11
+	tableMapColumnVisibility         = 12
+)
+
 // Init BinTableMapEvent tableIDLen
 func (e *BinTableMapEvent) Init(h *BinFmtDescEvent) *BinTableMapEvent {
-	if int(h.EventTypeHeader[TableMapEvent-1]) == 6 {
+	if len(h.EventTypeHeader) >= TableMapEvent && int(h.EventTypeHeader[TableMapEvent-1]) == 6 {
 		e.tableIDLen = 4
 	} else {
 		e.tableIDLen = 6
@@ -57,6 +84,9 @@ func decodeTableMapEvent(data []byte, h *BinFmtDescEvent) (*BinTableMapEvent, er
 	// set table id
 	event = event.Init(h)
 	pos := event.tableIDLen
+	if len(data) < pos+2+1 {
+		return nil, fmt.Errorf("invalid TABLE_MAP_EVENT length %d", len(data))
+	}
 	event.TableID = FixedLengthInt(data[:pos])
 
 	// set flags
@@ -66,12 +96,18 @@ func decodeTableMapEvent(data []byte, h *BinFmtDescEvent) (*BinTableMapEvent, er
 	// set schema && skip 0x00
 	schemaLength := int(data[pos])
 	pos++
+	if len(data) < pos+schemaLength+2 {
+		return nil, fmt.Errorf("invalid TABLE_MAP_EVENT schema length %d", schemaLength)
+	}
 	event.Schema = string(data[pos : pos+schemaLength])
 	pos += schemaLength + 1
 
 	// set table && skip 0x00
 	tableLength := int(data[pos])
 	pos++
+	if len(data) < pos+tableLength+2 {
+		return nil, fmt.Errorf("invalid TABLE_MAP_EVENT table length %d", tableLength)
+	}
 	event.Table = string(data[pos : pos+tableLength])
 	pos += tableLength + 1
 
@@ -79,6 +115,9 @@ func decodeTableMapEvent(data []byte, h *BinFmtDescEvent) (*BinTableMapEvent, er
 	var n int
 	event.ColumnCount, _, n = LengthEncodedInt(data[pos:])
 	pos += n
+	if pos > len(data) || event.ColumnCount > uint64(len(data)-pos) {
+		return nil, fmt.Errorf("invalid TABLE_MAP_EVENT column count %d", event.ColumnCount)
+	}
 
 	// column_type_def (string.var_len)
 	// array of column definitions, one byte per field type
@@ -99,18 +138,247 @@ func decodeTableMapEvent(data []byte, h *BinFmtDescEvent) (*BinTableMapEvent, er
 	pos += n
 
 	// null_bitmap (string.var_len) [len=(column_count + 8) / 7]
-	if len(data[pos:]) == bitmapByteSize(int(event.ColumnCount)) {
-		event.NullBitmap = data[pos:]
-		return event, nil
+	nullBitmapSize := bitmapByteSize(int(event.ColumnCount))
+	if len(data[pos:]) < nullBitmapSize {
+		return event, &ErrTruncatedEvent{Expected: int64(pos + nullBitmapSize), Actual: int64(len(data))}
 	}
+	event.NullBitmap = data[pos : pos+nullBitmapSize]
+	pos += nullBitmapSize
 
-	return event, io.EOF
+	// optional metadata
+	if err := event.decodeOptionalMeta(data[pos:]); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// IsNumericColumn return true if the column is numeric, which has signedness in optional metadata
+func (e *BinTableMapEvent) IsNumericColumn(i int) bool {
+	switch e.ColumnTypeDef[i] {
+	case MySQLTypeTiny, MySQLTypeShort, MySQLTypeInt24, MySQLTypeLong, MySQLTypeLonglong,
+		MySQLTypeNewDecimal, MySQLTypeFloat, MySQLTypeDouble:
+		return true
+	}
+	return false
+}
+
+// IsCharacterColumn return true if the column is character, which has charset in optional metadata
+func (e *BinTableMapEvent) IsCharacterColumn(i int) bool {
+	switch e.RealType(i) {
+	case MySQLTypeString, MySQLTypeVarString, MySQLTypeVarchar, MySQLTypeBlob:
+		return true
+	}
+	return false
+}
+
+// RealType return the real type of column, ENUM and SET columns are written as MySQLTypeString
+func (e *BinTableMapEvent) RealType(i int) byte {
+	return realType(e.ColumnTypeDef[i], e.ColumnMetaDef[i])
+}
+
+// IsUnsigned return true if the column is unsigned, it's known only if optional metadata is written
+func (e *BinTableMapEvent) IsUnsigned(i int) bool {
+	if len(e.Signedness) == 0 || !e.IsNumericColumn(i) {
+		return false
+	}
+
+	// the signedness bitmap only has bits of numeric columns
+	n := 0
+	for j := 0; j < i; j++ {
+		if e.IsNumericColumn(j) {
+			n++
+		}
+	}
+	return n/8 < len(e.Signedness) && e.Signedness[n/8]&(0x80>>uint(n%8)) != 0
+}
+
+// ColumnName return the name of column, '@N' as mysqlbinlog does if column names are not written
+func (e *BinTableMapEvent) ColumnName(i int) string {
+	if i < len(e.ColumnNames) {
+		return e.ColumnNames[i]
+	}
+	return fmt.Sprintf("@%d", i+1)
+}
+
+// IsNullable return true if the column can be NULL
+func (e *BinTableMapEvent) IsNullable(i int) bool {
+	return i/8 < len(e.NullBitmap) && e.NullBitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+// decodeOptionalMeta decode optional metadata of TABLE_MAP_EVENT, every field is [type][length][value]
+func (e *BinTableMapEvent) decodeOptionalMeta(data []byte) error {
+	for pos := 0; pos < len(data); {
+		typ := data[pos]
+		pos++
+
+		if pos >= len(data) {
+			return io.ErrUnexpectedEOF
+		}
+		length, _, n := LengthEncodedInt(data[pos:])
+		pos += n
+		if pos > len(data) || length > uint64(len(data)-pos) {
+			return io.ErrUnexpectedEOF
+		}
+		value := data[pos : pos+int(length)]
+		pos += int(length)
+
+		var err error
+		switch typ {
+		case tableMapSignedness:
+			e.Signedness = value
+		case tableMapDefaultCharset:
+			err = e.decodeDefaultCharset(value)
+		case tableMapColumnCharset:
+			err = e.decodeColumnCharset(value)
+		case tableMapColumnName:
+			e.ColumnNames, err = decodeStringList(value, -1)
+		case tableMapSetStrValue:
+			e.SetValues, err = e.decodeTypeValues(value, MySQLTypeSet)
+		case tableMapEnumStrValue:
+			e.EnumValues, err = e.decodeTypeValues(value, MySQLTypeEnum)
+		case tableMapSimplePrimaryKey:
+			e.PrimaryKey, err = decodeIntList(value, 1)
+		case tableMapPrimaryKeyWithPrefix:
+			e.PrimaryKey, err = decodeIntList(value, 2)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeDefaultCharset decode [default collation]([character column index][collation])*
+func (e *BinTableMapEvent) decodeDefaultCharset(data []byte) error {
+	list, err := decodeIntList(data, 1)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+
+	collations := make([]uint64, 0, e.ColumnCount)
+	for i := 0; i < int(e.ColumnCount); i++ {
+		if e.IsCharacterColumn(i) {
+			collations = append(collations, uint64(list[0]))
+		}
+	}
+	for i := 1; i+1 < len(list); i += 2 {
+		if list[i] >= 0 && list[i] < len(collations) {
+			collations[list[i]] = uint64(list[i+1])
+		}
+	}
+	e.setCharacterCollations(collations)
+	return nil
+}
+
+// decodeColumnCharset decode collation of every character column
+func (e *BinTableMapEvent) decodeColumnCharset(data []byte) error {
+	list, err := decodeIntList(data, 1)
+	if err != nil {
+		return err
+	}
+
+	collations := make([]uint64, len(list))
+	for i, v := range list {
+		collations[i] = uint64(v)
+	}
+	e.setCharacterCollations(collations)
+	return nil
+}
+
+// setCharacterCollations set collations of character columns in order
+func (e *BinTableMapEvent) setCharacterCollations(collations []uint64) {
+	e.ColumnCharset = make([]uint64, e.ColumnCount)
+	n := 0
+	for i := 0; i < int(e.ColumnCount) && n < len(collations); i++ {
+		if e.IsCharacterColumn(i) {
+			e.ColumnCharset[i] = collations[n]
+			n++
+		}
+	}
+}
+
+// decodeTypeValues decode enum or set values of every enum or set column, indexed by column
+func (e *BinTableMapEvent) decodeTypeValues(data []byte, typ byte) ([][]string, error) {
+	values := make([][]string, e.ColumnCount)
+	pos := 0
+	for i := 0; i < int(e.ColumnCount) && pos < len(data); i++ {
+		if e.RealType(i) != typ {
+			continue
+		}
+
+		count, _, n := LengthEncodedInt(data[pos:])
+		if pos += n; pos > len(data) || count > uint64(len(data)-pos) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		list, err := decodeStringList(data[pos:], int(count))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range list {
+			pos += lengthEncodedIntSize(uint64(len(v))) + len(v)
+		}
+		values[i] = list
+	}
+	return values, nil
+}
+
+// decodeStringList decode length encoded strings, decode all if count < 0
+func decodeStringList(data []byte, count int) ([]string, error) {
+	var list []string
+	for pos := 0; pos < len(data) && (count < 0 || len(list) < count); {
+		v, _, n, err := LengthEnodedString(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, string(v))
+		pos += n
+	}
+
+	if count >= 0 && len(list) != count {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return list, nil
+}
+
+// decodeIntList decode length encoded integers, only the first of every group is returned if group > 1
+func decodeIntList(data []byte, group int) ([]int, error) {
+	var list []int
+	for pos, i := 0, 0; pos < len(data); i++ {
+		v, _, n := LengthEncodedInt(data[pos:])
+		if pos+n > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		pos += n
+		if i%group == 0 {
+			list = append(list, int(v))
+		}
+	}
+	return list, nil
+}
+
+// lengthEncodedIntSize return the size of length encoded integer
+func lengthEncodedIntSize(n uint64) int {
+	switch {
+	case n < 251:
+		return 1
+	case n < 1<<16:
+		return 3
+	case n < 1<<24:
+		return 4
+	}
+	return 9
 }
 
 func (e *BinTableMapEvent) decodeMeta(data []byte) error {
 	pos := 0
 	e.ColumnMetaDef = make([]uint16, e.ColumnCount)
 	for i, t := range e.ColumnTypeDef {
+		if err := needBytes(data[pos:], columnMetaSize(t)); err != nil {
+			return fmt.Errorf("invalid TABLE_MAP_EVENT meta length %d", len(data))
+		}
+
 		switch t {
 		case MySQLTypeString:
 			// real type
@@ -143,11 +411,24 @@ func (e *BinTableMapEvent) decodeMeta(data []byte) error {
 	return nil
 }
 
+// columnMetaSize return the bytes of column meta in TABLE_MAP_EVENT by column type
+func columnMetaSize(t byte) int {
+	switch t {
+	case MySQLTypeString, MySQLTypeNewDecimal, MySQLTypeVarString, MySQLTypeVarchar, MySQLTypeBit:
+		return 2
+	case MySQLTypeBlob, MySQLTypeDouble, MySQLTypeFloat, MySQLTypeGeometry, MySQLTypeJSON,
+		MySQLTypeTime2, MySQLTypeDatetime2, MySQLTypeTimestamp2:
+		return 1
+	}
+	return 0
+}
+
 // BinRowsEvent describe MySQL ROWS_EVENT
 // https://dev.mysql.com/doc/internals/en/rows-event.html
 type BinRowsEvent struct {
 	BaseEventBody
 	// header
+	Type       uint8
 	Version    int
 	TableID    uint64
 	tableIDLen int
@@ -161,18 +442,51 @@ type BinRowsEvent struct {
 	// if UPDATE_ROWS_EVENTv1 or v2
 	ColumnsBitmap2 []byte
 
+	// table of TableID, rows are decoded only if the TABLE_MAP_EVENT is known
+	Table *BinTableMapEvent
+
 	// rows
-	// TODO
+	Rows []*BinRowChange
+
+	// offset of rows in event body
+	rowsOffset int
+}
+
+// BinRowChange is a row changed by ROWS_EVENT, Before is nil for WRITE_ROWS_EVENT and After is nil for DELETE_ROWS_EVENT.
+// Values are indexed by column, columns not present in the row image are nil too.
+type BinRowChange struct {
+	Before []interface{}
+	After  []interface{}
+
+	// row images in event body
+	beforeData []byte
+	afterData  []byte
 }
 
+// ROWS_EVENT flags
+const (
+	RowsEventStmtEndF       = 0x0001
+	RowsEventNoForeignKeyF  = 0x0002
+	RowsEventRelaxedUniqueF = 0x0004
+	RowsEventCompleteRowsF  = 0x0008
+)
+
+// row change actions
+const (
+	RowsActionInsert = "insert"
+	RowsActionUpdate = "update"
+	RowsActionDelete = "delete"
+)
+
 // Init BinRowsEvent, adding version and table_id length
 func (e *BinRowsEvent) Init(h *BinFmtDescEvent, eventType uint8) *BinRowsEvent {
-	if int(h.EventTypeHeader[eventType-1]) == 6 {
+	if len(h.EventTypeHeader) >= int(eventType) && int(h.EventTypeHeader[eventType-1]) == 6 {
 		e.tableIDLen = 4
 	} else {
 		e.tableIDLen = 6
 	}
 
+	e.Type = eventType
 	switch eventType {
 	case WriteRowsEventV0, UpdateRowsEventV0, DeleteRowsEventV0:
 		e.Version = 0
@@ -185,12 +499,35 @@ func (e *BinRowsEvent) Init(h *BinFmtDescEvent, eventType uint8) *BinRowsEvent {
 	return e
 }
 
-func decodeRowsEvent(data []byte, h *BinFmtDescEvent, typ uint8) (*BinRowsEvent, error) {
+// Action return insert, update or delete
+func (e *BinRowsEvent) Action() string {
+	switch e.Type {
+	case WriteRowsEventV0, WriteRowsEventV1, WriteRowsEventV2:
+		return RowsActionInsert
+	case UpdateRowsEventV0, UpdateRowsEventV1, UpdateRowsEventV2:
+		return RowsActionUpdate
+	}
+	return RowsActionDelete
+}
+
+// IsPresent return true if the column is present in before image (or after image if isAfter)
+func (e *BinRowsEvent) IsPresent(i int, isAfter bool) bool {
+	bitmap := e.ColumnsBitmap1
+	if isAfter && e.ColumnsBitmap2 != nil {
+		bitmap = e.ColumnsBitmap2
+	}
+	return i/8 < len(bitmap) && bitmap[i/8]&(1<<uint(i%8)) != 0
+}
+
+func decodeRowsEvent(data []byte, h *BinFmtDescEvent, typ uint8, tables map[uint64]*BinTableMapEvent) (*BinRowsEvent, error) {
 	event := &BinRowsEvent{}
 	event = event.Init(h, typ)
 
 	// set table id
 	pos := event.tableIDLen
+	if len(data) < pos+2 {
+		return nil, fmt.Errorf("invalid %s length %d", EventType2Str[typ], len(data))
+	}
 	event.TableID = FixedLengthInt(data[:pos])
 
 	// set flags
@@ -199,17 +536,26 @@ func decodeRowsEvent(data []byte, h *BinFmtDescEvent, typ uint8) (*BinRowsEvent,
 
 	// set extraDataLength
 	if event.Version == 2 {
-		extraDataLen := binary.LittleEndian.Uint16(data[pos:])
+		if len(data) < pos+2 {
+			return nil, fmt.Errorf("invalid %s length %d", EventType2Str[typ], len(data))
+		}
+		extraDataLen := int(binary.LittleEndian.Uint16(data[pos:]))
 		pos += 2
 
-		event.ExtraData = data[pos : pos+int(extraDataLen-2)]
-		pos += int(extraDataLen - 2)
+		if extraDataLen < 2 || len(data) < pos+extraDataLen-2 {
+			return nil, fmt.Errorf("invalid %s extra data length %d", EventType2Str[typ], extraDataLen)
+		}
+		event.ExtraData = data[pos : pos+extraDataLen-2]
+		pos += extraDataLen - 2
 	}
 
 	// body
 	var n int
 	event.ColumnCount, _, n = LengthEncodedInt(data[pos:])
 	pos += n
+	if pos > len(data) || event.ColumnCount > uint64(len(data)-pos)*8 {
+		return nil, fmt.Errorf("invalid %s column count %d", EventType2Str[typ], event.ColumnCount)
+	}
 
 	// columns-present-bitmap1
 	bitCount := bitmapByteSize(int(event.ColumnCount))
@@ -218,11 +564,127 @@ func decodeRowsEvent(data []byte, h *BinFmtDescEvent, typ uint8) (*BinRowsEvent,
 
 	// columns-present-bitmap2
 	if typ == UpdateRowsEventV1 || typ == UpdateRowsEventV2 {
+		if len(data) < pos+bitCount {
+			return nil, fmt.Errorf("invalid %s length %d", EventType2Str[typ], len(data))
+		}
 		event.ColumnsBitmap2 = data[pos : pos+bitCount]
-		// pos += bitCount
+		pos += bitCount
+	}
+
+	// rows can not be decoded without table map
+	table, ok := tables[event.TableID]
+	if !ok {
+		return event, nil
 	}
 
-	// TODO Unfinished
+	if table.ColumnCount != event.ColumnCount {
+		return nil, fmt.Errorf("column count %d of table %s.%s mismatch with rows event %d",
+			table.ColumnCount, table.Schema, table.Table, event.ColumnCount)
+	}
+
+	event.Table = table
+	event.rowsOffset = pos
+	for pos < len(data) {
+		row := &BinRowChange{}
+		image, n, err := event.decodeImage(data[pos:], event.ColumnsBitmap1)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("empty row image of %s", EventType2Str[typ])
+		}
+		imageData := data[pos : pos+n]
+		pos += n
+
+		switch event.Action() {
+		case RowsActionInsert:
+			row.After, row.afterData = image, imageData
+		case RowsActionDelete:
+			row.Before, row.beforeData = image, imageData
+		case RowsActionUpdate:
+			row.Before, row.beforeData = image, imageData
+			if row.After, n, err = event.decodeImage(data[pos:], event.ColumnsBitmap2); err != nil {
+				return nil, err
+			}
+			row.afterData = data[pos : pos+n]
+			pos += n
+		}
+
+		event.Rows = append(event.Rows, row)
+	}
 
 	return event, nil
 }
+
+// decodeImage decode a row image, [null-bitmap][values of present and not null columns]
+func (e *BinRowsEvent) decodeImage(data []byte, present []byte) ([]interface{}, int, error) {
+	columnCount := int(e.ColumnCount)
+	presentCount := 0
+	for i := 0; i < columnCount; i++ {
+		if present[i/8]&(1<<uint(i%8)) != 0 {
+			presentCount++
+		}
+	}
+
+	// null-bitmap only has bits of present columns
+	pos := bitmapByteSize(presentCount)
+	if len(data) < pos {
+		return nil, 0, &ErrTruncatedEvent{Expected: int64(pos), Actual: int64(len(data))}
+	}
+	nullBitmap := data[:pos]
+
+	row := make([]interface{}, columnCount)
+	for i, bit := 0, 0; i < columnCount; i++ {
+		if present[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+
+		isNull := nullBitmap[bit/8]&(1<<uint(bit%8)) != 0
+		bit++
+		if isNull {
+			continue
+		}
+
+		var collation uint64
+		if i < len(e.Table.ColumnCharset) {
+			collation = e.Table.ColumnCharset[i]
+		}
+
+		v, n, err := decodeValue(data[pos:], e.Table.ColumnTypeDef[i], e.Table.ColumnMetaDef[i], e.Table.IsUnsigned(i), collation)
+		if err != nil {
+			return nil, 0, fmt.Errorf("decode column %d of %s.%s failed: %w", i, e.Table.Schema, e.Table.Table, err)
+		}
+		row[i] = v
+		pos += n
+	}
+
+	return row, pos, nil
+}
+
+// EnumValue return the string of ENUM index, it's known only if enum values are written in optional metadata
+func (e *BinTableMapEvent) EnumValue(i int, index int64) (string, bool) {
+	if i >= len(e.EnumValues) || e.EnumValues[i] == nil || index < 0 || index > int64(len(e.EnumValues[i])) {
+		return "", false
+	}
+
+	// index 0 is the empty string of invalid value
+	if index == 0 {
+		return "", true
+	}
+	return e.EnumValues[i][index-1], true
+}
+
+// SetValue return the string of SET bitmap, it's known only if set values are written in optional metadata
+func (e *BinTableMapEvent) SetValue(i int, bits uint64) (string, bool) {
+	if i >= len(e.SetValues) || e.SetValues[i] == nil {
+		return "", false
+	}
+
+	var values []string
+	for j, v := range e.SetValues[i] {
+		if bits&(1<<uint(j)) != 0 {
+			values = append(values, v)
+		}
+	}
+	return strings.Join(values, ","), true
+}
@@ -0,0 +1,502 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column values of ROWS_EVENT are decoded as:
+//  TINY, SHORT, INT24, LONG, LONGLONG: int64, or uint64 if the column is unsigned
+//  FLOAT: float32, DOUBLE: float64
+//  NEWDECIMAL: string
+//  YEAR: int64
+//  DATE, TIME, DATETIME, TIMESTAMP: string, TIMESTAMP is formatted in UTC
+//  CHAR, VARCHAR: string, or []byte if the column is binary
+//  BLOB, GEOMETRY: []byte, or string if the column is known as TEXT
+//  JSON: string
+//  ENUM: int64 index, SET: uint64 bitmap, BIT: uint64
+//  NULL: nil
+// This is from 'github.com/siddontang/go-mysql/replication/row_event.go'
+
+// binaryCollationID is the collation id of binary charset
+const binaryCollationID = 63
+
+// offsets of temporal types
+const (
+	timefIntOffset     = 0x800000
+	timefOffset        = 0x800000000000
+	datetimefIntOffset = 0x8000000000
+)
+
+// digits per 4 bytes of decimal, and bytes of the leftover digits
+const digitsPerInteger = 9
+
+var compressedBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// realType return the column type of MySQLTypeString which may be ENUM or SET
+func realType(typ byte, meta uint16) byte {
+	if typ == MySQLTypeString && meta >= 256 {
+		if t := byte(meta >> 8); t == MySQLTypeEnum || t == MySQLTypeSet {
+			return t
+		}
+	}
+	return typ
+}
+
+// stringType return the real type and length of MySQLTypeString column by meta,
+// the real type may be ENUM or SET, and the high bits of length are in the real type byte
+func stringType(meta uint16) (byte, int) {
+	if meta < 256 {
+		return MySQLTypeString, int(meta)
+	}
+
+	b0 := uint8(meta >> 8)
+	b1 := uint8(meta & 0xff)
+	if b0&0x30 != 0x30 {
+		return b0 | 0x30, int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+	}
+	return b0, int(b1)
+}
+
+// decodeValue decode a column value, return value and the bytes used
+// collation is the collation id of character column, 0 if unknown
+func decodeValue(data []byte, typ byte, meta uint16, unsigned bool, collation uint64) (interface{}, int, error) {
+	var length int
+	if typ == MySQLTypeString {
+		typ, length = stringType(meta)
+	}
+
+	// fractional seconds precision is 0 to 6
+	if (typ == MySQLTypeTime2 || typ == MySQLTypeDatetime2 || typ == MySQLTypeTimestamp2) && meta > 6 {
+		return nil, 0, fmt.Errorf("invalid fsp %d", meta)
+	}
+
+	switch typ {
+	case MySQLTypeNull:
+		return nil, 0, nil
+
+	case MySQLTypeTiny:
+		if err := needBytes(data, 1); err != nil {
+			return nil, 0, err
+		}
+		if unsigned {
+			return uint64(data[0]), 1, nil
+		}
+		return int64(int8(data[0])), 1, nil
+
+	case MySQLTypeShort:
+		if err := needBytes(data, 2); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if unsigned {
+			return uint64(v), 2, nil
+		}
+		return int64(int16(v)), 2, nil
+
+	case MySQLTypeInt24:
+		if err := needBytes(data, 3); err != nil {
+			return nil, 0, err
+		}
+		v := uint32(FixedLengthInt(data[:3]))
+		if unsigned {
+			return uint64(v), 3, nil
+		}
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int64(int32(v)), 3, nil
+
+	case MySQLTypeLong:
+		if err := needBytes(data, 4); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if unsigned {
+			return uint64(v), 4, nil
+		}
+		return int64(int32(v)), 4, nil
+
+	case MySQLTypeLonglong:
+		if err := needBytes(data, 8); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+
+	case MySQLTypeFloat:
+		if err := needBytes(data, 4); err != nil {
+			return nil, 0, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), 4, nil
+
+	case MySQLTypeDouble:
+		if err := needBytes(data, 8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+
+	case MySQLTypeNewDecimal:
+		return decodeDecimal(data, int(meta>>8), int(meta&0xff))
+
+	case MySQLTypeYear:
+		if err := needBytes(data, 1); err != nil {
+			return nil, 0, err
+		}
+		if data[0] == 0 {
+			return int64(0), 1, nil
+		}
+		return int64(data[0]) + 1900, 1, nil
+
+	case MySQLTypeDate, MySQLTypeNewDate:
+		if err := needBytes(data, 3); err != nil {
+			return nil, 0, err
+		}
+		v := uint32(FixedLengthInt(data[:3]))
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)%16, v%32), 3, nil
+
+	case MySQLTypeTime:
+		if err := needBytes(data, 3); err != nil {
+			return nil, 0, err
+		}
+		v := int32(uint32(FixedLengthInt(data[:3]))<<8) >> 8
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v%10000)/100, v%100), 3, nil
+
+	case MySQLTypeTime2:
+		return decodeTime2(data, int(meta))
+
+	case MySQLTypeDatetime:
+		if err := needBytes(data, 8); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		d, t := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			d/10000, (d%10000)/100, d%100, t/10000, (t%10000)/100, t%100), 8, nil
+
+	case MySQLTypeDatetime2:
+		return decodeDatetime2(data, int(meta))
+
+	case MySQLTypeTimestamp:
+		if err := needBytes(data, 4); err != nil {
+			return nil, 0, err
+		}
+		return formatTimestamp(int64(binary.LittleEndian.Uint32(data)), 0, 0), 4, nil
+
+	case MySQLTypeTimestamp2:
+		fsp := int(meta)
+		n := 4 + (fsp+1)/2
+		if err := needBytes(data, n); err != nil {
+			return nil, 0, err
+		}
+		sec := int64(binary.BigEndian.Uint32(data))
+		return formatTimestamp(sec, decodeFraction(data[4:n], fsp), fsp), n, nil
+
+	case MySQLTypeEnum:
+		if err := needBytes(data, length); err != nil {
+			return nil, 0, err
+		}
+		switch length {
+		case 1, 2:
+			return int64(FixedLengthInt(data[:length])), length, nil
+		}
+		return nil, 0, fmt.Errorf("invalid enum length %d", length)
+
+	case MySQLTypeSet:
+		if err := needBytes(data, length); err != nil {
+			return nil, 0, err
+		}
+		return FixedLengthInt(data[:length]), length, nil
+
+	case MySQLTypeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		n := (nbits + 7) / 8
+		if err := needBytes(data, n); err != nil {
+			return nil, 0, err
+		}
+		var v uint64
+		for _, b := range data[:n] {
+			v = v<<8 | uint64(b)
+		}
+		return v, n, nil
+
+	case MySQLTypeString, MySQLTypeVarchar, MySQLTypeVarString:
+		if typ != MySQLTypeString {
+			length = int(meta)
+		}
+		v, n, err := decodeLengthPrefixed(data, length)
+		if err != nil {
+			return nil, 0, err
+		}
+		if collation == binaryCollationID {
+			return v, n, nil
+		}
+		return string(v), n, nil
+
+	case MySQLTypeBlob, MySQLTypeGeometry, MySQLTypeTinyBlob, MySQLTypeMediumBlob, MySQLTypeLongBlob:
+		v, n, err := decodeBlob(data, int(meta))
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ == MySQLTypeBlob && collation != 0 && collation != binaryCollationID {
+			return string(v), n, nil
+		}
+		return v, n, nil
+
+	case MySQLTypeJSON:
+		v, n, err := decodeBlob(data, int(meta))
+		if err != nil {
+			return nil, 0, err
+		}
+		doc, err := decodeJSONBinary(v)
+		return doc, n, err
+	}
+
+	return nil, 0, fmt.Errorf("unsupport type in binlog %d", typ)
+}
+
+// needBytes check if the data is long enough
+func needBytes(data []byte, n int) error {
+	if len(data) < n {
+		return &ErrTruncatedEvent{Expected: int64(n), Actual: int64(len(data))}
+	}
+	return nil
+}
+
+// decodeLengthPrefixed decode string with 1 byte length if max length < 256, else 2 bytes
+func decodeLengthPrefixed(data []byte, maxLength int) ([]byte, int, error) {
+	prefix := 1
+	if maxLength >= 256 {
+		prefix = 2
+	}
+	if err := needBytes(data, prefix); err != nil {
+		return nil, 0, err
+	}
+
+	length := int(FixedLengthInt(data[:prefix]))
+	if err := needBytes(data, prefix+length); err != nil {
+		return nil, 0, err
+	}
+	return data[prefix : prefix+length], prefix + length, nil
+}
+
+// decodeBlob decode blob with meta bytes length
+func decodeBlob(data []byte, meta int) ([]byte, int, error) {
+	if meta < 1 || meta > 4 {
+		return nil, 0, fmt.Errorf("invalid blob packlen %d", meta)
+	}
+	if err := needBytes(data, meta); err != nil {
+		return nil, 0, err
+	}
+
+	length := int(FixedLengthInt(data[:meta]))
+	if err := needBytes(data, meta+length); err != nil {
+		return nil, 0, err
+	}
+	return data[meta : meta+length], meta + length, nil
+}
+
+// decodeFraction decode fractional seconds part into microseconds
+func decodeFraction(data []byte, fsp int) int64 {
+	switch fsp {
+	case 1, 2:
+		return int64(data[0]) * 10000
+	case 3, 4:
+		return int64(binary.BigEndian.Uint16(data)) * 100
+	case 5, 6:
+		return int64(data[0])<<16 | int64(data[1])<<8 | int64(data[2])
+	}
+	return 0
+}
+
+// formatFraction format microseconds with fsp digits, empty if fsp is 0
+func formatFraction(usec int64, fsp int) string {
+	if fsp <= 0 {
+		return ""
+	}
+	return "." + fmt.Sprintf("%06d", usec)[:fsp]
+}
+
+func formatTimestamp(sec int64, usec int64, fsp int) string {
+	if sec == 0 && usec == 0 {
+		return "0000-00-00 00:00:00" + formatFraction(0, fsp)
+	}
+	return time.Unix(sec, 0).UTC().Format("2006-01-02 15:04:05") + formatFraction(usec, fsp)
+}
+
+// decodeDatetime2 decode DATETIME2, 5 bytes big endian and fractional part
+// 1 bit sign, 17 bits year*13+month, 5 bits day, 5 bits hour, 6 bits minute, 6 bits second
+func decodeDatetime2(data []byte, fsp int) (interface{}, int, error) {
+	n := 5 + (fsp+1)/2
+	if err := needBytes(data, n); err != nil {
+		return nil, 0, err
+	}
+
+	intPart := int64(bigEndianInt(data[:5])) - datetimefIntOffset
+	usec := decodeFraction(data[5:n], fsp)
+	if intPart == 0 && usec == 0 {
+		return "0000-00-00 00:00:00" + formatFraction(0, fsp), n, nil
+	}
+
+	if intPart < 0 {
+		intPart = -intPart
+	}
+
+	ymd := intPart >> 17
+	ym := ymd >> 5
+	hms := intPart % (1 << 17)
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d%s",
+		ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6), formatFraction(usec, fsp)), n, nil
+}
+
+// decodeTime2 decode TIME2, 3 bytes big endian and fractional part
+// 1 bit sign, 1 bit unused, 10 bits hour, 6 bits minute, 6 bits second
+func decodeTime2(data []byte, fsp int) (interface{}, int, error) {
+	n := 3 + (fsp+1)/2
+	if err := needBytes(data, n); err != nil {
+		return nil, 0, err
+	}
+
+	var tmp, intPart, frac int64
+	switch fsp {
+	case 1, 2:
+		intPart = int64(bigEndianInt(data[:3])) - timefIntOffset
+		frac = int64(data[3])
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x100
+		}
+		tmp = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart = int64(bigEndianInt(data[:3])) - timefIntOffset
+		frac = int64(binary.BigEndian.Uint16(data[3:]))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		tmp = intPart<<24 + frac*100
+	case 5, 6:
+		tmp = int64(bigEndianInt(data[:6])) - timefOffset
+	default:
+		intPart = int64(bigEndianInt(data[:3])) - timefIntOffset
+		tmp = intPart << 24
+	}
+
+	sign := ""
+	if tmp < 0 {
+		sign, tmp = "-", -tmp
+	}
+
+	hms := tmp >> 24
+	return fmt.Sprintf("%s%02d:%02d:%02d%s", sign,
+		(hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), formatFraction(tmp%(1<<24), fsp)), n, nil
+}
+
+// bigEndianInt turn big endian bytes to uint64
+func bigEndianInt(buf []byte) uint64 {
+	var num uint64
+	for _, b := range buf {
+		num = num<<8 | uint64(b)
+	}
+	return num
+}
+
+// decimalBinarySize return the bytes of decimal(precision, scale) in binary format
+func decimalBinarySize(precision, scale int) int {
+	integral := precision - scale
+	return integral/digitsPerInteger*4 + compressedBytes[integral%digitsPerInteger] +
+		scale/digitsPerInteger*4 + compressedBytes[scale%digitsPerInteger]
+}
+
+// decodeDecimal decode NEWDECIMAL into string
+// https://github.com/mysql/mysql-server/blob/8.0/strings/decimal.cc bin2decimal()
+func decodeDecimal(data []byte, precision, scale int) (interface{}, int, error) {
+	if precision < 1 || scale < 0 || scale > precision {
+		return nil, 0, fmt.Errorf("invalid decimal(%d,%d)", precision, scale)
+	}
+
+	size := decimalBinarySize(precision, scale)
+	if err := needBytes(data, size); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, size)
+	copy(buf, data[:size])
+
+	// the highest bit is sign, 1 for positive, other bits are inverted for negative
+	var mask byte
+	negative := buf[0]&0x80 == 0
+	if negative {
+		mask = 0xff
+	}
+	buf[0] ^= 0x80
+	for i := range buf {
+		buf[i] ^= mask
+	}
+
+	integral := precision - scale
+	pos := 0
+
+	// integral part, leftover digits first
+	var intPart strings.Builder
+	if n := compressedBytes[integral%digitsPerInteger]; n > 0 {
+		intPart.WriteString(strconv.FormatUint(bigEndianInt(buf[pos:pos+n]), 10))
+		pos += n
+	}
+	for i := 0; i < integral/digitsPerInteger; i++ {
+		fmt.Fprintf(&intPart, "%09d", bigEndianInt(buf[pos:pos+4]))
+		pos += 4
+	}
+
+	value := strings.TrimLeft(intPart.String(), "0")
+	if value == "" {
+		value = "0"
+	}
+
+	// fractional part, leftover digits last
+	if scale > 0 {
+		var fracPart strings.Builder
+		for i := 0; i < scale/digitsPerInteger; i++ {
+			fmt.Fprintf(&fracPart, "%09d", bigEndianInt(buf[pos:pos+4]))
+			pos += 4
+		}
+		if leftover := scale % digitsPerInteger; leftover > 0 {
+			n := compressedBytes[leftover]
+			fmt.Fprintf(&fracPart, "%0*d", leftover, bigEndianInt(buf[pos:pos+n]))
+			pos += n
+		}
+		value += "." + fracPart.String()
+	}
+
+	if negative {
+		value = "-" + value
+	}
+	return value, size, nil
+}
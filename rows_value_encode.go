@@ -0,0 +1,417 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column values are encoded from the types decodeValue() returns,
+// integers of any kind and numeric strings are accepted for numeric columns,
+// string and []byte are accepted for character, binary and temporal columns.
+
+// appendValue append a not null column value, it's the inverse of decodeValue()
+func appendValue(data []byte, v interface{}, typ byte, meta uint16) ([]byte, error) {
+	var length int
+	if typ == MySQLTypeString {
+		typ, length = stringType(meta)
+	}
+
+	switch typ {
+	case MySQLTypeTiny, MySQLTypeShort, MySQLTypeInt24, MySQLTypeLong, MySQLTypeLonglong:
+		n, err := integerValue(v)
+		if err != nil {
+			return nil, err
+		}
+		size := map[byte]int{MySQLTypeTiny: 1, MySQLTypeShort: 2, MySQLTypeInt24: 3, MySQLTypeLong: 4, MySQLTypeLonglong: 8}[typ]
+		return appendFixedLengthInt(data, n, size), nil
+
+	case MySQLTypeFloat:
+		f, err := floatValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, uint64(math.Float32bits(float32(f))), 4), nil
+
+	case MySQLTypeDouble:
+		f, err := floatValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, math.Float64bits(f), 8), nil
+
+	case MySQLTypeNewDecimal:
+		s, err := stringValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendDecimal(data, s, int(meta>>8), int(meta&0xff))
+
+	case MySQLTypeYear:
+		n, err := integerValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if n != 0 {
+			n -= 1900
+		}
+		return append(data, byte(n)), nil
+
+	case MySQLTypeDate, MySQLTypeNewDate:
+		t, err := parseTemporal(v, false)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, uint64(t.year<<9|t.month<<5|t.day), 3), nil
+
+	case MySQLTypeTime:
+		t, err := parseTemporal(v, true)
+		if err != nil {
+			return nil, err
+		}
+		n := t.hour*10000 + t.minute*100 + t.second
+		if t.negative {
+			n = -n
+		}
+		return appendFixedLengthInt(data, uint64(n), 3), nil
+
+	case MySQLTypeTime2:
+		t, err := parseTemporal(v, true)
+		if err != nil {
+			return nil, err
+		}
+		return appendTime2(data, t, int(meta)), nil
+
+	case MySQLTypeDatetime:
+		t, err := parseTemporal(v, false)
+		if err != nil {
+			return nil, err
+		}
+		n := (t.year*10000+t.month*100+t.day)*1000000 + t.hour*10000 + t.minute*100 + t.second
+		return appendFixedLengthInt(data, uint64(n), 8), nil
+
+	case MySQLTypeDatetime2:
+		t, err := parseTemporal(v, false)
+		if err != nil {
+			return nil, err
+		}
+		ym := t.year*13 + t.month
+		intPart := (ym<<5|t.day)<<17 | t.hour<<12 | t.minute<<6 | t.second
+		data = appendBigEndianInt(data, uint64(intPart+datetimefIntOffset), 5)
+		return appendFraction(data, t.usec, int(meta)), nil
+
+	case MySQLTypeTimestamp, MySQLTypeTimestamp2:
+		t, err := parseTemporal(v, false)
+		if err != nil {
+			return nil, err
+		}
+		var sec int64
+		if t.year != 0 || t.month != 0 || t.day != 0 {
+			sec = time.Date(int(t.year), time.Month(t.month), int(t.day),
+				int(t.hour), int(t.minute), int(t.second), 0, time.UTC).Unix()
+		}
+		if typ == MySQLTypeTimestamp {
+			return appendFixedLengthInt(data, uint64(sec), 4), nil
+		}
+		data = appendBigEndianInt(data, uint64(sec), 4)
+		return appendFraction(data, t.usec, int(meta)), nil
+
+	case MySQLTypeEnum, MySQLTypeSet:
+		n, err := integerValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendFixedLengthInt(data, n, length), nil
+
+	case MySQLTypeBit:
+		n, err := integerValue(v)
+		if err != nil {
+			return nil, err
+		}
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		return appendBigEndianInt(data, n, (nbits+7)/8), nil
+
+	case MySQLTypeString, MySQLTypeVarchar, MySQLTypeVarString:
+		if typ != MySQLTypeString {
+			length = int(meta)
+		}
+		s, err := stringValue(v)
+		if err != nil {
+			return nil, err
+		}
+		prefix := 1
+		if length >= 256 {
+			prefix = 2
+		}
+		if len(s) >= 1<<(8*uint(prefix)) {
+			return nil, fmt.Errorf("string length %d is too long", len(s))
+		}
+		return append(appendFixedLengthInt(data, uint64(len(s)), prefix), s...), nil
+
+	case MySQLTypeBlob, MySQLTypeGeometry, MySQLTypeTinyBlob, MySQLTypeMediumBlob, MySQLTypeLongBlob, MySQLTypeJSON:
+		s, err := stringValue(v)
+		if err != nil {
+			return nil, err
+		}
+		if typ == MySQLTypeJSON {
+			if s, err = encodeJSONBinary(s); err != nil {
+				return nil, err
+			}
+		}
+		if meta < 1 || meta > 4 {
+			return nil, fmt.Errorf("invalid blob packlen %d", meta)
+		}
+		if meta < 4 && len(s) >= 1<<(8*uint(meta)) {
+			return nil, fmt.Errorf("blob length %d is too long", len(s))
+		}
+		return append(appendFixedLengthInt(data, uint64(len(s)), int(meta)), s...), nil
+	}
+
+	return nil, fmt.Errorf("unsupport type in binlog %d", typ)
+}
+
+// integerValue return the bits of integer value, signed integers are in two's complement
+func integerValue(v interface{}) (uint64, error) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), nil
+	case int8:
+		return uint64(v), nil
+	case int16:
+		return uint64(v), nil
+	case int32:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case uint:
+		return uint64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return uint64(n), nil
+		}
+		return strconv.ParseUint(v, 10, 64)
+	}
+	return 0, fmt.Errorf("invalid integer value %v of %T", v, v)
+}
+
+// floatValue return the float64 of numeric value
+func floatValue(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+
+	n, err := integerValue(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid float value %v of %T", v, v)
+	}
+	if _, ok := v.(uint64); ok {
+		return float64(n), nil
+	}
+	return float64(int64(n)), nil
+}
+
+// stringValue return the string of string or []byte value, numbers are formatted for DECIMAL
+func stringValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("invalid string value %v of %T", v, v)
+}
+
+// appendBigEndianInt append the n bytes big endian integer
+func appendBigEndianInt(data []byte, num uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		data = append(data, byte(num>>(uint(i)*8)))
+	}
+	return data
+}
+
+// appendFraction append fractional seconds part of fsp, it's the inverse of decodeFraction()
+func appendFraction(data []byte, usec int64, fsp int) []byte {
+	switch fsp {
+	case 1, 2:
+		return append(data, byte(usec/10000))
+	case 3, 4:
+		return appendBigEndianInt(data, uint64(usec/100), 2)
+	case 5, 6:
+		return appendBigEndianInt(data, uint64(usec), 3)
+	}
+	return data
+}
+
+// appendTime2 append TIME2 of fsp as MySQL my_time_packed_to_binary()
+func appendTime2(data []byte, t *temporal, fsp int) []byte {
+	packed := (t.hour<<12|t.minute<<6|t.second)<<24 + t.usec
+	if t.negative {
+		packed = -packed
+	}
+
+	// shift and remainder keep the sign as MySQL does
+	intPart, frac := packed>>24, packed%(1<<24)
+	switch fsp {
+	case 1, 2:
+		data = appendBigEndianInt(data, uint64(intPart+timefIntOffset), 3)
+		return append(data, byte(frac/10000))
+	case 3, 4:
+		data = appendBigEndianInt(data, uint64(intPart+timefIntOffset), 3)
+		return appendBigEndianInt(data, uint64(frac/100), 2)
+	case 5, 6:
+		return appendBigEndianInt(data, uint64(packed+timefOffset), 6)
+	}
+	return appendBigEndianInt(data, uint64(intPart+timefIntOffset), 3)
+}
+
+// temporal is the parts of DATE, TIME, DATETIME or TIMESTAMP value
+type temporal struct {
+	negative             bool
+	year, month, day     int64
+	hour, minute, second int64
+	usec                 int64
+}
+
+// parseTemporal parse 'YYYY-MM-DD[ hh:mm:ss[.ffffff]]', or '[-]hh:mm:ss[.ffffff]' if isTime
+func parseTemporal(v interface{}, isTime bool) (*temporal, error) {
+	s, err := stringValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &temporal{}
+	invalid := fmt.Errorf("invalid temporal value %q", s)
+	rest := strings.TrimSpace(s)
+	if isTime {
+		if strings.HasPrefix(rest, "-") {
+			t.negative, rest = true, rest[1:]
+		}
+	} else {
+		date := rest
+		if i := strings.IndexByte(rest, ' '); i >= 0 {
+			date, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		parts := strings.Split(date, "-")
+		if len(parts) != 3 {
+			return nil, invalid
+		}
+		for i, p := range []*int64{&t.year, &t.month, &t.day} {
+			if *p, err = strconv.ParseInt(parts[i], 10, 64); err != nil {
+				return nil, invalid
+			}
+		}
+		if rest == "" {
+			return t, nil
+		}
+	}
+
+	if i := strings.IndexByte(rest, '.'); i >= 0 {
+		fraction := rest[i+1:]
+		if len(fraction) == 0 || len(fraction) > 6 {
+			return nil, invalid
+		}
+		if t.usec, err = strconv.ParseInt(fraction+strings.Repeat("0", 6-len(fraction)), 10, 64); err != nil {
+			return nil, invalid
+		}
+		rest = rest[:i]
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return nil, invalid
+	}
+	for i, p := range []*int64{&t.hour, &t.minute, &t.second} {
+		if *p, err = strconv.ParseInt(parts[i], 10, 64); err != nil || *p < 0 {
+			return nil, invalid
+		}
+	}
+	return t, nil
+}
+
+// appendDecimal append NEWDECIMAL of string, it's the inverse of decodeDecimal()
+func appendDecimal(data []byte, s string, precision, scale int) ([]byte, error) {
+	if precision < 1 || scale < 0 || scale > precision {
+		return nil, fmt.Errorf("invalid decimal(%d,%d)", precision, scale)
+	}
+
+	value := strings.TrimSpace(s)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimLeft(value, "+-")
+	intDigits, fracDigits := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		intDigits, fracDigits = value[:i], value[i+1:]
+	}
+	intDigits = strings.TrimLeft(intDigits, "0")
+
+	integral := precision - scale
+	if len(intDigits) > integral || strings.Trim(intDigits+fracDigits, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid decimal(%d,%d) value %q", precision, scale, s)
+	}
+	intDigits = strings.Repeat("0", integral-len(intDigits)) + intDigits
+	if len(fracDigits) > scale {
+		fracDigits = fracDigits[:scale]
+	}
+	fracDigits += strings.Repeat("0", scale-len(fracDigits))
+
+	group := func(digits string) uint64 {
+		n, _ := strconv.ParseUint(digits, 10, 64)
+		return n
+	}
+
+	// integral part has leftover digits first, and fractional part has leftover digits last
+	var buf []byte
+	leftover := integral % digitsPerInteger
+	buf = appendBigEndianInt(buf, group(intDigits[:leftover]), compressedBytes[leftover])
+	for pos := leftover; pos < integral; pos += digitsPerInteger {
+		buf = appendBigEndianInt(buf, group(intDigits[pos:pos+digitsPerInteger]), 4)
+	}
+	pos := 0
+	for ; pos+digitsPerInteger <= scale; pos += digitsPerInteger {
+		buf = appendBigEndianInt(buf, group(fracDigits[pos:pos+digitsPerInteger]), 4)
+	}
+	buf = appendBigEndianInt(buf, group(fracDigits[pos:]), compressedBytes[scale-pos])
+
+	// other bits are inverted for negative, and the highest bit is 1 for positive
+	if negative && strings.Trim(intDigits+fracDigits, "0") != "" {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+	buf[0] ^= 0x80
+	return append(data, buf...), nil
+}
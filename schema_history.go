@@ -0,0 +1,618 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaHistory tracks the definitions of tables through the binary logs, from a snapshot of
+// CREATE TABLE statements and the DDL of QUERY_EVENT, so that a TABLE_MAP_EVENT can be matched to
+// the columns of its table at that point. Tables neither in the snapshot nor created in the binary
+// logs are unknown, statements on them are ignored.
+type SchemaHistory struct {
+	// File is the binary log file name of the events added
+	File string
+
+	// versions of tables by 'schema.table', in order of positions
+	tables map[string][]*TableVersion
+}
+
+// TableVersion is the definition of a table since a position, Table is nil if it's dropped.
+// Versions of the snapshot have empty File and 0 Pos.
+type TableVersion struct {
+	File  string    `json:"file"`
+	Pos   int64     `json:"pos"`
+	Table *TableDef `json:"table"`
+}
+
+// NewSchemaHistory return an empty SchemaHistory
+func NewSchemaHistory() *SchemaHistory {
+	return &SchemaHistory{tables: make(map[string][]*TableVersion)}
+}
+
+// LoadSchemaHistory read a SchemaHistory written by Save()
+func LoadSchemaHistory(r io.Reader) (*SchemaHistory, error) {
+	h := NewSchemaHistory()
+	saved := struct {
+		Tables map[string][]*TableVersion `json:"tables"`
+	}{Tables: h.tables}
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Tables != nil {
+		h.tables = saved.Tables
+	}
+	return h, nil
+}
+
+// Save write the history as JSON
+func (h *SchemaHistory) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Tables map[string][]*TableVersion `json:"tables"`
+	}{h.tables})
+}
+
+// LoadSnapshot read the CREATE TABLE statements of tables, such as the output of SHOW CREATE TABLE or
+// mysqldump --no-data, unqualified tables are in schema or the database of the last USE statement
+func (h *SchemaHistory) LoadSnapshot(r io.Reader, schema string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	tokens, err := tokenizeDDL(string(data))
+	if err != nil {
+		return err
+	}
+
+	// the statements of snapshot are at the same position
+	pending := make(map[TableName]*TableDef)
+	for start := 0; start < len(tokens); {
+		end := start
+		for end < len(tokens) && !(tokens[end].kind == ddlSymbol && tokens[end].text == ";") {
+			end++
+		}
+		p := &ddlParser{tokens: tokens[start:end]}
+		start = end + 1
+
+		if p.acceptKeyword("USE") {
+			if schema, err = p.ident(); err != nil {
+				return err
+			}
+			continue
+		}
+		st, err := p.statement()
+		if err != nil {
+			return err
+		}
+		if st != nil {
+			h.apply("", 0, schema, st, pending)
+		}
+	}
+	return nil
+}
+
+// Add apply the DDL of QUERY_EVENT at the position of event
+func (h *SchemaHistory) Add(event *BinEvent) error {
+	if query, ok := event.Body.(*BinQueryEvent); ok {
+		return h.Apply(h.File, event.Header.LogPos-event.Header.EventSize, query.Schema, query.Query)
+	}
+	return nil
+}
+
+// Apply a statement executed at file and pos in the default schema, statements which don't change tables are ignored
+func (h *SchemaHistory) Apply(file string, pos int64, schema, query string) error {
+	st, err := ParseDDL(query)
+	if err != nil {
+		return fmt.Errorf("parse %.64q: %v", query, err)
+	}
+	if st != nil {
+		h.apply(file, pos, schema, st, make(map[TableName]*TableDef))
+	}
+	return nil
+}
+
+// apply a DDL statement, tables are looked up in pending before the versions before the position,
+// so that applying a statement again at the same position doesn't change the result
+func (h *SchemaHistory) apply(file string, pos int64, schema string, st *DDLStatement, pending map[TableName]*TableDef) {
+	qualify := func(name TableName) TableName {
+		if name.Schema == "" {
+			name.Schema = schema
+		}
+		return name
+	}
+	get := func(name TableName) *TableDef {
+		if def, ok := pending[name]; ok {
+			return def
+		}
+		return h.table(name.Schema, name.Table, file, pos, false)
+	}
+	put := func(name TableName, def *TableDef) {
+		pending[name] = def
+		h.set(name, file, pos, def)
+	}
+
+	switch st.Type {
+	case DDLCreateTable:
+		name := qualify(st.Table)
+		if st.IfNotExists && get(name) != nil {
+			return
+		}
+
+		var def *TableDef
+		if st.Like != nil {
+			if def = get(qualify(*st.Like)); def != nil {
+				def = def.clone()
+			}
+		} else {
+			def = st.Definition.clone()
+		}
+		if def != nil {
+			def.Schema, def.Name = name.Schema, name.Table
+		}
+		put(name, def)
+
+	case DDLAlterTable:
+		name := qualify(st.Table)
+		def := get(name)
+		if def == nil {
+			return
+		}
+
+		def = def.clone()
+		if err := def.alter(st.Alters); err != nil {
+			// the history is not what the server has, forget the table rather than mislabel its columns
+			put(name, nil)
+			return
+		}
+		if def.Schema == "" {
+			def.Schema = schema
+		}
+		if def.Schema != name.Schema || def.Name != name.Table {
+			put(name, nil)
+			name = TableName{def.Schema, def.Name}
+		}
+		put(name, def)
+
+	case DDLDropTable:
+		for _, name := range st.Tables {
+			if name = qualify(name); get(name) != nil {
+				put(name, nil)
+			}
+		}
+
+	case DDLRenameTable:
+		for _, rename := range st.Renames {
+			from, to := qualify(rename[0]), qualify(rename[1])
+			def := get(from)
+			if def == nil {
+				continue
+			}
+			def = def.clone()
+			def.Schema, def.Name = to.Schema, to.Table
+			put(from, nil)
+			put(to, def)
+		}
+
+	case DDLDropDatabase:
+		for _, versions := range h.tables {
+			for _, version := range versions {
+				if def := version.Table; def != nil {
+					if name := (TableName{def.Schema, def.Name}); name.Schema == st.Database && get(name) != nil {
+						put(name, nil)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// set the definition of table since the position, the version at the same position is replaced
+func (h *SchemaHistory) set(name TableName, file string, pos int64, def *TableDef) {
+	key := name.Schema + "." + name.Table
+	versions := h.tables[key]
+	if def == nil && len(versions) == 0 {
+		return
+	}
+
+	i := sort.Search(len(versions), func(i int) bool {
+		return compareBinlogPos(versions[i].File, versions[i].Pos, file, pos) > 0
+	})
+	version := &TableVersion{File: file, Pos: pos, Table: def}
+	if i > 0 && compareBinlogPos(versions[i-1].File, versions[i-1].Pos, file, pos) == 0 {
+		versions[i-1] = version
+	} else {
+		versions = append(versions, nil)
+		copy(versions[i+1:], versions[i:])
+		versions[i] = version
+	}
+	h.tables[key] = versions
+}
+
+// Table return the definition of table at the position of binary log, nil if it's unknown
+func (h *SchemaHistory) Table(schema, table, file string, pos int64) *TableDef {
+	return h.table(schema, table, file, pos, true)
+}
+
+// table return the definition of table at the position, or before it if at is false
+func (h *SchemaHistory) table(schema, table, file string, pos int64, at bool) *TableDef {
+	versions := h.tables[schema+"."+table]
+	i := sort.Search(len(versions), func(i int) bool {
+		c := compareBinlogPos(versions[i].File, versions[i].Pos, file, pos)
+		return c > 0 || c == 0 && !at
+	})
+	if i == 0 {
+		return nil
+	}
+	return versions[i-1].Table
+}
+
+// Fill set the column names, primary key, signedness, charsets and ENUM / SET values of TABLE_MAP_EVENT which are not
+// written by server, with the definition of table at the position. Nothing is set if the table is unknown,
+// a *SchemaMismatch is returned if the definition doesn't match the table map.
+func (h *SchemaHistory) Fill(table *BinTableMapEvent, file string, pos int64) error {
+	def := h.Table(table.Schema, table.Table, file, pos)
+	if def == nil {
+		return nil
+	}
+	if mismatch := def.check(table, file, pos); mismatch != nil {
+		return mismatch
+	}
+	def.fill(table)
+	return nil
+}
+
+// fill set the metadata of table map which are not written by server
+func (def *TableDef) fill(table *BinTableMapEvent) {
+	if len(table.ColumnNames) == 0 {
+		table.ColumnNames = make([]string, len(def.Columns))
+		for i, column := range def.Columns {
+			table.ColumnNames[i] = column.Name
+		}
+	}
+
+	if len(table.PrimaryKey) == 0 {
+		for _, name := range def.PrimaryKey {
+			if i := def.column(name); i >= 0 {
+				table.PrimaryKey = append(table.PrimaryKey, i)
+			}
+		}
+	}
+
+	if len(table.Signedness) == 0 {
+		var signedness []byte
+		n := 0
+		for i, column := range def.Columns {
+			if !table.IsNumericColumn(i) {
+				continue
+			}
+			if n%8 == 0 {
+				signedness = append(signedness, 0)
+			}
+			if column.Unsigned {
+				signedness[n/8] |= 0x80 >> uint(n%8)
+			}
+			n++
+		}
+		table.Signedness = signedness
+	}
+
+	if len(table.ColumnCharset) == 0 {
+		collations := make([]uint64, len(def.Columns))
+		known := false
+		for i, column := range def.Columns {
+			switch {
+			case !table.IsCharacterColumn(i):
+			case isBinaryType(column.Type):
+				collations[i] = binaryCollationID
+			case column.Charset != "" || column.Collation != "":
+				collations[i] = collationID(column.Charset, column.Collation)
+			default:
+				collations[i] = collationID(def.Charset, def.Collation)
+			}
+			known = known || collations[i] != 0
+		}
+		if known {
+			table.ColumnCharset = collations
+		}
+	}
+
+	for i, column := range def.Columns {
+		switch {
+		case column.Type == "enum" && table.EnumValues == nil:
+			table.EnumValues = make([][]string, len(def.Columns))
+			fallthrough
+		case column.Type == "enum" && table.EnumValues[i] == nil:
+			table.EnumValues[i] = column.Values
+		case column.Type == "set" && table.SetValues == nil:
+			table.SetValues = make([][]string, len(def.Columns))
+			fallthrough
+		case column.Type == "set" && table.SetValues[i] == nil:
+			table.SetValues[i] = column.Values
+		}
+	}
+}
+
+// TableSchema return the column names and primary key of table for SQLGenerator
+func (def *TableDef) TableSchema() *TableSchema {
+	schema := &TableSchema{PrimaryKey: def.PrimaryKey}
+	for _, column := range def.Columns {
+		schema.Columns = append(schema.Columns, column.Name)
+	}
+	return schema
+}
+
+// clone return a deep copy of table definition
+func (def *TableDef) clone() *TableDef {
+	c := *def
+	c.Columns = make([]*ColumnDef, len(def.Columns))
+	for i, column := range def.Columns {
+		cc := *column
+		c.Columns[i] = &cc
+	}
+	c.PrimaryKey = append([]string(nil), def.PrimaryKey...)
+	c.UniqueKeys = make([]*KeyDef, len(def.UniqueKeys))
+	for i, key := range def.UniqueKeys {
+		c.UniqueKeys[i] = &KeyDef{Name: key.Name, Columns: append([]string(nil), key.Columns...)}
+	}
+	return &c
+}
+
+// column return the index of column by name, -1 if not found
+func (def *TableDef) column(name string) int {
+	for i, column := range def.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// alter apply the specifications of ALTER TABLE
+func (def *TableDef) alter(specs []*AlterSpec) error {
+	for _, spec := range specs {
+		switch spec.Action {
+		case AlterAddColumn:
+			if def.column(spec.Column.Name) >= 0 {
+				return fmt.Errorf("column %s already exists", spec.Column.Name)
+			}
+			column := *spec.Column
+			if err := def.insert(&column, spec); err != nil {
+				return err
+			}
+
+		case AlterModifyColumn:
+			i := def.column(spec.Name)
+			if i < 0 {
+				return fmt.Errorf("column %s is not found", spec.Name)
+			}
+			def.Columns = append(def.Columns[:i], def.Columns[i+1:]...)
+			column := *spec.Column
+			if err := def.insert(&column, spec); err != nil {
+				return err
+			}
+			def.renameKey(spec.Name, column.Name)
+
+		case AlterDropColumn:
+			i := def.column(spec.Name)
+			if i < 0 {
+				return fmt.Errorf("column %s is not found", spec.Name)
+			}
+			def.Columns = append(def.Columns[:i], def.Columns[i+1:]...)
+			def.dropKeyColumn(spec.Name)
+
+		case AlterRenameColumn:
+			i := def.column(spec.Name)
+			if i < 0 {
+				return fmt.Errorf("column %s is not found", spec.Name)
+			}
+			def.Columns[i].Name = spec.NewName
+			def.renameKey(spec.Name, spec.NewName)
+
+		case AlterRenameTable:
+			def.Schema, def.Name = spec.Table.Schema, spec.Table.Table
+
+		case AlterAddPrimaryKey:
+			def.PrimaryKey = append([]string(nil), spec.PrimaryKey...)
+
+		case AlterDropPrimaryKey:
+			def.PrimaryKey = nil
+
+		case AlterAddUniqueKey:
+			def.addUniqueKey(&KeyDef{Name: spec.Key.Name, Columns: append([]string(nil), spec.Key.Columns...)})
+
+		case AlterDropIndex:
+			if strings.EqualFold(spec.Name, "PRIMARY") {
+				def.PrimaryKey = nil
+			}
+			for j, key := range def.UniqueKeys {
+				if strings.EqualFold(key.Name, spec.Name) {
+					def.UniqueKeys = append(def.UniqueKeys[:j], def.UniqueKeys[j+1:]...)
+					break
+				}
+			}
+
+		case AlterRenameIndex:
+			for _, key := range def.UniqueKeys {
+				if strings.EqualFold(key.Name, spec.Name) {
+					key.Name = spec.NewName
+				}
+			}
+
+		case AlterSetVisibility:
+			i := def.column(spec.Name)
+			if i < 0 {
+				return fmt.Errorf("column %s is not found", spec.Name)
+			}
+			def.Columns[i].Invisible = spec.Invisible
+
+		case AlterConvertCharset:
+			def.Charset, def.Collation = spec.Charset, spec.Collation
+			for _, column := range def.Columns {
+				if isCharacterType(column.Type) {
+					column.Charset, column.Collation = spec.Charset, spec.Collation
+				}
+			}
+
+		case AlterTableCharset:
+			if spec.Charset != "" {
+				def.Charset, def.Collation = spec.Charset, ""
+			}
+			if spec.Collation != "" {
+				def.Collation = spec.Collation
+			}
+		}
+	}
+	return nil
+}
+
+// insert the column at the position of specification
+func (def *TableDef) insert(column *ColumnDef, spec *AlterSpec) error {
+	i := len(def.Columns)
+	if spec.First {
+		i = 0
+	} else if spec.After != "" {
+		if i = def.column(spec.After); i < 0 {
+			return fmt.Errorf("column %s is not found", spec.After)
+		}
+		i++
+	}
+
+	def.Columns = append(def.Columns, nil)
+	copy(def.Columns[i+1:], def.Columns[i:])
+	def.Columns[i] = column
+	return nil
+}
+
+// renameKey rename the column in primary key and unique keys
+func (def *TableDef) renameKey(from, to string) {
+	for _, columns := range def.keys() {
+		for j, name := range columns {
+			if strings.EqualFold(name, from) {
+				columns[j] = to
+			}
+		}
+	}
+}
+
+// dropKeyColumn remove the column from primary key and unique keys, unique keys without columns are dropped
+func (def *TableDef) dropKeyColumn(column string) {
+	remove := func(columns []string) []string {
+		for j, name := range columns {
+			if strings.EqualFold(name, column) {
+				return append(columns[:j], columns[j+1:]...)
+			}
+		}
+		return columns
+	}
+
+	def.PrimaryKey = remove(def.PrimaryKey)
+	keys := def.UniqueKeys[:0]
+	for _, key := range def.UniqueKeys {
+		if key.Columns = remove(key.Columns); len(key.Columns) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	def.UniqueKeys = keys
+}
+
+// keys return the columns of primary key and unique keys
+func (def *TableDef) keys() [][]string {
+	keys := [][]string{def.PrimaryKey}
+	for _, key := range def.UniqueKeys {
+		keys = append(keys, key.Columns)
+	}
+	return keys
+}
+
+// addUniqueKey add a unique key, it's named after the first column if it has no name as mysql does
+func (def *TableDef) addUniqueKey(key *KeyDef) {
+	if len(key.Columns) == 0 {
+		return
+	}
+
+	exists := func(name string) bool {
+		for _, k := range def.UniqueKeys {
+			if strings.EqualFold(k.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+	if key.Name == "" {
+		key.Name = key.Columns[0]
+		for n := 2; exists(key.Name); n++ {
+			key.Name = fmt.Sprintf("%s_%d", key.Columns[0], n)
+		}
+	}
+	def.UniqueKeys = append(def.UniqueKeys, key)
+}
+
+// isCharacterType return true if the data type has charset
+func isCharacterType(typ string) bool {
+	switch typ {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	}
+	return false
+}
+
+// isBinaryType return true if the data type is binary string
+func isBinaryType(typ string) bool {
+	switch typ {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
+// compareBinlogPos compare positions of binary logs, files are compared by sequence numbers
+// of their extensions if they have the same base name, an empty file is before all files
+func compareBinlogPos(file1 string, pos1 int64, file2 string, pos2 int64) int {
+	if file1 != file2 {
+		i, j := strings.LastIndexByte(file1, '.'), strings.LastIndexByte(file2, '.')
+		if i >= 0 && j >= 0 && file1[:i] == file2[:j] {
+			n1, err1 := strconv.ParseInt(file1[i+1:], 10, 64)
+			n2, err2 := strconv.ParseInt(file2[j+1:], 10, 64)
+			if err1 == nil && err2 == nil && n1 != n2 {
+				if n1 < n2 {
+					return -1
+				}
+				return 1
+			}
+		}
+		return strings.Compare(file1, file2)
+	}
+
+	switch {
+	case pos1 < pos2:
+		return -1
+	case pos1 > pos2:
+		return 1
+	}
+	return 0
+}
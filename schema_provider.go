@@ -0,0 +1,442 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SchemaProvider provides the definitions of tables for TABLE_MAP_EVENT.
+// BinFileDecoder consults it for every TABLE_MAP_EVENT, the column names, primary key, signedness, charsets
+// and ENUM / SET values which are not written by server are filled from the definition.
+type SchemaProvider interface {
+	// TableDef return the definition of the table mapped at the position of binary log file, nil if unknown
+	TableDef(table *BinTableMapEvent, file string, pos int64) (*TableDef, error)
+}
+
+// SchemaMismatch is returned when the definition of SchemaProvider doesn't match TABLE_MAP_EVENT,
+// the columns of such table are not labeled by the definition.
+type SchemaMismatch struct {
+	File   string
+	Pos    int64
+	Schema string
+	Table  string
+
+	// Column is the index of mismatched column, -1 if the column counts differ
+	Column int
+
+	// Field is 'column count', 'type' or 'name'
+	Field string
+
+	// Expected is from SchemaProvider, Actual is from TABLE_MAP_EVENT
+	Expected string
+	Actual   string
+}
+
+// Error implement error
+func (m *SchemaMismatch) Error() string {
+	if m.Column < 0 {
+		return fmt.Sprintf("schema of %s.%s doesn't match TABLE_MAP_EVENT at %s:%d, %s %s != %s",
+			m.Schema, m.Table, m.File, m.Pos, m.Field, m.Expected, m.Actual)
+	}
+	return fmt.Sprintf("schema of %s.%s doesn't match TABLE_MAP_EVENT at %s:%d, %s of column %d %s != %s",
+		m.Schema, m.Table, m.File, m.Pos, m.Field, m.Column+1, m.Expected, m.Actual)
+}
+
+// fillSchema fill the metadata of table map from decoder.Schema, mismatches are returned unless
+// OnSchemaMismatch ignores them
+func (decoder *BinFileDecoder) fillSchema(table *BinTableMapEvent, pos int64) error {
+	file := filepath.Base(decoder.Path)
+	def, err := decoder.Schema.TableDef(table, file, pos)
+	if err != nil || def == nil {
+		return err
+	}
+
+	if mismatch := def.check(table, file, pos); mismatch != nil {
+		if decoder.OnSchemaMismatch == nil {
+			return mismatch
+		}
+		return decoder.OnSchemaMismatch(mismatch)
+	}
+	def.fill(table)
+	return nil
+}
+
+// check return the first difference between definition and table map, nil if they match
+func (def *TableDef) check(table *BinTableMapEvent, file string, pos int64) *SchemaMismatch {
+	mismatch := &SchemaMismatch{File: file, Pos: pos, Schema: table.Schema, Table: table.Table, Column: -1}
+	if len(def.Columns) != int(table.ColumnCount) {
+		mismatch.Field = "column count"
+		mismatch.Expected, mismatch.Actual = fmt.Sprint(len(def.Columns)), fmt.Sprint(table.ColumnCount)
+		return mismatch
+	}
+
+	for i, column := range def.Columns {
+		mismatch.Column = i
+		if types, ok := columnRealTypes[column.Type]; ok && !containsByte(types, table.RealType(i)) {
+			mismatch.Field = "type"
+			mismatch.Expected, mismatch.Actual = column.Type, tableMapColumnType(table, i)
+			return mismatch
+		}
+		if i < len(table.ColumnNames) && !strings.EqualFold(column.Name, table.ColumnNames[i]) {
+			mismatch.Field = "name"
+			mismatch.Expected, mismatch.Actual = column.Name, table.ColumnNames[i]
+			return mismatch
+		}
+	}
+	return nil
+}
+
+// containsByte return true if b is in list
+func containsByte(list []byte, b byte) bool {
+	for _, v := range list {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
+
+// columnRealTypes are the types in TABLE_MAP_EVENT of data types, data types not listed are not checked
+var columnRealTypes = map[string][]byte{
+	"tinyint":            {MySQLTypeTiny},
+	"smallint":           {MySQLTypeShort},
+	"mediumint":          {MySQLTypeInt24},
+	"int":                {MySQLTypeLong},
+	"bigint":             {MySQLTypeLonglong},
+	"decimal":            {MySQLTypeNewDecimal, MySQLTypeDecimal},
+	"float":              {MySQLTypeFloat, MySQLTypeDouble}, // FLOAT(p) is DOUBLE if p > 24
+	"double":             {MySQLTypeDouble},
+	"bit":                {MySQLTypeBit},
+	"date":               {MySQLTypeDate, MySQLTypeNewDate},
+	"datetime":           {MySQLTypeDatetime, MySQLTypeDatetime2},
+	"timestamp":          {MySQLTypeTimestamp, MySQLTypeTimestamp2},
+	"time":               {MySQLTypeTime, MySQLTypeTime2},
+	"year":               {MySQLTypeYear},
+	"char":               {MySQLTypeString},
+	"binary":             {MySQLTypeString},
+	"varchar":            {MySQLTypeVarchar, MySQLTypeVarString},
+	"varbinary":          {MySQLTypeVarchar, MySQLTypeVarString},
+	"tinytext":           {MySQLTypeBlob},
+	"text":               {MySQLTypeBlob},
+	"mediumtext":         {MySQLTypeBlob},
+	"longtext":           {MySQLTypeBlob},
+	"tinyblob":           {MySQLTypeBlob},
+	"blob":               {MySQLTypeBlob},
+	"mediumblob":         {MySQLTypeBlob},
+	"longblob":           {MySQLTypeBlob},
+	"enum":               {MySQLTypeEnum},
+	"set":                {MySQLTypeSet},
+	"json":               {MySQLTypeJSON},
+	"geometry":           {MySQLTypeGeometry},
+	"point":              {MySQLTypeGeometry},
+	"linestring":         {MySQLTypeGeometry},
+	"polygon":            {MySQLTypeGeometry},
+	"multipoint":         {MySQLTypeGeometry},
+	"multilinestring":    {MySQLTypeGeometry},
+	"multipolygon":       {MySQLTypeGeometry},
+	"geometrycollection": {MySQLTypeGeometry},
+	"geomcollection":     {MySQLTypeGeometry},
+}
+
+// tableMapColumnType return the data type of column in table map, BLOB and BINARY types are chosen
+// for character columns whose charset is binary or unknown
+func tableMapColumnType(table *BinTableMapEvent, i int) string {
+	binary := i >= len(table.ColumnCharset) || table.ColumnCharset[i] == binaryCollationID
+	switch typ := table.RealType(i); typ {
+	case MySQLTypeTiny:
+		return "tinyint"
+	case MySQLTypeShort:
+		return "smallint"
+	case MySQLTypeInt24:
+		return "mediumint"
+	case MySQLTypeLong:
+		return "int"
+	case MySQLTypeLonglong:
+		return "bigint"
+	case MySQLTypeNewDecimal, MySQLTypeDecimal:
+		return "decimal"
+	case MySQLTypeFloat:
+		return "float"
+	case MySQLTypeDouble:
+		return "double"
+	case MySQLTypeBit:
+		return "bit"
+	case MySQLTypeDate, MySQLTypeNewDate:
+		return "date"
+	case MySQLTypeDatetime, MySQLTypeDatetime2:
+		return "datetime"
+	case MySQLTypeTimestamp, MySQLTypeTimestamp2:
+		return "timestamp"
+	case MySQLTypeTime, MySQLTypeTime2:
+		return "time"
+	case MySQLTypeYear:
+		return "year"
+	case MySQLTypeString:
+		if binary {
+			return "binary"
+		}
+		return "char"
+	case MySQLTypeVarchar, MySQLTypeVarString:
+		if binary {
+			return "varbinary"
+		}
+		return "varchar"
+	case MySQLTypeBlob:
+		prefix := map[uint16]string{1: "tiny", 3: "medium", 4: "long"}[table.ColumnMetaDef[i]]
+		if binary {
+			return prefix + "blob"
+		}
+		return prefix + "text"
+	case MySQLTypeEnum:
+		return "enum"
+	case MySQLTypeSet:
+		return "set"
+	case MySQLTypeJSON:
+		return "json"
+	case MySQLTypeGeometry:
+		return "geometry"
+	default:
+		return fmt.Sprintf("type(%d)", typ)
+	}
+}
+
+// TableMapSchema is a SchemaProvider of the optional metadata of TABLE_MAP_EVENT only, which is written by
+// mysql >= 8.0.1 with binlog_row_metadata=FULL. Nothing is filled by it, tables without column names are unknown.
+type TableMapSchema struct{}
+
+// TableDef implement SchemaProvider
+func (TableMapSchema) TableDef(table *BinTableMapEvent, file string, pos int64) (*TableDef, error) {
+	if len(table.ColumnNames) != int(table.ColumnCount) {
+		return nil, nil
+	}
+
+	def := &TableDef{Schema: table.Schema, Name: table.Table, Columns: make([]*ColumnDef, table.ColumnCount)}
+	for i := range def.Columns {
+		column := &ColumnDef{
+			Name:     table.ColumnNames[i],
+			Type:     tableMapColumnType(table, i),
+			Unsigned: table.IsUnsigned(i),
+			Nullable: table.IsNullable(i),
+		}
+		switch column.Type {
+		case "enum":
+			if i < len(table.EnumValues) {
+				column.Values = table.EnumValues[i]
+			}
+		case "set":
+			if i < len(table.SetValues) {
+				column.Values = table.SetValues[i]
+			}
+		}
+		def.Columns[i] = column
+	}
+	for _, i := range table.PrimaryKey {
+		if i < len(def.Columns) {
+			def.PrimaryKey = append(def.PrimaryKey, def.Columns[i].Name)
+		}
+	}
+	return def, nil
+}
+
+// TableDef implement SchemaProvider, the definition at the position of binary log is returned
+func (h *SchemaHistory) TableDef(table *BinTableMapEvent, file string, pos int64) (*TableDef, error) {
+	return h.Table(table.Schema, table.Table, file, pos), nil
+}
+
+// SchemaFile is a SchemaProvider of the static definitions of tables in a JSON or YAML file, such as
+//
+//	tables:
+//	  - schema: test
+//	    name: users
+//	    columns:
+//	      - {name: id, type: bigint, unsigned: true}
+//	      - {name: state, type: enum, values: [active, disabled]}
+//	      - {name: name, type: varchar, charset: utf8mb4}
+//	    primary_key: [id]
+//
+// The fields are the JSON fields of TableDef, types are the data types in lower case without length.
+// Files with extension .yaml or .yml are YAML, others are JSON. A subset of YAML is supported,
+// which is block and flow collections, plain and quoted scalars and comments.
+type SchemaFile struct {
+	Path   string
+	tables map[TableName]*TableDef
+}
+
+// NewSchemaFile load the definitions of tables from file
+func NewSchemaFile(path string) (*SchemaFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		value, err := decodeYAML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	var file struct {
+		Tables []*TableDef `json:"tables"`
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	s := &SchemaFile{Path: path, tables: make(map[TableName]*TableDef)}
+	for _, def := range file.Tables {
+		if def == nil || def.Name == "" {
+			return nil, fmt.Errorf("%s: table without name", path)
+		}
+		for _, column := range def.Columns {
+			if column == nil || column.Name == "" || column.Type == "" {
+				return nil, fmt.Errorf("%s: column of %s.%s without name or type", path, def.Schema, def.Name)
+			}
+			column.Type = strings.ToLower(column.Type)
+		}
+		s.tables[TableName{Schema: def.Schema, Table: def.Name}] = def
+	}
+	return s, nil
+}
+
+// TableDef implement SchemaProvider, the position of binary log is ignored
+func (s *SchemaFile) TableDef(table *BinTableMapEvent, file string, pos int64) (*TableDef, error) {
+	return s.tables[TableName{Schema: table.Schema, Table: table.Table}], nil
+}
+
+// InformationSchema is a SchemaProvider which queries information_schema of a live server with db,
+// whose driver such as github.com/go-sql-driver/mysql is registered by caller.
+// The definitions are current ones rather than the ones at the position of binary log, they are cached
+// and queried again when the column count of table map changes.
+type InformationSchema struct {
+	DB *sql.DB
+
+	mu     sync.Mutex
+	tables map[TableName]*TableDef
+}
+
+// NewInformationSchema return an InformationSchema of db
+func NewInformationSchema(db *sql.DB) *InformationSchema {
+	return &InformationSchema{DB: db, tables: make(map[TableName]*TableDef)}
+}
+
+// queries of InformationSchema
+const (
+	informationSchemaColumns = "SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, CHARACTER_SET_NAME, COLLATION_NAME, EXTRA " +
+		"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+	informationSchemaKeys = "SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS " +
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0 ORDER BY INDEX_NAME, SEQ_IN_INDEX"
+)
+
+// TableDef implement SchemaProvider
+func (s *InformationSchema) TableDef(table *BinTableMapEvent, file string, pos int64) (*TableDef, error) {
+	name := TableName{Schema: table.Schema, Table: table.Table}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if def, ok := s.tables[name]; ok && len(def.Columns) == int(table.ColumnCount) {
+		return def, nil
+	}
+
+	def, err := s.query(name)
+	if err != nil || def == nil {
+		return nil, err
+	}
+	s.tables[name] = def
+	return def, nil
+}
+
+// query the definition of table, nil if the table doesn't exist
+func (s *InformationSchema) query(name TableName) (*TableDef, error) {
+	rows, err := s.DB.Query(informationSchemaColumns, name.Schema, name.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	def := &TableDef{Schema: name.Schema, Name: name.Table}
+	for rows.Next() {
+		var column, columnType, nullable, extra string
+		var charset, collation sql.NullString
+		if err = rows.Scan(&column, &columnType, &nullable, &charset, &collation, &extra); err != nil {
+			return nil, err
+		}
+
+		// COLUMN_TYPE is the data type of column definition, such as "int(10) unsigned" or "enum('a','b')"
+		tokens, err := tokenizeDDL(quoteIdentifier(column) + " " + columnType)
+		if err != nil {
+			return nil, err
+		}
+		p := &ddlParser{tokens: tokens}
+		c, _, _, err := p.columnDef()
+		if err != nil {
+			return nil, fmt.Errorf("bad type %q of column %s.%s.%s: %v", columnType, name.Schema, name.Table, column, err)
+		}
+
+		c.Nullable = nullable == "YES"
+		c.Charset, c.Collation = charset.String, collation.String
+		for _, word := range strings.Fields(strings.ToUpper(extra)) {
+			switch word {
+			case "VIRTUAL", "STORED":
+				c.Generated = word
+			case "INVISIBLE":
+				c.Invisible = true
+			}
+		}
+		def.Columns = append(def.Columns, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(def.Columns) == 0 {
+		return nil, nil
+	}
+
+	keys, err := s.DB.Query(informationSchemaKeys, name.Schema, name.Table)
+	if err != nil {
+		return nil, err
+	}
+	defer keys.Close()
+
+	for keys.Next() {
+		var index string
+		var column sql.NullString // NULL for functional key parts
+		if err = keys.Scan(&index, &column); err != nil {
+			return nil, err
+		}
+		if !column.Valid {
+			continue
+		}
+		if index == "PRIMARY" {
+			def.PrimaryKey = append(def.PrimaryKey, column.String)
+		} else if n := len(def.UniqueKeys); n > 0 && def.UniqueKeys[n-1].Name == index {
+			def.UniqueKeys[n-1].Columns = append(def.UniqueKeys[n-1].Columns, column.String)
+		} else {
+			def.UniqueKeys = append(def.UniqueKeys, &KeyDef{Name: index, Columns: []string{column.String}})
+		}
+	}
+	return def, keys.Err()
+}
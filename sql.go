@@ -0,0 +1,649 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sqlHeader is the statements written before generated SQL, TIMESTAMP values are decoded in UTC
+var sqlHeader = []string{"SET NAMES utf8mb4;", "SET time_zone = '+00:00';"}
+
+// TableSchema supplies the column names and primary key of a table,
+// for the binary logs written without binlog_row_metadata=FULL.
+type TableSchema struct {
+	Columns    []string
+	PrimaryKey []string
+}
+
+// SQLGenerator converts row changes into SQL statements.
+// UPDATE and DELETE statements match rows by the primary key if it's known, else by all columns.
+type SQLGenerator struct {
+	// Schemas supply column names and primary keys, keyed by "schema.table",
+	// they are used when TABLE_MAP_EVENT has no optional metadata
+	Schemas map[string]*TableSchema
+
+	// BatchSize is the max rows of an INSERT statement, consecutive rows inserted into
+	// the same table are batched into one statement
+	BatchSize int
+
+	// headerWritten is set after sqlHeader is written by the first WriteTransaction()
+	headerWritten bool
+}
+
+// NewSQLGenerator return a SQLGenerator which writes one row per INSERT statement
+func NewSQLGenerator() *SQLGenerator {
+	return &SQLGenerator{
+		Schemas:   make(map[string]*TableSchema),
+		BatchSize: 1,
+	}
+}
+
+// sqlTable is a table with the column names and primary key used in SQL
+type sqlTable struct {
+	*BinTableMapEvent
+	name       string
+	columns    []string
+	primaryKey []int
+}
+
+// sqlImage is a row image of ROWS_EVENT with the present columns
+type sqlImage struct {
+	columns []int
+	values  []interface{}
+}
+
+// sqlStatement is a SQL statement of row change, insert and values are set for INSERT
+// statements, so that the rows of the same table and columns can be batched.
+type sqlStatement struct {
+	query  string
+	insert string
+	values string
+}
+
+// table return the sqlTable of TABLE_MAP_EVENT
+func (g *SQLGenerator) table(table *BinTableMapEvent) (*sqlTable, error) {
+	t := &sqlTable{
+		BinTableMapEvent: table,
+		name:             quoteIdentifier(table.Schema) + "." + quoteIdentifier(table.Table),
+		columns:          table.ColumnNames,
+		primaryKey:       table.PrimaryKey,
+	}
+
+	schema := g.Schemas[table.Schema+"."+table.Table]
+	if schema != nil && len(t.columns) == 0 {
+		if len(schema.Columns) != int(table.ColumnCount) {
+			return nil, fmt.Errorf("supplied schema of %s.%s has %d columns, but TABLE_MAP_EVENT has %d",
+				table.Schema, table.Table, len(schema.Columns), table.ColumnCount)
+		}
+		t.columns = schema.Columns
+	}
+
+	if len(t.columns) == 0 {
+		return nil, fmt.Errorf("column names of %s.%s are unknown, binlog_row_metadata=FULL or supplied schema is needed",
+			table.Schema, table.Table)
+	}
+
+	if schema != nil && len(t.primaryKey) == 0 {
+		for _, name := range schema.PrimaryKey {
+			i := indexOf(t.columns, name)
+			if i < 0 {
+				return nil, fmt.Errorf("primary key column %s of %s.%s is not found", name, table.Schema, table.Table)
+			}
+			t.primaryKey = append(t.primaryKey, i)
+		}
+	}
+
+	return t, nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// newSQLImage return the image of row, only present columns are used
+func newSQLImage(rows *BinRowsEvent, values []interface{}, isAfter bool) *sqlImage {
+	image := &sqlImage{values: values}
+	for i := 0; i < int(rows.ColumnCount); i++ {
+		if rows.IsPresent(i, isAfter) {
+			image.columns = append(image.columns, i)
+		}
+	}
+	return image
+}
+
+// RowsSQL return the SQL statements which redo the row changes of ROWS_EVENT
+func (g *SQLGenerator) RowsSQL(rows *BinRowsEvent) ([]string, error) {
+	statements, err := g.rowsStatements(rows, false)
+	if err != nil {
+		return nil, err
+	}
+	return renderSQL(statements, g.BatchSize), nil
+}
+
+// FlashbackSQL return the SQL statements which undo the row changes of ROWS_EVENT, in reverse order
+func (g *SQLGenerator) FlashbackSQL(rows *BinRowsEvent) ([]string, error) {
+	statements, err := g.rowsStatements(rows, true)
+	if err != nil {
+		return nil, err
+	}
+	return renderSQL(statements, g.BatchSize), nil
+}
+
+// rowsStatements return the statements of rows, inverted and in reverse order if isFlashback
+func (g *SQLGenerator) rowsStatements(rows *BinRowsEvent, isFlashback bool) ([]*sqlStatement, error) {
+	if rows.Table == nil {
+		return nil, fmt.Errorf("table map of table id %d is unknown", rows.TableID)
+	}
+
+	table, err := g.table(rows.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]*sqlStatement, 0, len(rows.Rows))
+	for j := range rows.Rows {
+		row := rows.Rows[j]
+		if isFlashback {
+			row = rows.Rows[len(rows.Rows)-1-j]
+		}
+
+		before := newSQLImage(rows, row.Before, false)
+		after := newSQLImage(rows, row.After, true)
+
+		var statement *sqlStatement
+		switch action := rows.Action(); {
+		case action == RowsActionInsert && !isFlashback, action == RowsActionDelete && isFlashback:
+			image := after
+			if isFlashback {
+				image = before
+			}
+			statement, err = table.insert(image)
+		case action == RowsActionInsert:
+			statement, err = table.delete(after)
+		case action == RowsActionDelete:
+			statement, err = table.delete(before)
+		case isFlashback:
+			statement, err = table.update(before, after)
+		default:
+			statement, err = table.update(after, before)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// renderSQL return the SQL of statements, consecutive INSERT statements are batched
+func renderSQL(statements []*sqlStatement, batchSize int) []string {
+	var queries []string
+	for i := 0; i < len(statements); {
+		s := statements[i]
+		if s.insert == "" {
+			queries = append(queries, s.query)
+			i++
+			continue
+		}
+
+		values := []string{s.values}
+		for i++; i < len(statements) && len(values) < batchSize && statements[i].insert == s.insert; i++ {
+			values = append(values, statements[i].values)
+		}
+		queries = append(queries, s.insert+" "+strings.Join(values, ", ")+";")
+	}
+	return queries
+}
+
+// WriteTransaction write the SQL statements which redo the transaction, in BEGIN ... COMMIT.
+// Statements other than row changes, such as DDL, are written with USE of their schema, and their
+// context as mysqlbinlog does: SET TIMESTAMP, INSERT_ID, LAST_INSERT_ID, RAND seeds and user variables.
+// The first call writes SET NAMES utf8mb4 and SET time_zone = '+00:00' before the transaction,
+// which the string and TIMESTAMP values of generated SQL rely on.
+func (g *SQLGenerator) WriteTransaction(w io.Writer, tx *Transaction) error {
+	var statements []*sqlStatement
+	// context is the SET statements of INTVAR_EVENT, RAND_EVENT and USER_VAR_EVENT before a statement
+	var context []string
+	for _, event := range tx.Events {
+		switch body := event.Body.(type) {
+		case *BinIntvarEvent:
+			name := "INSERT_ID"
+			if body.Type == IntvarLastInsertID {
+				name = "LAST_INSERT_ID"
+			}
+			context = append(context, fmt.Sprintf("SET %s=%d;", name, body.Value))
+
+		case *BinRandEvent:
+			context = append(context, fmt.Sprintf("SET @@RAND_SEED1=%d, @@RAND_SEED2=%d;", body.Seed1, body.Seed2))
+
+		case *BinUserVarEvent:
+			value, err := body.SQLValue()
+			if err != nil {
+				return err
+			}
+			context = append(context, fmt.Sprintf("SET @%s:=%s;", quoteIdentifier(body.Name), value))
+
+		case *BinRowsEvent:
+			s, err := g.rowsStatements(body, false)
+			if err != nil {
+				return err
+			}
+			statements = append(statements, s...)
+
+		case *BinXAPrepareEvent:
+			query := "XA PREPARE " + body.XID() + ";"
+			if body.OnePhase {
+				query = "XA COMMIT " + body.XID() + " ONE PHASE;"
+			}
+			statements = append(statements, &sqlStatement{query: query})
+
+		case *BinQueryEvent:
+			switch queryKind(body.Query) {
+			case queryBegin, queryCommit, queryRollback:
+				continue
+			}
+
+			lines := context
+			if body.Schema != "" {
+				lines = append([]string{"USE " + quoteIdentifier(body.Schema) + ";"}, lines...)
+			}
+			lines = append(lines, "SET TIMESTAMP="+queryTimestamp(event.Header.Timestamp, body)+";",
+				strings.TrimRight(strings.TrimSpace(body.Query), ";")+";")
+			statements = append(statements, &sqlStatement{query: strings.Join(lines, "\n")})
+			context = nil
+		}
+	}
+
+	if !g.headerWritten {
+		for _, s := range sqlHeader {
+			if _, err := fmt.Fprintln(w, s); err != nil {
+				return err
+			}
+		}
+		g.headerWritten = true
+	}
+
+	if tx.GTID != "" {
+		if _, err := fmt.Fprintf(w, "# GTID %s\n", tx.GTID); err != nil {
+			return err
+		}
+	}
+
+	queries := renderSQL(statements, g.BatchSize)
+	if !tx.IsDDL && !tx.IsXA {
+		queries = append(append([]string{"BEGIN;"}, queries...), "COMMIT;")
+	}
+	for _, query := range queries {
+		if _, err := fmt.Fprintln(w, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryTimestamp return the timestamp of statement, with the microseconds of Q_MICROSECONDS if written
+func queryTimestamp(timestamp int64, query *BinQueryEvent) string {
+	vars, err := query.Statue()
+	if err != nil || vars.Microseconds == 0 {
+		return strconv.FormatInt(timestamp, 10)
+	}
+	return fmt.Sprintf("%d.%06d", timestamp, vars.Microseconds)
+}
+
+// WriteSQL write the SQL statements which redo all transactions walked by decoder
+func (g *SQLGenerator) WriteSQL(w io.Writer, decoder *BinFileDecoder) error {
+	bw := bufio.NewWriter(w)
+	err := decoder.WalkTransaction(func(tx *Transaction) (isContinue bool, err error) {
+		return true, g.WriteTransaction(bw, tx)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// insert return INSERT statement of the row image
+func (t *sqlTable) insert(image *sqlImage) (*sqlStatement, error) {
+	columns := make([]string, len(image.columns))
+	values := make([]string, len(image.columns))
+	for j, i := range image.columns {
+		columns[j] = quoteIdentifier(t.columns[i])
+
+		var err error
+		if values[j], err = t.value(i, image.values[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sqlStatement{
+		insert: fmt.Sprintf("INSERT INTO %s (%s) VALUES", t.name, strings.Join(columns, ", ")),
+		values: "(" + strings.Join(values, ", ") + ")",
+	}, nil
+}
+
+// delete return DELETE statement of the row image
+func (t *sqlTable) delete(image *sqlImage) (*sqlStatement, error) {
+	where, err := t.where(image)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStatement{query: fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", t.name, where)}, nil
+}
+
+// update return UPDATE statement which changes the row of where image into set image
+func (t *sqlTable) update(set *sqlImage, where *sqlImage) (*sqlStatement, error) {
+	assignments := make([]string, len(set.columns))
+	for j, i := range set.columns {
+		value, err := t.value(i, set.values[i])
+		if err != nil {
+			return nil, err
+		}
+		assignments[j] = quoteIdentifier(t.columns[i]) + "=" + value
+	}
+
+	condition, err := t.where(where)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStatement{
+		query: fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1;", t.name, strings.Join(assignments, ", "), condition),
+	}, nil
+}
+
+// where return the condition which matches the row image.
+// The primary key is used if it's known and present, else all present columns except FLOAT and DOUBLE,
+// which can not be compared exactly.
+func (t *sqlTable) where(image *sqlImage) (string, error) {
+	columns := t.keyColumns(image)
+	if columns == nil {
+		for _, i := range image.columns {
+			switch t.RealType(i) {
+			case MySQLTypeFloat, MySQLTypeDouble:
+				continue
+			}
+			columns = append(columns, i)
+		}
+	}
+
+	if len(columns) == 0 {
+		return "", fmt.Errorf("no column can be used in WHERE of %s.%s", t.Schema, t.Table)
+	}
+
+	conditions := make([]string, len(columns))
+	for j, i := range columns {
+		column := quoteIdentifier(t.columns[i])
+		if image.values[i] == nil {
+			conditions[j] = column + " IS NULL"
+			continue
+		}
+
+		value, err := t.value(i, image.values[i])
+		if err != nil {
+			return "", err
+		}
+		conditions[j] = column + "=" + value
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// keyColumns return the primary key columns if all of them are present in image, else nil
+func (t *sqlTable) keyColumns(image *sqlImage) []int {
+	if len(t.primaryKey) == 0 {
+		return nil
+	}
+
+	present := make(map[int]bool, len(image.columns))
+	for _, i := range image.columns {
+		present[i] = true
+	}
+
+	for _, i := range t.primaryKey {
+		if !present[i] {
+			return nil
+		}
+	}
+	return t.primaryKey
+}
+
+// value return the SQL literal of column value
+func (t *sqlTable) value(i int, v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "NULL", nil
+
+	case int64:
+		if t.RealType(i) == MySQLTypeEnum {
+			if s, ok := t.EnumValue(i, value); ok {
+				return quoteString(s), nil
+			}
+		}
+		return strconv.FormatInt(value, 10), nil
+
+	case uint64:
+		if t.RealType(i) == MySQLTypeSet {
+			if s, ok := t.SetValue(i, value); ok {
+				return quoteString(s), nil
+			}
+		}
+		return strconv.FormatUint(value, 10), nil
+
+	case float32:
+		return strconv.FormatFloat(float64(value), 'g', -1, 32), nil
+
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+
+	case []byte:
+		if len(value) == 0 {
+			return "''", nil
+		}
+		return "X'" + hex.EncodeToString(value) + "'", nil
+
+	case string:
+		switch t.RealType(i) {
+		case MySQLTypeNewDecimal, MySQLTypeDecimal:
+			return value, nil
+		case MySQLTypeJSON:
+			return "CAST(" + quoteString(value) + " AS JSON)", nil
+		}
+
+		var collation uint64
+		if i < len(t.ColumnCharset) {
+			collation = t.ColumnCharset[i]
+		}
+		return quoteCharsetString(value, collationCharset(collation)), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %T of column %s", v, t.columns[i])
+}
+
+// quoteIdentifier quote schema, table or column name with backticks
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteString quote string as a MySQL string literal
+func quoteString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0x1a:
+			buf.WriteString(`\Z`)
+		case '\'', '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// quoteCharsetString quote string of charset. The SQL is written in utf8mb4, so strings of
+// other charsets are written as hex with charset introducer unless they are ASCII.
+func quoteCharsetString(s string, charset string) string {
+	switch charset {
+	case "", "utf8", "utf8mb4", "ascii":
+		if utf8.ValidString(s) {
+			return quoteString(s)
+		}
+	default:
+		if isASCII(s) {
+			return quoteString(s)
+		}
+	}
+
+	if charset == "" {
+		return "X'" + hex.EncodeToString([]byte(s)) + "'"
+	}
+	return "_" + charset + " X'" + hex.EncodeToString([]byte(s)) + "'"
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// collationCharset return the charset name of collation id, empty if unknown
+// https://dev.mysql.com/doc/refman/8.0/en/information-schema-collations-table.html
+func collationCharset(id uint64) string {
+	switch {
+	case id == 0:
+		return ""
+	case id == binaryCollationID:
+		return "binary"
+	case id == 45, id == 46, id >= 224 && id <= 247, id >= 255 && id <= 323:
+		return "utf8mb4"
+	case id == 33, id == 76, id == 83, id >= 192 && id <= 215, id == 223:
+		return "utf8"
+	case id >= 128 && id <= 151:
+		return "ucs2"
+	case id >= 101 && id <= 124:
+		return "utf16"
+	case id >= 160 && id <= 183:
+		return "utf32"
+	}
+
+	return collationCharsets[id]
+}
+
+// collationCharsets is the charsets of other collations
+var collationCharsets = map[uint64]string{
+	1: "big5", 84: "big5",
+	3: "dec8", 69: "dec8",
+	4: "cp850", 80: "cp850",
+	5: "latin1", 8: "latin1", 15: "latin1", 31: "latin1", 47: "latin1", 48: "latin1", 49: "latin1", 94: "latin1",
+	6: "hp8", 72: "hp8",
+	7: "koi8r", 74: "koi8r",
+	9: "latin2", 21: "latin2", 27: "latin2", 77: "latin2",
+	10: "swe7", 82: "swe7",
+	11: "ascii", 65: "ascii",
+	12: "ujis", 91: "ujis",
+	13: "sjis", 88: "sjis",
+	14: "cp1251", 23: "cp1251", 50: "cp1251", 51: "cp1251", 52: "cp1251",
+	16: "hebrew", 71: "hebrew",
+	18: "tis620", 89: "tis620",
+	19: "euckr", 85: "euckr",
+	22: "koi8u", 75: "koi8u",
+	24: "gb2312", 86: "gb2312",
+	25: "greek", 70: "greek",
+	26: "cp1250", 34: "cp1250", 44: "cp1250", 66: "cp1250", 99: "cp1250",
+	28: "gbk", 87: "gbk",
+	30: "latin5", 78: "latin5",
+	32: "armscii8", 64: "armscii8",
+	35: "ucs2", 90: "ucs2",
+	36: "cp866", 68: "cp866",
+	37: "keybcs2", 73: "keybcs2",
+	38: "macce", 43: "macce",
+	39: "macroman", 53: "macroman",
+	40: "cp852", 81: "cp852",
+	20: "latin7", 41: "latin7", 42: "latin7", 79: "latin7",
+	54: "utf16", 55: "utf16", 56: "utf16le", 62: "utf16le",
+	57: "cp1256", 67: "cp1256",
+	58: "cp1257", 59: "cp1257", 29: "cp1257",
+	60: "utf32", 61: "utf32",
+	92: "geostd8", 93: "geostd8",
+	95: "cp932", 96: "cp932",
+	97: "eucjpms", 98: "eucjpms",
+	248: "gb18030", 249: "gb18030", 250: "gb18030",
+}
+
+// collationID return the id of collation, or the default collation of charset if collation is empty, 0 if unknown.
+// Collations which are not listed are resolved to the default collation of their charsets.
+func collationID(charset, collation string) uint64 {
+	collation = strings.ToLower(collation)
+	if id, ok := collationIDs[collation]; ok {
+		return id
+	}
+	if i := strings.IndexByte(collation, '_'); i > 0 {
+		charset = collation[:i]
+	}
+	return charsetCollations[strings.ToLower(charset)]
+}
+
+// collationIDs are the ids of common collations
+var collationIDs = map[string]uint64{
+	"binary":             binaryCollationID,
+	"utf8mb4_general_ci": 45, "utf8mb4_bin": 46, "utf8mb4_unicode_ci": 224, "utf8mb4_unicode_520_ci": 246,
+	"utf8mb4_0900_ai_ci": 255, "utf8mb4_0900_as_cs": 278, "utf8mb4_0900_as_ci": 305, "utf8mb4_0900_bin": 309,
+	"utf8_general_ci": 33, "utf8_bin": 83, "utf8_unicode_ci": 192,
+	"utf8mb3_general_ci": 33, "utf8mb3_bin": 83, "utf8mb3_unicode_ci": 192,
+	"latin1_swedish_ci": 8, "latin1_bin": 47, "latin1_general_ci": 48, "latin1_general_cs": 49,
+	"ascii_general_ci": 11, "ascii_bin": 65,
+	"gbk_chinese_ci": 28, "gbk_bin": 87,
+	"gb18030_chinese_ci": 248, "gb18030_bin": 249,
+	"big5_chinese_ci": 1, "big5_bin": 84,
+	"ucs2_general_ci": 35, "ucs2_bin": 90,
+	"utf16_general_ci": 54, "utf16_bin": 55,
+	"utf32_general_ci": 60, "utf32_bin": 61,
+}
+
+// charsetCollations are the default collations of charsets, utf8mb4_0900_ai_ci of mysql 8.0 for utf8mb4
+var charsetCollations = map[string]uint64{
+	"binary": binaryCollationID, "utf8mb4": 255, "utf8": 33, "utf8mb3": 33, "latin1": 8, "ascii": 11,
+	"big5": 1, "dec8": 3, "cp850": 4, "hp8": 6, "koi8r": 7, "latin2": 9, "swe7": 10, "ujis": 12, "sjis": 13,
+	"hebrew": 16, "tis620": 18, "euckr": 19, "koi8u": 22, "gb2312": 24, "greek": 25, "cp1250": 26, "gbk": 28,
+	"latin5": 30, "armscii8": 32, "ucs2": 35, "cp866": 36, "keybcs2": 37, "macce": 38, "macroman": 39,
+	"cp852": 40, "latin7": 41, "cp1251": 51, "utf16": 54, "utf16le": 56, "cp1256": 57, "cp1257": 59,
+	"utf32": 60, "geostd8": 92, "cp932": 95, "eucjpms": 97, "gb18030": 248,
+}
@@ -0,0 +1,415 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// defaultStatsTopN is the number of largest transactions kept by default
+const defaultStatsTopN = 10
+
+// Stats is the workload statistics of binary log events
+type Stats struct {
+	// timestamps of the first and the last event
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+
+	Events       int64 `json:"events"`
+	Bytes        int64 `json:"bytes"`
+	Transactions int64 `json:"transactions"`
+
+	// sorted by bytes in descending order
+	EventTypes []*EventTypeStats `json:"event_types"`
+	Tables     []*TableStats     `json:"tables"`
+
+	// the largest transactions by bytes and rows, and the longest transactions by duration
+	LargestByBytes    []*TransactionStats `json:"largest_by_bytes"`
+	LargestByRows     []*TransactionStats `json:"largest_by_rows"`
+	LongestByDuration []*TransactionStats `json:"longest_by_duration"`
+
+	DDL     []*DDLStats    `json:"ddl"`
+	Minutes []*MinuteStats `json:"minutes"`
+}
+
+// EventTypeStats is the count and bytes of an event type
+type EventTypeStats struct {
+	Type   string `json:"type"`
+	Events int64  `json:"events"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// TableStats is the rows events of a table, Bytes is the size of rows events
+type TableStats struct {
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	Events  int64  `json:"events"`
+	Bytes   int64  `json:"bytes"`
+	Inserts int64  `json:"inserts"`
+	Updates int64  `json:"updates"`
+	Deletes int64  `json:"deletes"`
+}
+
+// TransactionStats is the size of a transaction, Duration is the seconds between the first event and the commit
+type TransactionStats struct {
+	File       string   `json:"file,omitempty"`
+	GTID       string   `json:"gtid"`
+	StartPos   int64    `json:"start_pos"`
+	EndPos     int64    `json:"end_pos"`
+	StartTime  int64    `json:"start_time"`
+	CommitTime int64    `json:"commit_time"`
+	Duration   int64    `json:"duration"`
+	Bytes      int64    `json:"bytes"`
+	Rows       int64    `json:"rows"`
+	Tables     []string `json:"tables"`
+}
+
+// DDLStats is a statement which commits implicitly, such as DDL
+type DDLStats struct {
+	File      string `json:"file,omitempty"`
+	GTID      string `json:"gtid"`
+	Pos       int64  `json:"pos"`
+	Timestamp int64  `json:"timestamp"`
+	Schema    string `json:"schema"`
+	Query     string `json:"query"`
+}
+
+// MinuteStats is the throughput of a minute, transactions are counted in the minute of commit
+type MinuteStats struct {
+	Minute       int64 `json:"minute"`
+	Events       int64 `json:"events"`
+	Bytes        int64 `json:"bytes"`
+	Rows         int64 `json:"rows"`
+	Transactions int64 `json:"transactions"`
+}
+
+// StatsAnalyzer aggregates the statistics of binary log events, events should be added in order
+type StatsAnalyzer struct {
+	// File is the binary log file name of the transactions and DDL added
+	File string
+
+	// TopN is the number of largest transactions kept
+	TopN int
+
+	stats      Stats
+	grouper    transactionGrouper
+	eventTypes map[string]*EventTypeStats
+	tables     map[string]*TableStats
+	minutes    map[int64]*MinuteStats
+}
+
+// NewStatsAnalyzer return a StatsAnalyzer which keeps 10 largest transactions
+func NewStatsAnalyzer() *StatsAnalyzer {
+	return &StatsAnalyzer{
+		TopN:       defaultStatsTopN,
+		eventTypes: make(map[string]*EventTypeStats),
+		tables:     make(map[string]*TableStats),
+		minutes:    make(map[int64]*MinuteStats),
+	}
+}
+
+// Add an event into statistics
+func (a *StatsAnalyzer) Add(event *BinEvent) {
+	h := event.Header
+	if a.stats.Events == 0 {
+		a.stats.StartTime = h.Timestamp
+	}
+	a.stats.EndTime = h.Timestamp
+	a.stats.Events++
+	a.stats.Bytes += h.EventSize
+
+	typ := a.eventTypes[h.Type()]
+	if typ == nil {
+		typ = &EventTypeStats{Type: h.Type()}
+		a.eventTypes[h.Type()] = typ
+	}
+	typ.Events++
+	typ.Bytes += h.EventSize
+
+	minute := a.minute(h.Timestamp)
+	minute.Events++
+	minute.Bytes += h.EventSize
+
+	if rows, ok := event.Body.(*BinRowsEvent); ok && rows.Table != nil {
+		name := rows.Table.Schema + "." + rows.Table.Table
+		table := a.tables[name]
+		if table == nil {
+			table = &TableStats{Schema: rows.Table.Schema, Table: rows.Table.Table}
+			a.tables[name] = table
+		}
+		table.Events++
+		table.Bytes += h.EventSize
+		switch rows.Action() {
+		case RowsActionInsert:
+			table.Inserts += int64(len(rows.Rows))
+		case RowsActionUpdate:
+			table.Updates += int64(len(rows.Rows))
+		case RowsActionDelete:
+			table.Deletes += int64(len(rows.Rows))
+		}
+		minute.Rows += int64(len(rows.Rows))
+	}
+
+	if tx := a.grouper.push(event); tx != nil {
+		a.addTransaction(tx)
+	}
+}
+
+// minute return the MinuteStats of timestamp
+func (a *StatsAnalyzer) minute(timestamp int64) *MinuteStats {
+	key := timestamp - timestamp%60
+	minute := a.minutes[key]
+	if minute == nil {
+		minute = &MinuteStats{Minute: key}
+		a.minutes[key] = minute
+	}
+	return minute
+}
+
+// addTransaction add a finished transaction
+func (a *StatsAnalyzer) addTransaction(tx *Transaction) {
+	a.stats.Transactions++
+	a.minute(tx.CommitTime).Transactions++
+
+	if tx.IsDDL {
+		for _, query := range tx.Statements {
+			a.stats.DDL = append(a.stats.DDL, &DDLStats{
+				File:      a.File,
+				GTID:      tx.GTID,
+				Pos:       tx.StartPos,
+				Timestamp: tx.CommitTime,
+				Schema:    query.Schema,
+				Query:     query.Query,
+			})
+		}
+	}
+
+	ts := newTransactionStats(a.File, tx)
+	a.stats.LargestByBytes = topTransactions(a.stats.LargestByBytes, ts, a.TopN, func(t *TransactionStats) int64 { return t.Bytes })
+	a.stats.LargestByRows = topTransactions(a.stats.LargestByRows, ts, a.TopN, func(t *TransactionStats) int64 { return t.Rows })
+	a.stats.LongestByDuration = topTransactions(a.stats.LongestByDuration, ts, a.TopN, func(t *TransactionStats) int64 { return t.Duration })
+}
+
+// newTransactionStats return the TransactionStats of transaction, tables are in order of their first rows event
+func newTransactionStats(file string, tx *Transaction) *TransactionStats {
+	ts := &TransactionStats{
+		File:       file,
+		GTID:       tx.GTID,
+		StartPos:   tx.StartPos,
+		EndPos:     tx.EndPos,
+		StartTime:  tx.StartTime,
+		CommitTime: tx.CommitTime,
+		Duration:   tx.CommitTime - tx.StartTime,
+		Bytes:      tx.Size(),
+		Tables:     []string{},
+	}
+
+	seen := make(map[string]bool)
+	for _, rows := range tx.Rows {
+		ts.Rows += int64(len(rows.Rows))
+		if rows.Table == nil {
+			continue
+		}
+		name := rows.Table.Schema + "." + rows.Table.Table
+		if !seen[name] {
+			seen[name] = true
+			ts.Tables = append(ts.Tables, name)
+		}
+	}
+	return ts
+}
+
+// topTransactions insert transaction into the top n list in descending order of key
+func topTransactions(top []*TransactionStats, ts *TransactionStats, n int, key func(*TransactionStats) int64) []*TransactionStats {
+	if n <= 0 || key(ts) <= 0 {
+		return top
+	}
+	if len(top) == n && key(top[n-1]) >= key(ts) {
+		return top
+	}
+
+	i := sort.Search(len(top), func(i int) bool { return key(top[i]) < key(ts) })
+	top = append(top, nil)
+	copy(top[i+1:], top[i:])
+	top[i] = ts
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Stats return the statistics of events added
+func (a *StatsAnalyzer) Stats() *Stats {
+	stats := a.stats
+	stats.EventTypes = make([]*EventTypeStats, 0, len(a.eventTypes))
+	for _, typ := range a.eventTypes {
+		stats.EventTypes = append(stats.EventTypes, typ)
+	}
+	sort.Slice(stats.EventTypes, func(i, j int) bool {
+		if stats.EventTypes[i].Bytes != stats.EventTypes[j].Bytes {
+			return stats.EventTypes[i].Bytes > stats.EventTypes[j].Bytes
+		}
+		return stats.EventTypes[i].Type < stats.EventTypes[j].Type
+	})
+
+	stats.Tables = make([]*TableStats, 0, len(a.tables))
+	for _, table := range a.tables {
+		stats.Tables = append(stats.Tables, table)
+	}
+	sort.Slice(stats.Tables, func(i, j int) bool {
+		ti, tj := stats.Tables[i], stats.Tables[j]
+		if ti.Bytes != tj.Bytes {
+			return ti.Bytes > tj.Bytes
+		}
+		return ti.Schema+"."+ti.Table < tj.Schema+"."+tj.Table
+	})
+
+	stats.Minutes = make([]*MinuteStats, 0, len(a.minutes))
+	for _, minute := range a.minutes {
+		stats.Minutes = append(stats.Minutes, minute)
+	}
+	sort.Slice(stats.Minutes, func(i, j int) bool { return stats.Minutes[i].Minute < stats.Minutes[j].Minute })
+
+	for _, list := range []*[]*TransactionStats{&stats.LargestByBytes, &stats.LargestByRows, &stats.LongestByDuration} {
+		*list = append([]*TransactionStats{}, *list...)
+	}
+	stats.DDL = append([]*DDLStats{}, stats.DDL...)
+	return &stats
+}
+
+// statsTime format timestamp in local time
+func statsTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// WriteJSON write the statistics as a JSON object
+func (s *Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteText write the statistics as text tables
+func (s *Stats) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Time: %s - %s\n", statsTime(s.StartTime), statsTime(s.EndTime))
+	fmt.Fprintf(tw, "Events: %d, Bytes: %d, Transactions: %d\n", s.Events, s.Bytes, s.Transactions)
+
+	fmt.Fprintln(tw, "\nEVENT TYPE\tEVENTS\tBYTES")
+	for _, typ := range s.EventTypes {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", typ.Type, typ.Events, typ.Bytes)
+	}
+
+	fmt.Fprintln(tw, "\nTABLE\tEVENTS\tBYTES\tINSERTS\tUPDATES\tDELETES")
+	for _, t := range s.Tables {
+		fmt.Fprintf(tw, "%s.%s\t%d\t%d\t%d\t%d\t%d\n", t.Schema, t.Table, t.Events, t.Bytes, t.Inserts, t.Updates, t.Deletes)
+	}
+
+	for _, top := range []struct {
+		title string
+		list  []*TransactionStats
+	}{
+		{"LARGEST TRANSACTIONS BY BYTES", s.LargestByBytes},
+		{"LARGEST TRANSACTIONS BY ROWS", s.LargestByRows},
+		{"LONGEST TRANSACTIONS BY DURATION", s.LongestByDuration},
+	} {
+		fmt.Fprintf(tw, "\n%s\nFILE\tGTID\tSTART POS\tEND POS\tCOMMIT TIME\tDURATION\tBYTES\tROWS\tTABLES\n", top.title)
+		for _, t := range top.list {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%d\t%d\t%d\t%s\n", t.File, t.GTID, t.StartPos, t.EndPos,
+				statsTime(t.CommitTime), t.Duration, t.Bytes, t.Rows, strings.Join(t.Tables, ","))
+		}
+	}
+
+	fmt.Fprintln(tw, "\nDDL\nFILE\tPOS\tTIME\tSCHEMA\tQUERY")
+	for _, ddl := range s.DDL {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", ddl.File, ddl.Pos, statsTime(ddl.Timestamp), ddl.Schema,
+			strings.Join(strings.Fields(ddl.Query), " "))
+	}
+
+	fmt.Fprintln(tw, "\nMINUTE\tEVENTS\tBYTES\tROWS\tTRANSACTIONS")
+	for _, m := range s.Minutes {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", statsTime(m.Minute), m.Events, m.Bytes, m.Rows, m.Transactions)
+	}
+	return tw.Flush()
+}
+
+// stats sections of WriteCSV()
+const (
+	StatsEventTypes   = "event_types"
+	StatsTables       = "tables"
+	StatsTransactions = "transactions"
+	StatsDDL          = "ddl"
+	StatsMinutes      = "minutes"
+)
+
+// WriteCSV write a section of statistics as CSV with header, section is one of StatsEventTypes, StatsTables,
+// StatsTransactions (the largest transactions by bytes), StatsDDL and StatsMinutes
+func (s *Stats) WriteCSV(w io.Writer, section string) error {
+	i64 := func(n int64) string { return strconv.FormatInt(n, 10) }
+
+	var records [][]string
+	switch section {
+	case StatsEventTypes:
+		records = append(records, []string{"type", "events", "bytes"})
+		for _, t := range s.EventTypes {
+			records = append(records, []string{t.Type, i64(t.Events), i64(t.Bytes)})
+		}
+
+	case StatsTables:
+		records = append(records, []string{"schema", "table", "events", "bytes", "inserts", "updates", "deletes"})
+		for _, t := range s.Tables {
+			records = append(records, []string{t.Schema, t.Table, i64(t.Events), i64(t.Bytes), i64(t.Inserts), i64(t.Updates), i64(t.Deletes)})
+		}
+
+	case StatsTransactions:
+		records = append(records, []string{"file", "gtid", "start_pos", "end_pos", "start_time", "commit_time", "duration", "bytes", "rows", "tables"})
+		for _, t := range s.LargestByBytes {
+			records = append(records, []string{t.File, t.GTID, i64(t.StartPos), i64(t.EndPos), i64(t.StartTime), i64(t.CommitTime),
+				i64(t.Duration), i64(t.Bytes), i64(t.Rows), strings.Join(t.Tables, ",")})
+		}
+
+	case StatsDDL:
+		records = append(records, []string{"file", "gtid", "pos", "timestamp", "schema", "query"})
+		for _, ddl := range s.DDL {
+			records = append(records, []string{ddl.File, ddl.GTID, i64(ddl.Pos), i64(ddl.Timestamp), ddl.Schema, ddl.Query})
+		}
+
+	case StatsMinutes:
+		records = append(records, []string{"minute", "events", "bytes", "rows", "transactions"})
+		for _, m := range s.Minutes {
+			records = append(records, []string{i64(m.Minute), i64(m.Events), i64(m.Bytes), i64(m.Rows), i64(m.Transactions)})
+		}
+
+	default:
+		return fmt.Errorf("unknown stats section %q", section)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
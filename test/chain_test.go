@@ -0,0 +1,105 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// chainFixture write two binary logs of three DDL each, return their paths and the start offsets of DDL
+func chainFixture(t *testing.T) ([]string, [][]int64) {
+	dir := tempDir(t)
+	var paths []string
+	var offsets [][]int64
+	for i, schema := range []string{"db1", "db2"} {
+		b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+		b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+		for _, table := range []string{"t1", "t2", "t3"} {
+			b.Query(schema, "CREATE TABLE "+schema+"."+table+" (id INT)")
+		}
+		b.Rotate("mysql-bin.00000" + string(rune('2'+i)))
+		path := writeBinlog(t, dir, "mysql-bin.00000"+string(rune('1'+i)), b)
+
+		var starts []int64
+		for _, event := range decodeAll(t, openDecoder(t, path)) {
+			if _, ok := event.Body.(*binlog.BinQueryEvent); ok {
+				starts = append(starts, event.Header.LogPos-event.Header.EventSize)
+			}
+		}
+		paths, offsets = append(paths, path), append(offsets, starts)
+	}
+	return paths, offsets
+}
+
+// walkQueries return the queries walked by decoder
+func walkQueries(t *testing.T, decoder *binlog.BinFileDecoder) []string {
+	var queries []string
+	for _, event := range decodeAll(t, decoder) {
+		if query, ok := event.Body.(*binlog.BinQueryEvent); ok {
+			queries = append(queries, query.Query)
+		}
+	}
+	return queries
+}
+
+func TestChainDecoderPositions(t *testing.T) {
+	paths, offsets := chainFixture(t)
+
+	// start position is in the first binary log and stop position is in the last one, as mysqlbinlog
+	option := &binlog.BinReaderOption{StartPos: offsets[0][1], EndPos: offsets[1][1]}
+	decoder, err := binlog.NewBinFileChainDecoder(paths, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+
+	expected := []string{
+		"CREATE TABLE db1.t2 (id INT)",
+		"CREATE TABLE db1.t3 (id INT)",
+		"CREATE TABLE db2.t1 (id INT)",
+	}
+	if queries := walkQueries(t, decoder); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("queries %q, expected %q", queries, expected)
+	}
+	if option.StartPos != offsets[0][1] || option.EndPos != offsets[1][1] {
+		t.Errorf("option of caller is changed: %+v", option)
+	}
+}
+
+func TestChainDecoderSettings(t *testing.T) {
+	paths, _ := chainFixture(t)
+	decoder, err := binlog.NewBinFileChainDecoder(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+
+	// settings set after the decoder is created are applied to the binary logs linked
+	decoder.Filter = &binlog.EventFilter{ExcludeTables: []string{"db2"}}
+	expected := []string{
+		"CREATE TABLE db1.t1 (id INT)",
+		"CREATE TABLE db1.t2 (id INT)",
+		"CREATE TABLE db1.t3 (id INT)",
+	}
+	if queries := walkQueries(t, decoder); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("queries %q, expected %q", queries, expected)
+	}
+}
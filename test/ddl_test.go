@@ -0,0 +1,180 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+func TestParseCreateTable(t *testing.T) {
+	st, err := binlog.ParseDDL("CREATE TABLE IF NOT EXISTS `db`.`t``1` (\n" +
+		"  id bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'a, (b)',\n" +
+		"  `name` national varchar(64) DEFAULT 'x''y',\n" +
+		"  code char(4) CHARACTER SET latin1 COLLATE latin1_bin NOT NULL,\n" +
+		"  state enum('a,b','it''s') NOT NULL DEFAULT 'a,b',\n" +
+		"  flags set('x','y'),\n" +
+		"  total decimal(10,2) GENERATED ALWAYS AS (price * 2) STORED,\n" +
+		"  note text /* comment */ INVISIBLE,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY uk_code (code(2), state),\n" +
+		"  KEY idx_name (name),\n" +
+		"  CONSTRAINT fk FOREIGN KEY (id) REFERENCES other (id) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci PARTITION BY HASH (id) PARTITIONS 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &binlog.DDLStatement{
+		Type:        binlog.DDLCreateTable,
+		Table:       binlog.TableName{Schema: "db", Table: "t`1"},
+		IfNotExists: true,
+		Definition: &binlog.TableDef{
+			Schema: "db",
+			Name:   "t`1",
+			Columns: []*binlog.ColumnDef{
+				{Name: "id", Type: "bigint", Unsigned: true},
+				{Name: "name", Type: "varchar", Nullable: true, Charset: "utf8"},
+				{Name: "code", Type: "char", Charset: "latin1", Collation: "latin1_bin"},
+				{Name: "state", Type: "enum", Values: []string{"a,b", "it's"}},
+				{Name: "flags", Type: "set", Nullable: true, Values: []string{"x", "y"}},
+				{Name: "total", Type: "decimal", Nullable: true, Generated: "STORED"},
+				{Name: "note", Type: "text", Nullable: true, Invisible: true},
+			},
+			PrimaryKey: []string{"id"},
+			UniqueKeys: []*binlog.KeyDef{{Name: "uk_code", Columns: []string{"code", "state"}}},
+			Charset:    "utf8mb4",
+			Collation:  "utf8mb4_0900_ai_ci",
+		},
+	}
+	if !reflect.DeepEqual(st, expected) {
+		actual, _ := json.MarshalIndent(st, "", "  ")
+		t.Errorf("CREATE TABLE\n%s", actual)
+	}
+
+	st, err = binlog.ParseDDL("create table t2 like db.t1")
+	if err != nil || st.Definition != nil || st.Like == nil || *st.Like != (binlog.TableName{Schema: "db", Table: "t1"}) ||
+		st.Table != (binlog.TableName{Table: "t2"}) {
+		t.Errorf("CREATE TABLE LIKE: %+v, %v", st, err)
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	for _, c := range []struct {
+		query    string
+		expected []*binlog.AlterSpec
+	}{
+		{
+			"ALTER TABLE t ADD COLUMN age int unsigned NOT NULL AFTER name, ADD (a int, b int) FIRST",
+			[]*binlog.AlterSpec{
+				{Action: binlog.AlterAddColumn, Name: "age", Column: &binlog.ColumnDef{Name: "age", Type: "int", Unsigned: true}, After: "name"},
+				{Action: binlog.AlterAddColumn, Name: "a", Column: &binlog.ColumnDef{Name: "a", Type: "int", Nullable: true}},
+				{Action: binlog.AlterAddColumn, Name: "b", Column: &binlog.ColumnDef{Name: "b", Type: "int", Nullable: true}},
+			},
+		},
+		{
+			"ALTER TABLE t CHANGE name full_name varchar(64) FIRST, MODIFY id bigint PRIMARY KEY, DROP COLUMN note, DROP age",
+			[]*binlog.AlterSpec{
+				{Action: binlog.AlterModifyColumn, Name: "name", Column: &binlog.ColumnDef{Name: "full_name", Type: "varchar", Nullable: true}, First: true},
+				{Action: binlog.AlterModifyColumn, Name: "id", Column: &binlog.ColumnDef{Name: "id", Type: "bigint"}},
+				{Action: binlog.AlterAddPrimaryKey, PrimaryKey: []string{"id"}},
+				{Action: binlog.AlterDropColumn, Name: "note"},
+				{Action: binlog.AlterDropColumn, Name: "age"},
+			},
+		},
+		{
+			"ALTER TABLE t DROP PRIMARY KEY, ADD PRIMARY KEY (a, b), ADD UNIQUE INDEX uk (c), DROP INDEX idx, RENAME INDEX uk TO uk2",
+			[]*binlog.AlterSpec{
+				{Action: binlog.AlterDropPrimaryKey},
+				{Action: binlog.AlterAddPrimaryKey, PrimaryKey: []string{"a", "b"}},
+				{Action: binlog.AlterAddUniqueKey, Key: &binlog.KeyDef{Name: "uk", Columns: []string{"c"}}},
+				{Action: binlog.AlterDropIndex, Name: "idx"},
+				{Action: binlog.AlterRenameIndex, Name: "uk", NewName: "uk2"},
+			},
+		},
+		{
+			"ALTER TABLE t RENAME COLUMN a TO b, ALTER COLUMN c SET INVISIBLE, ALTER COLUMN d SET DEFAULT 1, RENAME TO db.t2",
+			[]*binlog.AlterSpec{
+				{Action: binlog.AlterRenameColumn, Name: "a", NewName: "b"},
+				{Action: binlog.AlterSetVisibility, Name: "c", Invisible: true},
+				{Action: binlog.AlterRenameTable, Table: binlog.TableName{Schema: "db", Table: "t2"}},
+			},
+		},
+		{
+			"ALTER TABLE t CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_bin, ENGINE=InnoDB DEFAULT CHARSET latin1, ADD INDEX idx (a)",
+			[]*binlog.AlterSpec{
+				{Action: binlog.AlterConvertCharset, Charset: "utf8mb4", Collation: "utf8mb4_bin"},
+				{Action: binlog.AlterTableCharset, Charset: "latin1"},
+			},
+		},
+		{
+			"ALTER TABLE t ENGINE=InnoDB, ALGORITHM=INPLACE, LOCK=NONE",
+			nil,
+		},
+	} {
+		st, err := binlog.ParseDDL(c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if st.Type != binlog.DDLAlterTable || st.Table != (binlog.TableName{Table: "t"}) || !reflect.DeepEqual(st.Alters, c.expected) {
+			actual, _ := json.MarshalIndent(st, "", "  ")
+			t.Errorf("%s\n%s", c.query, actual)
+		}
+	}
+}
+
+func TestParseDDL(t *testing.T) {
+	for _, c := range []struct {
+		query    string
+		expected *binlog.DDLStatement
+	}{
+		{"DROP TABLE IF EXISTS a, `db`.b /* generated by server */", &binlog.DDLStatement{Type: binlog.DDLDropTable, IfExists: true,
+			Tables: []binlog.TableName{{Table: "a"}, {Schema: "db", Table: "b"}}}},
+		{"RENAME TABLE a TO b, db.c TO db2.c", &binlog.DDLStatement{Type: binlog.DDLRenameTable,
+			Renames: [][2]binlog.TableName{{{Table: "a"}, {Table: "b"}}, {{Schema: "db", Table: "c"}, {Schema: "db2", Table: "c"}}}}},
+		{"CREATE DATABASE IF NOT EXISTS `shop`", &binlog.DDLStatement{Type: binlog.DDLCreateDatabase, IfNotExists: true, Database: "shop"}},
+		{"drop schema shop", &binlog.DDLStatement{Type: binlog.DDLDropDatabase, Database: "shop"}},
+		{"CREATE TEMPORARY TABLE t (id int)", nil},
+		{"CREATE INDEX idx ON t (a)", nil},
+		{"INSERT INTO t VALUES ('CREATE TABLE x (id int)')", nil},
+		{"BEGIN", nil},
+	} {
+		st, err := binlog.ParseDDL(c.query)
+		if err != nil || !reflect.DeepEqual(st, c.expected) {
+			actual, _ := json.Marshal(st)
+			t.Errorf("%s: %s, %v", c.query, actual, err)
+		}
+	}
+
+	for _, query := range []string{
+		"CREATE TABLE t (id int",
+		"CREATE TABLE t (state enum(1, 2))",
+		"CREATE TABLE `t (id int)",
+		"CREATE TABLE t (name varchar(10) DEFAULT 'a)",
+		"RENAME TABLE a b",
+		"ALTER TABLE t RENAME COLUMN a b",
+	} {
+		if st, err := binlog.ParseDDL(query); err == nil {
+			actual, _ := json.Marshal(st)
+			t.Errorf("%s is not an error: %s", query, actual)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// debeziumMessages return the change events of binary log built by b
+func debeziumMessages(t *testing.T, b *binlogtest.Builder) []map[string]interface{} {
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))
+
+	var buf bytes.Buffer
+	enc := binlog.NewDebeziumEncoder(&buf, "dbserver1")
+	enc.File = "mysql-bin.000001"
+	enc.Now = func() time.Time { return time.Unix(1537600001, 0) }
+	for _, event := range decodeAll(t, decoder) {
+		if err := enc.Encode(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return decodeJSONLines(t, buf.Bytes())
+}
+
+// debeziumColumns return the column schemas of before/after keyed by field name
+func debeziumColumns(message map[string]interface{}) map[string]map[string]interface{} {
+	envelope := message["schema"].(map[string]interface{})
+	value := envelope["fields"].([]interface{})[0].(map[string]interface{})
+	columns := map[string]map[string]interface{}{}
+	for _, field := range value["fields"].([]interface{}) {
+		field := field.(map[string]interface{})
+		columns[field["field"].(string)] = field
+	}
+	return columns
+}
+
+// decimalValue decode the base64 bytes of Kafka Connect Decimal of scale 0
+func decimalValue(t *testing.T, v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		t.Fatalf("Decimal value %#v is not base64 bytes", v)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return n.String()
+}
+
+func TestDebeziumEncoder(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	b.MinimalRowImage = true
+	users := b.Table("test", "users",
+		binlogtest.BigInt("id").AsUnsigned().AsNotNull().AsPrimaryKey(),
+		binlogtest.Varchar("name", 20).AsNotNull(),
+		binlogtest.Enum("state", "active", "locked").AsNotNull(),
+		binlogtest.BigInt("score"),
+	)
+	b.Begin().
+		Insert(users, []interface{}{uint64(18446744073709551615), "alice", 1, -5}).
+		Update(users, []interface{}{uint64(18446744073709551615), "alice", 1, -5}, []interface{}{uint64(18446744073709551615), "alice", 2, -5}).
+		Commit()
+
+	messages := debeziumMessages(t, b)
+	if len(messages) != 2 {
+		t.Fatalf("got %d change events, expected 2", len(messages))
+	}
+
+	// BIGINT UNSIGNED is Decimal as bigint.unsigned.handling.mode=precise
+	columns := debeziumColumns(messages[0])
+	id := columns["id"]
+	if id["type"] != "bytes" || id["name"] != "org.apache.kafka.connect.data.Decimal" ||
+		id["parameters"].(map[string]interface{})["scale"] != "0" || id["optional"] != false {
+		t.Errorf("id schema %v", id)
+	}
+	if score := columns["score"]; score["type"] != "int64" || score["optional"] != true {
+		t.Errorf("score schema %v", score)
+	}
+	if state := columns["state"]; state["type"] != "string" || state["name"] != "io.debezium.data.Enum" {
+		t.Errorf("state schema %v", state)
+	}
+
+	insert := messages[0]["payload"].(map[string]interface{})
+	after := insert["after"].(map[string]interface{})
+	if insert["op"] != "c" || decimalValue(t, after["id"]) != "18446744073709551615" || after["score"] != float64(-5) ||
+		after["state"] != "active" || after["name"] != "alice" {
+		t.Errorf("insert payload %v", insert)
+	}
+
+	// columns absent from the before or after image of minimal update are optional
+	columns = debeziumColumns(messages[1])
+	for name, optional := range map[string]bool{"id": true, "name": true, "state": true, "score": true} {
+		if columns[name]["optional"] != optional {
+			t.Errorf("update schema of %s: optional %v, expected %v", name, columns[name]["optional"], optional)
+		}
+	}
+	update := messages[1]["payload"].(map[string]interface{})
+	before, after := update["before"].(map[string]interface{}), update["after"].(map[string]interface{})
+	if len(before) != 1 || decimalValue(t, before["id"]) != "18446744073709551615" || len(after) != 1 || after["state"] != "locked" {
+		t.Errorf("update payload %v", update)
+	}
+	source := update["source"].(map[string]interface{})
+	if update["op"] != "u" || source["gtid"] != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1" || source["table"] != "users" ||
+		source["file"] != "mysql-bin.000001" || update["ts_ms"] != float64(1537600001000) ||
+		source["version"] != binlog.DebeziumVersion || source["connector"] != binlog.DebeziumConnector {
+		t.Errorf("update envelope %v", update)
+	}
+}
+
+func TestDebeziumEncoderUnknownEnum(t *testing.T) {
+	// ENUM values are not known without binlog_row_metadata=FULL
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	state := b.Table("test", "state", binlogtest.Enum("state", "active", "locked"))
+	b.Begin().Insert(state, []interface{}{2}).Commit()
+
+	messages := debeziumMessages(t, b)
+	if len(messages) != 1 {
+		t.Fatalf("got %d change events, expected 1", len(messages))
+	}
+	column := debeziumColumns(messages[0])["@1"]
+	if column["type"] != "int32" || column["name"] != nil {
+		t.Errorf("ENUM schema %v", column)
+	}
+	if after := messages[0]["payload"].(map[string]interface{})["after"].(map[string]interface{}); after["@1"] != float64(2) {
+		t.Errorf("ENUM value %#v", after["@1"])
+	}
+}
@@ -17,48 +17,224 @@ limitations under the License.
 package test
 
 import (
+	"errors"
 	"fmt"
-	"runtime"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
 )
 
-func TestDecoder(t *testing.T) {
-	memStats := &runtime.MemStats{}
-	runtime.ReadMemStats(memStats)
-	decoder, err := binlog.NewBinFileDecoder("./testdata/mysql-bin.000004")
+// fixture build a binary log of every column type, NULLs, a wide table and a 6 bytes table id
+func fixture(b *binlogtest.Builder) [][]interface{} {
+	all := b.Table("test", "all_types",
+		binlogtest.Int("id").AsPrimaryKey(),
+		binlogtest.TinyInt("c_tiny"),
+		binlogtest.SmallInt("c_small").AsUnsigned(),
+		binlogtest.MediumInt("c_medium"),
+		binlogtest.BigInt("c_big").AsUnsigned(),
+		binlogtest.Float("c_float"),
+		binlogtest.Double("c_double"),
+		binlogtest.Decimal("c_decimal", 10, 3),
+		binlogtest.Year("c_year"),
+		binlogtest.Date("c_date"),
+		binlogtest.Time("c_time", 3),
+		binlogtest.Datetime("c_datetime", 6),
+		binlogtest.Timestamp("c_timestamp", 0),
+		binlogtest.Char("c_char", 100),
+		binlogtest.Varchar("c_varchar", 20),
+		binlogtest.Binary("c_binary", 4),
+		binlogtest.Text("c_text", 2),
+		binlogtest.JSON("c_json"),
+		binlogtest.Bit("c_bit", 12),
+		binlogtest.Enum("c_enum", "a", "b", "c"),
+		binlogtest.Set("c_set", "x", "y", "z"),
+	)
+	row := []interface{}{1, -128, 65535, -8388608, uint64(18446744073709551615), 1.5, -2.25, "-1234567.890",
+		2018, "2018-09-22", "-838:59:59.500", "2018-09-22 10:00:00.123456", "2018-09-22 10:00:00",
+		"中文", "hello", "ab\x00\x00", "text", `{"a": [1, 2, null]}`, 0xabc, 2, 5}
+	null := []interface{}{2, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
+
+	var columns []binlogtest.Column
+	var wide []interface{}
+	for i := 0; i < 70; i++ {
+		columns = append(columns, binlogtest.Int(fmt.Sprintf("c%d", i)))
+		wide = append(wide, i)
+		if i%3 == 0 {
+			wide[i] = nil
+		}
+	}
+	big := b.Table("test", "wide", columns...)
+	big.ID = 1<<40 + 1
+
+	b.Query("test", "CREATE TABLE t(id int)")
+	b.Begin().Insert(all, row, null).Update(all, null, row).Commit()
+	b.Insert(big, wide)
+	b.Delete(all, row)
+	return [][]interface{}{row, null, null, row, wide, row}
+}
+
+// decoded return the row of all_types decoded, signedness and charsets are known by optional
+// metadata of TABLE_MAP_EVENT since mysql 8.0.1, or the unsigned are negative and TEXT is []byte
+func decoded(row []interface{}, metadata bool) []interface{} {
+	if len(row) != 21 || row[1] == nil {
+		return row
+	}
+
+	row = append([]interface{}{}, row...)
+	if metadata {
+		row[15] = []byte(row[15].(string))
+	} else {
+		row[2], row[4], row[16] = -1, -1, []byte(row[16].(string))
+	}
+	return row
+}
 
+func TestDecoder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogtest")
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		version     string
+		checksumAlg byte
+		uuid        string
+		metadata    bool
+	}{
+		{"8.0.32", binlog.BinlogChecksumAlgCRC32, "3e11fa47-71ca-11e1-9e33-c80aa9429562", true},
+		{"8.0.32", binlog.BinlogChecksumAlgOff, "", true},
+		{"5.7.44-log", binlog.BinlogChecksumAlgCRC32, "", false},
+		{"5.6.51-log", binlog.BinlogChecksumAlgCRC32, "3e11fa47-71ca-11e1-9e33-c80aa9429562", false},
+		{"5.5.62-log", binlog.BinlogChecksumAlgOff, "", false},
+	} {
+		b := binlogtest.New(c.version, c.checksumAlg)
+		b.UUID = c.uuid
+		expected := fixture(b)
+
+		path := filepath.Join(dir, "mysql-bin."+c.version)
+		if err := b.WriteFile(path); err != nil {
+			t.Fatal(c.version, err)
+		}
+
+		decoder, err := binlog.NewBinFileDecoder(path)
+		if err != nil {
+			t.Fatal(c.version, err)
+		}
+
+		var images [][]interface{}
+		err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+			if rows, ok := event.Body.(*binlog.BinRowsEvent); ok {
+				for _, row := range rows.Rows {
+					if row.Before != nil {
+						images = append(images, row.Before)
+					}
+					if row.After != nil {
+						images = append(images, row.After)
+					}
+				}
+			}
+			return true, nil
+		})
+		decoder.BinFile.Close()
+		if err != nil {
+			t.Fatal(c.version, err)
+		}
+
+		if len(images) != len(expected) {
+			t.Fatalf("%s: %d row images decoded, expected %d", c.version, len(images), len(expected))
+		}
+		for i, image := range images {
+			if got, want := fmt.Sprint(image), fmt.Sprint(decoded(expected[i], c.metadata)); got != want {
+				t.Errorf("%s: row image %d\n got: %s\nwant: %s", c.version, i, got, want)
+			}
+		}
 	}
+}
 
-	f, _ := decoder.BinFile.Stat()
-	fmt.Println("Binlog file size:", f.Size()>>10>>10, "MB")
-	starTime := time.Now()
+func TestDecoderPreviousGTIDs(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.PreviousGTIDs = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,5b3a7f21-2c9d-11e8-8a6e-0242ac110002:3"
+	b.Query("test", "CREATE TABLE t(id int)")
 
-	count := 0
-	maxCount := 0
-	err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
-		fmt.Println(event.Header)
-		count++
-		return maxCount > count || maxCount == 0, nil
-	})
+	var previous []*binlog.BinPreGTIDsEvent
+	for _, event := range decodeAll(t, openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))) {
+		if body, ok := event.Body.(*binlog.BinPreGTIDsEvent); ok {
+			previous = append(previous, body)
+		}
+	}
 
-	duration := time.Since(starTime)
-	fmt.Println("Time total:", duration.String())
+	if len(previous) != 1 {
+		t.Fatalf("%d PREVIOUS_GTIDS_EVENT decoded, expected 1", len(previous))
+	}
+	if got := previous[0].GTIDs.String(); got != b.PreviousGTIDs {
+		t.Errorf("previous GTIDs %s, expected %s", got, b.PreviousGTIDs)
+	}
+}
 
-	speed := float64(f.Size()>>10>>10) / duration.Seconds()
-	fmt.Printf("Speed: %.2f MB/s\n", speed)
+func TestQueryStatusVars(t *testing.T) {
+	data := []byte{
+		binlog.QFlags2Code, 0x00, 0x00, 0x00, 0x00,
+		binlog.QSQLModeCode, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00,
+		binlog.QCatalogNZCode, 3, 's', 't', 'd',
+		binlog.QCharsetCode, 0xff, 0x00, 0xff, 0x00, 0x2d, 0x00,
+		binlog.QTimeZoneCode, 6, '+', '0', '8', ':', '0', '0',
+		binlog.QUpdatedDBNames, 2, 't', 'e', 's', 't', 0x00, 'a', 0x00,
+		binlog.QMicroseconds, 0x40, 0xe2, 0x01,
+		binlog.QDDLLoggedWithXID, 0x2a, 0, 0, 0, 0, 0, 0, 0,
+		binlog.QDefaultCollationForUTF8MB4, 0xff, 0x00,
+	}
 
+	vars, err := (&binlog.BinQueryEvent{StatusVars: data}).Statue()
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%d %s %d/%d/%d %s %v %d %d %d", vars.SQLMode, vars.Catalog, vars.ClientCharset,
+		vars.CollationConnection, vars.CollationServer, vars.TimeZone, vars.UpdatedDBNames, vars.Microseconds,
+		vars.DDLLoggedWithXID, vars.DefaultCollationForUTF8MB4)
+	if expected := "2097152 std 255/255/45 +08:00 [test a] 123456 42 255"; got != expected {
+		t.Errorf("status vars %s, expected %s", got, expected)
 	}
 
-	runtime.ReadMemStats(memStats)
-	fmt.Println("GC times:", memStats.NumGC)
-	pauseTotal := time.Duration(int64(memStats.PauseTotalNs))
-	fmt.Println("Pause total:", pauseTotal.String())
+	// every truncated status vars are malformed, instead of panic
+	for _, n := range []int{3, 10, 16, 22, 30, 40, 45, 49, 57, 58} {
+		var malformed *binlog.ErrMalformedEvent
+		if _, err := (&binlog.BinQueryEvent{StatusVars: data[:n]}).Statue(); !errors.As(err, &malformed) {
+			t.Errorf("status vars truncated to %d bytes: got %v, expected ErrMalformedEvent", n, err)
+		}
+	}
+
+	if _, err := (&binlog.BinQueryEvent{StatusVars: []byte{0x7f, 0x00}}).Statue(); err == nil ||
+		!strings.Contains(err.Error(), "status var 0x7f: unknown") {
+		t.Errorf("unknown status var: got %v", err)
+	}
+}
+
+func TestUserVarSQLValue(t *testing.T) {
+	for _, c := range []struct {
+		event    binlog.BinUserVarEvent
+		expected string
+	}{
+		{binlog.BinUserVarEvent{IsNull: true}, "NULL"},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarStringResult, Charset: 45, Value: []byte("it's")}, `'it\'s'`},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarStringResult, Charset: 8, Value: []byte("caf\xe9")}, "_latin1 X'636166e9'"},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarRealResult, Value: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}}, "1.5"},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarIntResult, Value: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}, "-1"},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarIntResult, Flags: binlog.UserVarUnsignedF,
+			Value: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}, "18446744073709551615"},
+		{binlog.BinUserVarEvent{Type: binlog.UserVarDecimalResult, Value: []byte{5, 2, 0x80, 0x7b, 0x2d}}, "123.45"},
+	} {
+		if got, err := c.event.SQLValue(); err != nil || got != c.expected {
+			t.Errorf("%+v: got %s, %v, expected %s", c.event, got, err, c.expected)
+		}
+	}
+
+	if _, err := (&binlog.BinUserVarEvent{Type: binlog.UserVarIntResult, Value: []byte{1}}).SQLValue(); err == nil {
+		t.Error("truncated INT user variable: expected error")
+	}
 }
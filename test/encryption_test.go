@@ -0,0 +1,220 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+const replicationKeyID = "MySQLReplicationKey_3e11fa47-71ca-11e1-9e33-c80aa9429562_1"
+
+// sequence return n bytes of from, from+1, ...
+func sequence(from, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(from + i)
+	}
+	return data
+}
+
+// encryptBinlog encrypt binary log as binlog_encryption: a 512 bytes header with the file password
+// encrypted by master key with AES-256-CBC, then the binary log encrypted with AES-256-CTR,
+// whose key and iv are SHA-512 of the file password
+func encryptBinlog(t *testing.T, plain, masterKey, password, iv []byte) []byte {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPassword := make([]byte, len(password))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encryptedPassword, password)
+
+	header := []byte{0xfd, 'b', 'i', 'n', 1}
+	header = append(header, 1, byte(len(replicationKeyID)))
+	header = append(header, replicationKeyID...)
+	header = append(header, 2)
+	header = append(header, encryptedPassword...)
+	header = append(header, 3)
+	header = append(header, iv...)
+	header = append(header, make([]byte, 512-len(header))...)
+
+	keyIV := sha512.Sum512(password)
+	if block, err = aes.NewCipher(keyIV[:32]); err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, len(plain))
+	cipher.NewCTR(block, keyIV[32:48]).XORKeyStream(content, plain)
+	return append(header, content...)
+}
+
+// keyringFile return the data file of keyring_file plugin with a key,
+// which is obfuscated and stored with its id, type and user in 8 bytes aligned
+func keyringFile(keyID string, key []byte) []byte {
+	const obfuscate = "*305=Ljt0*!@$Hnm(*-9-w;:"
+	obfuscated := make([]byte, len(key))
+	for i := range key {
+		obfuscated[i] = key[i] ^ obfuscate[i%len(obfuscate)]
+	}
+
+	fields := [][]byte{[]byte(keyID), []byte("AES"), nil, obfuscated}
+	size := 40
+	for _, field := range fields {
+		size += len(field)
+	}
+	size = (size + 7) / 8 * 8
+
+	pod := make([]byte, 40, size)
+	binary.LittleEndian.PutUint64(pod, uint64(size))
+	for i, field := range fields {
+		binary.LittleEndian.PutUint64(pod[8+i*8:], uint64(len(field)))
+	}
+	for _, field := range fields {
+		pod = append(pod, field...)
+	}
+	pod = pod[:size]
+
+	digest := sha256.Sum256(pod)
+	data := append([]byte("Keyring file version:2.0"), pod...)
+	data = append(data, "EOF"...)
+	return append(data, digest[:]...)
+}
+
+// encodeEvents return the JSON Lines of events
+func encodeEvents(t *testing.T, events []*binlog.BinEvent) string {
+	var buf bytes.Buffer
+	enc := binlog.NewJSONEncoder(&buf)
+	for _, event := range events {
+		if err := enc.EncodeEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func TestEncryptedBinlog(t *testing.T) {
+	dir := tempDir(t)
+	masterKey, password, iv := sequence(1, 32), sequence(101, 32), sequence(201, 16)
+
+	var plainPaths, encryptedPaths []string
+	for i, next := range []string{"mysql-bin.000002", "mysql-bin.000003"} {
+		b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+		b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+		fixture(b)
+		b.Rotate(next)
+		data, err := b.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := filepath.Join(dir, "mysql-bin.00000"+string(rune('1'+i)))
+		if err := ioutil.WriteFile(name+".plain", data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, encryptBinlog(t, data, masterKey, password, iv), 0644); err != nil {
+			t.Fatal(err)
+		}
+		plainPaths, encryptedPaths = append(plainPaths, name+".plain"), append(encryptedPaths, name)
+	}
+
+	keyringPath := filepath.Join(dir, "keyring")
+	if err := ioutil.WriteFile(keyringPath, keyringFile(replicationKeyID, masterKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := binlog.NewKeyringFile(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	option := &binlog.BinReaderOption{KeyProvider: keys}
+
+	// the encrypted chain decodes as the plain one
+	plain, err := binlog.NewBinFileChainDecoder(plainPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.BinFile.Close()
+	encrypted, err := binlog.NewBinFileChainDecoder(encryptedPaths, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encrypted.BinFile.Close()
+	if got, want := encodeEvents(t, decodeAll(t, encrypted)), encodeEvents(t, decodeAll(t, plain)); got != want {
+		t.Errorf("encrypted binary logs decoded\n%s\nexpected\n%s", got, want)
+	}
+
+	report, err := binlog.Verify(encryptedPaths[0], option)
+	if err != nil || !report.OK() {
+		t.Errorf("verify encrypted binary log: %v %v", report.Issues, err)
+	}
+
+	// key provider is needed
+	if _, err := binlog.NewBinFileDecoder(encryptedPaths[0]); err == nil || !strings.Contains(err.Error(), "key provider") {
+		t.Errorf("without key provider: got %v", err)
+	}
+
+	// content decrypted by a wrong key is not a binary log
+	wrongPath := filepath.Join(dir, "wrong")
+	if err := ioutil.WriteFile(wrongPath, keyringFile(replicationKeyID, sequence(2, 32)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := binlog.NewKeyringFile(wrongPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var invalid *binlog.ErrInvalidHeader
+	if _, err := binlog.NewBinFileDecoder(encryptedPaths[0], &binlog.BinReaderOption{KeyProvider: wrong}); !errors.As(err, &invalid) {
+		t.Errorf("wrong master key: got %v, expected ErrInvalidHeader", err)
+	}
+	if _, err := wrong.Key("MySQLReplicationKey_unknown_1"); err == nil {
+		t.Errorf("unknown key id: no error")
+	}
+
+	// keyring is validated by its digest
+	data := keyringFile(replicationKeyID, masterKey)
+	data[len("Keyring file version:2.0")+45] ^= 0xff
+	if err := ioutil.WriteFile(keyringPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := binlog.NewKeyringFile(keyringPath); err == nil || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("tampered keyring: got %v", err)
+	}
+
+	// encryption header without IV
+	data, err = ioutil.ReadFile(encryptedPaths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := bytes.IndexByte(data[7+len(replicationKeyID)+33:512], 3) + 7 + len(replicationKeyID) + 33
+	copy(data[pos:512], make([]byte, 512-pos))
+	if err := ioutil.WriteFile(wrongPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := binlog.NewBinFileDecoder(wrongPath, option); err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Errorf("header without IV: got %v", err)
+	}
+}
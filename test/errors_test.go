@@ -0,0 +1,122 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// walkFile decode all events of binary log data written into path, the types of events are returned
+func walkFile(path string, data []byte, strict bool) ([]uint8, error) {
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+
+	decoder, err := binlog.NewBinFileDecoder(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.BinFile.Close()
+
+	var types []uint8
+	decoder.Strict = strict
+	err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		types = append(types, event.Header.EventType)
+		return true, nil
+	})
+	return types, err
+}
+
+func TestDecodeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mysql-bin.000123")
+
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	fixture(b)
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// start offset of the first XID_EVENT
+	var offset int64
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := binlog.NewBinFileDecoder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		offset = event.Header.LogPos - event.Header.EventSize
+		return event.Header.EventType != binlog.XIDEvent, nil
+	})
+	decoder.BinFile.Close()
+
+	corrupted := append([]byte{}, data...)
+	corrupted[offset+20] ^= 0xff
+	var mismatch *binlog.ErrChecksumMismatch
+	if _, err := walkFile(path, corrupted, false); !errors.As(err, &mismatch) {
+		t.Fatalf("corrupted XID_EVENT: got %v, expected ErrChecksumMismatch", err)
+	}
+	if mismatch.File != path || mismatch.Offset != offset || mismatch.EventType != binlog.XIDEvent ||
+		mismatch.Expected == mismatch.Actual {
+		t.Errorf("corrupted XID_EVENT: got %+v at offset %d", mismatch, offset)
+	}
+
+	var truncated *binlog.ErrTruncatedEvent
+	if _, err := walkFile(path, data[:offset+25], false); !errors.As(err, &truncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated XID_EVENT: got %v, expected ErrTruncatedEvent", err)
+	}
+	if truncated.Offset != offset || truncated.Expected != 31 || truncated.Actual != 25 {
+		t.Errorf("truncated XID_EVENT: got %+v at offset %d", truncated, offset)
+	}
+
+	var invalid *binlog.ErrInvalidHeader
+	if _, err := walkFile(path, append([]byte("\xfebim"), data[4:]...), false); !errors.As(err, &invalid) {
+		t.Errorf("invalid magic: got %v, expected ErrInvalidHeader", err)
+	}
+
+	// an INCIDENT_EVENT without body replaces the XID_EVENT
+	unsupported := append([]byte{}, data[:offset+19]...)
+	unsupported[offset+4] = binlog.IncidentEvent
+	binary.LittleEndian.PutUint32(unsupported[offset+9:], 23)
+	unsupported = append(unsupported, make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(unsupported[offset+19:], crc32.ChecksumIEEE(unsupported[offset:offset+19]))
+	types, err := walkFile(path, unsupported, false)
+	if err != nil || types[len(types)-1] != binlog.IncidentEvent {
+		t.Errorf("INCIDENT_EVENT: got %v, expected it walked", err)
+	}
+	var unsupportedErr *binlog.ErrUnsupportedEvent
+	if _, err := walkFile(path, unsupported, true); !errors.As(err, &unsupportedErr) || unsupportedErr.Offset != offset {
+		t.Errorf("INCIDENT_EVENT in strict mode: got %v, expected ErrUnsupportedEvent at %d", err, offset)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// filterFixture return a binary log of transactions on tables of db1 and db2, from server 1 and 2
+func filterFixture() *binlogtest.Builder {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	users := b.Table("db1", "users", binlogtest.Int("id").AsPrimaryKey())
+	orders := b.Table("db1", "orders", binlogtest.Int("id").AsPrimaryKey())
+	logs := b.Table("db2", "logs", binlogtest.Int("id").AsPrimaryKey())
+
+	// GTID 1-3 from server 1, GTID 4 from server 2
+	b.Begin().Insert(users, []interface{}{1}).Insert(orders, []interface{}{10}).Commit()
+	b.Begin().Update(orders, []interface{}{10}, []interface{}{11}).Delete(logs, []interface{}{100}).Commit()
+	b.Query("db2", "CREATE TABLE db2.t (id INT)")
+	b.ServerID = 2
+	b.Begin().Insert(logs, []interface{}{101}).Commit()
+	return b
+}
+
+// filterSummary return the GNOs, statements and XIDs walked with filter
+func filterSummary(t *testing.T, filter *binlog.EventFilter) []string {
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", filterFixture()))
+	decoder.Filter = filter
+
+	var summary []string
+	for _, event := range decodeAll(t, decoder) {
+		switch body := event.Body.(type) {
+		case *binlog.BinGTIDEvent:
+			summary = append(summary, body.GTID()[strings.LastIndexByte(body.GTID(), ':'):])
+		case *binlog.BinQueryEvent:
+			summary = append(summary, body.Query)
+		case *binlog.BinXIDEvent:
+			summary = append(summary, "XID")
+		}
+	}
+	return summary
+}
+
+func TestEventFilter(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		filter *binlog.EventFilter
+		rows   []string
+	}{
+		{
+			name:   "include schema",
+			filter: &binlog.EventFilter{IncludeTables: []string{"db1"}},
+			rows: []string{"db1.users insert [] -> [1]", "db1.orders insert [] -> [10]",
+				"db1.orders update [10] -> [11]"},
+		},
+		{
+			name:   "exclude glob",
+			filter: &binlog.EventFilter{ExcludeTables: []string{"db?.or*"}},
+			rows:   []string{"db1.users insert [] -> [1]", "db2.logs delete [100] -> []", "db2.logs insert [] -> [101]"},
+		},
+		{
+			name:   "regexp",
+			filter: &binlog.EventFilter{IncludeTables: []string{`/^db[0-9]\.(users|logs)$/`}},
+			rows:   []string{"db1.users insert [] -> [1]", "db2.logs delete [100] -> []", "db2.logs insert [] -> [101]"},
+		},
+		{
+			name:   "actions",
+			filter: &binlog.EventFilter{Actions: []string{binlog.RowsActionUpdate, binlog.RowsActionDelete}},
+			rows:   []string{"db1.orders update [10] -> [11]", "db2.logs delete [100] -> []"},
+		},
+		{
+			name:   "event types",
+			filter: &binlog.EventFilter{ExcludeEventTypes: []uint8{binlog.WriteRowsEventV2}},
+			rows:   []string{"db1.orders update [10] -> [11]", "db2.logs delete [100] -> []"},
+		},
+		{
+			name:   "server ids",
+			filter: &binlog.EventFilter{ExcludeServerIDs: []int64{1}},
+			rows:   []string{"db2.logs insert [] -> [101]"},
+		},
+		{
+			name:   "gtids",
+			filter: &binlog.EventFilter{IncludeGTIDs: "3e11fa47-71ca-11e1-9e33-c80aa9429562:2-4", ExcludeGTIDs: "3e11fa47-71ca-11e1-9e33-c80aa9429562:4"},
+			rows:   []string{"db1.orders update [10] -> [11]", "db2.logs delete [100] -> []"},
+		},
+	} {
+		decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", filterFixture()))
+		decoder.Filter = c.filter
+		if rows := rowChanges(decodeAll(t, decoder)); !reflect.DeepEqual(rows, c.rows) {
+			t.Errorf("%s: rows %q, expected %q", c.name, rows, c.rows)
+		}
+	}
+}
+
+func TestEventFilterContext(t *testing.T) {
+	// context events are kept for the transactions, DDL is filtered by its default schema
+	summary := filterSummary(t, &binlog.EventFilter{IncludeTables: []string{"db1.orders"}})
+	expected := []string{":1", "BEGIN", "XID", ":2", "BEGIN", "XID", ":3", ":4", "BEGIN", "XID"}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("include db1.orders: %q, expected %q", summary, expected)
+	}
+
+	// the whole transactions are excluded by server id and GTID
+	summary = filterSummary(t, &binlog.EventFilter{IncludeServerIDs: []int64{1}, ExcludeGTIDs: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1"})
+	expected = []string{":2", "BEGIN", "XID", ":3", "CREATE TABLE db2.t (id INT)"}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("include server 1 except GTID 1: %q, expected %q", summary, expected)
+	}
+
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", filterFixture()))
+	decoder.Filter = &binlog.EventFilter{IncludeTables: []string{"/[/"}}
+	if err := decoder.WalkEvent(func(*binlog.BinEvent) (bool, error) { return true, nil }); err == nil {
+		t.Errorf("invalid regexp: no error")
+	}
+}
+
+func TestEventFilterRelayLogs(t *testing.T) {
+	const replica, source = 2, 1
+	dir := tempDir(t)
+	sid := []byte("\x3e\x11\xfa\x47\x71\xca\x11\xe1\x9e\x33\xc8\x0a\xa9\x42\x95\x62")
+
+	// the transaction of GTID 1 continues in the next relay log
+	writeRelayLog(t, filepath.Join(dir, "relay-bin.000001"), []relayEvent{
+		{serverID: replica, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, flag: binlog.LogEventArtificialF, typ: binlog.RotateEvent, body: &binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000007"}},
+		{serverID: source, logPos: 1100, typ: binlog.GTIDEvent, body: &binlog.BinGTIDEvent{SID: sid, GNO: 1}},
+		{serverID: source, logPos: 1200, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}},
+		{serverID: source, logPos: 1300, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "INSERT INTO t VALUES (1)"}},
+	})
+	writeRelayLog(t, filepath.Join(dir, "relay-bin.000002"), []relayEvent{
+		{serverID: replica, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, logPos: 1331, typ: binlog.XIDEvent, body: &binlog.BinXIDEvent{XID: 42}},
+		{serverID: source, logPos: 1400, typ: binlog.GTIDEvent, body: &binlog.BinGTIDEvent{SID: sid, GNO: 2}},
+		{serverID: source, logPos: 1500, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}},
+		{serverID: source, logPos: 1531, typ: binlog.XIDEvent, body: &binlog.BinXIDEvent{XID: 43}},
+	})
+	index := filepath.Join(dir, "relay-bin.index")
+	if err := ioutil.WriteFile(index, []byte("./relay-bin.000001\n./relay-bin.000002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := binlog.NewRelayLogIndexDecoder(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+	decoder.Filter = &binlog.EventFilter{ExcludeGTIDs: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1"}
+
+	var xids []uint64
+	for _, event := range decodeAll(t, decoder) {
+		if xid, ok := event.Body.(*binlog.BinXIDEvent); ok {
+			xids = append(xids, xid.XID)
+		}
+	}
+	if !reflect.DeepEqual(xids, []uint64{43}) {
+		t.Errorf("XIDs %v, expected [43]", xids)
+	}
+}
+
+func TestParseGTIDSet(t *testing.T) {
+	set, err := binlog.ParseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7, 4e11fa47-71ca-11e1-9e33-c80aa9429562:3")
+	if err != nil || set.String() != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,4e11fa47-71ca-11e1-9e33-c80aa9429562:3" {
+		t.Errorf("GTID set %v, %v", set, err)
+	}
+
+	for s, expected := range map[string]string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:domain_1:1-5":     "tagged GTID set",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3:domain_1:1-5": "tagged GTID set",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:5-1":              "invalid GTID set",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1x":               "invalid GTID set",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562":                  "invalid GTID set",
+	} {
+		if _, err := binlog.ParseGTIDSet(s); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: got %v, expected %s", s, err, expected)
+		}
+	}
+}
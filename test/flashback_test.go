@@ -0,0 +1,157 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// rowChanges return the row changes of events as "action before -> after" in order
+func rowChanges(events []*binlog.BinEvent) []string {
+	var changes []string
+	for _, event := range events {
+		rows, ok := event.Body.(*binlog.BinRowsEvent)
+		if !ok {
+			continue
+		}
+		for _, row := range rows.Rows {
+			changes = append(changes, fmt.Sprintf("%s.%s %s %v -> %v", rows.Table.Schema, rows.Table.Table,
+				rows.Action(), row.Before, row.After))
+		}
+	}
+	return changes
+}
+
+// flashbackFixture return a binary log with an insert transaction, then an update and delete transaction
+func flashbackFixture() *binlogtest.Builder {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	logs := b.Table("test", "logs", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("msg", 20))
+	b.Begin().Insert(users, []interface{}{1, "alice"}, []interface{}{2, "bob"}).Insert(logs, []interface{}{1, "created"}).Commit()
+	b.Begin().
+		Update(users, []interface{}{1, "alice"}, []interface{}{1, "o'neil"}).
+		Delete(users, []interface{}{2, "bob"}).
+		Commit()
+	return b
+}
+
+func TestFlashbackBinlog(t *testing.T) {
+	dir := tempDir(t)
+	decoder := openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", flashbackFixture()))
+
+	var buf bytes.Buffer
+	if err := binlog.NewFlashback(decoder).WriteBinlog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "flashback.000001")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// transactions, rows events and rows are in reverse order
+	events := decodeAll(t, openDecoder(t, path))
+	expected := []string{
+		"test.users insert [] -> [2 bob]",
+		"test.users update [1 o'neil] -> [1 alice]",
+		"test.logs delete [1 created] -> []",
+		"test.users delete [2 bob] -> []",
+		"test.users delete [1 alice] -> []",
+	}
+	if changes := rowChanges(events); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("flashback row changes\n%s\nexpected\n%s", strings.Join(changes, "\n"), strings.Join(expected, "\n"))
+	}
+
+	var queries []string
+	for _, event := range events {
+		if query, ok := event.Body.(*binlog.BinQueryEvent); ok {
+			queries = append(queries, query.Query)
+		}
+		if rows, ok := event.Body.(*binlog.BinRowsEvent); ok && rows.Flags&binlog.RowsEventStmtEndF != 0 {
+			queries = append(queries, "STMT_END_F")
+		}
+	}
+	if expected := []string{"BEGIN", "STMT_END_F", "COMMIT", "BEGIN", "STMT_END_F", "COMMIT"}; !reflect.DeepEqual(queries, expected) {
+		t.Errorf("flashback transactions %v, expected %v", queries, expected)
+	}
+
+	// flashback of flashback is the original row changes
+	buf.Reset()
+	if err := binlog.NewFlashback(openDecoder(t, path)).WriteBinlog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := rowChanges(decodeAll(t, openDecoder(t, filepath.Join(dir, "mysql-bin.000001"))))
+	if changes := rowChanges(decodeAll(t, openDecoder(t, path))); !reflect.DeepEqual(changes, original) {
+		t.Errorf("flashback of flashback\n%s\nexpected\n%s", strings.Join(changes, "\n"), strings.Join(original, "\n"))
+	}
+}
+
+func TestFlashbackSQL(t *testing.T) {
+	dir := tempDir(t)
+	fb := binlog.NewFlashback(openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", flashbackFixture())))
+	fb.Tables = []string{"users"}
+
+	var buf bytes.Buffer
+	if err := fb.WriteSQL(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var statements []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "SET ") {
+			statements = append(statements, line)
+		}
+	}
+	expected := []string{
+		"BEGIN;",
+		"INSERT INTO `test`.`users` (`id`, `name`) VALUES (2, 'bob');",
+		"UPDATE `test`.`users` SET `id`=1, `name`='alice' WHERE `id`=1 LIMIT 1;",
+		"COMMIT;",
+		"BEGIN;",
+		"DELETE FROM `test`.`users` WHERE `id`=2 LIMIT 1;",
+		"DELETE FROM `test`.`users` WHERE `id`=1 LIMIT 1;",
+		"COMMIT;",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("flashback SQL\n%s\nexpected\n%s", strings.Join(statements, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestFlashbackMinimalImage(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.MinimalRowImage = true
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	b.Begin().Delete(users, []interface{}{1, "alice"}).Commit()
+
+	fb := binlog.NewFlashback(openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b)))
+	if err := fb.WriteBinlog(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "binlog_row_image=FULL") {
+		t.Errorf("flashback of minimal row image: got %v", err)
+	}
+}
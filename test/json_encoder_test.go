@@ -0,0 +1,140 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// decodeJSONLines return the JSON objects of lines
+func decodeJSONLines(t *testing.T, data []byte) []map[string]interface{} {
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestJSONEncoderBigIntegers(t *testing.T) {
+	var buf bytes.Buffer
+	enc := binlog.NewJSONEncoder(&buf)
+
+	gtid := &binlog.BinGTIDEvent{
+		SID:                      []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62},
+		GNO:                      1<<53 + 1,
+		LastCommitted:            1<<62 + 1,
+		SequenceNumber:           1<<62 + 2,
+		ImmediateCommitTimestamp: 1<<60 + 3,
+		TransactionLength:        1<<64 - 1,
+	}
+	events := []*binlog.BinEvent{
+		{Header: &binlog.BinEventHeader{EventType: binlog.GTIDEvent}, Body: gtid},
+		{Header: &binlog.BinEventHeader{EventType: binlog.XIDEvent}, Body: &binlog.BinXIDEvent{XID: 1<<64 - 2}},
+		{Header: &binlog.BinEventHeader{EventType: binlog.RotateEvent}, Body: &binlog.BinRotateEvent{Position: 1<<53 + 5, FileName: "mysql-bin.000002"}},
+	}
+	for _, event := range events {
+		if err := enc.EncodeEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := decodeJSONLines(t, buf.Bytes())
+	expected := []map[string]interface{}{
+		{
+			"gno":                        "9007199254740993",
+			"last_committed":             "4611686018427387905",
+			"sequence_number":            "4611686018427387906",
+			"immediate_commit_timestamp": "1152921504606846979",
+			"original_commit_timestamp":  "0",
+			"transaction_length":         "18446744073709551615",
+		},
+		{"xid": "18446744073709551614"},
+		{"position": "9007199254740997"},
+	}
+	for i, fields := range expected {
+		body := lines[i]["body"].(map[string]interface{})
+		for k, v := range fields {
+			if body[k] != v {
+				t.Errorf("%s %s = %#v, expected %#v", events[i].Header.Type(), k, body[k], v)
+			}
+		}
+	}
+	if gtid := lines[0]["body"].(map[string]interface{})["gtid"]; gtid != "3e11fa47-71ca-11e1-9e33-c80aa9429562:9007199254740993" {
+		t.Errorf("gtid = %v", gtid)
+	}
+}
+
+func TestJSONEncoderRows(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	users := b.Table("test", "users",
+		binlogtest.BigInt("id").AsUnsigned().AsPrimaryKey(),
+		binlogtest.Decimal("balance", 20, 4),
+		binlogtest.VarBinary("token", 16),
+		binlogtest.Enum("state", "active", "locked"),
+		binlogtest.Set("roles", "admin", "dev", "ops"),
+		binlogtest.Int("age"),
+		binlogtest.JSON("extra"),
+	)
+	b.Begin().Insert(users, []interface{}{uint64(18446744073709551615), "12345678901234.5678", "\x00\xff", 2, 5, 30, `{"a":1}`}).Commit()
+
+	dir := tempDir(t)
+	decoder := openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", b))
+
+	var buf bytes.Buffer
+	enc := binlog.NewJSONEncoder(&buf)
+	enc.File = "mysql-bin.000001"
+	for _, event := range decodeAll(t, decoder) {
+		if err := enc.EncodeRows(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := decodeJSONLines(t, buf.Bytes())
+	if len(lines) != 1 {
+		t.Fatalf("got %d row changes, expected 1", len(lines))
+	}
+	line := lines[0]
+	after := map[string]interface{}{
+		"id":      "18446744073709551615",
+		"balance": "12345678901234.5678",
+		"token":   "AP8=",
+		"state":   "locked",
+		"roles":   "admin,ops",
+		"age":     float64(30),
+		"extra":   map[string]interface{}{"a": float64(1)},
+	}
+	if !reflect.DeepEqual(line["after"], after) {
+		t.Errorf("after image %#v, expected %#v", line["after"], after)
+	}
+	if line["before"] != nil || line["op"] != "insert" || line["schema"] != "test" || line["table"] != "users" ||
+		line["file"] != "mysql-bin.000001" || line["gtid"] != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1" {
+		t.Errorf("row change %v", line)
+	}
+}
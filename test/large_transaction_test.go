@@ -0,0 +1,117 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// checkTransactions return the large transactions of binary log found by detector
+func checkTransactions(t *testing.T, path string, detector *binlog.LargeTransactionDetector) []*binlog.LargeTransaction {
+	var large []*binlog.LargeTransaction
+	err := openDecoder(t, path).WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+		if lt := detector.Check(tx); lt != nil {
+			large = append(large, lt)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return large
+}
+
+func TestLargeTransactionDetector(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	logs := b.Table("test", "logs", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("msg", 20))
+	orders := b.Table("test", "orders", binlogtest.Int("id").AsPrimaryKey())
+
+	b.Query("test", "CREATE TABLE users(id int primary key, name varchar(20))")
+	// 3 rows of a table
+	b.Begin().
+		Event(binlog.RowsQueryEvent, &binlog.BinRowsQueryEvent{Query: "INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c')"}).
+		Insert(users, []interface{}{1, "a"}, []interface{}{2, "b"}, []interface{}{3, "c"}).
+		Commit()
+	// 3 tables in 2 minutes
+	b.Begin().Insert(users, []interface{}{4, "d"}).Insert(logs, []interface{}{1, "x"})
+	b.Timestamp += 120
+	b.Insert(orders, []interface{}{1}).Commit()
+	// small
+	b.Begin().Delete(users, []interface{}{4, "d"}).Commit()
+
+	path := writeBinlog(t, tempDir(t), "mysql-bin.000001", b)
+	detector := &binlog.LargeTransactionDetector{File: "mysql-bin.000001", MaxRows: 2, MaxTables: 2, MaxDuration: time.Minute}
+	large := checkTransactions(t, path, detector)
+	if len(large) != 2 {
+		t.Fatalf("%d large transactions, expected 2", len(large))
+	}
+
+	rows, tables := large[0], large[1]
+	if rows.GTID != b.UUID+":2" || rows.File != "mysql-bin.000001" || rows.Rows != 3 ||
+		!reflect.DeepEqual(rows.Reasons, []string{"rows 3 > 2"}) ||
+		!reflect.DeepEqual(rows.Statements, []string{"INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c')"}) {
+		t.Errorf("large transaction by rows: %+v", rows)
+	}
+	expected := []string{"rows 3 > 2", "tables 3 > 2", "duration 2m0s > 1m0s"}
+	if tables.GTID != b.UUID+":3" || tables.Duration != 120 || !reflect.DeepEqual(tables.Reasons, expected) ||
+		!reflect.DeepEqual(tables.Tables, []string{"test.users", "test.logs", "test.orders"}) || len(tables.Statements) != 0 {
+		t.Errorf("large transaction by tables and duration: %+v", tables)
+	}
+	if rows.EndPos > tables.StartPos {
+		t.Errorf("positions [%d, %d) and [%d, %d) overlap", rows.StartPos, rows.EndPos, tables.StartPos, tables.EndPos)
+	}
+
+	large = checkTransactions(t, path, &binlog.LargeTransactionDetector{MaxBytes: 1})
+	if len(large) != 4 || !strings.HasPrefix(large[0].Reasons[0], "bytes ") {
+		t.Errorf("%d transactions larger than 1 byte, expected 4", len(large))
+	}
+	if large := checkTransactions(t, path, &binlog.LargeTransactionDetector{}); len(large) != 0 {
+		t.Errorf("%d large transactions without thresholds", len(large))
+	}
+
+	var buf bytes.Buffer
+	if err := rows.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	if !strings.Contains(text, "mysql-bin.000001 "+b.UUID+":2") || !strings.Contains(text, "rows 3 > 2") ||
+		!strings.HasSuffix(text, "INSERT INTO users VALUES (1, 'a'), (2, 'b'), (3, 'c');\n") {
+		t.Errorf("text output\n%s", text)
+	}
+
+	buf.Reset()
+	if err := tables.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded binlog.LargeTransaction
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, tables) || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("JSON line %s", buf.String())
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// maskFixture return a binary log of users with PII, written row-based and statement-based
+func maskFixture() *binlogtest.Builder {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.FullMetadata = true
+	users := b.Table("test", "users",
+		binlogtest.Int("id").AsPrimaryKey(),
+		binlogtest.Varchar("email", 64),
+		binlogtest.Varchar("phone", 20),
+		binlogtest.Int("age"),
+		binlogtest.Varchar("password", 64),
+		binlogtest.Varchar("note", 20),
+	)
+	b.Query("test", "CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(64))")
+	b.Begin().
+		Event(binlog.RowsQueryEvent, &binlog.BinRowsQueryEvent{Query: "INSERT INTO users VALUES (1, 'alice@example.com', ...)"}).
+		Insert(users, []interface{}{1, "alice@example.com", "13800138000", 30, "secret", nil}).
+		Update(users, []interface{}{1, "alice@example.com", "13800138000", 30, "secret", nil},
+			[]interface{}{1, "bob@example.com", "13900139000", 31, "secret2", "vip"}).
+		Commit()
+
+	// statement-based DML
+	b.Begin().
+		Query("test", "INSERT INTO users (id, email) VALUES (2, 'carol@example.com')").
+		Query("test", "/* app=web */ UPDATE users SET email = 'dave@example.com' WHERE id = 2").
+		Commit()
+	return b
+}
+
+// maskHash return the hex of SHA-256 of salt and value
+func maskHash(salt, value string) string {
+	sum := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestColumnMasker(t *testing.T) {
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", maskFixture()))
+	decoder.Masker = &binlog.ColumnMasker{
+		Rules: []*binlog.MaskRule{
+			{Pattern: "test.users.email", Action: binlog.MaskHash},
+			{Pattern: "users.phone", Action: binlog.MaskTruncate, Length: 3},
+			{Pattern: "age", Action: binlog.MaskConstant, Value: "**"},
+			{Pattern: "pass*", Action: binlog.MaskDrop},
+			{Pattern: "other.*.note", Action: binlog.MaskDrop},
+		},
+		Salt: "salt",
+	}
+	events := decodeAll(t, decoder)
+
+	expected := [][]interface{}{
+		{int64(1), maskHash("salt", "alice@example.com"), "138", "**", nil, nil},
+		{int64(1), maskHash("salt", "alice@example.com"), "138", "**", nil, nil},
+		{int64(1), maskHash("salt", "bob@example.com"), "139", "**", nil, "vip"},
+	}
+	if images := rowImages(events); !reflect.DeepEqual(images, expected) {
+		t.Errorf("masked images %v, expected %v", images, expected)
+	}
+
+	var queries []string
+	for _, event := range events {
+		switch body := event.Body.(type) {
+		case *binlog.BinRowsQueryEvent:
+			queries = append(queries, "rows query: "+body.Query)
+		case *binlog.BinQueryEvent:
+			queries = append(queries, body.Query)
+		case *binlog.BinRowsEvent:
+			// dropped column is not present, masked columns are VARCHAR
+			if body.IsPresent(4, false) || body.IsPresent(4, true) {
+				t.Errorf("dropped column password is present")
+			}
+			if body.Table.RealType(3) != binlog.MySQLTypeVarchar {
+				t.Errorf("masked column age is type %d", body.Table.RealType(3))
+			}
+		}
+	}
+
+	// the query of ROWS_QUERY_EVENT is cleared, and statement-based DML is dropped
+	expectedQueries := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, email VARCHAR(64))",
+		"BEGIN",
+		"rows query: ",
+		"BEGIN",
+	}
+	if !reflect.DeepEqual(queries, expectedQueries) {
+		t.Errorf("queries %q, expected %q", queries, expectedQueries)
+	}
+
+	// transactions are kept with BEGIN and XID
+	decoder = openDecoder(t, decoder.Path)
+	decoder.Masker = &binlog.ColumnMasker{Rules: []*binlog.MaskRule{{Pattern: "email", Action: binlog.MaskDrop}}}
+	var txs int
+	err := decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+		txs++
+		return true, nil
+	})
+	if err != nil || txs != 3 {
+		t.Errorf("got %d transactions, %v", txs, err)
+	}
+}
+
+func TestColumnMaskerErrors(t *testing.T) {
+	// columns are matched by name, which are written by binlog_row_metadata=FULL
+	b := binlogtest.New("5.7.44-log", binlog.BinlogChecksumAlgCRC32)
+	users := b.Table("test", "users", binlogtest.Int("id"), binlogtest.Varchar("email", 64))
+	b.Begin().Insert(users, []interface{}{1, "alice@example.com"}).Commit()
+	path := writeBinlog(t, tempDir(t), "mysql-bin.000001", b)
+
+	for _, c := range []struct {
+		rule *binlog.MaskRule
+		err  string
+	}{
+		{&binlog.MaskRule{Pattern: "email", Action: binlog.MaskHash}, "binlog_row_metadata=FULL is needed"},
+		{&binlog.MaskRule{Pattern: "email", Action: "encrypt"}, "unknown action"},
+		{&binlog.MaskRule{Pattern: "a.b.c.d", Action: binlog.MaskDrop}, "invalid mask rule pattern"},
+		{&binlog.MaskRule{Pattern: "email", Action: binlog.MaskTruncate, Length: -1}, "invalid truncate length"},
+	} {
+		decoder := openDecoder(t, path)
+		decoder.Masker = &binlog.ColumnMasker{Rules: []*binlog.MaskRule{c.rule}}
+		err := decoder.WalkEvent(func(*binlog.BinEvent) (bool, error) { return true, nil })
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("rule %+v: got %v, expected %q", c.rule, err, c.err)
+		}
+	}
+
+	// numbers can't be truncated
+	b = maskFixture()
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))
+	decoder.Masker = &binlog.ColumnMasker{Rules: []*binlog.MaskRule{{Pattern: "age", Action: binlog.MaskTruncate, Length: 1}}}
+	if err := decoder.WalkEvent(func(*binlog.BinEvent) (bool, error) { return true, nil }); err == nil ||
+		!strings.Contains(err.Error(), "can't be truncated") {
+		t.Errorf("truncate number: got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// clockTransaction return a transaction of logical clock, its cost is its size
+func clockTransaction(seq, lastCommitted, cost int64) *binlog.Transaction {
+	return &binlog.Transaction{
+		GTIDEvent: &binlog.BinGTIDEvent{SequenceNumber: seq, LastCommitted: lastCommitted},
+		EndPos:    cost,
+	}
+}
+
+func TestParallelSimulator(t *testing.T) {
+	s := binlog.NewParallelSimulator(1, 2)
+	s.TopN = 2
+	for _, tx := range []*binlog.Transaction{
+		// 3 transactions in parallel, then one depending on all of them
+		clockTransaction(1, 0, 10),
+		clockTransaction(2, 0, 10),
+		clockTransaction(3, 0, 10),
+		clockTransaction(4, 3, 10),
+		// sequence numbers restart in the next binary log
+		clockTransaction(1, 0, 5),
+	} {
+		s.Add(tx)
+	}
+
+	report := s.Report()
+	if report.Transactions != 5 || report.SerialCost != 45 || report.CriticalPath != 25 || report.MaxSpeedup != 1.8 ||
+		report.LongestChain != 3 {
+		t.Errorf("report: %+v", report)
+	}
+	if !reflect.DeepEqual(report.Distances, []int64{3, 2}) {
+		t.Errorf("distances %v, expected [3 2]", report.Distances)
+	}
+	var serializing []int64
+	for _, tx := range report.Serializing {
+		serializing = append(serializing, tx.SequenceNumber)
+	}
+	if report.SerialTransactions != 3 || !reflect.DeepEqual(serializing, []int64{1, 4}) {
+		t.Errorf("%d serial transactions, the most costly %v", report.SerialTransactions, serializing)
+	}
+
+	expected := []*binlog.ParallelRun{
+		{Workers: 1, Makespan: 45, Speedup: 1, Utilization: 1},
+		{Workers: 2, Makespan: 35, Speedup: 45.0 / 35, Utilization: 45.0 / 70},
+	}
+	if !reflect.DeepEqual(report.Runs, expected) {
+		for _, run := range report.Runs {
+			t.Errorf("run: %+v", run)
+		}
+	}
+}
+
+func TestParallelSimulatorCommitOrder(t *testing.T) {
+	makespan := func(preserveCommitOrder bool) int64 {
+		s := binlog.NewParallelSimulator(2)
+		s.PreserveCommitOrder = preserveCommitOrder
+		for _, tx := range []*binlog.Transaction{
+			clockTransaction(1, 0, 30),
+			clockTransaction(2, 0, 10),
+			clockTransaction(3, 0, 10),
+		} {
+			s.Add(tx)
+		}
+		return s.Report().Runs[0].Makespan
+	}
+
+	// the second worker is free after the commit of the first transaction only if commit order is preserved
+	if n := makespan(false); n != 30 {
+		t.Errorf("makespan %d, expected 30", n)
+	}
+	if n := makespan(true); n != 40 {
+		t.Errorf("makespan of preserving commit order %d, expected 40", n)
+	}
+}
+
+func TestParallelSimulatorBinlog(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey())
+	b.Query("test", "CREATE TABLE users(id int primary key)")
+	b.Begin().Insert(users, []interface{}{1}, []interface{}{2}).Commit()
+	b.Begin().Delete(users, []interface{}{1}).Commit()
+
+	// transactions of builder depend on the previous ones, such as COMMIT_ORDER of a single session
+	s := binlog.NewParallelSimulator(4)
+	s.File = "mysql-bin.000001"
+	s.Cost = func(tx *binlog.Transaction) int64 { return int64(len(tx.Rows)) + 1 }
+	err := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b)).WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+		s.Add(tx)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := s.Report()
+	if report.Transactions != 3 || report.SerialCost != 5 || report.CriticalPath != 5 || report.LongestChain != 3 ||
+		report.SerialTransactions != 3 || report.Runs[0].Speedup != 1 {
+		t.Errorf("report: %+v", report)
+	}
+	if len(report.Serializing) != 3 || report.Serializing[0].GTID != b.UUID+":2" || report.Serializing[0].File != "mysql-bin.000001" ||
+		report.Serializing[0].Cost != 2 {
+		t.Errorf("the most costly serializing transaction: %+v", report.Serializing[0])
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "SERIALIZING TRANSACTIONS: 3") || !strings.Contains(buf.String(), b.UUID+":2") {
+		t.Errorf("text output\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded binlog.ParallelReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, report) {
+		t.Errorf("JSON round trip\n%s", buf.String())
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// recoverFile walk binary log data in recovery mode, return the start offsets of events decoded and the ranges skipped
+func recoverFile(path string, data []byte, strict bool) ([]int64, []binlog.SkippedRange, error) {
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return nil, nil, err
+	}
+
+	decoder, err := binlog.NewBinFileDecoder(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer decoder.BinFile.Close()
+
+	var offsets []int64
+	var skipped []binlog.SkippedRange
+	decoder.Recover, decoder.Strict = true, strict
+	decoder.OnSkip = func(r *binlog.SkippedRange) error {
+		skipped = append(skipped, *r)
+		return nil
+	}
+	err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		offsets = append(offsets, event.Header.LogPos-event.Header.EventSize)
+		return true, nil
+	})
+	return offsets, skipped, err
+}
+
+func TestRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mysql-bin.000001")
+
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	fixture(b)
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offsets, skipped, err := recoverFile(path, data, false)
+	if err != nil || len(skipped) != 0 {
+		t.Fatalf("intact binary log: skipped %v, %v", skipped, err)
+	}
+	// the 4th to 6th events are overwritten
+	start, end := offsets[3], offsets[6]
+
+	for _, c := range []struct {
+		name  string
+		data  []byte
+		start int64
+		end   int64
+	}{
+		{"checksum", corrupt(data, offsets[3]+20, offsets[3]+21), offsets[3], offsets[4]},
+		{"garbage", corrupt(data, start, end), start, end},
+		{"header", corrupt(data, offsets[5]+4, offsets[5]+5), offsets[5], offsets[6]},
+		{"truncated", data[:offsets[len(offsets)-1]+10], offsets[len(offsets)-1], offsets[len(offsets)-1] + 10},
+	} {
+		got, skipped, err := recoverFile(path, c.data, false)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(skipped) != 1 || skipped[0].Start != c.start || skipped[0].End != c.end || skipped[0].Err == nil {
+			t.Errorf("%s: skipped %v, expected %d-%d", c.name, skipped, c.start, c.end)
+			continue
+		}
+		// all events out of the skipped range are decoded
+		var want []int64
+		for _, offset := range offsets {
+			if offset < c.start || offset >= c.end {
+				want = append(want, offset)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: decoded events at %v, expected %v", c.name, got, want)
+		}
+	}
+}
+
+func TestRecoverUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mysql-bin.000001")
+
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	fixture(b)
+	b.Event(binlog.IncidentEvent, &binlog.BinEventUnParsed{Data: []byte{0x01, 0x00, 0x00}})
+	fixture(b)
+	data, err := b.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an intact INCIDENT_EVENT is walked in recovery mode
+	if _, skipped, err := recoverFile(path, data, false); err != nil || len(skipped) != 0 {
+		t.Errorf("INCIDENT_EVENT: skipped %v, %v", skipped, err)
+	}
+
+	// in strict mode it is not skipped as corruption
+	var unsupported *binlog.ErrUnsupportedEvent
+	if _, skipped, err := recoverFile(path, data, true); !errors.As(err, &unsupported) || len(skipped) != 0 {
+		t.Errorf("INCIDENT_EVENT in strict mode: skipped %v, got %v, expected ErrUnsupportedEvent", skipped, err)
+	}
+}
+
+// corrupt return a copy of data with bytes from start to end inverted
+func corrupt(data []byte, start, end int64) []byte {
+	data = append([]byte{}, data...)
+	for i := start; i < end; i++ {
+		data[i] ^= 0xa5
+	}
+	return data
+}
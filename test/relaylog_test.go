@@ -0,0 +1,184 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// relayEvent is an event of relay log, LogPos is the position in the binary log of source
+// for the events received from source
+type relayEvent struct {
+	serverID  int64
+	flag      uint16
+	logPos    int64
+	body      binlog.BinEventBody
+	typ       uint8
+	timestamp int64
+}
+
+// writeRelayLog write a relay log of events without checksum, log_pos of events from source are kept
+func writeRelayLog(t *testing.T, path string, events []relayEvent) {
+	var buf bytes.Buffer
+	writer, err := binlog.NewBinWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offsets []int64
+	for _, e := range events {
+		offsets = append(offsets, writer.Pos())
+		timestamp := e.timestamp
+		if timestamp == 0 {
+			timestamp = 1537600000
+		}
+		header := &binlog.BinEventHeader{Timestamp: timestamp, EventType: e.typ, ServerID: e.serverID, Flag: e.flag}
+		if err := writer.WriteEvent(&binlog.BinEvent{Header: header, Body: e.body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// log_pos is at offset 13 of event header
+	data := buf.Bytes()
+	for i, e := range events {
+		if e.logPos > 0 {
+			binary.LittleEndian.PutUint32(data[offsets[i]+13:], uint32(e.logPos))
+		}
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelayLog(t *testing.T) {
+	const replica, source = 2, 1
+	dir := tempDir(t)
+	fakeRotate := binlog.LogEventArtificialF
+
+	writeRelayLog(t, filepath.Join(dir, "relay-bin.000001"), []relayEvent{
+		{serverID: replica, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, flag: fakeRotate, typ: binlog.RotateEvent, body: &binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000007"}},
+		{serverID: source, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, logPos: 1200, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}},
+		{serverID: source, logPos: 1300, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "INSERT INTO t VALUES (1)"}},
+		{serverID: source, logPos: 1331, typ: binlog.XIDEvent, body: &binlog.BinXIDEvent{XID: 42}},
+		{serverID: source, typ: binlog.RotateEvent, body: &binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000008"}},
+	})
+	writeRelayLog(t, filepath.Join(dir, "relay-bin.000002"), []relayEvent{
+		{serverID: replica, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, flag: fakeRotate, typ: binlog.RotateEvent, body: &binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000008"}},
+		{serverID: source, logPos: 219, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "CREATE TABLE t2 (id INT)"}},
+	})
+	index := filepath.Join(dir, "relay-bin.index")
+	if err := ioutil.WriteFile(index, []byte("./relay-bin.000001\n./relay-bin.000002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := binlog.NewRelayLogIndexDecoder(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+	events := decodeAll(t, decoder)
+
+	expected := []struct {
+		typ        uint8
+		relayFile  string
+		sourceFile string
+		sourcePos  int64
+	}{
+		{binlog.FormatDescriptionEvent, "relay-bin.000001", "", 0},
+		{binlog.RotateEvent, "relay-bin.000001", "mysql-bin.000007", 4},
+		{binlog.FormatDescriptionEvent, "relay-bin.000001", "mysql-bin.000007", 4},
+		{binlog.QueryEvent, "relay-bin.000001", "mysql-bin.000007", 1200},
+		{binlog.QueryEvent, "relay-bin.000001", "mysql-bin.000007", 1300},
+		{binlog.XIDEvent, "relay-bin.000001", "mysql-bin.000007", 1331},
+		{binlog.RotateEvent, "relay-bin.000001", "mysql-bin.000008", 4},
+		{binlog.FormatDescriptionEvent, "relay-bin.000002", "mysql-bin.000008", 4},
+		{binlog.RotateEvent, "relay-bin.000002", "mysql-bin.000008", 4},
+		{binlog.QueryEvent, "relay-bin.000002", "mysql-bin.000008", 219},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events, expected %d", len(events), len(expected))
+	}
+
+	var relayPos int64 = 4
+	for i, event := range events {
+		e, relay := expected[i], event.Relay
+		if i > 0 && relay.RelayFile != events[i-1].Relay.RelayFile {
+			relayPos = 4
+		}
+		if event.Header.EventType != e.typ || filepath.Base(relay.RelayFile) != e.relayFile || relay.RelayPos != relayPos ||
+			relay.SourceFile != e.sourceFile || relay.SourcePos != e.sourcePos {
+			t.Errorf("event %d: %s %s:%d source %s:%d, expected %s %s:%d source %s:%d", i,
+				event.Header.Type(), filepath.Base(relay.RelayFile), relay.RelayPos, relay.SourceFile, relay.SourcePos,
+				binlog.EventType2Str[e.typ], e.relayFile, relayPos, e.sourceFile, e.sourcePos)
+		}
+		relayPos += event.Header.EventSize
+	}
+
+	// the query of source is decoded by the FORMAT_DESCRIPTION_EVENT of source
+	if query, ok := events[4].Body.(*binlog.BinQueryEvent); !ok || query.Query != "INSERT INTO t VALUES (1)" {
+		t.Errorf("query from source decoded as %#v", events[4].Body)
+	}
+}
+
+func TestRelayLogSkipped(t *testing.T) {
+	const replica, source = 2, 1
+	path := filepath.Join(tempDir(t), "relay-bin.000001")
+
+	// the source coordinates are updated by the events before start and the events filtered out
+	writeRelayLog(t, path, []relayEvent{
+		{serverID: replica, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, flag: binlog.LogEventArtificialF, typ: binlog.RotateEvent, body: &binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000007"}},
+		{serverID: source, typ: binlog.FormatDescriptionEvent, body: binlog.NewFmtDescEvent(binlog.BinlogChecksumAlgOff)},
+		{serverID: source, logPos: 1200, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}},
+		{serverID: source, logPos: 1300, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "INSERT INTO t VALUES (1)"}},
+		{serverID: source, logPos: 1331, typ: binlog.XIDEvent, body: &binlog.BinXIDEvent{XID: 42}},
+		{serverID: source, logPos: 1400, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}, timestamp: 1537600100},
+		{serverID: source, logPos: 1500, typ: binlog.QueryEvent, body: &binlog.BinQueryEvent{Schema: "test", Query: "INSERT INTO t VALUES (2)"}, timestamp: 1537600100},
+		{serverID: source, logPos: 1531, typ: binlog.XIDEvent, body: &binlog.BinXIDEvent{XID: 43}, timestamp: 1537600100},
+	})
+
+	decoder, err := binlog.NewRelayLogDecoder(path, &binlog.BinReaderOption{StartTime: time.Unix(1537600100, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.BinFile.Close()
+	decoder.Filter = &binlog.EventFilter{ExcludeTables: []string{"test"}}
+
+	var got []string
+	for _, event := range decodeAll(t, decoder) {
+		got = append(got, fmt.Sprintf("%s %s:%d", event.Header.Type(), event.Relay.SourceFile, event.Relay.SourcePos))
+	}
+	expected := "[FORMAT_DESCRIPTION_EVENT :0 FORMAT_DESCRIPTION_EVENT mysql-bin.000007:4 QUERY_EVENT mysql-bin.000007:1400 " +
+		"XID_EVENT mysql-bin.000007:1531]"
+	if fmt.Sprint(got) != expected {
+		t.Errorf("relay log events %v, expected %s", got, expected)
+	}
+}
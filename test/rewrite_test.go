@@ -0,0 +1,209 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// rewriteFixture return a binary log of database prod, whose first rows transaction has a statement
+// changing users and audit, the rows event of users has no STMT_END_F
+func rewriteFixture(t *testing.T, dir string) string {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	users := b.Table("prod", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	audit := b.Table("prod", "audit", binlogtest.Int("id").AsPrimaryKey())
+
+	b.Query("prod", "CREATE TABLE users (id int primary key, name varchar(20))")
+	b.Query("prod", "CREATE TABLE audit (id int primary key)")
+	b.Begin().
+		Event(binlog.RowsQueryEvent, &binlog.BinRowsQueryEvent{Query: "INSERT INTO users VALUES (1, 'a')"}).
+		Insert(users, []interface{}{1, "a"}).
+		Insert(audit, []interface{}{1}).
+		Commit()
+	b.Begin().Insert(audit, []interface{}{2}).Commit()
+	b.Begin().Query("prod", "UPDATE users SET name = 'b' WHERE id = 1").Commit()
+	b.Query("prod", "DROP TABLE audit")
+	b.Query("", "ALTER TABLE prod.users ADD COLUMN age int")
+
+	events := decodeAll(t, openDecoder(t, writeBinlog(t, dir, "fixture.000001", b)))
+	for _, event := range events {
+		if rows, ok := event.Body.(*binlog.BinRowsEvent); ok && rows.Table.Table == "users" {
+			rows.Flags &^= binlog.RowsEventStmtEndF
+			break
+		}
+	}
+	path := filepath.Join(dir, "mysql-bin.000001")
+	writeEvents(t, path, events)
+	return path
+}
+
+// rewrite return the events of the binary log rewritten by r
+func rewrite(t *testing.T, r *binlog.Rewriter, path string) []*binlog.BinEvent {
+	var buf bytes.Buffer
+	if err := r.Rewrite(&buf, openDecoder(t, path)); err != nil {
+		t.Fatal(err)
+	}
+	rewritten := filepath.Join(filepath.Dir(path), "rewritten.000001")
+	if err := ioutil.WriteFile(rewritten, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return decodeAll(t, openDecoder(t, rewritten))
+}
+
+// describeEvents return the queries, rows events and XID of events, one transaction a line
+func describeEvents(events []*binlog.BinEvent) []string {
+	var lines []string
+	var line []string
+	for _, event := range events {
+		switch body := event.Body.(type) {
+		case *binlog.BinGTIDEvent:
+			if line != nil {
+				lines = append(lines, strings.Join(line, " | "))
+			}
+			line = []string{fmt.Sprintf("%d", body.GNO)}
+		case *binlog.BinQueryEvent:
+			line = append(line, body.Schema+": "+body.Query)
+		case *binlog.BinRowsQueryEvent:
+			line = append(line, "ROWS_QUERY")
+		case *binlog.BinRowsEvent:
+			s := fmt.Sprintf("%s.%s %s", body.Table.Schema, body.Table.Table, body.Action())
+			if body.Flags&binlog.RowsEventStmtEndF != 0 {
+				s += " STMT_END_F"
+			}
+			line = append(line, s)
+		case *binlog.BinXIDEvent:
+			line = append(line, "XID")
+		}
+	}
+	return append(lines, strings.Join(line, " | "))
+}
+
+// checkTransactionLength check transaction_length of GTID_EVENTs is the size of their transactions
+func checkTransactionLength(t *testing.T, events []*binlog.BinEvent) {
+	var gtid *binlog.BinGTIDEvent
+	var length uint64
+	for _, event := range append(events, nil) {
+		if event == nil || event.Header.EventType == binlog.GTIDEvent {
+			if gtid != nil && gtid.TransactionLength != length {
+				t.Errorf("transaction_length of gno %d is %d, the transaction is %d bytes", gtid.GNO, gtid.TransactionLength, length)
+			}
+			if event == nil {
+				break
+			}
+			gtid, length = event.Body.(*binlog.BinGTIDEvent), 0
+		}
+		if gtid != nil {
+			length += uint64(event.Header.EventSize)
+		}
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	path := rewriteFixture(t, tempDir(t))
+	r := binlog.NewRewriter()
+	r.RenameSchemas["prod"] = "staging"
+	r.DropTables = []string{"prod.audit"}
+	r.StripRowsQuery = true
+	events := rewrite(t, r, path)
+
+	expected := []string{
+		"1 | staging: CREATE TABLE users (id int primary key, name varchar(20))",
+		"2 | staging: BEGIN | staging: COMMIT",
+		"3 | : BEGIN | staging.users insert STMT_END_F | XID",
+		"4 | : BEGIN | XID",
+		"5 | : BEGIN | staging: UPDATE users SET name = 'b' WHERE id = 1 | XID",
+		"6 | staging: BEGIN | staging: COMMIT",
+		"7 | : ALTER TABLE `staging`.users ADD COLUMN age int",
+	}
+	if lines := describeEvents(events); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("rewritten\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+	if changes := rowChanges(events); !reflect.DeepEqual(changes, []string{"staging.users insert [] -> [1 a]"}) {
+		t.Errorf("row changes %v", changes)
+	}
+	checkTransactionLength(t, events)
+	checkTransactionLength(t, decodeAll(t, openDecoder(t, path)))
+}
+
+func TestRewriterRenameTables(t *testing.T) {
+	path := rewriteFixture(t, tempDir(t))
+	r := binlog.NewRewriter()
+	r.RenameTables["prod.users"] = "accounts"
+	r.RenameTables["prod.audit"] = "archive.audit_log"
+	events := rewrite(t, r, path)
+
+	expected := []string{
+		"1 | prod: CREATE TABLE `accounts` (id int primary key, name varchar(20))",
+		"2 | prod: CREATE TABLE `archive`.`audit_log` (id int primary key)",
+		"3 | : BEGIN | ROWS_QUERY | prod.accounts insert | archive.audit_log insert STMT_END_F | XID",
+		"4 | : BEGIN | archive.audit_log insert STMT_END_F | XID",
+		"5 | : BEGIN | prod: UPDATE `accounts` SET name = 'b' WHERE id = 1 | XID",
+		"6 | prod: DROP TABLE `archive`.`audit_log`",
+		"7 | : ALTER TABLE prod.`accounts` ADD COLUMN age int",
+	}
+	if lines := describeEvents(events); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("rewritten\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+	checkTransactionLength(t, events)
+
+	// a copy without rules is the same binary log
+	var buf bytes.Buffer
+	if err := binlog.NewRewriter().Rewrite(&buf, openDecoder(t, path)); err != nil {
+		t.Fatal(err)
+	}
+	if original, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(buf.Bytes(), original) {
+		t.Errorf("copy of %d bytes differs from the original, %v", buf.Len(), err)
+	}
+}
+
+func TestRewriterDropStatements(t *testing.T) {
+	dir := tempDir(t)
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.Begin().
+		Query("prod", "INSERT INTO audit VALUES (1)").
+		Query("prod", "INSERT INTO users (id, name) VALUES (1, 'a')").
+		Query("prod", "INSERT IGNORE INTO users SELECT id, 'b' FROM `prod`.`audit`").
+		Query("prod", "UPDATE users u JOIN audit a ON u.id = a.id SET u.name = 'c'").
+		Query("prod", "DELETE FROM users WHERE id IN (SELECT id FROM audit)").
+		Query("prod", "DELETE FROM users, x USING users, archive.x WHERE users.id = x.id").
+		Query("prod", "REPLACE users VALUES (2, 'd')").
+		Commit()
+	b.Query("prod", "UPDATE LOW_PRIORITY users AS u, audit SET u.name = 'e'")
+	path := writeBinlog(t, dir, "mysql-bin.000001", b)
+
+	r := binlog.NewRewriter()
+	r.DropTables = []string{"prod.audit", "archive"}
+	expected := []string{
+		"1 | : BEGIN | prod: INSERT INTO users (id, name) VALUES (1, 'a') | prod: REPLACE users VALUES (2, 'd') | XID",
+		"2 | prod: BEGIN | prod: COMMIT",
+	}
+	if lines := describeEvents(rewrite(t, r, path)); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("rewritten\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
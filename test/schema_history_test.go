@@ -0,0 +1,190 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+const historySnapshot = "USE test;\n" +
+	"CREATE TABLE `users` (\n" +
+	"  `id` int unsigned NOT NULL,\n" +
+	"  `name` varchar(20) DEFAULT NULL,\n" +
+	"  `state` enum('active','disabled') NOT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n"
+
+// historyFixture return a binary log of mysql 5.7 without column names, whose table users is altered, renamed and dropped
+func historyFixture() *binlogtest.Builder {
+	b := binlogtest.New("5.7.44-log", binlog.BinlogChecksumAlgCRC32)
+	v1 := b.Table("test", "users", binlogtest.Int("id").AsUnsigned(), binlogtest.Varchar("name", 20), binlogtest.Enum("state"))
+	b.Begin().Insert(v1, []interface{}{1, "a", 1}).Commit()
+
+	v2 := b.Table("test", "users", binlogtest.Int("id").AsUnsigned(), binlogtest.Varchar("name", 20), binlogtest.Int("age"),
+		binlogtest.Enum("state"))
+	b.Query("test", "ALTER TABLE users ADD COLUMN age int AFTER name")
+	b.Begin().Insert(v2, []interface{}{2, "b", 30, 2}).Commit()
+
+	people := b.Table("test", "people", v2.Columns...)
+	b.Query("test", "RENAME TABLE users TO people")
+	b.Begin().Insert(people, []interface{}{3, "c", 40, 1}).Commit()
+
+	b.Query("", "DROP TABLE test.people")
+	b.Begin().Insert(people, []interface{}{4, "d", 50, 1}).Commit()
+	return b
+}
+
+// describeTables return the column names, primary key and the first enum value of tables mapped by rows events
+func describeTables(events []*binlog.BinEvent) []string {
+	var tables []string
+	for _, event := range events {
+		rows, ok := event.Body.(*binlog.BinRowsEvent)
+		if !ok {
+			continue
+		}
+		table := rows.Table
+		state, _ := table.EnumValue(int(table.ColumnCount)-1, 1)
+		tables = append(tables, fmt.Sprintf("%s.%s %v pk %v unsigned %v %s", table.Schema, table.Table, table.ColumnNames,
+			table.PrimaryKey, table.IsUnsigned(0), state))
+	}
+	return tables
+}
+
+func TestSchemaHistory(t *testing.T) {
+	dir := tempDir(t)
+	path := writeBinlog(t, dir, "mysql-bin.000001", historyFixture())
+
+	h := binlog.NewSchemaHistory()
+	if err := h.LoadSnapshot(strings.NewReader(historySnapshot), ""); err != nil {
+		t.Fatal(err)
+	}
+	h.File = "mysql-bin.000001"
+	decoder := openDecoder(t, path)
+	var events []*binlog.BinEvent
+	err := decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		events = append(events, event)
+		if table, ok := event.Body.(*binlog.BinTableMapEvent); ok {
+			return true, h.Fill(table, h.File, event.Header.LogPos-event.Header.EventSize)
+		}
+		return true, h.Add(event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"test.users [id name state] pk [0] unsigned true active",
+		"test.users [id name age state] pk [0] unsigned true active",
+		"test.people [id name age state] pk [0] unsigned true active",
+		"test.people [] pk [] unsigned false ",
+	}
+	if tables := describeTables(events); !reflect.DeepEqual(tables, expected) {
+		t.Errorf("tables\n%s\nexpected\n%s", strings.Join(tables, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if def := h.Table("test", "users", "", 0); def == nil || len(def.Columns) != 3 {
+		t.Errorf("snapshot of test.users: %+v", def)
+	}
+	if def := h.Table("test", "users", "mysql-bin.000002", 4); def != nil {
+		t.Errorf("renamed test.users: %+v", def)
+	}
+	if def := h.Table("test", "people", "mysql-bin.000001", events[len(events)-1].Header.LogPos); def != nil {
+		t.Errorf("dropped test.people: %+v", def)
+	}
+
+	// the saved history labels the binary log as a SchemaProvider
+	var buf bytes.Buffer
+	if err := h.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := binlog.LoadSchemaHistory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder = openDecoder(t, path)
+	decoder.Schema = loaded
+	if tables := describeTables(decodeAll(t, decoder)); !reflect.DeepEqual(tables, expected) {
+		t.Errorf("tables of loaded history\n%s\nexpected\n%s", strings.Join(tables, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestSchemaHistoryApply(t *testing.T) {
+	h := binlog.NewSchemaHistory()
+	if err := h.LoadSnapshot(strings.NewReader(historySnapshot), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	columns := func(schema, table string, pos int64) string {
+		def := h.Table(schema, table, "mysql-bin.000001", pos)
+		if def == nil {
+			return "<nil>"
+		}
+		var names []string
+		for _, column := range def.Columns {
+			names = append(names, column.Name)
+		}
+		return strings.Join(names, ",") + " pk " + strings.Join(def.PrimaryKey, ",")
+	}
+
+	for _, st := range []struct {
+		pos    int64
+		schema string
+		query  string
+	}{
+		{100, "test", "CREATE TABLE IF NOT EXISTS users (id int)"},
+		{200, "test", "CREATE TABLE logs LIKE users"},
+		{300, "test", "ALTER TABLE logs DROP PRIMARY KEY, CHANGE name msg varchar(64) FIRST"},
+		{400, "test", "ALTER TABLE users DROP COLUMN missing"},
+		{500, "test", "INSERT INTO logs VALUES ('a', 1, 1)"},
+		{600, "other", "DROP DATABASE test"},
+	} {
+		if err := h.Apply("mysql-bin.000001", st.pos, st.schema, st.query); err != nil {
+			t.Fatal(st.query, err)
+		}
+	}
+
+	for _, c := range []struct {
+		table    string
+		pos      int64
+		expected string
+	}{
+		{"users", 150, "id,name,state pk id"},
+		{"logs", 150, "<nil>"},
+		{"logs", 250, "id,name,state pk id"},
+		{"logs", 300, "msg,id,state pk "},
+		{"users", 350, "id,name,state pk id"},
+		// the history is not what the server has, the table is forgotten rather than mislabeled
+		{"users", 450, "<nil>"},
+		{"logs", 550, "msg,id,state pk "},
+		{"logs", 650, "<nil>"},
+	} {
+		if columns := columns("test", c.table, c.pos); columns != c.expected {
+			t.Errorf("test.%s at %d: %s, expected %s", c.table, c.pos, columns, c.expected)
+		}
+	}
+
+	if err := h.Apply("mysql-bin.000001", 700, "test", "CREATE TABLE t (id int"); err == nil {
+		t.Error("bad DDL is not an error")
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// infoSchema is a stand-in of information_schema, rows of COLUMNS and STATISTICS by 'schema.table'
+type infoSchema struct {
+	mu         sync.Mutex
+	columns    map[string][][]driver.Value
+	statistics map[string][][]driver.Value
+	queries    int
+}
+
+// infoSchemas are the stand-ins by data source name
+var infoSchemas sync.Map
+
+func init() {
+	sql.Register("infoschema", infoSchemaDriver{})
+}
+
+// openInfoSchema return a db of the stand-in, which is closed after test
+func openInfoSchema(t *testing.T, s *infoSchema) *sql.DB {
+	infoSchemas.Store(t.Name(), s)
+	db, err := sql.Open("infoschema", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// infoSchemaDriver implement driver.Driver and driver.Conn, queries of information_schema.COLUMNS and
+// information_schema.STATISTICS are answered by the stand-in of data source name
+type infoSchemaDriver struct {
+	s *infoSchema
+}
+
+func (infoSchemaDriver) Open(name string) (driver.Conn, error) {
+	s, ok := infoSchemas.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown stand-in %s", name)
+	}
+	return infoSchemaDriver{s.(*infoSchema)}, nil
+}
+
+func (d infoSchemaDriver) Prepare(query string) (driver.Stmt, error) {
+	return infoSchemaStmt{d.s, query}, nil
+}
+
+func (infoSchemaDriver) Close() error { return nil }
+
+func (infoSchemaDriver) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+// infoSchemaStmt implement driver.Stmt
+type infoSchemaStmt struct {
+	s     *infoSchema
+	query string
+}
+
+func (infoSchemaStmt) Close() error { return nil }
+
+func (infoSchemaStmt) NumInput() int { return 2 }
+
+func (infoSchemaStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (st infoSchemaStmt) Query(args []driver.Value) (driver.Rows, error) {
+	st.s.mu.Lock()
+	defer st.s.mu.Unlock()
+	st.s.queries++
+
+	table := fmt.Sprintf("%s.%s", args[0], args[1])
+	switch {
+	case strings.Contains(st.query, "information_schema.COLUMNS"):
+		return &infoSchemaRows{columns: 6, values: st.s.columns[table]}, nil
+	case strings.Contains(st.query, "information_schema.STATISTICS"):
+		return &infoSchemaRows{columns: 2, values: st.s.statistics[table]}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", st.query)
+}
+
+// infoSchemaRows implement driver.Rows
+type infoSchemaRows struct {
+	columns int
+	values  [][]driver.Value
+}
+
+func (r *infoSchemaRows) Columns() []string {
+	return make([]string, r.columns)
+}
+
+func (r *infoSchemaRows) Close() error { return nil }
+
+func (r *infoSchemaRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// usersBinlog return the binary log of mysql 5.7 with a row of table users without column names
+func usersBinlog(columns ...binlogtest.Column) *binlogtest.Builder {
+	b := binlogtest.New("5.7.44-log", binlog.BinlogChecksumAlgCRC32)
+	users := b.Table("test", "users", columns...)
+	row := make([]interface{}, len(columns))
+	for i := range row {
+		row[i] = 1
+	}
+	b.Begin().Insert(users, row).Commit()
+	return b
+}
+
+// mappedTables return the table maps of rows events walked by decoder
+func mappedTables(t *testing.T, decoder *binlog.BinFileDecoder) []*binlog.BinTableMapEvent {
+	var tables []*binlog.BinTableMapEvent
+	for _, event := range decodeAll(t, decoder) {
+		if rows, ok := event.Body.(*binlog.BinRowsEvent); ok {
+			tables = append(tables, rows.Table)
+		}
+	}
+	return tables
+}
+
+func TestInformationSchema(t *testing.T) {
+	s := &infoSchema{
+		columns: map[string][][]driver.Value{
+			"test.users": {
+				{"id", "int(10) unsigned", "NO", nil, nil, "auto_increment"},
+				{"name", "varchar(20)", "YES", "latin1", "latin1_bin", ""},
+				{"state", "enum('active','disabled')", "NO", "utf8mb4", "utf8mb4_general_ci", ""},
+				{"total", "decimal(10,2)", "YES", nil, nil, "STORED GENERATED"},
+			},
+		},
+		statistics: map[string][][]driver.Value{
+			"test.users": {
+				{"PRIMARY", "id"},
+				{"uk_name", "name"},
+				{"uk_name", "state"},
+				{"uk_func", nil},
+			},
+		},
+	}
+	provider := binlog.NewInformationSchema(openInfoSchema(t, s))
+
+	dir := tempDir(t)
+	columns := []binlogtest.Column{binlogtest.Int("id").AsUnsigned(), binlogtest.Varchar("name", 20),
+		binlogtest.Enum("state"), binlogtest.Decimal("total", 10, 2)}
+	path := writeBinlog(t, dir, "mysql-bin.000001", usersBinlog(columns...))
+	decoder := openDecoder(t, path)
+	decoder.Schema = provider
+	tables := mappedTables(t, decoder)
+	if len(tables) != 1 {
+		t.Fatalf("%d tables, expected 1", len(tables))
+	}
+	table := tables[0]
+	state, _ := table.EnumValue(2, 2)
+	if !reflect.DeepEqual(table.ColumnNames, []string{"id", "name", "state", "total"}) || !reflect.DeepEqual(table.PrimaryKey, []int{0}) ||
+		!table.IsUnsigned(0) || state != "disabled" {
+		t.Errorf("table map: names %v, primary key %v, unsigned %v, enum %q", table.ColumnNames, table.PrimaryKey, table.IsUnsigned(0), state)
+	}
+
+	def, err := provider.TableDef(table, "mysql-bin.000001", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &binlog.TableDef{
+		Schema: "test",
+		Name:   "users",
+		Columns: []*binlog.ColumnDef{
+			{Name: "id", Type: "int", Unsigned: true},
+			{Name: "name", Type: "varchar", Nullable: true, Charset: "latin1", Collation: "latin1_bin"},
+			{Name: "state", Type: "enum", Values: []string{"active", "disabled"}, Charset: "utf8mb4", Collation: "utf8mb4_general_ci"},
+			{Name: "total", Type: "decimal", Nullable: true, Generated: "STORED"},
+		},
+		PrimaryKey: []string{"id"},
+		UniqueKeys: []*binlog.KeyDef{{Name: "uk_name", Columns: []string{"name", "state"}}},
+	}
+	if !reflect.DeepEqual(def, expected) {
+		t.Errorf("definition %+v", def)
+	}
+
+	// the definition is cached until the column count of table map changes
+	if s.queries != 2 {
+		t.Errorf("%d queries, expected 2", s.queries)
+	}
+	s.columns["test.users"] = append(s.columns["test.users"], []driver.Value{"age", "int(11)", "YES", nil, nil, ""})
+	decoder = openDecoder(t, writeBinlog(t, dir, "mysql-bin.000002", usersBinlog(append(columns, binlogtest.Int("age"))...)))
+	decoder.Schema = provider
+	if tables := mappedTables(t, decoder); len(tables[0].ColumnNames) != 5 || tables[0].ColumnNames[4] != "age" || s.queries != 4 {
+		t.Errorf("altered table: names %v, %d queries", tables[0].ColumnNames, s.queries)
+	}
+
+	// tables which don't exist are unknown
+	decoder = openDecoder(t, writeBinlog(t, dir, "mysql-bin.000003", usersBinlog(columns...)))
+	decoder.Schema = binlog.NewInformationSchema(openInfoSchema(t, &infoSchema{}))
+	if tables := mappedTables(t, decoder); len(tables[0].ColumnNames) != 0 {
+		t.Errorf("unknown table: names %v", tables[0].ColumnNames)
+	}
+}
+
+func TestSchemaMismatch(t *testing.T) {
+	dir := tempDir(t)
+	path := writeBinlog(t, dir, "mysql-bin.000001", usersBinlog(binlogtest.Int("id"), binlogtest.Varchar("name", 20)))
+
+	for _, c := range []struct {
+		columns  string
+		expected binlog.SchemaMismatch
+	}{
+		{
+			`[{"name": "id", "type": "int"}]`,
+			binlog.SchemaMismatch{Column: -1, Field: "column count", Expected: "1", Actual: "2"},
+		},
+		{
+			`[{"name": "id", "type": "int"}, {"name": "name", "type": "int"}]`,
+			binlog.SchemaMismatch{Column: 1, Field: "type", Expected: "int", Actual: "varbinary"},
+		},
+		{
+			`[{"name": "id", "type": "BIGINT"}, {"name": "name", "type": "varchar"}]`,
+			binlog.SchemaMismatch{Column: 0, Field: "type", Expected: "bigint", Actual: "int"},
+		},
+	} {
+		schemaFile := filepath.Join(dir, "schema.json")
+		data := `{"tables": [{"schema": "test", "name": "users", "columns": ` + c.columns + `}]}`
+		if err := ioutil.WriteFile(schemaFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		schema, err := binlog.NewSchemaFile(schemaFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoder := openDecoder(t, path)
+		decoder.Schema = schema
+		err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) { return true, nil })
+		var mismatch *binlog.SchemaMismatch
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: %v is not a schema mismatch", c.columns, err)
+			continue
+		}
+		expected := c.expected
+		expected.File, expected.Pos, expected.Schema, expected.Table = "mysql-bin.000001", mismatch.Pos, "test", "users"
+		if *mismatch != expected || mismatch.Pos <= 4 {
+			t.Errorf("%s: %+v, expected %+v", c.columns, *mismatch, expected)
+		}
+
+		// the columns of mismatched table are not labeled if the mismatch is ignored
+		var mismatches []string
+		decoder = openDecoder(t, path)
+		decoder.Schema = schema
+		decoder.OnSchemaMismatch = func(mismatch *binlog.SchemaMismatch) error {
+			mismatches = append(mismatches, mismatch.Error())
+			return nil
+		}
+		tables := mappedTables(t, decoder)
+		if len(mismatches) != 1 || len(tables) != 1 || len(tables[0].ColumnNames) != 0 {
+			t.Errorf("%s: ignored mismatches %v, names %v", c.columns, mismatches, tables[0].ColumnNames)
+		}
+	}
+}
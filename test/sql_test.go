@@ -0,0 +1,208 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// collationLatin1 is latin1_swedish_ci
+const collationLatin1 = 8
+
+// generateSQL return the SQL written by g for the binary log built by b
+func generateSQL(t *testing.T, g *binlog.SQLGenerator, b *binlogtest.Builder) (string, error) {
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))
+	var buf bytes.Buffer
+	err := g.WriteSQL(&buf, decoder)
+	return buf.String(), err
+}
+
+func TestSQLGenerator(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.FullMetadata = true
+	users := b.Table("test", "users",
+		binlogtest.Int("id").AsPrimaryKey(),
+		binlogtest.Varchar("na`me", 40),
+		binlogtest.Varchar("city", 20).WithCollation(collationLatin1),
+		binlogtest.VarBinary("token", 8),
+		binlogtest.Decimal("balance", 10, 2),
+		binlogtest.JSON("extra"),
+		binlogtest.Enum("state", "active", "locked"),
+		binlogtest.Set("roles", "admin", "dev", "ops"),
+	)
+	points := b.Table("test", "points", binlogtest.Int("x"), binlogtest.Varchar("label", 10), binlogtest.Double("weight"))
+
+	b.Query("test", "CREATE TABLE points (x INT, label VARCHAR(10), weight DOUBLE)")
+	b.Begin().Insert(users,
+		[]interface{}{1, "it's \"q\" \\ \n\r\x00\x1a", "caf\xe9", "\x00\xff", "-12.50", `{"a": "b'c"}`, 2, 5},
+		[]interface{}{2, "中文", "paris", "", "0.00", nil, 1, 0},
+		[]interface{}{3, nil, nil, nil, nil, nil, nil, nil},
+	).Commit()
+	b.Begin().
+		Update(users, []interface{}{2, "中文", "paris", "", "0.00", nil, 1, 0}, []interface{}{2, "中文", "paris", "", "1.00", nil, 1, 2}).
+		Delete(points, []interface{}{1, nil, 0.5}).
+		Commit()
+
+	g := binlog.NewSQLGenerator()
+	g.BatchSize = 2
+	sql, err := generateSQL(t, g, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"SET NAMES utf8mb4;",
+		"SET time_zone = '+00:00';",
+		"# GTID 3e11fa47-71ca-11e1-9e33-c80aa9429562:1",
+		"USE `test`;",
+		"SET TIMESTAMP=1537600000;",
+		"CREATE TABLE points (x INT, label VARCHAR(10), weight DOUBLE);",
+		"# GTID 3e11fa47-71ca-11e1-9e33-c80aa9429562:2",
+		"BEGIN;",
+		"INSERT INTO `test`.`users` (`id`, `na``me`, `city`, `token`, `balance`, `extra`, `state`, `roles`) VALUES " +
+			`(1, 'it\'s \"q\" \\ \n\r\0\Z', _latin1 X'636166e9', X'00ff', -12.50, CAST('{\"a\": \"b\'c\"}' AS JSON), 'locked', 'admin,ops'), ` +
+			"(2, '中文', 'paris', '', 0.00, NULL, 'active', '');",
+		"INSERT INTO `test`.`users` (`id`, `na``me`, `city`, `token`, `balance`, `extra`, `state`, `roles`) VALUES " +
+			"(3, NULL, NULL, NULL, NULL, NULL, NULL, NULL);",
+		"COMMIT;",
+		"# GTID 3e11fa47-71ca-11e1-9e33-c80aa9429562:3",
+		"BEGIN;",
+		"UPDATE `test`.`users` SET `id`=2, `na``me`='中文', `city`='paris', `token`='', `balance`=1.00, `extra`=NULL, " +
+			"`state`='active', `roles`='dev' WHERE `id`=2 LIMIT 1;",
+		"DELETE FROM `test`.`points` WHERE `x`=1 AND `label` IS NULL LIMIT 1;",
+		"COMMIT;",
+		"",
+	}, "\n")
+	if sql != expected {
+		t.Errorf("SQL\n%s\nexpected\n%s", sql, expected)
+	}
+}
+
+func TestSQLGeneratorWriteTransaction(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.FullMetadata = true
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	b.Begin().Insert(users, []interface{}{1, "alice"}).Commit()
+	b.Begin().Delete(users, []interface{}{1, "alice"}).Commit()
+
+	// the header is written once by the first WriteTransaction, as WriteSQL does
+	g := binlog.NewSQLGenerator()
+	var buf bytes.Buffer
+	decoder := openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))
+	err := decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+		return true, g.WriteTransaction(&buf, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := generateSQL(t, binlog.NewSQLGenerator(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected || strings.Count(expected, "SET NAMES utf8mb4;\n") != 1 {
+		t.Errorf("SQL of WriteTransaction\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestSQLGeneratorStatementContext(t *testing.T) {
+	b := binlogtest.New("5.7.44-log", binlog.BinlogChecksumAlgCRC32)
+	b.Begin()
+	b.Event(binlog.IntvarEvent, &binlog.BinIntvarEvent{Type: binlog.IntvarLastInsertID, Value: 7})
+	b.Event(binlog.IntvarEvent, &binlog.BinIntvarEvent{Type: binlog.IntvarInsertID, Value: 42})
+	b.Event(binlog.RandEvent, &binlog.BinRandEvent{Seed1: 123, Seed2: 456})
+	b.Event(binlog.UserVarEvent, &binlog.BinUserVarEvent{
+		Name: "na`me", Type: binlog.UserVarStringResult, Charset: collationLatin1, Value: []byte("caf\xe9"),
+	})
+	b.Event(binlog.UserVarEvent, &binlog.BinUserVarEvent{Name: "n", IsNull: true})
+	b.Event(binlog.QueryEvent, &binlog.BinQueryEvent{
+		Schema:     "test",
+		StatusVars: []byte{binlog.QMicroseconds, 0x40, 0xe2, 0x01},
+		Query:      "INSERT INTO t (name, n, r) VALUES (@`na``me`, @n, RAND())",
+	})
+	// the context of a statement is not written before the next one
+	b.Query("test", "UPDATE t SET r = 0")
+	b.Commit()
+
+	sql, err := generateSQL(t, binlog.NewSQLGenerator(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"SET NAMES utf8mb4;",
+		"SET time_zone = '+00:00';",
+		"BEGIN;",
+		"USE `test`;",
+		"SET LAST_INSERT_ID=7;",
+		"SET INSERT_ID=42;",
+		"SET @@RAND_SEED1=123, @@RAND_SEED2=456;",
+		"SET @`na``me`:=_latin1 X'636166e9';",
+		"SET @`n`:=NULL;",
+		"SET TIMESTAMP=1537600000.123456;",
+		"INSERT INTO t (name, n, r) VALUES (@`na``me`, @n, RAND());",
+		"USE `test`;",
+		"SET TIMESTAMP=1537600000;",
+		"UPDATE t SET r = 0;",
+		"COMMIT;",
+		"",
+	}, "\n")
+	if sql != expected {
+		t.Errorf("SQL\n%s\nexpected\n%s", sql, expected)
+	}
+}
+
+func TestSQLGeneratorSchemas(t *testing.T) {
+	// column names and primary key are not written without binlog_row_metadata=FULL
+	build := func() *binlogtest.Builder {
+		b := binlogtest.New("5.7.44-log", binlog.BinlogChecksumAlgCRC32)
+		users := b.Table("test", "users", binlogtest.Int("id"), binlogtest.Varchar("name", 20))
+		b.Begin().Delete(users, []interface{}{1, "alice"}).Commit()
+		return b
+	}
+
+	g := binlog.NewSQLGenerator()
+	if _, err := generateSQL(t, g, build()); err == nil || !strings.Contains(err.Error(), "column names of test.users are unknown") {
+		t.Errorf("without column names: got %v", err)
+	}
+
+	g.Schemas["test.users"] = &binlog.TableSchema{Columns: []string{"id"}}
+	if _, err := generateSQL(t, g, build()); err == nil || !strings.Contains(err.Error(), "has 1 columns") {
+		t.Errorf("supplied schema of wrong column count: got %v", err)
+	}
+
+	g.Schemas["test.users"] = &binlog.TableSchema{Columns: []string{"id", "name"}, PrimaryKey: []string{"ID"}}
+	sql, err := generateSQL(t, g, build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql, "\nDELETE FROM `test`.`users` WHERE `id`=1 LIMIT 1;\n") {
+		t.Errorf("DELETE by supplied primary key:\n%s", sql)
+	}
+
+	g.Schemas["test.users"].PrimaryKey = nil
+	if sql, err = generateSQL(t, g, build()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql, "\nDELETE FROM `test`.`users` WHERE `id`=1 AND `name`='alice' LIMIT 1;\n") {
+		t.Errorf("DELETE by all columns:\n%s", sql)
+	}
+}
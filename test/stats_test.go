@@ -0,0 +1,198 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// statsFixture return a binary log with a DDL, a transaction of 90 seconds and a transaction 2 minutes later
+func statsFixture() *binlogtest.Builder {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.Timestamp = 1537599960
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+	logs := b.Table("test", "logs", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("msg", 20))
+
+	b.Query("test", "CREATE TABLE users(id int primary key, name varchar(20))")
+	b.Begin().Insert(users, []interface{}{1, "a"}, []interface{}{2, "b"}, []interface{}{3, "c"}).Insert(logs, []interface{}{1, "x"})
+	b.Timestamp += 90
+	b.Commit()
+	b.Timestamp += 30
+	b.Begin().Update(users, []interface{}{1, "a"}, []interface{}{1, "d"}).Delete(users, []interface{}{2, "b"}).Commit()
+	return b
+}
+
+func TestStatsAnalyzer(t *testing.T) {
+	events := decodeAll(t, openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", statsFixture())))
+	analyzer := binlog.NewStatsAnalyzer()
+	analyzer.File = "mysql-bin.000001"
+	var size int64
+	for _, event := range events {
+		analyzer.Add(event)
+		size += event.Header.EventSize
+	}
+	stats := analyzer.Stats()
+
+	if stats.Events != int64(len(events)) || stats.Bytes != size || stats.Transactions != 3 {
+		t.Errorf("events %d, bytes %d, transactions %d, expected %d, %d, 3", stats.Events, stats.Bytes, stats.Transactions, len(events), size)
+	}
+	if stats.StartTime != 1537599960 || stats.EndTime != 1537599960+120 {
+		t.Errorf("time %d - %d", stats.StartTime, stats.EndTime)
+	}
+
+	var typeEvents int64
+	for i, typ := range stats.EventTypes {
+		typeEvents += typ.Events
+		if i > 0 && typ.Bytes > stats.EventTypes[i-1].Bytes {
+			t.Errorf("event types are not sorted by bytes: %s after %s", typ.Type, stats.EventTypes[i-1].Type)
+		}
+	}
+	if typeEvents != stats.Events {
+		t.Errorf("%d events of event types, expected %d", typeEvents, stats.Events)
+	}
+
+	tables := make(map[string]binlog.TableStats)
+	for _, table := range stats.Tables {
+		tables[table.Schema+"."+table.Table] = *table
+	}
+	if users := tables["test.users"]; users.Events != 3 || users.Inserts != 3 || users.Updates != 1 || users.Deletes != 1 {
+		t.Errorf("test.users: %+v", users)
+	}
+	if logs := tables["test.logs"]; logs.Events != 1 || logs.Inserts != 1 || logs.Bytes <= 0 {
+		t.Errorf("test.logs: %+v", logs)
+	}
+
+	if len(stats.LargestByRows) != 2 {
+		t.Fatalf("%d largest transactions by rows, expected 2", len(stats.LargestByRows))
+	}
+	largest := stats.LargestByRows[0]
+	if largest.Rows != 4 || largest.File != "mysql-bin.000001" || largest.GTID != "3e11fa47-71ca-11e1-9e33-c80aa9429562:2" ||
+		!reflect.DeepEqual(largest.Tables, []string{"test.users", "test.logs"}) || largest.StartPos >= largest.EndPos {
+		t.Errorf("largest transaction by rows: %+v", largest)
+	}
+	if len(stats.LongestByDuration) != 1 || stats.LongestByDuration[0].Duration != 90 || stats.LongestByDuration[0] != largest {
+		t.Errorf("longest transactions: %+v", stats.LongestByDuration)
+	}
+	if len(stats.DDL) != 1 || stats.DDL[0].Schema != "test" || !strings.HasPrefix(stats.DDL[0].Query, "CREATE TABLE users") {
+		t.Errorf("DDL: %+v", stats.DDL)
+	}
+
+	// the DDL and the first transaction start in the first minute, the first transaction commits in the second
+	// minute, the last transaction in the third
+	var minutes []int64
+	var minuteEvents, minuteRows int64
+	for _, m := range stats.Minutes {
+		minutes = append(minutes, m.Transactions)
+		minuteEvents += m.Events
+		minuteRows += m.Rows
+	}
+	if !reflect.DeepEqual(minutes, []int64{1, 1, 1}) || stats.Minutes[0].Minute != 1537599960 || minuteEvents != stats.Events || minuteRows != 6 {
+		t.Errorf("minutes: %d transactions, %d events, %d rows", minutes, minuteEvents, minuteRows)
+	}
+}
+
+func TestStatsAnalyzerTopN(t *testing.T) {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	users := b.Table("test", "users", binlogtest.Int("id").AsPrimaryKey())
+	for i := 1; i <= 4; i++ {
+		b.Begin()
+		for j := 0; j < i; j++ {
+			b.Insert(users, []interface{}{i*10 + j})
+		}
+		b.Commit()
+	}
+
+	analyzer := binlog.NewStatsAnalyzer()
+	analyzer.TopN = 2
+	for _, event := range decodeAll(t, openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", b))) {
+		analyzer.Add(event)
+	}
+	stats := analyzer.Stats()
+	var rows []int64
+	for _, tx := range stats.LargestByRows {
+		rows = append(rows, tx.Rows)
+	}
+	if !reflect.DeepEqual(rows, []int64{4, 3}) || len(stats.LargestByBytes) != 2 || stats.LargestByBytes[0].Rows != 4 {
+		t.Errorf("top 2 transactions by rows %v, by bytes %+v", rows, stats.LargestByBytes)
+	}
+	if len(stats.LongestByDuration) != 0 {
+		t.Errorf("transactions of no duration: %+v", stats.LongestByDuration)
+	}
+}
+
+func TestStatsOutput(t *testing.T) {
+	analyzer := binlog.NewStatsAnalyzer()
+	for _, event := range decodeAll(t, openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", statsFixture()))) {
+		analyzer.Add(event)
+	}
+	stats := analyzer.Stats()
+
+	var buf bytes.Buffer
+	if err := stats.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded binlog.Stats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, stats) {
+		t.Errorf("JSON round trip\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := stats.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Transactions: 3", "test.users", "LONGEST TRANSACTIONS BY DURATION", "CREATE TABLE users(id int primary key, name varchar(20))"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("text output has no %q\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := stats.WriteCSV(&buf, binlog.StatsTables); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[1]) != 7 || len(records[2]) != 7 {
+		t.Fatalf("CSV tables %v", records)
+	}
+	expected := [][]string{
+		{"schema", "table", "events", "bytes", "inserts", "updates", "deletes"},
+		{"test", "users", "3", records[1][3], "3", "1", "1"},
+		{"test", "logs", "1", records[2][3], "1", "0", "0"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("CSV tables %v, expected %v", records, expected)
+	}
+
+	if err := stats.WriteCSV(&buf, "unknown"); err == nil {
+		t.Error("CSV of unknown section is not an error")
+	}
+}
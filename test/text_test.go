@@ -0,0 +1,149 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// textFixture return a binary log with a DDL and a transaction of insert and update
+func textFixture() *binlogtest.Builder {
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	b.PreviousGTIDs = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"
+	users := b.Table("test", "users",
+		binlogtest.Int("id").AsNotNull().AsPrimaryKey(),
+		binlogtest.TinyInt("flag").AsUnsigned(),
+		binlogtest.Varchar("name", 20),
+		binlogtest.Date("birthday"),
+		binlogtest.Set("roles", "a", "b"),
+	)
+	b.Query("test", "CREATE TABLE users (id INT)")
+	b.Begin().
+		Insert(users, []interface{}{1, 255, "it's", "2018-09-22", 3}).
+		Update(users, []interface{}{1, 255, "it's", "2018-09-22", 3}, []interface{}{1, 0, nil, "2018-09-23", 1}).
+		Commit()
+	b.Rotate("mysql-bin.000002")
+	return b
+}
+
+// formatText return the text of events formatted by f
+func formatText(t *testing.T, f *binlog.TextFormatter, buf *bytes.Buffer, events []*binlog.BinEvent) string {
+	for _, event := range events {
+		if err := f.Format(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTextFormatterDecodeRows(t *testing.T) {
+	events := decodeAll(t, openDecoder(t, writeBinlog(t, tempDir(t), "mysql-bin.000001", textFixture())))
+
+	var buf bytes.Buffer
+	f := binlog.NewTextFormatter(&buf)
+	f.Verbose, f.DecodeRows, f.Location = 2, true, time.UTC
+	text := formatText(t, f, &buf, events)
+
+	// GTID events and the end of output are checked by fragments, other lines are compared
+	for _, fragment := range []string{
+		"# at 126\n#180922  7:06:40 server id 1  end_log_pos 197 CRC32 0xecb9b27c \tPrevious-GTIDs\n# 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5\n",
+		"\tGTID\tlast_committed=0\tsequence_number=1\trbr_only=no\t",
+		"# original_commit_timestamp=1537600000000000 (2018-09-22 07:06:40.000000 UTC)\n",
+		"SET @@SESSION.GTID_NEXT= '3e11fa47-71ca-11e1-9e33-c80aa9429562:2'/*!*/;\n",
+		"use `test`/*!*/;\nSET TIMESTAMP=1537600000/*!*/;\nSET @@session.pseudo_thread_id=0/*!*/;\nCREATE TABLE users (id INT)\n/*!*/;\n",
+		"\tTable_map: `test`.`users` mapped to number 108\n# at 527\n",
+		"\tWrite_rows: table id 108 flags: STMT_END_F\n" +
+			"### INSERT INTO `test`.`users`\n" +
+			"### SET\n" +
+			"###   @1=1 /* INT meta=0 nullable=0 is_null=0 */\n" +
+			"###   @2=-1 (255) /* TINYINT meta=0 nullable=1 is_null=0 */\n" +
+			"###   @3='it\\x27s' /* VARSTRING(80) meta=80 nullable=1 is_null=0 */\n" +
+			"###   @4='2018:09:22' /* DATE meta=0 nullable=1 is_null=0 */\n" +
+			"###   @5=b'00000011' /* SET(1 bytes) meta=63489 nullable=1 is_null=0 */\n",
+		"### SET\n" +
+			"###   @1=1 /* INT meta=0 nullable=0 is_null=0 */\n" +
+			"###   @2=0 /* TINYINT meta=0 nullable=1 is_null=0 */\n" +
+			"###   @3=NULL /* VARSTRING(80) meta=80 nullable=1 is_null=1 */\n" +
+			"###   @4='2018:09:23' /* DATE meta=0 nullable=1 is_null=0 */\n" +
+			"###   @5=b'00000001' /* SET(1 bytes) meta=63489 nullable=1 is_null=0 */\n" +
+			"# at 702\n",
+		"\tXid = 1\nCOMMIT/*!*/;\n",
+		"\tRotate to mysql-bin.000002  pos: 4\n" +
+			"SET @@SESSION.GTID_NEXT= 'AUTOMATIC' /* added by mysqlbinlog */ /*!*/;\n" +
+			"DELIMITER ;\n# End of log file\n",
+	} {
+		if !strings.Contains(text, fragment) {
+			t.Errorf("output doesn't contain\n%s\noutput:\n%s", fragment, text)
+		}
+	}
+	if strings.Contains(text, "BINLOG '") {
+		t.Errorf("BINLOG statement is written with DecodeRows")
+	}
+}
+
+func TestTextFormatterBase64(t *testing.T) {
+	path := writeBinlog(t, tempDir(t), "mysql-bin.000001", textFixture())
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := decodeAll(t, openDecoder(t, path))
+
+	var buf bytes.Buffer
+	f := binlog.NewTextFormatter(&buf)
+	f.Location = time.UTC
+	text := formatText(t, f, &buf, events)
+
+	// BINLOG statements are the FORMAT_DESCRIPTION_EVENT and TABLE_MAP_EVENT with rows events of statements
+	var statements [][]byte
+	for _, block := range strings.Split(text, "BINLOG '\n")[1:] {
+		// events are encoded separately in lines of 76 characters, so every line can be decoded
+		var raw []byte
+		for _, line := range strings.Fields(block[:strings.Index(block, "'")]) {
+			data, err := base64.StdEncoding.DecodeString(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw = append(raw, data...)
+		}
+		statements = append(statements, raw)
+	}
+	expected := [][]byte{data[4:126], data[463:577], data[577:702]}
+	if len(statements) != len(expected) {
+		t.Fatalf("got %d BINLOG statements, expected %d", len(statements), len(expected))
+	}
+	for i := range expected {
+		if !bytes.Equal(statements[i], expected[i]) {
+			t.Errorf("BINLOG statement %d is not the raw events", i)
+		}
+	}
+	if strings.Contains(text, "###") {
+		t.Errorf("pseudo-SQL is written without Verbose")
+	}
+}
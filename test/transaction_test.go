@@ -0,0 +1,95 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+func TestWalkTransaction(t *testing.T) {
+	dir := tempDir(t)
+
+	b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+	b.UUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	table := b.Table("test", "t", binlogtest.Int("id").AsPrimaryKey(), binlogtest.Varchar("name", 20))
+
+	b.Query("test", "CREATE TABLE t(id int primary key, name varchar(20))")
+	b.Begin().Insert(table, []interface{}{1, "a"}, []interface{}{2, "b"}).Delete(table, []interface{}{2, "b"}).Commit()
+
+	// XA transaction prepared, then committed by a single statement transaction
+	b.Query("test", "XA START X'78',X'',1")
+	b.Event(binlog.QueryEvent, &binlog.BinQueryEvent{Schema: "test", Query: "INSERT INTO t VALUES (3, 'c')"})
+	b.Event(binlog.QueryEvent, &binlog.BinQueryEvent{Schema: "test", Query: "XA END X'78',X'',1"})
+	b.Event(binlog.XAPrepareLogEvent, &binlog.BinXAPrepareEvent{FormatID: 1, GTRID: []byte("x")})
+	b.Query("test", "XA COMMIT X'78',X'',1")
+
+	// statement-based transaction ending with QUERY_EVENT COMMIT, with the context of statement
+	b.Begin()
+	b.Event(binlog.IntvarEvent, &binlog.BinIntvarEvent{Type: binlog.IntvarInsertID, Value: 5})
+	b.Event(binlog.RandEvent, &binlog.BinRandEvent{Seed1: 1, Seed2: 2})
+	b.Event(binlog.UserVarEvent, &binlog.BinUserVarEvent{
+		Name: "name", Type: binlog.UserVarStringResult, Charset: 45, Value: []byte("d"),
+	})
+	b.Query("test", "UPDATE t SET name = @name WHERE id = RAND()")
+	b.Event(binlog.QueryEvent, &binlog.BinQueryEvent{Schema: "test", Query: "COMMIT"})
+
+	decoder := openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", b))
+	var txs []*binlog.Transaction
+	err := decoder.WalkTransaction(func(tx *binlog.Transaction) (isContinue bool, err error) {
+		txs = append(txs, tx)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 5 {
+		t.Fatalf("%d transactions, expected 5", len(txs))
+	}
+
+	ddl, rows, prepare, commit, statement := txs[0], txs[1], txs[2], txs[3], txs[4]
+	if !ddl.IsDDL || len(ddl.Statements) != 1 || ddl.GTID != b.UUID+":1" {
+		t.Errorf("DDL: %+v", ddl)
+	}
+	if rows.IsDDL || rows.XID == 0 || len(rows.Rows) != 2 || rows.GTID != b.UUID+":2" || rows.StartPos != ddl.EndPos {
+		t.Errorf("rows: %+v", rows)
+	}
+	if !prepare.IsXA || prepare.XAPrepare == nil || prepare.XAID != "X'78',X'',1" || len(prepare.Statements) != 1 {
+		t.Errorf("XA PREPARE: %+v", prepare)
+	}
+	if !commit.IsXA || commit.XAPrepare != nil || commit.XAID != "X'78',X'',1" || commit.StartPos != prepare.EndPos {
+		t.Errorf("XA COMMIT: %+v", commit)
+	}
+	if statement.IsDDL || statement.XID != 0 || len(statement.Statements) != 1 || statement.Size() <= 0 {
+		t.Errorf("statement-based: %+v", statement)
+	}
+	var types []string
+	for _, event := range statement.Events {
+		types = append(types, fmt.Sprintf("%T", event.Body))
+	}
+	expected := "[*binlog.BinGTIDEvent *binlog.BinQueryEvent *binlog.BinIntvarEvent *binlog.BinRandEvent " +
+		"*binlog.BinUserVarEvent *binlog.BinQueryEvent *binlog.BinQueryEvent]"
+	if fmt.Sprint(types) != expected {
+		t.Errorf("statement-based events %v, expected %s", types, expected)
+	}
+	if v, err := statement.Events[4].Body.(*binlog.BinUserVarEvent).SQLValue(); err != nil || v != "'d'" {
+		t.Errorf("user variable %s, %v", v, err)
+	}
+}
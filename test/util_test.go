@@ -0,0 +1,89 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+// tempDir return a temporary directory which is removed after test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "binlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// writeBinlog write the binary log built by b into dir, return its path
+func writeBinlog(t *testing.T, dir, name string, b *binlogtest.Builder) string {
+	path := filepath.Join(dir, name)
+	if err := b.WriteFile(path); err != nil {
+		t.Fatal(name, err)
+	}
+	return path
+}
+
+// openDecoder return the decoder of binary log, which is closed after test
+func openDecoder(t *testing.T, path string, options ...*binlog.BinReaderOption) *binlog.BinFileDecoder {
+	decoder, err := binlog.NewBinFileDecoder(path, options...)
+	if err != nil {
+		t.Fatal(path, err)
+	}
+	t.Cleanup(func() { decoder.BinFile.Close() })
+	return decoder
+}
+
+// decodeAll return all events walked by decoder
+func decodeAll(t *testing.T, decoder *binlog.BinFileDecoder) []*binlog.BinEvent {
+	var events []*binlog.BinEvent
+	err := decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		events = append(events, event)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(decoder.Path, err)
+	}
+	return events
+}
+
+// rowImages return the before and after images of row changes in events
+func rowImages(events []*binlog.BinEvent) [][]interface{} {
+	var images [][]interface{}
+	for _, event := range events {
+		rows, ok := event.Body.(*binlog.BinRowsEvent)
+		if !ok {
+			continue
+		}
+		for _, row := range rows.Rows {
+			if row.Before != nil {
+				images = append(images, row.Before)
+			}
+			if row.After != nil {
+				images = append(images, row.After)
+			}
+		}
+	}
+	return images
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+	"github.com/liipx/go-mysql-binlog/binlogtest"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mysql-bin.000001")
+
+	const uuid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	build := func(f func(b *binlogtest.Builder)) []byte {
+		b := binlogtest.New("8.0.32", binlog.BinlogChecksumAlgCRC32)
+		b.UUID = uuid
+		f(b)
+		data, err := b.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	closed := build(func(b *binlogtest.Builder) {
+		fixture(b)
+		b.Rotate("mysql-bin.000002")
+	})
+	// start offset of the first XID_EVENT
+	var xid int64
+	if err := ioutil.WriteFile(path, closed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := binlog.NewBinFileDecoder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) {
+		xid = event.Header.LogPos - event.Header.EventSize
+		return event.Header.EventType != binlog.XIDEvent, nil
+	})
+	decoder.BinFile.Close()
+
+	// the flashback binary log is written by BinFileWriter without ROTATE_EVENT
+	var flashback bytes.Buffer
+	if err := binlog.NewFlashback(openDecoder(t, writeBinlog(t, dir, "fixture.000001", flashbackFixture()))).WriteBinlog(&flashback); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		data     []byte
+		problems []string
+		warnings []string
+	}{
+		{"closed", closed, nil, nil},
+		{"open", build(func(b *binlogtest.Builder) { fixture(b) }), nil, []string{"doesn't end with ROTATE_EVENT"}},
+		{"writer", flashback.Bytes(), nil, []string{"doesn't end with ROTATE_EVENT"}},
+		{"checksum", corrupt(closed, xid+20, xid+21), []string{"checksum mismatch", "transaction is not terminated"}, nil},
+		{"truncated", closed[:xid+10], []string{"truncated event header", "transaction is not terminated"}, []string{"doesn't end"}},
+		{"magic", append([]byte("\xfebim"), closed[4:]...), []string{"invalid binary log magic"}, nil},
+		{"unterminated", build(func(b *binlogtest.Builder) {
+			table := b.Table("test", "t", binlogtest.Int("id"))
+			b.Begin().Insert(table, []interface{}{1}).Rotate("mysql-bin.000002")
+		}), []string{"transaction is not terminated"}, nil},
+		{"gtid", build(func(b *binlogtest.Builder) {
+			b.PreviousGTIDs = uuid + ":1"
+			b.Query("test", "CREATE TABLE t(id int)").Rotate("mysql-bin.000002")
+		}), []string{"GTID " + uuid + ":1 is executed before"}, nil},
+		{"gtid gap", build(func(b *binlogtest.Builder) {
+			b.UUID, b.PreviousGTIDs = "", uuid+":1"
+			sid := []byte("\x3e\x11\xfa\x47\x71\xca\x11\xe1\x9e\x33\xc8\x0a\xa9\x42\x95\x62")
+			b.Event(binlog.GTIDEvent, &binlog.BinGTIDEvent{SID: sid, GNO: 3})
+			b.Event(binlog.QueryEvent, &binlog.BinQueryEvent{Schema: "test", Query: "CREATE TABLE t(id int)"})
+			b.Rotate("mysql-bin.000002")
+		}), nil, []string{"GTID " + uuid + ":3 doesn't continue " + uuid + ":1"}},
+	} {
+		if err := ioutil.WriteFile(path, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		report, err := binlog.Verify(path)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if report.OK() != (len(c.problems) == 0) || len(report.Issues) != len(c.problems) || len(report.Warnings) != len(c.warnings) {
+			t.Errorf("%s: issues %v, warnings %v, expected %v, %v", c.name, report.Issues, report.Warnings, c.problems, c.warnings)
+			continue
+		}
+		for i, issue := range report.Issues {
+			if !strings.Contains(issue.Problem, c.problems[i]) {
+				t.Errorf("%s: issue %s, expected %q", c.name, issue, c.problems[i])
+			}
+		}
+		for i, warning := range report.Warnings {
+			if !strings.Contains(warning.Problem, c.warnings[i]) {
+				t.Errorf("%s: warning %s, expected %q", c.name, warning, c.warnings[i])
+			}
+		}
+	}
+}
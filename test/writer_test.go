@@ -0,0 +1,188 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/liipx/go-mysql-binlog"
+)
+
+// writeEvents write events into a binary log of path with BinFileWriter
+func writeEvents(t *testing.T, path string, events []*binlog.BinEvent) {
+	writer, err := binlog.NewBinFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if err := writer.WriteEvent(event); err != nil {
+			t.Fatal(event.Header.Type(), err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinFileWriterCopy(t *testing.T) {
+	dir := tempDir(t)
+	path := writeBinlog(t, dir, "mysql-bin.000001", flashbackFixture())
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decoded events are written with their raw data
+	copied := filepath.Join(dir, "copy.000001")
+	writeEvents(t, copied, decodeAll(t, openDecoder(t, path)))
+	data, err := ioutil.ReadFile(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Errorf("copy of %d bytes differs from the original of %d bytes", len(data), len(original))
+	}
+}
+
+func TestBinFileWriterEncode(t *testing.T) {
+	for _, alg := range []byte{binlog.BinlogChecksumAlgCRC32, binlog.BinlogChecksumAlgOff} {
+		t.Run(fmt.Sprint(alg), func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := binlog.NewBinWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := func(typ uint8) *binlog.BinEventHeader {
+				return &binlog.BinEventHeader{Timestamp: 1537600000, EventType: typ, ServerID: 2}
+			}
+			query := &binlog.BinEvent{Header: header(binlog.QueryEvent), Body: &binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"}}
+			if err := writer.WriteEvent(query); err == nil {
+				t.Error("QUERY_EVENT is written before FORMAT_DESCRIPTION_EVENT")
+			}
+
+			bodies := []binlog.BinEventBody{
+				binlog.NewFmtDescEvent(alg),
+				&binlog.BinQueryEvent{Schema: "test", Query: "CREATE TABLE t (id int)"},
+				&binlog.BinQueryEvent{Schema: "test", Query: "BEGIN"},
+				&binlog.BinXIDEvent{XID: 42},
+				&binlog.BinRotateEvent{Position: 4, FileName: "mysql-bin.000002"},
+			}
+			types := []uint8{binlog.FormatDescriptionEvent, binlog.QueryEvent, binlog.QueryEvent, binlog.XIDEvent, binlog.RotateEvent}
+			var positions []int64
+			for i, body := range bodies {
+				if err := writer.WriteEvent(&binlog.BinEvent{Header: header(types[i]), Body: body}); err != nil {
+					t.Fatal(err)
+				}
+				positions = append(positions, writer.Pos())
+			}
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if int64(buf.Len()) != writer.Pos() {
+				t.Errorf("%d bytes written, position %d", buf.Len(), writer.Pos())
+			}
+
+			path := filepath.Join(tempDir(t), "mysql-bin.000001")
+			if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			events := decodeAll(t, openDecoder(t, path))
+			if len(events) != len(bodies) {
+				t.Fatalf("%d events decoded, expected %d", len(events), len(bodies))
+			}
+			for i, event := range events {
+				if event.Header.EventType != types[i] || event.Header.LogPos != positions[i] || event.Header.ServerID != 2 {
+					t.Errorf("header of event %d: %+v", i, event.Header)
+				}
+			}
+			if desc := events[0].Body.(*binlog.BinFmtDescEvent); desc.ChecksumAlg != alg {
+				t.Errorf("checksum algorithm %d, expected %d", desc.ChecksumAlg, alg)
+			}
+			if q := events[1].Body.(*binlog.BinQueryEvent); q.Schema != "test" || q.Query != "CREATE TABLE t (id int)" {
+				t.Errorf("query: %+v", q)
+			}
+			if xid := events[3].Body.(*binlog.BinXIDEvent); xid.XID != 42 {
+				t.Errorf("xid: %+v", xid)
+			}
+			if rotate := events[4].Body.(*binlog.BinRotateEvent); rotate.Position != 4 || rotate.FileName != "mysql-bin.000002" {
+				t.Errorf("rotate: %+v", rotate)
+			}
+
+			// a changed byte of query is found by checksum
+			data := append([]byte{}, buf.Bytes()...)
+			data[bytes.Index(data, []byte("CREATE TABLE"))] = 'c'
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			decoder, err := binlog.NewBinFileDecoder(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer decoder.BinFile.Close()
+			err = decoder.WalkEvent(func(event *binlog.BinEvent) (isContinue bool, err error) { return true, nil })
+			if (err != nil) != (alg == binlog.BinlogChecksumAlgCRC32) {
+				t.Errorf("decoding changed query with checksum algorithm %d: %v", alg, err)
+			}
+		})
+	}
+}
+
+func TestBinFileWriterMasked(t *testing.T) {
+	for _, rules := range [][]*binlog.MaskRule{
+		{{Pattern: "email", Action: binlog.MaskHash}, {Pattern: "password", Action: binlog.MaskDrop}},
+		{{Pattern: "age", Action: binlog.MaskConstant, Value: "**"}, {Pattern: "phone", Action: binlog.MaskTruncate, Length: 3}},
+	} {
+		dir := tempDir(t)
+		decoder := openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", maskFixture()))
+		decoder.Masker = &binlog.ColumnMasker{Rules: rules, Salt: "salt"}
+		events := decodeAll(t, decoder)
+
+		// the masked binary log decodes as the masked events, unmasked columns such as INT age are kept
+		path := filepath.Join(dir, "masked.000001")
+		writeEvents(t, path, events)
+		masked := decodeAll(t, openDecoder(t, path))
+		if images, expected := rowImages(masked), rowImages(events); len(images) != 3 || !reflect.DeepEqual(images, expected) {
+			t.Errorf("%s: masked binary log\n%v\nexpected\n%v", rules[0].Pattern, images, expected)
+		}
+
+		var names []string
+		for _, event := range masked {
+			if table, ok := event.Body.(*binlog.BinTableMapEvent); ok {
+				names = table.ColumnNames
+			}
+		}
+		if expected := []string{"id", "email", "phone", "age", "password", "note"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("%s: column names %v, expected %v", rules[0].Pattern, names, expected)
+		}
+	}
+
+	// the age is kept as an INT if it's not masked
+	dir := tempDir(t)
+	decoder := openDecoder(t, writeBinlog(t, dir, "mysql-bin.000001", maskFixture()))
+	decoder.Masker = &binlog.ColumnMasker{Rules: []*binlog.MaskRule{{Pattern: "email", Action: binlog.MaskConstant, Value: "x"}}}
+	path := filepath.Join(dir, "masked.000001")
+	writeEvents(t, path, decodeAll(t, decoder))
+	if images := rowImages(decodeAll(t, openDecoder(t, path))); len(images) == 0 || images[0][1] != "x" || images[0][3] != int64(30) {
+		t.Errorf("masked email and unmasked age: %#v", images)
+	}
+}
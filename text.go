@@ -0,0 +1,510 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// mysqlbinlog statement delimiter
+const textDelimiter = "/*!*/;"
+
+// TextFormatter writes binary log events in the layout of mysqlbinlog, such as
+// 'mysqlbinlog -vv' or 'mysqlbinlog -vv --base64-output=decode-rows'.
+// Close() must be called after all events to write the end of output.
+type TextFormatter struct {
+	// Verbose is the verbosity of pseudo-SQL of row events, 1 for -v and 2 for -vv with column types
+	Verbose int
+
+	// DecodeRows omits BINLOG statements as --base64-output=decode-rows
+	DecodeRows bool
+
+	// Location is the time zone of timestamps, time.Local if nil
+	Location *time.Location
+
+	w        *bufio.Writer
+	started  bool
+	schema   string
+	threadID int64
+
+	// BINLOG and pseudo-SQL of the rows events of current statement
+	base64 strings.Builder
+	rows   strings.Builder
+
+	// pendingRows is true if the statement end of rows events is not written,
+	// it's written before the next event when the last rows event is filtered out
+	pendingRows bool
+
+	// masked is true if a rows event of current statement is masked by ColumnMasker
+	masked bool
+}
+
+// NewTextFormatter return a TextFormatter writing into w
+func NewTextFormatter(w io.Writer) *TextFormatter {
+	return &TextFormatter{w: bufio.NewWriter(w), threadID: -1}
+}
+
+// Format write an event with '# at' position, header comment and statements
+func (f *TextFormatter) Format(event *BinEvent) error {
+	if !f.started {
+		f.started = true
+		f.w.WriteString("/*!50530 SET @@SESSION.PSEUDO_SLAVE_MODE=1*/;\n")
+		f.w.WriteString("/*!50003 SET @OLD_COMPLETION_TYPE=@@COMPLETION_TYPE,COMPLETION_TYPE=0*/;\n")
+		f.w.WriteString("DELIMITER " + textDelimiter + "\n")
+	}
+
+	if _, ok := event.Body.(*BinRowsEvent); !ok && f.pendingRows {
+		f.flushRows()
+	}
+
+	h := event.Header
+	pos := h.LogPos - h.EventSize
+	if event.Relay != nil {
+		pos = event.Relay.RelayPos
+	}
+	fmt.Fprintf(f.w, "# at %d\n", pos)
+
+	fmt.Fprintf(f.w, "#%s server id %d  end_log_pos %d ", f.timestamp(h.Timestamp), h.ServerID, h.LogPos)
+	if len(event.ChecksumVal) == binlogChecksumLength {
+		fmt.Fprintf(f.w, "CRC32 0x%08x ", binary.LittleEndian.Uint32(event.ChecksumVal))
+	}
+	f.w.WriteByte('\t')
+
+	switch body := event.Body.(type) {
+	case *BinFmtDescEvent:
+		fmt.Fprintf(f.w, "Start: binlog v %d, server v %s created %s", body.BinlogVersion, body.MySQLVersion, f.timestamp(h.Timestamp))
+		if body.CreateTime != 0 {
+			f.w.WriteString(" at startup")
+		}
+		f.w.WriteByte('\n')
+		if h.Flag&LogEventBinlogInUseF != 0 {
+			f.w.WriteString("# Warning: this binlog is either in use or was not closed properly.\n")
+		}
+		if body.CreateTime != 0 {
+			f.w.WriteString("ROLLBACK" + textDelimiter + "\n")
+		}
+		if !f.DecodeRows {
+			f.w.WriteString("BINLOG '\n" + textBase64(event.raw()) + "'" + textDelimiter + "\n")
+		}
+
+	case *BinQueryEvent:
+		fmt.Fprintf(f.w, "Query\tthread_id=%d\texec_time=%d\terror_code=%d\n", body.SlaveProxyID, body.ExecutionTime, body.ErrorCode)
+		if body.Schema != "" && body.Schema != f.schema {
+			f.schema = body.Schema
+			fmt.Fprintf(f.w, "use %s%s\n", quoteIdentifier(body.Schema), textDelimiter)
+		}
+		fmt.Fprintf(f.w, "SET TIMESTAMP=%d%s\n", h.Timestamp, textDelimiter)
+		if body.SlaveProxyID != f.threadID {
+			f.threadID = body.SlaveProxyID
+			fmt.Fprintf(f.w, "SET @@session.pseudo_thread_id=%d%s\n", body.SlaveProxyID, textDelimiter)
+		}
+		f.w.WriteString(body.Query + "\n" + textDelimiter + "\n")
+
+	case *BinXIDEvent:
+		fmt.Fprintf(f.w, "Xid = %d\n", body.XID)
+		f.w.WriteString("COMMIT" + textDelimiter + "\n")
+
+	case *BinIntvarEvent:
+		f.w.WriteString("Intvar\n")
+		name := "INSERT_ID"
+		if body.Type == IntvarLastInsertID {
+			name = "LAST_INSERT_ID"
+		}
+		fmt.Fprintf(f.w, "SET %s=%d%s\n", name, body.Value, textDelimiter)
+
+	case *BinRandEvent:
+		f.w.WriteString("Rand\n")
+		fmt.Fprintf(f.w, "SET @@RAND_SEED1=%d, @@RAND_SEED2=%d%s\n", body.Seed1, body.Seed2, textDelimiter)
+
+	case *BinUserVarEvent:
+		value, err := body.SQLValue()
+		if err != nil {
+			return err
+		}
+		f.w.WriteString("User_var\n")
+		fmt.Fprintf(f.w, "SET @%s:=%s%s\n", quoteIdentifier(body.Name), value, textDelimiter)
+
+	case *BinRotateEvent:
+		fmt.Fprintf(f.w, "Rotate to %s  pos: %d\n", body.FileName, body.Position)
+
+	case *BinGTIDEvent:
+		f.formatGTID(body)
+
+	case *BinXAPrepareEvent:
+		query := "XA PREPARE " + body.XID()
+		if body.OnePhase {
+			query = "XA COMMIT " + body.XID() + " ONE PHASE"
+		}
+		f.w.WriteString("XA PREPARE\n" + query + "\n" + textDelimiter + "\n")
+
+	case *BinRowsQueryEvent:
+		f.w.WriteString("Rows_query\n")
+		for _, line := range strings.Split(body.Query, "\n") {
+			f.w.WriteString("# " + line + "\n")
+		}
+
+	case *BinTableMapEvent:
+		fmt.Fprintf(f.w, "Table_map: %s.%s mapped to number %d\n",
+			quoteIdentifier(body.Schema), quoteIdentifier(body.Table), body.TableID)
+		f.base64.WriteString(textBase64(event.raw()))
+
+	case *BinRowsEvent:
+		f.formatRows(event, body)
+
+	case *BinPreGTIDsEvent:
+		f.w.WriteString("Previous-GTIDs\n")
+		f.w.WriteString(textGTIDSet(body.GTIDs))
+
+	default:
+		f.w.WriteString(h.Type() + "\n")
+	}
+
+	return nil
+}
+
+// Close write the end of output and flush
+func (f *TextFormatter) Close() error {
+	if f.pendingRows {
+		f.flushRows()
+	}
+	if f.started {
+		f.w.WriteString("SET @@SESSION.GTID_NEXT= 'AUTOMATIC' /* added by mysqlbinlog */ " + textDelimiter + "\n")
+		f.w.WriteString("DELIMITER ;\n# End of log file\n")
+		f.w.WriteString("/*!50003 SET COMPLETION_TYPE=@OLD_COMPLETION_TYPE*/;\n")
+		f.w.WriteString("/*!50530 SET @@SESSION.PSEUDO_SLAVE_MODE=0*/;\n")
+	}
+	return f.w.Flush()
+}
+
+// timestamp format time as yymmdd hh:mm:ss
+func (f *TextFormatter) timestamp(sec int64) string {
+	location := f.Location
+	if location == nil {
+		location = time.Local
+	}
+	t := time.Unix(sec, 0).In(location)
+	return fmt.Sprintf("%02d%02d%02d %2d:%02d:%02d", t.Year()%100, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+}
+
+// microTimestamp format microseconds since epoch with time zone
+func (f *TextFormatter) microTimestamp(usec int64) string {
+	location := f.Location
+	if location == nil {
+		location = time.Local
+	}
+	return time.Unix(usec/1000000, usec%1000000*1000).In(location).Format("2006-01-02 15:04:05.000000 MST")
+}
+
+// formatGTID write GTID_EVENT and ANONYMOUS_GTID_EVENT
+func (f *TextFormatter) formatGTID(body *BinGTIDEvent) {
+	rbrOnly := "no"
+	if body.CommitFlag&0x01 == 0 {
+		rbrOnly = "yes"
+	}
+
+	name, next := "GTID", body.GTID()
+	if body.IsAnonymous() {
+		name, next = "Anonymous_GTID", "ANONYMOUS"
+	}
+
+	fmt.Fprintf(f.w, "%s\tlast_committed=%d\tsequence_number=%d\trbr_only=%s", name, body.LastCommitted, body.SequenceNumber, rbrOnly)
+	if body.ImmediateCommitTimestamp != 0 {
+		fmt.Fprintf(f.w, "\toriginal_committed_timestamp=%d\timmediate_commit_timestamp=%d\ttransaction_length=%d",
+			body.OriginalCommitTimestamp, body.ImmediateCommitTimestamp, body.TransactionLength)
+	}
+	f.w.WriteByte('\n')
+
+	if rbrOnly == "yes" {
+		f.w.WriteString("/*!50718 SET TRANSACTION ISOLATION LEVEL READ COMMITTED*/" + textDelimiter + "\n")
+	}
+	if body.ImmediateCommitTimestamp != 0 {
+		fmt.Fprintf(f.w, "# original_commit_timestamp=%d (%s)\n", body.OriginalCommitTimestamp, f.microTimestamp(body.OriginalCommitTimestamp))
+		fmt.Fprintf(f.w, "# immediate_commit_timestamp=%d (%s)\n", body.ImmediateCommitTimestamp, f.microTimestamp(body.ImmediateCommitTimestamp))
+		fmt.Fprintf(f.w, "/*!80001 SET @@session.original_commit_timestamp=%d*/%s\n", body.OriginalCommitTimestamp, textDelimiter)
+	}
+	if body.ImmediateServerVersion != 0 {
+		fmt.Fprintf(f.w, "/*!80014 SET @@session.original_server_version=%d*/%s\n", body.OriginalServerVersion, textDelimiter)
+		fmt.Fprintf(f.w, "/*!80014 SET @@session.immediate_server_version=%d*/%s\n", body.ImmediateServerVersion, textDelimiter)
+	}
+	fmt.Fprintf(f.w, "SET @@SESSION.GTID_NEXT= '%s'%s\n", next, textDelimiter)
+}
+
+// formatRows write ROWS_EVENT, BINLOG and pseudo-SQL are written at the end of statement
+func (f *TextFormatter) formatRows(event *BinEvent, body *BinRowsEvent) {
+	name := map[string]string{RowsActionInsert: "Write_rows", RowsActionUpdate: "Update_rows", RowsActionDelete: "Delete_rows"}[body.Action()]
+	switch body.Version {
+	case 0:
+		name += "_obsolete"
+	case 1:
+		name += "_v1"
+	}
+
+	fmt.Fprintf(f.w, "%s: table id %d", name, body.TableID)
+	if body.Flags&RowsEventStmtEndF != 0 {
+		f.w.WriteString(" flags: STMT_END_F")
+	}
+	f.w.WriteByte('\n')
+
+	// masked rows events have no raw data, BINLOG of the statement is omitted
+	if event.data == nil {
+		f.masked = true
+	}
+	f.base64.WriteString(textBase64(event.raw()))
+	if f.Verbose > 0 && body.Table != nil {
+		f.verboseRows(body)
+	}
+
+	f.pendingRows = true
+	if body.Flags&RowsEventStmtEndF != 0 {
+		f.flushRows()
+	}
+}
+
+// flushRows write BINLOG and pseudo-SQL of the rows events of current statement
+func (f *TextFormatter) flushRows() {
+	if !f.DecodeRows && !f.masked {
+		f.w.WriteString("\nBINLOG '\n" + f.base64.String() + "'" + textDelimiter + "\n")
+	}
+	f.w.WriteString(f.rows.String())
+	f.base64.Reset()
+	f.rows.Reset()
+	f.pendingRows, f.masked = false, false
+}
+
+// verboseRows write the pseudo-SQL of rows as mysqlbinlog -v
+func (f *TextFormatter) verboseRows(body *BinRowsEvent) {
+	table := quoteIdentifier(body.Table.Schema) + "." + quoteIdentifier(body.Table.Table)
+	for _, row := range body.Rows {
+		switch body.Action() {
+		case RowsActionInsert:
+			f.rows.WriteString("### INSERT INTO " + table + "\n### SET\n")
+			f.verboseImage(body, row.After, true)
+		case RowsActionDelete:
+			f.rows.WriteString("### DELETE FROM " + table + "\n### WHERE\n")
+			f.verboseImage(body, row.Before, false)
+		case RowsActionUpdate:
+			f.rows.WriteString("### UPDATE " + table + "\n### WHERE\n")
+			f.verboseImage(body, row.Before, false)
+			f.rows.WriteString("### SET\n")
+			f.verboseImage(body, row.After, true)
+		}
+	}
+}
+
+// verboseImage write the present columns of row image as '###   @1=value'
+func (f *TextFormatter) verboseImage(body *BinRowsEvent, image []interface{}, isAfter bool) {
+	table := body.Table
+	for i, v := range image {
+		if !body.IsPresent(i, isAfter) {
+			continue
+		}
+
+		fmt.Fprintf(&f.rows, "###   @%d=%s", i+1, textValue(table, i, v))
+		if f.Verbose > 1 {
+			isNull := 0
+			if v == nil {
+				isNull = 1
+			}
+			nullable := 0
+			if table.IsNullable(i) {
+				nullable = 1
+			}
+			fmt.Fprintf(&f.rows, " /* %s meta=%d nullable=%d is_null=%d */", textType(table, i), table.ColumnMetaDef[i], nullable, isNull)
+		}
+		f.rows.WriteByte('\n')
+	}
+}
+
+// textValue format column value as mysqlbinlog does
+func textValue(table *BinTableMapEvent, i int, v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+
+	typ := table.RealType(i)
+	meta := table.ColumnMetaDef[i]
+	switch typ {
+	case MySQLTypeTiny, MySQLTypeShort, MySQLTypeInt24, MySQLTypeLong, MySQLTypeLonglong:
+		// signed value, and unsigned value if it's negative
+		bits := map[byte]uint{MySQLTypeTiny: 8, MySQLTypeShort: 16, MySQLTypeInt24: 24, MySQLTypeLong: 32, MySQLTypeLonglong: 64}[typ]
+		var u uint64
+		switch n := v.(type) {
+		case int64:
+			u = uint64(n)
+		case uint64:
+			u = n
+		}
+		if bits < 64 {
+			u &= 1<<bits - 1
+		}
+		s := int64(u<<(64-bits)) >> (64 - bits)
+		if s < 0 {
+			return fmt.Sprintf("%d (%d)", s, u)
+		}
+		return fmt.Sprintf("%d", s)
+
+	case MySQLTypeFloat:
+		return fmt.Sprintf("%-20.6g", v)
+
+	case MySQLTypeDouble:
+		return fmt.Sprintf("%.20g", v)
+
+	case MySQLTypeNewDecimal, MySQLTypeYear:
+		return fmt.Sprintf("%v", v)
+
+	case MySQLTypeTimestamp, MySQLTypeTimestamp2:
+		// seconds since epoch
+		s := v.(string)
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", s[:19], time.UTC)
+		if err != nil {
+			return quoteText(s)
+		}
+		return fmt.Sprintf("%d%s", t.Unix(), s[19:])
+
+	case MySQLTypeDate, MySQLTypeNewDate:
+		return "'" + strings.Replace(v.(string), "-", ":", -1) + "'"
+
+	case MySQLTypeEnum:
+		return fmt.Sprintf("%d", v)
+
+	case MySQLTypeSet:
+		// bits of little endian bytes
+		var buf strings.Builder
+		buf.WriteString("b'")
+		for j := 0; j < int(meta&0xff); j++ {
+			fmt.Fprintf(&buf, "%08b", byte(v.(uint64)>>(8*uint(j))))
+		}
+		return buf.String() + "'"
+
+	case MySQLTypeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		return fmt.Sprintf("b'%0*b'", nbits, v)
+	}
+
+	switch value := v.(type) {
+	case string:
+		return quoteText(value)
+	case []byte:
+		return quoteText(string(value))
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// quoteText quote string as mysqlbinlog, control characters, quote and backslash are written as \xNN
+func quoteText(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c > 0x1f && c != '\'' && c != '\\' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "\\x%02x", c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// textType return the column type written in -vv comments
+func textType(table *BinTableMapEvent, i int) string {
+	meta := table.ColumnMetaDef[i]
+	switch typ := table.RealType(i); typ {
+	case MySQLTypeTiny:
+		return "TINYINT"
+	case MySQLTypeShort:
+		return "SHORTINT"
+	case MySQLTypeInt24:
+		return "MEDIUMINT"
+	case MySQLTypeLong:
+		return "INT"
+	case MySQLTypeLonglong:
+		return "LONGINT"
+	case MySQLTypeFloat:
+		return "FLOAT"
+	case MySQLTypeDouble:
+		return "DOUBLE"
+	case MySQLTypeNewDecimal:
+		return fmt.Sprintf("DECIMAL(%d,%d)", meta>>8, meta&0xff)
+	case MySQLTypeTimestamp:
+		return "TIMESTAMP"
+	case MySQLTypeTimestamp2:
+		return fmt.Sprintf("TIMESTAMP(%d)", meta)
+	case MySQLTypeDatetime:
+		return "DATETIME"
+	case MySQLTypeDatetime2:
+		return fmt.Sprintf("DATETIME(%d)", meta)
+	case MySQLTypeTime:
+		return "TIME"
+	case MySQLTypeTime2:
+		return fmt.Sprintf("TIME(%d)", meta)
+	case MySQLTypeDate, MySQLTypeNewDate:
+		return "DATE"
+	case MySQLTypeYear:
+		return "YEAR"
+	case MySQLTypeEnum:
+		if meta&0xff == 1 {
+			return "ENUM(1 byte)"
+		}
+		return fmt.Sprintf("ENUM(%d bytes)", meta&0xff)
+	case MySQLTypeSet:
+		return fmt.Sprintf("SET(%d bytes)", meta&0xff)
+	case MySQLTypeBit:
+		return fmt.Sprintf("BIT(%d)", int(meta>>8)*8+int(meta&0xff))
+	case MySQLTypeVarchar, MySQLTypeVarString:
+		return fmt.Sprintf("VARSTRING(%d)", meta)
+	case MySQLTypeString:
+		length := int(meta & 0xff)
+		if meta >= 256 && byte(meta>>8)&0x30 != 0x30 {
+			length |= int((byte(meta>>8)&0x30)^0x30) << 4
+		}
+		return fmt.Sprintf("STRING(%d)", length)
+	case MySQLTypeBlob:
+		return map[uint16]string{1: "TINYBLOB/TINYTEXT", 2: "BLOB/TEXT", 3: "MEDIUMBLOB/MEDIUMTEXT", 4: "LONGBLOB/LONGTEXT"}[meta]
+	case MySQLTypeJSON:
+		return "JSON"
+	case MySQLTypeGeometry:
+		return "GEOMETRY"
+	default:
+		return fmt.Sprintf("TYPE(%d)", typ)
+	}
+}
+
+// textBase64 encode event as mysqlbinlog, 76 characters per line
+func textBase64(data []byte) string {
+	s := base64.StdEncoding.EncodeToString(data)
+	var buf strings.Builder
+	for len(s) > 76 {
+		buf.WriteString(s[:76] + "\n")
+		s = s[76:]
+	}
+	buf.WriteString(s + "\n")
+	return buf.String()
+}
+
+// textGTIDSet format the GTID set of PREVIOUS_GTIDS_LOG_EVENT, one server uuid per line
+func textGTIDSet(set GTIDSet) string {
+	if len(set) == 0 {
+		return "# [empty]\n"
+	}
+	return "# " + strings.Replace(set.String(), ",", ",\n# ", -1) + "\n"
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"strings"
+)
+
+// Transaction is a group of binary log events committed together.
+// A transaction starts with GTID_EVENT or QUERY_EVENT(BEGIN / XA START) and ends with
+// XID_EVENT, QUERY_EVENT(COMMIT / ROLLBACK), XA_PREPARE_LOG_EVENT or an implicit commit statement.
+type Transaction struct {
+	// GTID is 'uuid:gno', empty if gtid_mode is off
+	GTID      string
+	GTIDEvent *BinGTIDEvent
+
+	// positions, [StartPos, EndPos)
+	StartPos int64
+	EndPos   int64
+
+	// timestamps of the first event and the commit event
+	StartTime  int64
+	CommitTime int64
+
+	// XID of XID_EVENT, 0 if the transaction is not committed by XID_EVENT
+	XID uint64
+
+	// XA transaction, XAPrepare is set if it ends with XA PREPARE or XA COMMIT ... ONE PHASE
+	IsXA      bool
+	XAID      string
+	XAPrepare *BinXAPrepareEvent
+
+	// statements (not including BEGIN/COMMIT) and row changes
+	Statements []*BinQueryEvent
+	Rows       []*BinRowsEvent
+
+	// IsDDL is true if the transaction is committed implicitly by a statement, such as DDL
+	IsDDL bool
+
+	// all events of the transaction in order
+	Events []*BinEvent
+}
+
+// Size return the bytes of the transaction in binary log
+func (tx *Transaction) Size() int64 {
+	return tx.EndPos - tx.StartPos
+}
+
+// query kinds which are used to split transactions
+const (
+	queryStatement = iota
+	queryBegin
+	queryCommit
+	queryRollback
+	queryXAStart
+	queryXAEnd
+	queryXACommit
+	queryXARollback
+)
+
+// queryKind return the kind of query which is used for transaction grouping
+func queryKind(query string) int {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	switch {
+	case q == "BEGIN", q == "START TRANSACTION":
+		return queryBegin
+	case q == "COMMIT":
+		return queryCommit
+	case q == "ROLLBACK":
+		return queryRollback
+	case strings.HasPrefix(q, "XA START"), strings.HasPrefix(q, "XA BEGIN"):
+		return queryXAStart
+	case strings.HasPrefix(q, "XA END"):
+		return queryXAEnd
+	case strings.HasPrefix(q, "XA COMMIT"):
+		return queryXACommit
+	case strings.HasPrefix(q, "XA ROLLBACK"):
+		return queryXARollback
+	}
+	return queryStatement
+}
+
+// xaQueryID return the xid part of 'XA START xid' or 'XA COMMIT xid ...'
+func xaQueryID(query string) string {
+	fields := strings.Fields(strings.TrimSpace(query))
+	if len(fields) < 3 {
+		return ""
+	}
+	xid := strings.Join(fields[2:], " ")
+	for _, suffix := range []string{" ONE PHASE", " JOIN", " RESUME", " SUSPEND FOR MIGRATE", " SUSPEND"} {
+		if strings.HasSuffix(strings.ToUpper(xid), suffix) {
+			xid = xid[:len(xid)-len(suffix)]
+		}
+	}
+	return xid
+}
+
+// transactionGrouper receives events in order and groups them into transactions
+type transactionGrouper struct {
+	tx *Transaction
+
+	// begun is true after BEGIN or XA START, the following statements are inside the transaction
+	begun bool
+}
+
+// push one event, return the transaction if it's finished by this event
+func (g *transactionGrouper) push(event *BinEvent) *Transaction {
+	switch body := event.Body.(type) {
+	case *BinGTIDEvent:
+		// a new transaction, an unfinished one before is dropped
+		g.start(event)
+		g.tx.GTIDEvent = body
+		g.tx.GTID = body.GTID()
+		return nil
+
+	case *BinQueryEvent:
+		kind := queryKind(body.Query)
+		switch kind {
+		case queryBegin, queryXAStart:
+			if g.tx == nil || g.begun {
+				g.start(event)
+			}
+			g.add(event)
+			g.begun = true
+			if kind == queryXAStart {
+				g.tx.IsXA = true
+				g.tx.XAID = xaQueryID(body.Query)
+			}
+			return nil
+
+		case queryXAEnd:
+			if g.tx == nil {
+				return nil
+			}
+			g.add(event)
+			return nil
+
+		case queryCommit, queryRollback:
+			if g.tx == nil {
+				return nil
+			}
+			g.add(event)
+			return g.finish(event)
+
+		case queryXACommit, queryXARollback:
+			// the second phase of XA is a single statement transaction
+			if g.tx == nil || g.begun {
+				g.start(event)
+			}
+			g.add(event)
+			g.tx.IsXA = true
+			g.tx.XAID = xaQueryID(body.Query)
+			g.tx.Statements = append(g.tx.Statements, body)
+			return g.finish(event)
+		}
+
+		if g.tx == nil {
+			g.start(event)
+		}
+		g.add(event)
+		g.tx.Statements = append(g.tx.Statements, body)
+		if g.begun {
+			return nil
+		}
+
+		// statement without BEGIN commits implicitly, such as DDL
+		g.tx.IsDDL = true
+		return g.finish(event)
+
+	case *BinXIDEvent:
+		if g.tx == nil {
+			return nil
+		}
+		g.add(event)
+		g.tx.XID = body.XID
+		return g.finish(event)
+
+	case *BinXAPrepareEvent:
+		if g.tx == nil {
+			return nil
+		}
+		g.add(event)
+		g.tx.IsXA = true
+		g.tx.XAPrepare = body
+		g.tx.XAID = body.XID()
+		return g.finish(event)
+
+	case *BinRowsEvent:
+		if g.tx == nil {
+			return nil
+		}
+		g.add(event)
+		g.tx.Rows = append(g.tx.Rows, body)
+		return nil
+	}
+
+	// events which are not a part of transaction
+	switch event.Header.EventType {
+	case TableMapEvent, IntvarEvent, RandEvent, UserVarEvent, RowsQueryEvent:
+		if g.tx != nil {
+			g.add(event)
+		}
+	}
+	return nil
+}
+
+// start a new transaction with the event
+func (g *transactionGrouper) start(event *BinEvent) {
+	g.tx = &Transaction{
+		StartPos:  event.Header.LogPos - event.Header.EventSize,
+		StartTime: event.Header.Timestamp,
+	}
+	g.begun = false
+	g.tx.Events = append(g.tx.Events, event)
+}
+
+// add event into current transaction
+func (g *transactionGrouper) add(event *BinEvent) {
+	if len(g.tx.Events) > 0 && g.tx.Events[len(g.tx.Events)-1] == event {
+		return
+	}
+	g.tx.Events = append(g.tx.Events, event)
+}
+
+// finish current transaction with the commit event
+func (g *transactionGrouper) finish(event *BinEvent) *Transaction {
+	tx := g.tx
+	tx.EndPos = event.Header.LogPos
+	tx.CommitTime = event.Header.Timestamp
+	g.tx = nil
+	g.begun = false
+	return tx
+}
+
+// WalkTransaction will walk all transactions for binary log, events are grouped by transaction.
+// Events out of transaction such as FORMAT_DESCRIPTION_EVENT and ROTATE_EVENT are ignored,
+// and the unfinished transaction at the end of binary log is dropped.
+func (decoder *BinFileDecoder) WalkTransaction(f func(tx *Transaction) (isContinue bool, err error)) error {
+	grouper := &transactionGrouper{}
+	return decoder.WalkEvent(func(event *BinEvent) (isContinue bool, err error) {
+		if tx := grouper.push(event); tx != nil {
+			return f(tx)
+		}
+		return true, nil
+	})
+}
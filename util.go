@@ -17,11 +17,30 @@ limitations under the License.
 package binlog
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 )
 
-// ReadNBytes read n bytes from io.Reader
+// maxPreallocSize is the max size allocated before reading, larger data is read into a growing buffer,
+// so a corrupted event size doesn't allocate gigabytes
+const maxPreallocSize = 1 << 20
+
+// ReadNBytes read n bytes from io.Reader, the bytes read are returned with error if less than n
 func ReadNBytes(rd io.Reader, size int64) ([]byte, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d to read", size)
+	}
+
+	if size > maxPreallocSize {
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, rd, size)
+		if n == 0 && err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), err
+	}
+
 	data := make([]byte, size)
 	n, err := rd.Read(data)
 	total := n
@@ -30,11 +49,11 @@ func ReadNBytes(rd io.Reader, size int64) ([]byte, error) {
 		total += n
 	}
 
-	if n == 0 && err != nil {
+	if total == 0 && err != nil {
 		return nil, err
 	}
 
-	return data, err
+	return data[:total], err
 }
 
 // FixedLengthInt will turn byte to uint64
@@ -49,7 +68,15 @@ func FixedLengthInt(buf []byte) uint64 {
 
 // LengthEncodedInt will decode byte to uint64
 // this function is from 'github.com/siddontang/go-mysql/replication/util.go'
+// If b is truncated, n is the size needed which is larger than len(b), and num is 0.
 func LengthEncodedInt(b []byte) (num uint64, isNull bool, n int) {
+	if len(b) == 0 {
+		return 0, false, 1
+	}
+	if size := lengthEncodedIntPrefixSize(b[0]); len(b) < size {
+		return 0, false, size
+	}
+
 	switch b[0] {
 	case 0xfb:
 		// 251: NULL
@@ -81,19 +108,59 @@ func LengthEncodedInt(b []byte) (num uint64, isNull bool, n int) {
 	return
 }
 
+// lengthEncodedIntPrefixSize return the size of length encoded integer by its first byte
+func lengthEncodedIntPrefixSize(b byte) int {
+	switch b {
+	case 0xfc:
+		return 3
+	case 0xfd:
+		return 4
+	case 0xfe:
+		return 9
+	}
+	return 1
+}
+
 // LengthEnodedString will decode bytes
 func LengthEnodedString(b []byte) ([]byte, bool, int, error) {
 	// Get length
 	num, isNull, n := LengthEncodedInt(b)
+	if n > len(b) {
+		return nil, false, n, io.EOF
+	}
 	if num < 1 {
 		return nil, isNull, n, nil
 	}
 
-	n += int(num)
-
 	// Check data length
-	if len(b) >= n {
-		return b[n-int(num) : n], false, n, nil
+	if num > uint64(len(b)-n) {
+		return nil, false, n, io.EOF
+	}
+	return b[n : n+int(num)], false, n + int(num), nil
+}
+
+// appendFixedLengthInt append the n bytes little endian integer
+func appendFixedLengthInt(data []byte, num uint64, n int) []byte {
+	for i := 0; i < n; i++ {
+		data = append(data, byte(num>>(uint(i)*8)))
+	}
+	return data
+}
+
+// appendLengthEncodedInt append the length encoded integer
+func appendLengthEncodedInt(data []byte, num uint64) []byte {
+	switch {
+	case num < 251:
+		return append(data, byte(num))
+	case num < 1<<16:
+		return appendFixedLengthInt(append(data, 0xfc), num, 2)
+	case num < 1<<24:
+		return appendFixedLengthInt(append(data, 0xfd), num, 3)
 	}
-	return nil, false, n, io.EOF
+	return appendFixedLengthInt(append(data, 0xfe), num, 8)
+}
+
+// appendLengthEncodedString append the length encoded string
+func appendLengthEncodedString(data []byte, s string) []byte {
+	return append(appendLengthEncodedInt(data, uint64(len(s))), s...)
 }
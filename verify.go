@@ -0,0 +1,369 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VerifyReport is the integrity report of a binary log returned by Verify
+type VerifyReport struct {
+	File string `json:"file"`
+	Size int64  `json:"size"`
+
+	ServerVersion string `json:"server_version"`
+	Checksum      string `json:"checksum"`
+
+	// InUse is true if LOG_EVENT_BINLOG_IN_USE_F is set, the binary log is being written or not closed properly
+	InUse bool `json:"in_use"`
+
+	Events       int64 `json:"events"`
+	Transactions int64 `json:"transactions"`
+
+	// bytes skipped after corrupted events
+	SkippedBytes int64 `json:"skipped_bytes"`
+
+	// LastEvent is the type of the last event, ROTATE_EVENT or STOP_EVENT if the binary log is closed
+	LastEvent string `json:"last_event"`
+
+	// GTIDs of PREVIOUS_GTIDS_EVENT and of the transactions in binary log
+	PreviousGTIDs string `json:"previous_gtids"`
+	GTIDs         string `json:"gtids"`
+
+	Issues []*VerifyIssue `json:"issues"`
+
+	// Warnings are not integrity problems, such as the end of a binary log being written or not closed by server
+	Warnings []*VerifyIssue `json:"warnings"`
+}
+
+// VerifyIssue is an integrity problem found by Verify
+type VerifyIssue struct {
+	// start offset of the event
+	Offset int64  `json:"offset"`
+	Event  string `json:"event,omitempty"`
+
+	Problem string `json:"problem"`
+}
+
+func (issue *VerifyIssue) String() string {
+	if issue.Event == "" {
+		return fmt.Sprintf("%d: %s", issue.Offset, issue.Problem)
+	}
+	return fmt.Sprintf("%d (%s): %s", issue.Offset, issue.Event, issue.Problem)
+}
+
+// OK return true if no issue is found, warnings are ignored
+func (report *VerifyReport) OK() bool {
+	return len(report.Issues) == 0
+}
+
+// verifier checks the events of binary log in order
+type verifier struct {
+	decoder *BinFileDecoder
+	report  *VerifyReport
+
+	previousGTIDs GTIDSet
+	gtids         GTIDSet
+
+	// start offset of the unterminated transaction, -1 if it's out of transaction
+	txStart int64
+
+	// begun is true after BEGIN or XA START
+	begun bool
+}
+
+// Verify check the integrity of binary log without decoding row changes: the magic header, event sizes,
+// checksums, log_pos against the offsets of events, FORMAT_DESCRIPTION_EVENT at first, GTIDs continuing
+// PREVIOUS_GTIDS_EVENT and unterminated transactions.
+// The verification continues from the next plausible event after a corrupted one as the recovery mode.
+// Problems are reported as issues, the error is returned only if the binary log can't be read.
+// A binary log without ROTATE_EVENT or STOP_EVENT at the end is reported as a warning, as the binary log
+// being written by server and the ones written by BinFileWriter don't have them.
+// Only KeyProvider of options is used, for binary logs encrypted by binlog_encryption.
+func Verify(path string, options ...*BinReaderOption) (*VerifyReport, error) {
+	report := &VerifyReport{File: path}
+	var option *BinReaderOption
+	if len(options) > 0 && options[0] != nil {
+		option = &BinReaderOption{KeyProvider: options[0].KeyProvider}
+	}
+	decoder, err := NewBinFileDecoder(path, option)
+	if decoder.BinFile != nil {
+		defer decoder.BinFile.Close()
+	}
+	if err != nil {
+		var invalid *ErrInvalidHeader
+		if !errors.As(err, &invalid) {
+			return nil, err
+		}
+		report.issue(0, UnknownEvent, "%s", invalid.Reason)
+		return report, nil
+	}
+
+	info, err := decoder.BinFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	report.Size = info.Size()
+
+	v := &verifier{decoder: decoder, report: report, previousGTIDs: GTIDSet{}, gtids: GTIDSet{}, txStart: -1}
+	if err := v.run(); err != nil {
+		return nil, err
+	}
+	v.finish()
+	return report, nil
+}
+
+// issue add an issue of the event at offset
+func (report *VerifyReport) issue(offset int64, eventType uint8, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, newVerifyIssue(offset, eventType, format, args...))
+}
+
+// warn add a warning of the event at offset
+func (report *VerifyReport) warn(offset int64, eventType uint8, format string, args ...interface{}) {
+	report.Warnings = append(report.Warnings, newVerifyIssue(offset, eventType, format, args...))
+}
+
+// newVerifyIssue return a VerifyIssue of the event at offset
+func newVerifyIssue(offset int64, eventType uint8, format string, args ...interface{}) *VerifyIssue {
+	issue := &VerifyIssue{Offset: offset, Problem: fmt.Sprintf(format, args...)}
+	if eventType != UnknownEvent {
+		issue.Event = EventType2Str[eventType]
+	}
+	return issue
+}
+
+// run read all events, checksums are validated but only the events of transaction boundaries are decoded
+func (v *verifier) run() error {
+	decoder := v.decoder
+	for {
+		start := decoder.offset
+		headerLength := int64(defaultEventHeaderSize)
+		if decoder.description != nil {
+			headerLength = decoder.description.EventHeaderLength
+		}
+
+		headerData, err := ReadNBytes(decoder.buf, headerLength)
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			if len(headerData) > 0 {
+				v.report.issue(start, UnknownEvent, "truncated event header, %d bytes of %d", len(headerData), headerLength)
+			}
+			return nil
+		}
+
+		header, err := decodeEventHeader(headerData, headerLength)
+		if err != nil {
+			return err
+		}
+		if _, ok := EventType2Str[header.EventType]; !ok || header.EventType == UnknownEvent {
+			if ok, err := v.corrupted(start, UnknownEvent, fmt.Sprintf("unknown event type %#x", header.EventType)); !ok {
+				return err
+			}
+			continue
+		}
+		if header.EventSize < headerLength {
+			if ok, err := v.corrupted(start, header.EventType, fmt.Sprintf("event size %d less than header length %d",
+				header.EventSize, headerLength)); !ok {
+				return err
+			}
+			continue
+		}
+
+		body, err := ReadNBytes(decoder.buf, header.EventSize-headerLength)
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			v.report.issue(start, header.EventType, "truncated event, %d bytes of %d", headerLength+int64(len(body)), header.EventSize)
+			return nil
+		}
+		decoder.offset += header.EventSize
+
+		event := &BinEvent{Header: header}
+		if body, err = event.Validation(decoder.BinaryLogInfo, headerData, body); err != nil {
+			problem := err.Error()
+			var mismatch *ErrChecksumMismatch
+			if errors.As(err, &mismatch) {
+				problem = fmt.Sprintf("checksum mismatch, expected %08x, actual %08x", mismatch.Expected, mismatch.Actual)
+			}
+			if ok, err := v.corrupted(start, header.EventType, problem); !ok {
+				return err
+			}
+			continue
+		}
+		v.check(start, event, body)
+	}
+}
+
+// corrupted report the corrupted event at start, the decoder is moved to the next plausible event.
+// It return false if the verification can't continue, encrypted binary logs are not resynchronized.
+func (v *verifier) corrupted(start int64, eventType uint8, problem string) (bool, error) {
+	if v.decoder.encrypted {
+		v.report.issue(start, eventType, "%s, the rest of encrypted binary log is not verified", problem)
+		return false, nil
+	}
+
+	if err := v.decoder.resync(start, nil); err != nil {
+		return false, err
+	}
+	skipped := v.decoder.offset - start
+	v.report.SkippedBytes += skipped
+	v.report.issue(start, eventType, "%s, %d bytes skipped", problem, skipped)
+	return true, nil
+}
+
+// check the event of binary log
+func (v *verifier) check(start int64, event *BinEvent, body []byte) {
+	header, report := event.Header, v.report
+	report.Events++
+	if report.Events == 1 && header.EventType != FormatDescriptionEvent {
+		report.issue(start, header.EventType, "the first event is not FORMAT_DESCRIPTION_EVENT")
+	}
+	if end := start + header.EventSize; header.LogPos != end {
+		report.issue(start, header.EventType, "log_pos %d is not the end of event %d", header.LogPos, end)
+	}
+	report.LastEvent = header.Type()
+
+	switch header.EventType {
+	case FormatDescriptionEvent:
+		description, err := decodeFmtDescEvent(body)
+		if err != nil {
+			report.issue(start, header.EventType, "%v", err)
+			return
+		}
+		v.decoder.description = description
+		report.ServerVersion, report.Checksum = description.MySQLVersion, "NONE"
+		if description.ChecksumAlg == BinlogChecksumAlgCRC32 {
+			report.Checksum = "CRC32"
+		}
+		report.InUse = header.Flag&LogEventBinlogInUseF != 0
+
+	case PreviousGTIDEvent:
+		previous, err := decodePreGTIDsEvent(body)
+		if err != nil {
+			report.issue(start, header.EventType, "%v", err)
+			return
+		}
+		v.previousGTIDs = previous.GTIDs
+
+	case GTIDEvent, AnonymousGTIDEvent:
+		gtid, err := decodeGTIDEvent(body)
+		if err != nil {
+			report.issue(start, header.EventType, "%v", err)
+			return
+		}
+		v.unterminated()
+		v.txStart = start
+		if !gtid.IsAnonymous() {
+			v.checkGTID(start, header.EventType, gtid)
+		}
+
+	case QueryEvent:
+		if v.decoder.description == nil {
+			return
+		}
+		query, err := decodeQueryEvent(body, v.decoder.description.BinlogVersion)
+		if err != nil {
+			report.issue(start, header.EventType, "%v", err)
+			return
+		}
+
+		switch queryKind(query.Query) {
+		case queryBegin, queryXAStart:
+			if v.begun {
+				v.unterminated()
+			}
+			if v.txStart < 0 {
+				v.txStart = start
+			}
+			v.begun = true
+		case queryCommit, queryRollback, queryXACommit, queryXARollback:
+			v.terminate()
+		case queryStatement:
+			// statement without BEGIN commits implicitly, such as DDL
+			if !v.begun {
+				v.terminate()
+			}
+		}
+
+	case XIDEvent, XAPrepareLogEvent:
+		v.terminate()
+
+	case RotateEvent, StopEvent:
+		v.unterminated()
+	}
+}
+
+// checkGTID check the GTID is not executed before, a gap of transaction numbers of its server uuid is a warning
+func (v *verifier) checkGTID(start int64, eventType uint8, gtid *BinGTIDEvent) {
+	uuid := gtid.UUID()
+	if v.previousGTIDs.Contains(uuid, gtid.GNO) || v.gtids.Contains(uuid, gtid.GNO) {
+		v.report.issue(start, eventType, "GTID %s is executed before", gtid.GTID())
+		return
+	}
+
+	var last int64
+	for _, set := range []GTIDSet{v.previousGTIDs, v.gtids} {
+		for _, interval := range set[uuid] {
+			if interval.End > last {
+				last = interval.End
+			}
+		}
+	}
+	if last > 0 && gtid.GNO != last+1 {
+		// gaps may be left by GTIDs assigned with gtid_next, they are not corruption
+		v.report.warn(start, eventType, "GTID %s doesn't continue %s:%d", gtid.GTID(), uuid, last)
+	}
+	v.gtids.Add(uuid, gtid.GNO)
+}
+
+// terminate current transaction
+func (v *verifier) terminate() {
+	v.report.Transactions++
+	v.txStart, v.begun = -1, false
+}
+
+// unterminated report the transaction not terminated before a new transaction or the end of binary log
+func (v *verifier) unterminated() {
+	if v.txStart >= 0 {
+		v.report.issue(v.txStart, UnknownEvent, "transaction is not terminated")
+	}
+	v.txStart, v.begun = -1, false
+}
+
+// finish check the end of binary log
+func (v *verifier) finish() {
+	report := v.report
+	v.unterminated()
+	report.PreviousGTIDs, report.GTIDs = v.previousGTIDs.String(), v.gtids.String()
+
+	if report.Events == 0 {
+		report.issue(v.decoder.offset, UnknownEvent, "no event in binary log")
+		return
+	}
+	if report.LastEvent != EventType2Str[RotateEvent] && report.LastEvent != EventType2Str[StopEvent] {
+		problem := "binary log doesn't end with ROTATE_EVENT or STOP_EVENT"
+		if report.InUse {
+			problem += ", it's in use or not closed properly"
+		}
+		report.warn(v.decoder.offset, UnknownEvent, "%s", problem)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// BinFileWriter writes events into a binary log file.
+// Event sizes, positions and checksums are computed by writer, the checksum algorithm
+// follows the FORMAT_DESCRIPTION_EVENT written before.
+type BinFileWriter struct {
+	Path string // binary log path, empty if writing into io.Writer
+
+	w    *bufio.Writer
+	file *os.File
+
+	// position of the next event
+	pos int64
+
+	checksumAlg byte
+
+	// the FORMAT_DESCRIPTION_EVENT and TABLE_MAP_EVENTs written, for encoding event bodies
+	description *BinFmtDescEvent
+	tables      map[uint64]*BinTableMapEvent
+}
+
+// NewBinFileWriter create the binary log file of path, return a BinFileWriter
+func NewBinFileWriter(path string) (*BinFileWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewBinWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	writer.Path = path
+	writer.file = file
+	return writer, nil
+}
+
+// NewBinWriter return a BinFileWriter writing into w, the binary log file header is written
+func NewBinWriter(w io.Writer) (*BinFileWriter, error) {
+	writer := &BinFileWriter{
+		w:           bufio.NewWriter(w),
+		pos:         int64(len(binFileHeader)),
+		checksumAlg: BinlogChecksumAlgOff,
+		tables:      make(map[uint64]*BinTableMapEvent),
+	}
+
+	_, err := writer.w.Write(binFileHeader)
+	return writer, err
+}
+
+// Pos return the position of the next event
+func (writer *BinFileWriter) Pos() int64 {
+	return writer.pos
+}
+
+// WriteEvent write an event, the header is kept except event size and log position.
+// The body is encoded if the event is not decoded from a binary log, such as events built by
+// NewFmtDescEvent() and &BinQueryEvent{...}, the event type is taken from the header.
+// Rows of ROWS_EVENT are encoded by the TABLE_MAP_EVENT of Table or the one written before.
+// LOG_EVENT_BINLOG_IN_USE_F of FORMAT_DESCRIPTION_EVENT is cleared, the written binary log is closed.
+// Flags of ROWS_EVENT are written from the body, so STMT_END_F can be moved when rows events are dropped.
+func (writer *BinFileWriter) WriteEvent(event *BinEvent) error {
+	if event.Header == nil {
+		return fmt.Errorf("event has no header to write")
+	}
+
+	header, data := *event.Header, event.data
+	if data == nil {
+		var err error
+		if data, err = encodeEventBody(header.EventType, event.Body, writer.description, writer.tables); err != nil {
+			return err
+		}
+	}
+
+	switch body := event.Body.(type) {
+	case *BinFmtDescEvent:
+		header.Flag &^= LogEventBinlogInUseF
+		description, err := decodeFmtDescEvent(data)
+		if err != nil {
+			return err
+		}
+		writer.description = description
+		writer.checksumAlg = description.ChecksumAlg
+
+	case *BinTableMapEvent:
+		writer.tables[body.TableID] = body
+
+	case *BinRowsEvent:
+		if event.data != nil && binary.LittleEndian.Uint16(data[body.tableIDLen:]) != body.Flags {
+			data = append([]byte{}, data...)
+			binary.LittleEndian.PutUint16(data[body.tableIDLen:], body.Flags)
+		}
+	}
+
+	return writer.write(&header, data)
+}
+
+// write an event with header and body, event size and log position are set by writer.
+// FORMAT_DESCRIPTION_EVENT of mysql >= 5.6.2 always has checksum, even if the algorithm is OFF.
+func (writer *BinFileWriter) write(header *BinEventHeader, body []byte) error {
+	withChecksum := writer.checksumAlg == BinlogChecksumAlgCRC32
+	if header.EventType == FormatDescriptionEvent {
+		withChecksum = writer.description != nil && writer.description.hasCheckSum
+	}
+
+	size := defaultEventHeaderSize + int64(len(body))
+	if withChecksum {
+		size += binlogChecksumLength
+	}
+	writer.pos += size
+
+	h := *header
+	h.EventSize, h.LogPos = size, writer.pos
+	data := append(h.encode(), body...)
+
+	if withChecksum {
+		checksum := make([]byte, binlogChecksumLength)
+		binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+		data = append(data, checksum...)
+	}
+
+	_, err := writer.w.Write(data)
+	return err
+}
+
+// Flush write the buffered events
+func (writer *BinFileWriter) Flush() error {
+	return writer.w.Flush()
+}
+
+// Close flush the buffered events and close the file created by NewBinFileWriter()
+func (writer *BinFileWriter) Close() error {
+	if err := writer.w.Flush(); err != nil {
+		return err
+	}
+
+	if writer.file != nil {
+		return writer.file.Close()
+	}
+	return nil
+}
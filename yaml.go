@@ -0,0 +1,325 @@
+/*
+Copyright 2018 liipx(lipengxiang)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of YAML document without indentation and comment
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlDecoder decodes the subset of YAML used by configuration files: block mappings and sequences,
+// flow mappings and sequences in one line, plain and quoted scalars, and comments.
+// Mappings are decoded as map[string]interface{}, sequences as []interface{}, true / false as bool,
+// null / ~ / empty as nil and other scalars as string, so the result can be converted by encoding/json.
+type yamlDecoder struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML decode a YAML document
+func decodeYAML(doc string) (interface{}, error) {
+	d := &yamlDecoder{}
+	for i, line := range strings.Split(doc, "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" || text == "..." {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		d.lines = append(d.lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(d.lines) == 0 {
+		return nil, nil
+	}
+
+	value, err := d.block(d.lines[0].indent)
+	if err == nil && d.pos < len(d.lines) {
+		err = fmt.Errorf("line %d: bad indentation", d.lines[d.pos].num)
+	}
+	return value, err
+}
+
+// stripYAMLComment remove the comment of line, '#' starts a comment at the beginning or after a space
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '\'' && c == '\'' && i+1 < len(line) && line[i+1] == '\'':
+			i++ // '' is a single quote
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			if i == 0 || strings.IndexByte(" \t:[{,-", line[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// isYAMLItem return true if the line is an item of block sequence
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block decode the block collection at indent
+func (d *yamlDecoder) block(indent int) (interface{}, error) {
+	if isYAMLItem(d.lines[d.pos].text) {
+		return d.sequence(indent)
+	}
+	return d.mapping(indent)
+}
+
+// nested decode the value of key or item in the lines after, which are more indented than indent,
+// or a sequence at the same indent as key
+func (d *yamlDecoder) nested(indent int, key bool) (interface{}, error) {
+	if d.pos >= len(d.lines) {
+		return nil, nil
+	}
+	next := d.lines[d.pos]
+	if next.indent > indent || key && next.indent == indent && isYAMLItem(next.text) {
+		return d.block(next.indent)
+	}
+	return nil, nil
+}
+
+// sequence decode the block sequence at indent
+func (d *yamlDecoder) sequence(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for d.pos < len(d.lines) && d.lines[d.pos].indent == indent && isYAMLItem(d.lines[d.pos].text) {
+		line := d.lines[d.pos]
+		text := strings.TrimLeft(line.text[1:], " ")
+		if text == "" {
+			d.pos++
+			value, err := d.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			continue
+		}
+
+		// '- key: value' starts a mapping indented after '- '
+		if _, _, ok := splitYAMLKey(text); ok {
+			d.lines[d.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(text), text: text}
+			value, err := d.mapping(d.lines[d.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			continue
+		}
+
+		value, err := yamlValue(text, line.num)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		d.pos++
+	}
+	return list, nil
+}
+
+// mapping decode the block mapping at indent
+func (d *yamlDecoder) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for d.pos < len(d.lines) && d.lines[d.pos].indent == indent && !isYAMLItem(d.lines[d.pos].text) {
+		line := d.lines[d.pos]
+		key, text, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", line.num)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		d.pos++
+
+		var value interface{}
+		var err error
+		if text == "" {
+			value, err = d.nested(indent, true)
+		} else {
+			value, err = yamlValue(text, line.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// splitYAMLKey split 'key: value' of mapping, the key may be quoted
+func splitYAMLKey(text string) (string, string, bool) {
+	var key string
+	rest := text
+	if text[0] == '\'' || text[0] == '"' {
+		value, n, err := yamlQuoted(text)
+		if err != nil {
+			return "", "", false
+		}
+		key, rest = value, text[n:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+	} else if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	} else {
+		i := strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false
+			}
+			i = len(text) - 1
+		}
+		key, rest = strings.TrimSpace(text[:i]), text[i:]
+	}
+	if rest != ":" && !strings.HasPrefix(rest, ": ") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest[1:]), true
+}
+
+// yamlValue decode the scalar or flow collection of text
+func yamlValue(text string, num int) (interface{}, error) {
+	value, rest, err := yamlFlow(text, false)
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("unexpected %q", rest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", num, err)
+	}
+	return value, nil
+}
+
+// yamlFlow decode a value at the beginning of text, return the value and text after it.
+// Plain scalars in flow collections end at ',', ']' and '}'.
+func yamlFlow(text string, inFlow bool) (interface{}, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", nil
+	}
+
+	switch text[0] {
+	case '\'', '"':
+		value, n, err := yamlQuoted(text)
+		return value, text[n:], err
+
+	case '[':
+		list := []interface{}{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, "]") {
+			value, after, err := yamlFlow(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, value)
+			if rest = strings.TrimLeft(after, " "); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("unterminated flow sequence")
+			}
+		}
+		return list, rest[1:], nil
+
+	case '{':
+		m := make(map[string]interface{})
+		rest := strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, "}") {
+			key, after, err := yamlFlow(rest, true)
+			if err != nil {
+				return nil, "", err
+			}
+			if rest = strings.TrimLeft(after, " "); !strings.HasPrefix(rest, ":") {
+				return nil, "", fmt.Errorf("expected ':' in flow mapping")
+			}
+			value, after, err := yamlFlow(rest[1:], true)
+			if err != nil {
+				return nil, "", err
+			}
+			m[fmt.Sprint(key)] = value
+			if rest = strings.TrimLeft(after, " "); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "}") {
+				return nil, "", fmt.Errorf("unterminated flow mapping")
+			}
+		}
+		return m, rest[1:], nil
+	}
+
+	end := len(text)
+	if inFlow {
+		for i := 0; i < len(text); i++ {
+			if c := text[i]; c == ',' || c == ']' || c == '}' || c == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+				end = i
+				break
+			}
+		}
+	}
+	return yamlScalar(strings.TrimSpace(text[:end])), text[end:], nil
+}
+
+// yamlScalar convert a plain scalar
+func yamlScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	return s
+}
+
+// yamlQuoted decode the quoted scalar at the beginning of text, return the value and its length in text
+func yamlQuoted(text string) (string, int, error) {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '\'' && text[i] == '\'':
+			// '' is a single quote
+			if i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+			return strings.Replace(text[1:i], "''", "'", -1), i + 1, nil
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '"' && text[i] == '"':
+			value, err := strconv.Unquote(text[:i+1])
+			return value, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted scalar")
+}